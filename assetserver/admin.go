@@ -0,0 +1,210 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// adminOnly wraps an admin API handler with X-Admin-Key authentication.
+func (s *Server) adminOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-Admin-Key")
+		client := "ip:" + s.clientIP(r)
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.config.AdminKey)) != 1 {
+			if key != "" {
+				s.authFailed(r.Context(), client, r.URL.Path)
+			}
+			writeJSON(w, http.StatusUnauthorized, Response{Message: "Unauthorized"})
+			return
+		}
+		s.authSucceeded(client)
+		h(w, r)
+	}
+}
+
+func (s *Server) registerAdminHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("GET /events", s.adminOnly(s.eventsHandler))
+	mux.HandleFunc("GET /admin/audit", s.adminOnly(s.adminAuditHandler))
+	mux.HandleFunc("GET /admin/reports", s.adminOnly(s.adminListReportsHandler))
+	mux.HandleFunc("POST /admin/reports/{id}/dismiss", s.adminOnly(s.adminDismissReportHandler))
+	mux.HandleFunc("GET /admin/search", s.adminOnly(s.adminSearchHandler))
+	mux.HandleFunc("GET /admin/usage", s.adminOnly(s.adminUsageHandler))
+	mux.HandleFunc("GET /admin/stats", s.adminOnly(s.adminStatsHandler))
+	mux.HandleFunc("GET /admin/logging", s.adminOnly(s.adminLoggingHandler))
+	mux.HandleFunc("PATCH /admin/logging", s.adminOnly(s.adminUpdateLoggingHandler))
+	mux.HandleFunc("GET /admin/maintenance", s.adminOnly(s.adminMaintenanceHandler))
+	mux.HandleFunc("PUT /admin/maintenance", s.adminOnly(s.adminSetMaintenanceHandler))
+	mux.HandleFunc("GET /admin/users", s.adminOnly(s.adminListUsersHandler))
+	mux.HandleFunc("PATCH /admin/users/{id}", s.adminOnly(s.adminUpdateUserHandler))
+	mux.HandleFunc("GET /admin/keys", s.adminOnly(s.adminListKeysHandler))
+	mux.HandleFunc("POST /admin/keys", s.adminOnly(s.adminCreateKeyHandler))
+	mux.HandleFunc("POST /admin/keys/{id}/disable", s.adminOnly(s.adminDisableKeyHandler))
+	mux.HandleFunc("POST /admin/keys/{id}/rotate", s.adminOnly(s.adminRotateKeyHandler))
+	mux.HandleFunc("GET /admin/assets/{id}", s.adminOnly(s.adminGetAssetHandler))
+	mux.HandleFunc("PATCH /admin/assets/{id}/tags", s.adminOnly(s.adminTagsHandler))
+	mux.HandleFunc("GET /admin/tags", s.adminOnly(s.adminListTagsHandler))
+	mux.HandleFunc("PUT /admin/assets/{id}/state", s.adminOnly(s.adminSetStateHandler))
+	mux.HandleFunc("POST /admin/assets/{id}/quarantine", s.adminOnly(s.adminQuarantineHandler))
+	mux.HandleFunc("DELETE /admin/assets/{id}", s.adminOnly(s.adminDeleteAssetHandler))
+	mux.HandleFunc("GET /admin/trash", s.adminOnly(s.adminTrashHandler))
+	mux.HandleFunc("POST /admin/assets/{id}/restore", s.adminOnly(s.adminRestoreHandler))
+	mux.HandleFunc("GET /admin/manifest", s.adminOnly(s.adminExportManifestHandler))
+	mux.HandleFunc("GET /admin/manifest/key", s.adminOnly(s.adminManifestKeyHandler))
+	mux.HandleFunc("POST /admin/manifest", s.adminOnly(s.adminImportManifestHandler))
+	mux.HandleFunc("GET /admin/export", s.adminOnly(s.adminExportHandler))
+	mux.HandleFunc("GET /admin/transfers", s.adminOnly(s.adminTransfersHandler))
+	mux.HandleFunc("GET /admin/processing", s.adminOnly(s.adminProcessingHandler))
+	mux.HandleFunc("DELETE /admin/transfers/{id}", s.adminOnly(s.adminCancelTransferHandler))
+	mux.Handle(davPrefix+"/", s.davHandler())
+}
+
+// flaggedAsset is an entry of the admin report listing: a reported asset
+// together with the reports filed against it.
+type flaggedAsset struct {
+	Asset   Asset    `json:"asset"`
+	Reports []Report `json:"reports"`
+}
+
+func (s *Server) adminListReportsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = reportOpen
+	}
+
+	byAsset := make(map[string]*flaggedAsset)
+	for _, rep := range s.reports.list() {
+		if status != "all" && rep.Status != status {
+			continue
+		}
+		fa, ok := byAsset[rep.AssetID]
+		if !ok {
+			asset, ok := s.assets.get(rep.AssetID)
+			if !ok {
+				asset = Asset{ID: rep.AssetID}
+			}
+			fa = &flaggedAsset{Asset: asset}
+			byAsset[rep.AssetID] = fa
+		}
+		fa.Reports = append(fa.Reports, rep)
+	}
+
+	flagged := make([]*flaggedAsset, 0, len(byAsset))
+	for _, fa := range byAsset {
+		sort.Slice(fa.Reports, func(i, j int) bool {
+			return fa.Reports[i].CreatedAt.Before(fa.Reports[j].CreatedAt)
+		})
+		flagged = append(flagged, fa)
+	}
+	// Most reported first
+	sort.Slice(flagged, func(i, j int) bool {
+		if len(flagged[i].Reports) != len(flagged[j].Reports) {
+			return len(flagged[i].Reports) > len(flagged[j].Reports)
+		}
+		return flagged[i].Asset.ID < flagged[j].Asset.ID
+	})
+
+	writeJSON(w, http.StatusOK, flagged)
+}
+
+func (s *Server) adminDismissReportHandler(w http.ResponseWriter, r *http.Request) {
+	rep, err := s.reports.update(r.PathValue("id"), func(rp *Report) error {
+		if rp.Status != reportOpen {
+			return fmt.Errorf("report is already %s", rp.Status)
+		}
+		rp.Status = reportDismissed
+		rp.ResolvedAt = s.now().UTC()
+		rp.ResolvedBy = "admin"
+		return nil
+	})
+	if err == errRecordNotFound {
+		writeJSON(w, http.StatusNotFound, Response{Message: "Report not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusConflict, Response{Message: err.Error()})
+		return
+	}
+
+	s.infof("Report %s against %s dismissed\n", rep.ID, rep.AssetID)
+	s.audit(r.Context(), "admin", auditReportUpdate, rep.ID, reportDismissed)
+	writeJSON(w, http.StatusOK, Response{Success: true, Message: "Report dismissed"})
+}
+
+func (s *Server) adminGetAssetHandler(w http.ResponseWriter, r *http.Request) {
+	asset, ok := s.assets.get(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, Response{Message: "Asset not found"})
+		return
+	}
+	writeJSON(w, http.StatusOK, asset)
+}
+
+func (s *Server) adminSetStateHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		State  AssetState `json:"state"`
+		Reason string     `json:"reason"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.bodyLimit(r, maxRequestSize))).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid request body"})
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "set by admin"
+	}
+	s.changeAssetState(w, r, req.State, req.Reason)
+}
+
+func (s *Server) adminQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeAssetState(w, r, stateQuarantined, "quarantined by admin")
+}
+
+func (s *Server) adminDeleteAssetHandler(w http.ResponseWriter, r *http.Request) {
+	s.changeAssetState(w, r, stateDeleted, "deleted by admin")
+}
+
+// changeAssetState applies an operator requested state change and resolves
+// any open reports against the asset accordingly.
+func (s *Server) changeAssetState(w http.ResponseWriter, r *http.Request, to AssetState, reason string) {
+	id := r.PathValue("id")
+	if _, ok := assetTransitions[to]; !ok && to != stateDeleted {
+		writeJSON(w, http.StatusBadRequest, Response{Message: fmt.Sprintf("Unknown state %q", to)})
+		return
+	}
+
+	asset, err := s.setAssetState(id, to, reason)
+	if err == errRecordNotFound {
+		writeJSON(w, http.StatusNotFound, Response{Message: "Asset not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusConflict, Response{Message: err.Error()})
+		return
+	}
+
+	switch to {
+	case stateQuarantined:
+		s.resolveReports(id, reportQuarantined, "admin")
+	case stateDeleted:
+		s.resolveReports(id, reportDeleted, "admin")
+	}
+	s.infof("Asset %s is now %s: %s\n", id, asset.State, reason)
+	action := auditStateChange
+	if to == stateDeleted {
+		action = auditDelete
+	}
+	s.audit(r.Context(), "admin", action, id, string(to)+": "+reason)
+	writeJSON(w, http.StatusOK, asset)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,189 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karamble/braibot-assetserver/internal/upload"
+)
+
+// errAlbumOwned is returned when an album belongs to another key.
+var errAlbumOwned = errors.New("album belongs to another key")
+
+// Album is an album uploaded in one request, such as the variants of an
+// image generation job: its assets, tagged album:<name>, in order and the
+// one that stands for the album.  Albums shared with a scoped token before
+// they have any are recorded without assets, for their owner.
+type Album struct {
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`
+	Cover     string    `json:"cover"`
+	Assets    []string  `json:"assets"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AlbumV1 is the client view of a new album.
+type AlbumV1 struct {
+	Name      string    `json:"name"`
+	Cover     string    `json:"cover"`
+	Assets    []AssetV1 `json:"assets"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// claimAlbum records owner as the owner of an album, unless another key
+// owns it.
+func (s *Server) claimAlbum(name, owner string) error {
+	_, err := s.albums.upsert(name, func(a *Album) error {
+		if a.Owner != "" && a.Owner != owner {
+			return errAlbumOwned
+		}
+		if a.Owner == "" {
+			*a = Album{Name: name, Owner: owner, CreatedAt: s.now().UTC()}
+		}
+		return nil
+	})
+	return err
+}
+
+// sortAlbum orders the assets of an album: those of its record first, in
+// their order, then any added since, newest first.
+func (s *Server) sortAlbum(name string, assets []Asset) {
+	album, _ := s.albums.get(name)
+	position := func(a *Asset) int {
+		if i := slices.Index(album.Assets, a.ID); i >= 0 {
+			return i
+		}
+		return len(album.Assets)
+	}
+	sort.SliceStable(assets, func(i, j int) bool {
+		if pi, pj := position(&assets[i]), position(&assets[j]); pi != pj {
+			return pi < pj
+		}
+		return assets[i].UploadedAt.After(assets[j].UploadedAt)
+	})
+}
+
+// albumCover returns the index of the cover of an album among its files:
+// the cover form field, a position counted from 0 or a file name, or else
+// the first file.
+func albumCover(r *http.Request, parts []*upload.Part) (int, bool) {
+	cover := r.FormValue("cover")
+	if cover == "" {
+		return 0, true
+	}
+	if i, err := strconv.Atoi(cover); err == nil {
+		return i, i >= 0 && i < len(parts)
+	}
+	i := slices.IndexFunc(parts, func(p *upload.Part) bool { return p.Filename == cover })
+	return i, i >= 0
+}
+
+// createAlbumHandler stores the files of a multipart upload as the album
+// of the name field, in the order they were sent.  Every file is checked
+// as any upload is and goes into the album; if one is refused, those
+// already stored are deleted again and the request fails with its error.
+func (s *Server) createAlbumHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+	if upload.Classify(r.Header.Get("Content-Type")) != upload.Multipart {
+		s.sendEnvelopeError(w, r, http.StatusUnsupportedMediaType, "unsupported_content_type", "Unsupported content type")
+		return
+	}
+	form, parts, _ := s.readMultipartFiles(w, r)
+	if form == nil {
+		return
+	}
+	defer form.RemoveAll()
+
+	name := strings.ToLower(r.FormValue("name"))
+	if !validTag(albumTagPrefix + name) {
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_album", "Invalid album name")
+		return
+	}
+	cover, ok := albumCover(r, parts)
+	if !ok {
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_cover", "The cover is not one of the files")
+		return
+	}
+	actor := uploadActor(r)
+	if a, exists := s.albums.get(name); exists && (a.Owner != actor || len(a.Assets) > 0) {
+		s.sendEnvelopeError(w, r, http.StatusConflict, "album_exists", "Album already exists")
+		return
+	}
+
+	r.Form["tags"] = append(r.Form["tags"], albumTagPrefix+name)
+	var saved []AssetV1
+	discard := func(reason string) {
+		for _, asset := range saved {
+			if err := s.deleteAsset(asset.ID, reason); err != nil {
+				fmt.Printf("Error deleting %s of album %s: %v\n", asset.ID, name, err)
+				continue
+			}
+			s.audit(r.Context(), actor, auditDelete, asset.ID, reason)
+		}
+	}
+	for _, part := range parts {
+		asset, uerr := s.uploadMultipartFile(r, part)
+		if uerr != nil {
+			discard("album upload failed")
+			s.rejectUpload(w, r, uerr)
+			return
+		}
+		saved = append(saved, asset)
+	}
+
+	// An album its owner only shared so far gets its assets now
+	album := Album{
+		Name:      name,
+		Owner:     actor,
+		Cover:     saved[cover].ID,
+		CreatedAt: s.now().UTC(),
+	}
+	for _, asset := range saved {
+		album.Assets = append(album.Assets, asset.ID)
+	}
+	_, err := s.albums.upsert(name, func(a *Album) error {
+		if a.Owner != "" && (a.Owner != actor || len(a.Assets) > 0) {
+			return errRecordExists
+		}
+		*a = album
+		return nil
+	})
+	if errors.Is(err, errRecordExists) {
+		discard("album already exists")
+		s.sendEnvelopeError(w, r, http.StatusConflict, "album_exists", "Album already exists")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Error recording album %s: %v\n", name, err)
+		discard("album not recorded")
+		s.sendEnvelopeError(w, r, http.StatusInternalServerError, "storage_error", "Error recording album")
+		return
+	}
+
+	v := AlbumV1{Name: name, Cover: album.Cover, CreatedAt: album.CreatedAt}
+	for _, asset := range saved {
+		v.Assets = append(v.Assets, s.originAsset(r, asset))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(Envelope{
+		APIVersion: apiVersion,
+		Success:    true,
+		Data:       v,
+		Warnings:   s.quotaWarnings(r, saved...),
+	})
+}
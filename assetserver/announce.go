@@ -0,0 +1,152 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// announceTimeout bounds sending one announcement to brclient
+	announceTimeout = 30 * time.Second
+
+	// announcePrefix starts every announcement, so mirroring instances can
+	// tell them from the chat in the group
+	announcePrefix = "assetserver-mirror/1"
+)
+
+func (s *Server) validateAnnounceConfig() error {
+	if s.config.BRAnnounceGC == "" {
+		return nil
+	}
+	if s.config.BRClientRPCURL == "" {
+		return fmt.Errorf("br_clientrpc_url cannot be empty with br_announce_gc")
+	}
+	u, err := url.Parse(s.config.BRClientRPCURL)
+	if err != nil || (u.Scheme != "wss" && u.Scheme != "ws") {
+		return fmt.Errorf("br_clientrpc_url must be a ws:// or wss:// URL")
+	}
+	if (s.config.BRClientCert == "") != (s.config.BRClientKey == "") {
+		return fmt.Errorf("br_client_cert and br_client_key must be set together")
+	}
+	return nil
+}
+
+// announceable reports whether anyone may fetch an asset as often as they
+// like, and so mirror it.  Protected, limited and flagged assets are never
+// announced, and new content only once it has replaced an asset's.
+func (a *Asset) announceable() bool {
+	return a.State == stateActive && !a.DryRun && a.ReplaceOf == "" && !a.Blind && !a.NSFW && a.PasswordHash == "" &&
+		len(a.Recipients) == 0 && a.SHA256 != "" && a.downloadLimit() == unlimitedDownloads
+}
+
+// announcement is the message announcing an asset: its SHA-256, which
+// mirrors check the file against and may serve it under, size, type and
+// download URL.
+func (s *Server) announcement(asset Asset) string {
+	return fmt.Sprintf("%s %s %d %s %s", announcePrefix, asset.SHA256, asset.Size, asset.ContentType, s.downloadURL(asset.ID))
+}
+
+// announceAsset posts a newly stored public asset to the br_announce_gc
+// group chat in the background.  Announcements are a hint for other
+// servers, so one that fails is logged and dropped.
+func (s *Server) announceAsset(asset Asset) {
+	if s.config.BRAnnounceGC == "" || !asset.announceable() {
+		return
+	}
+	msg := s.announcement(asset)
+	s.background.Go(func() {
+		if err := s.sendGroupChat(s.config.BRAnnounceGC, msg); err != nil {
+			fmt.Printf("Error announcing %s on Bison Relay: %v\n", asset.ID, err)
+		}
+	})
+}
+
+// rpcRequest and rpcResponse are JSON-RPC 2.0 messages as spoken by the
+// clientrpc websocket of brclient.
+type rpcRequest struct {
+	Version string `json:"jsonrpc"`
+	ID      int    `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+type rpcResponse struct {
+	ID    int `json:"id"`
+	Error *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// sendGroupChat sends a message to a group chat through the clientrpc
+// interface of a Bison Relay client at br_clientrpc_url.
+func (s *Server) sendGroupChat(gc, msg string) error {
+	cfg, err := websocket.NewConfig(s.config.BRClientRPCURL, "https://"+s.config.Domain)
+	if err != nil {
+		return err
+	}
+	if cfg.TlsConfig, err = s.clientRPCTLSConfig(); err != nil {
+		return err
+	}
+	cfg.Dialer = &net.Dialer{Timeout: announceTimeout}
+	ws, err := websocket.DialConfig(cfg)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	ws.SetDeadline(time.Now().Add(announceTimeout))
+
+	req := rpcRequest{
+		Version: "2.0",
+		ID:      1,
+		Method:  "ChatService.GCM",
+		Params:  map[string]string{"gc": gc, "msg": msg},
+	}
+	if err := websocket.JSON.Send(ws, req); err != nil {
+		return err
+	}
+	var resp rpcResponse
+	if err := websocket.JSON.Receive(ws, &resp); err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return errors.New(resp.Error.Message)
+	}
+	return nil
+}
+
+// clientRPCTLSConfig trusts br_server_cert, if set, and presents the
+// br_client_cert brclient's clientrpc requires.
+func (s *Server) clientRPCTLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if s.config.BRServerCert != "" {
+		pem, err := os.ReadFile(s.config.BRServerCert)
+		if err != nil {
+			return nil, fmt.Errorf("error reading br_server_cert: %v", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("br_server_cert has no certificates")
+		}
+	}
+	if s.config.BRClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(s.config.BRClientCert, s.config.BRClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading br_client_cert: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,77 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// anonymousPrefix starts the uploader of anonymous uploads, followed by
+// the client address.
+const anonymousPrefix = "anon:"
+
+// defaultAnonymousTypes are the types anonymous uploads may have unless
+// anonymous_types says otherwise: a paste-image service.
+var defaultAnonymousTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+func (s *Server) validateAnonymousConfig() error {
+	if !s.config.AnonymousUploads {
+		return nil
+	}
+	if len(s.config.ScanCommand) == 0 {
+		return fmt.Errorf("anonymous_uploads needs a scan_command")
+	}
+	if s.config.AnonymousMaxFileSize <= 0 {
+		s.config.AnonymousMaxFileSize = min(1<<20, s.config.MaxFileSize)
+	}
+	if s.config.AnonymousMaxFileSize > s.config.MaxFileSize {
+		return fmt.Errorf("anonymous_max_file_size cannot be larger than max_file_size")
+	}
+	if s.config.AnonymousTTL <= 0 {
+		s.config.AnonymousTTL = Duration(24 * time.Hour)
+	}
+	if s.config.AnonymousRateLimit <= 0 {
+		s.config.AnonymousRateLimit = 10 // Uploads per hour per client
+	}
+	if len(s.config.AnonymousTypes) == 0 {
+		s.config.AnonymousTypes = defaultAnonymousTypes
+	}
+	return nil
+}
+
+// isAnonymous reports whether an uploader is an anonymous client.
+func isAnonymous(uploader string) bool {
+	return strings.HasPrefix(uploader, anonymousPrefix)
+}
+
+// anonymousRetention is the rule for anonymous uploads, which retention
+// rules can't extend: they can be downloaded any number of times until
+// anonymous_ttl has passed.
+func (s *Server) anonymousRetention() RetentionRule {
+	return RetentionRule{Name: "anonymous", MaxDownloads: unlimitedDownloads, TTL: s.config.AnonymousTTL}
+}
+
+// anonymousUpload admits an upload without credentials, returning the
+// request carrying its limits, or nil with the response written if the
+// client has used up its rate.  Anonymous uploads are held to the limits
+// of a ticket of anonymous_max_file_size and anonymous_types.
+func (s *Server) anonymousUpload(w http.ResponseWriter, r *http.Request) *http.Request {
+	ip := s.clientIP(r)
+	if !s.anonymousLimiter.allow(ip) {
+		w.Header().Set("Retry-After", "3600")
+		s.sendUploadError(w, r, http.StatusTooManyRequests, "rate_limited", "Too many uploads, try again later")
+		return nil
+	}
+	ticket := uploadTicket{
+		actor:   anonymousPrefix + ip,
+		maxSize: s.config.AnonymousMaxFileSize,
+		types:   s.config.AnonymousTypes,
+	}
+	return r.WithContext(context.WithValue(r.Context(), uploadTicketKey{}, ticket))
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const apiVersion = "v1"
+
+// Envelope wraps every response of the /api/v1 endpoints.
+type Envelope struct {
+	APIVersion string    `json:"api_version"`
+	Success    bool      `json:"success"`
+	Data       any       `json:"data,omitempty"`
+	Error      *APIError `json:"error,omitempty"`
+	Warnings   []Warning `json:"warnings,omitempty"`
+}
+
+// APIError describes a failed /api/v1 request.  Code is stable and meant for
+// programs; Message is for humans.  Details tell why a file was refused.
+type APIError struct {
+	Code    string        `json:"code"`
+	Message string        `json:"message"`
+	Details *ErrorDetails `json:"details,omitempty"`
+}
+
+// ErrorDetails are what a refused file was measured against, so a bot can
+// tell its user why, such as the type detected and the types allowed.
+// Only those that apply are set.
+type ErrorDetails struct {
+	DetectedType string   `json:"detected_type,omitempty"`
+	AllowedTypes []string `json:"allowed_types,omitempty"`
+	Size         int64    `json:"size,omitempty"`
+	Files        int      `json:"files,omitempty"`
+	Limit        int64    `json:"limit,omitempty"`
+}
+
+func (s *Server) registerAPIHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("POST /api/v1/upload", versioned(s.uploadHandler))
+	mux.HandleFunc("POST /api/v1/auth", versioned(s.authHandler))
+	mux.HandleFunc("DELETE /api/v1/auth", versioned(s.authHandler))
+	mux.HandleFunc("POST /api/v1/tickets", versioned(s.ticketHandler))
+	mux.HandleFunc("POST /api/v1/tokens", versioned(s.scopedTokenHandler))
+	mux.HandleFunc("GET /api/v1/tokens", versioned(s.listScopedTokensHandler))
+	mux.HandleFunc("DELETE /api/v1/tokens/{id}", versioned(s.revokeScopedTokenHandler))
+	mux.HandleFunc("POST /api/v1/albums", versioned(s.createAlbumHandler))
+	mux.HandleFunc("GET /api/v1/albums/{name}", versioned(s.albumHandler))
+	mux.HandleFunc("GET /api/v1/users/{id}", versioned(s.userHandler))
+	mux.HandleFunc("GET /api/v1/users/{id}/assets", versioned(s.userAssetsHandler))
+	mux.HandleFunc("POST /api/v1/precheck", versioned(s.precheckHandler))
+	mux.HandleFunc("GET /api/v1/assets/{id}", versioned(s.assetInfoHandler))
+	mux.HandleFunc("GET /api/v1/assets/{id}/embed", versioned(s.embedHandler))
+	mux.HandleFunc("DELETE /api/v1/assets/{id}", versioned(s.deleteHandler))
+	mux.HandleFunc("PUT /api/v1/assets/{id}", versioned(s.replaceHandler))
+	mux.HandleFunc("POST /api/v1/assets/{id}/copy", versioned(s.copyHandler))
+	mux.HandleFunc("PUT /api/v1/assets/{id}/sidecars/{name}", versioned(s.putSidecarHandler))
+	mux.HandleFunc("DELETE /api/v1/assets/{id}/sidecars/{name}", versioned(s.deleteSidecarHandler))
+	mux.HandleFunc("GET /api/v1/download/{id}", versioned(s.downloadHandler))
+	mux.HandleFunc("POST /api/v1/download/{id}", versioned(s.downloadHandler))
+	mux.HandleFunc("DELETE /api/v1/download/{id}", versioned(s.deleteHandler))
+	mux.HandleFunc("GET /api/v1/download/{id}/{variant}", versioned(s.downloadHandler))
+	mux.HandleFunc("POST /api/v1/download/{id}/{variant}", versioned(s.downloadHandler))
+	mux.HandleFunc("POST /api/v1/download/{id}/challenge", versioned(s.challengeHandler))
+	mux.HandleFunc("GET /api/v1/download/{id}/sidecar/{name}", versioned(s.sidecarHandler))
+	mux.HandleFunc("GET /api/v1/thumbnails/{name}", versioned(s.thumbnailHandler))
+	if s.config.CDNURL != "" {
+		mux.HandleFunc("GET /api/v1/origin/{id}", s.originHandler)
+	}
+	if s.config.QRCodes {
+		mux.HandleFunc("GET /api/v1/download/{id}/qr.png", s.qrHandler)
+	}
+	if s.config.ReportPowDifficulty > 0 {
+		mux.HandleFunc("GET /api/v1/pow", versioned(s.powHandler))
+	}
+}
+
+type apiVersionKey struct{}
+
+// versioned marks requests as coming in on the current API version, which
+// selects the enveloped response format.
+func versioned(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, apiVersion)))
+	}
+}
+
+// isVersioned reports whether a request came in on an /api/v1 endpoint.
+func isVersioned(r *http.Request) bool {
+	return r.Context().Value(apiVersionKey{}) != nil
+}
+
+// deprecated marks a legacy endpoint in its responses and points clients at
+// its replacement.  An {id} in the successor path is filled in from the
+// request.
+func deprecated(successor string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		link := strings.ReplaceAll(successor, "{id}", r.PathValue("id"))
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+link+`>; rel="successor-version"`)
+		h(w, r)
+	}
+}
+
+func sendEnvelope(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Envelope{
+		APIVersion: apiVersion,
+		Success:    true,
+		Data:       data,
+	})
+}
+
+// sendEnvelopeError reports an error in the client's language.  The code
+// is never translated.
+func (s *Server) sendEnvelopeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	sendAPIError(w, status, &APIError{Code: code, Message: s.localize(r, message)})
+}
+
+// metadata returns the details that are set as strings, as gRPC errors
+// carry them.
+func (d *ErrorDetails) metadata() map[string]string {
+	if d == nil {
+		return nil
+	}
+	m := make(map[string]string)
+	if d.DetectedType != "" {
+		m["detected_type"] = d.DetectedType
+	}
+	if len(d.AllowedTypes) > 0 {
+		m["allowed_types"] = strings.Join(d.AllowedTypes, ",")
+	}
+	if d.Size > 0 {
+		m["size"] = strconv.FormatInt(d.Size, 10)
+	}
+	if d.Files > 0 {
+		m["files"] = strconv.Itoa(d.Files)
+	}
+	if d.Limit > 0 {
+		m["limit"] = strconv.FormatInt(d.Limit, 10)
+	}
+	return m
+}
+
+func sendAPIError(w http.ResponseWriter, status int, apiErr *APIError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Envelope{
+		APIVersion: apiVersion,
+		Error:      apiErr,
+	})
+}
+
+// sendUploadError reports a failed upload.  The legacy endpoint answers 200
+// with success false, which deployed bots rely on; /api/v1 uses the status.
+func (s *Server) sendUploadError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	s.rejectUpload(w, r, &uploadError{status, code, message, nil})
+}
+
+// rejectUpload reports a refused upload, with its details on /api/v1.
+func (s *Server) rejectUpload(w http.ResponseWriter, r *http.Request, uerr *uploadError) {
+	if isVersioned(r) {
+		sendAPIError(w, uerr.status, s.uploadAPIError(r, uerr))
+		return
+	}
+	s.sendJSONResponse(w, r, false, uerr.message, "")
+}
+
+func (s *Server) uploadAPIError(r *http.Request, uerr *uploadError) *APIError {
+	return &APIError{Code: uerr.code, Message: s.localize(r, uerr.message), Details: uerr.details}
+}
+
+// assetInfoHandler returns the asset object of an asset in any state, so
+// clients can tell a consumed download from one that never existed.
+func (s *Server) assetInfoHandler(w http.ResponseWriter, r *http.Request) {
+	asset, ok := s.assets.get(r.PathValue("id"))
+	if !(ok && s.checkScopedToken(r, accessRead, &asset)) && !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+	if !ok {
+		s.sendEnvelopeError(w, r, http.StatusNotFound, "not_found", "Asset not found")
+		return
+	}
+	v := s.originAsset(r, s.assetV1(&asset, ""))
+	if prefersMinimal(w, r) {
+		v = v.minimal()
+	}
+	sendEnvelope(w, http.StatusOK, v)
+}
+
+// deleteHandler deletes an asset on presentation of the deletion token
+// returned at upload, given as the token query parameter (as in delete_url)
+// or the X-Delete-Token header.
+func (s *Server) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	reply := func(status int, code, message string) {
+		if isVersioned(r) {
+			if status == http.StatusOK {
+				sendEnvelope(w, status, map[string]string{"id": r.PathValue("id")})
+				return
+			}
+			s.sendEnvelopeError(w, r, status, code, message)
+			return
+		}
+		writeJSON(w, status, Response{Success: status == http.StatusOK, Message: s.localize(r, message)})
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.Header.Get("X-Delete-Token")
+	}
+	if uerr := s.deleteWithToken(r.Context(), r.PathValue("id"), token, "ip:"+s.clientIP(r)); uerr != nil {
+		reply(uerr.status, uerr.code, uerr.message)
+		return
+	}
+	reply(http.StatusOK, "", "Asset deleted")
+}
+
+// deleteWithToken deletes an asset if token is its deletion token.  client
+// is recorded in the audit log if it isn't.
+func (s *Server) deleteWithToken(ctx context.Context, id, token, client string) *uploadError {
+	asset, ok := s.assets.get(id)
+	if !ok {
+		return &uploadError{http.StatusNotFound, "not_found", "Asset not found", nil}
+	}
+	if token == "" || asset.DeleteTokenHash == "" ||
+		subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(asset.DeleteTokenHash)) != 1 {
+		s.audit(ctx, client, auditDelete, id, "invalid deletion token")
+		return &uploadError{http.StatusForbidden, "invalid_token", "Invalid deletion token", nil}
+	}
+
+	switch asset.State {
+	case stateDeleted:
+		return &uploadError{http.StatusGone, "deleted", "Asset already deleted", nil}
+	case stateQuarantined:
+		// Quarantined files are kept as evidence until an operator acts
+		return &uploadError{http.StatusConflict, "quarantined", "Asset is quarantined", nil}
+	}
+
+	if err := s.deleteAsset(id, "deleted by uploader"); err != nil {
+		fmt.Printf("Error deleting %s: %v\n", id, err)
+		return &uploadError{http.StatusInternalServerError, "storage_error", "Error deleting asset", nil}
+	}
+	s.audit(ctx, "delete-token", auditDelete, id, "deleted by uploader")
+	return nil
+}
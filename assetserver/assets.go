@@ -0,0 +1,464 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AssetState is the lifecycle state of an asset.
+type AssetState string
+
+const (
+	// statePending assets are still being written or scanned.
+	statePending AssetState = "pending"
+	// stateActive assets can be downloaded.
+	stateActive AssetState = "active"
+	// stateQuarantined assets stay on disk for operator review but cannot
+	// be downloaded.
+	stateQuarantined AssetState = "quarantined"
+	// stateDeleted assets have had their file removed.  The record is kept
+	// so downloads can report the asset as gone.
+	stateDeleted AssetState = "deleted"
+)
+
+// assetTransitions lists the states each state may move to.  Deleted
+// assets can only be restored while their file is in the trash.
+var assetTransitions = map[AssetState][]AssetState{
+	statePending:     {stateActive, stateQuarantined, stateDeleted},
+	stateActive:      {stateQuarantined, stateDeleted},
+	stateQuarantined: {stateActive, stateDeleted},
+	stateDeleted:     {stateActive, stateQuarantined},
+}
+
+// Asset is the metadata kept for every stored file.  The ID is the random
+// filename the file is stored under.
+type Asset struct {
+	ID           string      `json:"id"`
+	OriginalName string      `json:"original_name"`
+	ContentType  string      `json:"content_type"`
+	Size         int64       `json:"size"`
+	UploadedAt   time.Time   `json:"uploaded_at"`
+	State        AssetState  `json:"state"`
+	StateReason  string      `json:"state_reason,omitempty"`
+	StateChanged time.Time   `json:"state_changed"`
+	Reports      int         `json:"reports,omitempty"`
+	Blind        bool        `json:"blind,omitempty"`
+	SHA256       string      `json:"sha256"`
+	ExpiresAt    time.Time   `json:"expires_at,omitzero"`
+	Thumbnails   []Thumbnail `json:"thumbnails,omitempty"`
+	Variants     []Variant   `json:"variants,omitempty"`
+	Pages        int         `json:"pages,omitempty"`
+	Audio        *AudioInfo  `json:"audio,omitempty"`
+
+	// Sidecars are text files attached by the uploader, such as subtitles,
+	// or made in processing.  Transcript is the text of a transcript
+	// sidecar short enough to be kept inline.
+	Sidecars   []Sidecar `json:"sidecars,omitempty"`
+	Transcript string    `json:"transcript,omitempty"`
+
+	// Renditions are the streams of packaged video and audio
+	Renditions []Rendition `json:"renditions,omitempty"`
+
+	// Width and Height are the dimensions of images, Orientation their
+	// EXIF orientation.  Color is the average color as #rrggbb, and
+	// Blurhash and Placeholder, a tiny JPEG data URI, are shown while the
+	// image loads.
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	Orientation int    `json:"orientation,omitempty"`
+	Color       string `json:"color,omitempty"`
+	Blurhash    string `json:"blurhash,omitempty"`
+	Placeholder string `json:"placeholder,omitempty"`
+
+	// SourceSHA256 is the hash of the file as uploaded, if processing
+	// changed it
+	SourceSHA256 string `json:"source_sha256,omitempty"`
+
+	// Encoding is how the file is compressed on disk, if it is, and
+	// StoredSize the space it takes there.  Size and SHA256 are those of
+	// the content.
+	Encoding   string `json:"encoding,omitempty"`
+	StoredSize int64  `json:"stored_size,omitempty"`
+
+	// NSFW is set when the classifier flagged the image.  Verdict is the
+	// outcome of the checks, once they have run.
+	NSFW    bool     `json:"nsfw,omitempty"`
+	Verdict *Verdict `json:"verdict,omitempty"`
+
+	// Uploader identifies who stored the asset as in the audit log, e.g.
+	// key:1a2b3c4d
+	Uploader string `json:"uploader,omitempty"`
+
+	// Metadata is the JSON object supplied by the uploader
+	Metadata map[string]any `json:"metadata,omitempty"`
+
+	// Tags are set by the uploader and operators, and may decide retention
+	Tags []string `json:"tags,omitempty"`
+
+	// Retention names the rule applied at upload.  MaxDownloads of 0 is a
+	// single download, as for assets stored before retention rules.
+	Retention    string `json:"retention,omitempty"`
+	MaxDownloads int    `json:"max_downloads,omitempty"`
+	Downloads    int    `json:"downloads,omitempty"`
+	CacheControl string `json:"cache_control,omitempty"`
+	ShortCode    string `json:"short_code,omitempty"`
+
+	// Delivery journals the parts sent of a download in progress
+	Delivery *Delivery `json:"delivery,omitempty"`
+
+	// DeletedFrom is the state a deleted asset was in.  TrashedAt is set
+	// while its files are in the trash and can be restored.
+	DeletedFrom AssetState `json:"deleted_from,omitempty"`
+	TrashedAt   time.Time  `json:"trashed_at,omitzero"`
+
+	// Tier is "cold" while the file is in the cold store.  AccessedAt is
+	// the last download.
+	Tier       string    `json:"tier,omitempty"`
+	AccessedAt time.Time `json:"accessed_at,omitzero"`
+
+	// Only a hash of the deletion token is kept; the token itself is
+	// returned once, in the upload response.
+	DeleteTokenHash string `json:"delete_token_hash,omitempty"`
+
+	// PasswordHash is the bcrypt hash of the download password, if any
+	PasswordHash string `json:"password_hash,omitempty"`
+
+	// Recipients are the identity keys downloads are restricted to, if any
+	Recipients []string `json:"recipients,omitempty"`
+
+	// User is the identity key of the Bison Relay user braibot stored the
+	// asset for, if any
+	User string `json:"user,omitempty"`
+
+	// DryRun uploads are discarded once checked
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Version counts the contents the asset has had, 0 for the first, and
+	// Versions lists the earlier ones.  ReplacedAt is when the current
+	// content was stored.
+	Version    int            `json:"version,omitempty"`
+	Versions   []AssetVersion `json:"versions,omitempty"`
+	ReplacedAt time.Time      `json:"replaced_at,omitzero"`
+
+	// ReplaceOf is the asset an upload is new content for, set on the
+	// record holding it until it takes the asset's place
+	ReplaceOf string `json:"replace_of,omitempty"`
+
+	// keepOriginal keeps an upload being processed as the original
+	// variant if processing replaces it
+	keepOriginal bool
+
+	// wantSHA256 is the hash an upload stored as it is read must turn
+	// out to have
+	wantSHA256 string
+}
+
+// AssetV1 is version 1 of the asset object returned to clients.
+type AssetV1 struct {
+	ID           string            `json:"id"`
+	URL          string            `json:"url"`
+	DeleteToken  string            `json:"delete_token,omitempty"`
+	DeleteURL    string            `json:"delete_url,omitempty"`
+	ExpiresAt    *time.Time        `json:"expires_at"`
+	MaxDownloads *int              `json:"max_downloads"`
+	Downloads    int               `json:"downloads"`
+	Size         int64             `json:"size"`
+	SHA256       string            `json:"sha256"`
+	ContentType  string            `json:"content_type"`
+	State        AssetState        `json:"state"`
+	Blind        bool              `json:"blind,omitempty"`
+	DryRun       bool              `json:"dry_run,omitempty"`
+	Password     bool              `json:"password_protected,omitempty"`
+	Recipients   []string          `json:"recipients,omitempty"`
+	ShortURL     string            `json:"short_url,omitempty"`
+	QRURL        string            `json:"qr_url,omitempty"`
+	Mirrors      []MirrorV1        `json:"mirrors,omitempty"`
+	Thumbnails   []ThumbnailV1     `json:"thumbnails,omitempty"`
+	Variants     []VariantV1       `json:"variants,omitempty"`
+	Srcset       map[string]string `json:"srcset,omitempty"`
+	StreamURL    string            `json:"stream_url,omitempty"`
+	Sidecars     []SidecarV1       `json:"sidecars,omitempty"`
+	Transcript   string            `json:"transcript,omitempty"`
+	Width        int               `json:"width,omitempty"`
+	Height       int               `json:"height,omitempty"`
+	Orientation  int               `json:"orientation,omitempty"`
+	Color        string            `json:"color,omitempty"`
+	Blurhash     string            `json:"blurhash,omitempty"`
+	Placeholder  string            `json:"placeholder,omitempty"`
+	Pages        int               `json:"pages,omitempty"`
+	Audio        *AudioInfo        `json:"audio,omitempty"`
+	NSFW         bool              `json:"nsfw,omitempty"`
+	NSFWScore    *float64          `json:"nsfw_score,omitempty"`
+	Verdict      *Verdict          `json:"verdict,omitempty"`
+	Metadata     map[string]any    `json:"metadata,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	Version      int               `json:"version"`
+	Versions     []VersionV1       `json:"versions,omitempty"`
+}
+
+// ThumbnailV1 is version 1 of a thumbnail entry of an asset object.
+type ThumbnailV1 struct {
+	URL    string `json:"url"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// assetV1 returns the client view of an asset.  The deletion token and URL are
+// only included when the token is known, i.e. right after upload.  A null
+// expires_at means the asset has no time limit and a null max_downloads
+// that it may be downloaded any number of times.
+func (s *Server) assetV1(a *Asset, deleteToken string) AssetV1 {
+	v := AssetV1{
+		ID:          a.ID,
+		URL:         s.downloadURL(a.ID),
+		Size:        a.Size,
+		SHA256:      a.SHA256,
+		ContentType: a.ContentType,
+		State:       a.State,
+		Blind:       a.Blind,
+		DryRun:      a.DryRun,
+		Password:    a.PasswordHash != "",
+		Recipients:  a.Recipients,
+		Downloads:   a.Downloads,
+		Width:       a.Width,
+		Height:      a.Height,
+		Orientation: a.Orientation,
+		Color:       a.Color,
+		Blurhash:    a.Blurhash,
+		Pages:       a.Pages,
+		Audio:       a.Audio,
+		NSFW:        a.NSFW,
+		Verdict:     a.Verdict,
+		Metadata:    a.Metadata,
+		Tags:        a.Tags,
+		Transcript:  a.Transcript,
+		Version:     a.version(),
+	}
+	if a.Verdict != nil {
+		v.NSFWScore = a.Verdict.NSFWScore
+	}
+	if limit := a.downloadLimit(); limit != unlimitedDownloads {
+		v.MaxDownloads = &limit
+	}
+	if a.ShortCode != "" {
+		v.ShortURL = s.shortURL(a.ShortCode)
+	}
+	if s.config.QRCodes && a.State == stateActive {
+		v.QRURL = s.qrURL(a.ID)
+	}
+	v.Mirrors = s.mirrors(a.ID)
+	if deleteToken != "" {
+		v.DeleteToken = deleteToken
+		v.DeleteURL = s.downloadURL(a.ID) + "?token=" + url.QueryEscape(deleteToken)
+	}
+	if !a.ExpiresAt.IsZero() {
+		t := a.ExpiresAt
+		v.ExpiresAt = &t
+	}
+	for _, t := range a.Thumbnails {
+		v.Thumbnails = append(v.Thumbnails, ThumbnailV1{
+			URL:    s.thumbnailURL(a.ID, t.Size),
+			Width:  t.Width,
+			Height: t.Height,
+		})
+	}
+	for _, variant := range a.Variants {
+		v.Variants = append(v.Variants, VariantV1{
+			Name:        variant.Name,
+			URL:         s.variantURL(a.ID, variant.Name),
+			ContentType: variant.ContentType,
+			Size:        variant.Size,
+			Width:       variant.Width,
+			Height:      variant.Height,
+		})
+	}
+	for _, sc := range a.Sidecars {
+		v.Sidecars = append(v.Sidecars, SidecarV1{
+			Name:        sc.Name,
+			URL:         s.sidecarURL(a.ID, sc.Name),
+			ContentType: sc.ContentType,
+			Size:        sc.Size,
+		})
+	}
+	for _, version := range a.Versions {
+		v.Versions = append(v.Versions, VersionV1{
+			Version:     version.Version,
+			URL:         s.versionURL(a.ID, version.Version),
+			ContentType: version.ContentType,
+			Size:        version.Size,
+			SHA256:      version.SHA256,
+			StoredAt:    version.StoredAt,
+		})
+	}
+	v.Srcset = s.srcset(a)
+	if a.PasswordHash == "" && len(a.Recipients) == 0 {
+		// Like thumbnails, previews would show restricted images
+		v.Placeholder = a.Placeholder
+	}
+	if len(a.Renditions) > 0 && a.streamable() {
+		v.StreamURL = s.streamURL(a.ID)
+	}
+	return v
+}
+
+// hashToken returns the form tokens are stored in.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// transition moves the asset to a new state at now, rejecting moves the
+// state machine does not allow.
+func (a *Asset) transition(to AssetState, reason string, now time.Time) error {
+	if a.State == to {
+		return nil
+	}
+	allowed := false
+	for _, s := range assetTransitions[a.State] {
+		if s == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("cannot change asset state from %s to %s", a.State, to)
+	}
+	if a.State == stateDeleted && a.TrashedAt.IsZero() {
+		return fmt.Errorf("asset was deleted and its file is gone")
+	}
+	a.State = to
+	a.StateReason = reason
+	a.StateChanged = now.UTC()
+	return nil
+}
+
+// setAssetState transitions a stored asset to a new state.  Files of
+// deleted assets are moved to the trash, or removed from disk if the trash
+// is disabled, and moved back when the asset is restored.
+func (s *Server) setAssetState(id string, to AssetState, reason string) (Asset, error) {
+	var from AssetState
+	asset, err := s.assets.update(id, func(a *Asset) error {
+		from = a.State
+		if from == to {
+			return nil
+		}
+		if from == stateDeleted {
+			// Restore the files before the record says they're back
+			if err := a.transition(to, reason, s.now()); err != nil {
+				return err
+			}
+			if err := s.moveAssetFiles(*a, false); err != nil {
+				return fmt.Errorf("error restoring files: %v", err)
+			}
+			a.TrashedAt = time.Time{}
+			a.Downloads = 0
+			if a.expired(s.now()) {
+				a.ExpiresAt = time.Time{}
+			}
+			return nil
+		}
+		if err := a.transition(to, reason, s.now()); err != nil {
+			return err
+		}
+		if to == stateDeleted {
+			a.DeletedFrom = from
+			if s.config.TrashRetention > 0 && !a.DryRun {
+				if err := s.moveAssetFiles(*a, true); err != nil {
+					fmt.Printf("Error moving %s to the trash: %v\n", id, err)
+				} else {
+					a.TrashedAt = a.StateChanged
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return asset, err
+	}
+	if to == stateDeleted && from != stateDeleted && asset.TrashedAt.IsZero() {
+		s.removeThumbnails(asset)
+		s.removeVariants(asset)
+		s.removeStream(asset)
+		s.removeSidecars(asset)
+		s.removeVersions(asset)
+		s.removeColdFile(asset)
+		s.removeReplicas(asset)
+		if err := os.Remove(s.assetPath(id)); err != nil && !os.IsNotExist(err) {
+			return asset, err
+		}
+	}
+	return asset, nil
+}
+
+func (s *Server) openAssetStores() error {
+	var err error
+	if s.assets, err = openRecordStore[Asset](filepath.Join(s.config.DataDir, "assets.json")); err != nil {
+		return fmt.Errorf("error opening asset store: %v", err)
+	}
+	if s.reports, err = openRecordStore[Report](filepath.Join(s.config.DataDir, "reports.json")); err != nil {
+		return fmt.Errorf("error opening report store: %v", err)
+	}
+	if s.shortLinks, err = openRecordStore[ShortLink](filepath.Join(s.config.DataDir, "links.json")); err != nil {
+		return fmt.Errorf("error opening short link store: %v", err)
+	}
+	if s.usage, err = openRecordStore[Usage](filepath.Join(s.config.DataDir, "usage.json")); err != nil {
+		return fmt.Errorf("error opening usage store: %v", err)
+	}
+	if s.apiKeys, err = openRecordStore[APIKey](filepath.Join(s.config.DataDir, "keys.json")); err != nil {
+		return fmt.Errorf("error opening key store: %v", err)
+	}
+	if s.scopedTokens, err = openRecordStore[ScopedToken](filepath.Join(s.config.DataDir, "tokens.json")); err != nil {
+		return fmt.Errorf("error opening token store: %v", err)
+	}
+	if s.users, err = openRecordStore[User](filepath.Join(s.config.DataDir, "users.json")); err != nil {
+		return fmt.Errorf("error opening user store: %v", err)
+	}
+	if s.albums, err = openRecordStore[Album](filepath.Join(s.config.DataDir, "albums.json")); err != nil {
+		return fmt.Errorf("error opening album store: %v", err)
+	}
+	return nil
+}
+
+// validAssetID reports whether id can name a stored file.  It rejects
+// anything that could escape the upload directory.
+func validAssetID(id string) bool {
+	return id != "" && !strings.HasPrefix(id, ".") && filepath.Base(id) == id
+}
+
+func (s *Server) assetPath(id string) string {
+	return filepath.Join(s.config.UploadDir, id)
+}
+
+func (s *Server) downloadURL(id string) string {
+	return fmt.Sprintf("https://%s/api/v1/download/%s", s.config.Domain, id)
+}
+
+// assetIDFromRef accepts either a bare asset ID or a full download URL, on
+// either the legacy or the /api/v1 path, as pasted by a user and returns the
+// asset ID.
+func assetIDFromRef(ref string) string {
+	ref = strings.TrimSpace(ref)
+	if i := strings.Index(ref, "/download/"); i >= 0 {
+		ref = ref[i+len("/download/"):]
+	}
+	if i := strings.IndexAny(ref, "/?#"); i >= 0 {
+		ref = ref[:i]
+	}
+	return ref
+}
+
+// deleteAsset removes an asset's file and marks its record deleted.
+func (s *Server) deleteAsset(id, reason string) error {
+	_, err := s.setAssetState(id, stateDeleted, reason)
+	return err
+}
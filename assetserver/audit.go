@@ -0,0 +1,241 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Audited actions.
+const (
+	auditUpload       = "upload"
+	auditDelete       = "delete"
+	auditStateChange  = "state_change"
+	auditKeyUse       = "key_use"
+	auditConfigLoad   = "config_load"
+	auditReport       = "report"
+	auditReportUpdate = "report_update"
+	auditManifest     = "manifest"
+	auditTransfer     = "transfer_cancel"
+	auditExport       = "export"
+	auditTicket       = "ticket"
+	auditKeyChange    = "key_change"
+	auditLockout      = "auth_lockout"
+	auditTagChange    = "tag_change"
+	auditSidecar      = "sidecar"
+	auditLogging      = "logging_change"
+	auditSession      = "session"
+	auditUserChange   = "user_change"
+	auditReplace      = "replace"
+	auditCopy         = "copy"
+	auditMaintenance  = "maintenance"
+)
+
+// AuditEntry is a single record of the append-only audit log.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Actor     string    `json:"actor"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// auditLog appends JSON encoded entries, one per line, to a file that is
+// never rewritten.
+type auditLog struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func openAuditLog(path string) (*auditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("error opening audit log: %v", err)
+	}
+	return &auditLog{path: path, f: f}, nil
+}
+
+// close closes the log, which may be nil if it was never opened.
+func (l *auditLog) close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+func (l *auditLog) append(e AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.f.Write(line)
+	return err
+}
+
+// audit records an action.  Actions taken on behalf of a request are
+// tagged with its request ID, carried in ctx.
+func (s *Server) audit(ctx context.Context, actor, action, target, detail string) {
+	e := AuditEntry{
+		Time:      time.Now().UTC(),
+		RequestID: requestID(ctx),
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		Detail:    detail,
+	}
+	if err := s.auditor.append(e); err != nil {
+		fmt.Printf("Error writing audit log entry %+v: %v\n", e, err)
+	}
+
+	// Uploads and downloads are published where their sizes are known
+	switch action {
+	case auditDelete, auditStateChange:
+		s.publishEvent(action, target, actor, 0, detail)
+	}
+}
+
+// keyActor identifies an API key in the audit log without recording the
+// key itself.
+func keyActor(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key:" + hex.EncodeToString(sum[:4])
+}
+
+// auditFilter selects entries when querying the audit log.  Empty fields
+// match everything.
+type auditFilter struct {
+	Action, Actor, Target, RequestID string
+	Since, Until                     time.Time
+	Limit                            int
+}
+
+func (f *auditFilter) match(e *AuditEntry) bool {
+	switch {
+	case f.Action != "" && e.Action != f.Action:
+		return false
+	case f.Actor != "" && e.Actor != f.Actor:
+		return false
+	case f.Target != "" && e.Target != f.Target:
+		return false
+	case f.RequestID != "" && e.RequestID != f.RequestID:
+		return false
+	case !f.Since.IsZero() && e.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.Time.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// query returns the newest entries matching the filter, newest first.
+func (l *auditLog) query(f auditFilter) ([]AuditEntry, error) {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var matches []AuditEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if f.match(&e) {
+			matches = append(matches, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(matches) > f.Limit {
+		matches = matches[len(matches)-f.Limit:]
+	}
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches, nil
+}
+
+func (s *Server) adminAuditHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := auditFilter{
+		Action:    q.Get("action"),
+		Actor:     q.Get("actor"),
+		Target:    q.Get("target"),
+		RequestID: q.Get("request_id"),
+		Limit:     100,
+	}
+
+	var err error
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid since time"})
+			return
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid until time"})
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 {
+			writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid limit"})
+			return
+		}
+	}
+
+	entries, err := s.auditor.query(f)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Message: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+type requestIDKey struct{}
+
+// withRequestID tags every request with an ID, reusing a sane X-Request-ID
+// from the proxy if one was sent, and echoes it in the response.
+func withRequestID(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if id == "" || len(id) > 128 {
+			var err error
+			if id, err = randomID(); err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+		w.Header().Set("X-Request-ID", id)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// blindContentType is the type every blind upload is stored and served as.
+const blindContentType = "application/octet-stream"
+
+// blindUpload reports whether the client asked for a blind upload via the
+// X-Blind-Upload header or blind form field.  Blind uploads carry data the
+// client encrypted itself: the server skips sniffing, type checks, scanning
+// and previews, drops the original filename and stores the bytes as is.
+func (s *Server) blindUpload(r *http.Request) (bool, *uploadError) {
+	v := r.Header.Get("X-Blind-Upload")
+	if v == "" {
+		v = r.FormValue("blind")
+	}
+	if v == "" {
+		return false, nil
+	}
+	blind, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &uploadError{http.StatusBadRequest, "invalid_form", "Invalid blind upload flag", nil}
+	}
+	if blind && !s.config.BlindUploads {
+		return false, &uploadError{http.StatusForbidden, "blind_disabled", "Blind uploads are not enabled", nil}
+	}
+	if blind && isAnonymous(uploadActor(r)) {
+		return false, &uploadError{http.StatusForbidden, "blind_disabled", "Blind uploads need an API key", nil}
+	}
+	return blind, nil
+}
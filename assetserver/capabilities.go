@@ -0,0 +1,129 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Capabilities describes what a server accepts, as /test reports it to
+// clients adapting to it.
+type Capabilities struct {
+	Version    string `json:"version"`
+	APIVersion string `json:"api_version"`
+
+	// MaxSizes is the largest file of each allowed type
+	MaxFileSize    int64            `json:"max_file_size"`
+	MaxSizes       map[string]int64 `json:"max_sizes"`
+	MaxBatchFiles  int              `json:"max_batch_files"`
+	MaxSidecarSize int64            `json:"max_sidecar_size"`
+	AllowedTypes   []string         `json:"allowed_types"`
+
+	// UploadModes are the bodies /api/v1/upload takes, and grpc if the
+	// gRPC API is served
+	UploadModes []string `json:"upload_modes"`
+
+	// ResponseEncodings are the Content-Encodings of compressed JSON
+	// responses.  Only gzip is offered.
+	ResponseEncodings []string `json:"response_encodings"`
+
+	Retention RetentionV1     `json:"retention"`
+	Features  map[string]bool `json:"features"`
+}
+
+// RetentionV1 is how long the uploads of a client are kept: by the first
+// of Rules matching an upload, or else by Default.
+type RetentionV1 struct {
+	Default RetentionRuleV1   `json:"default"`
+	Rules   []RetentionRuleV1 `json:"rules"`
+}
+
+// RetentionRuleV1 is a retention rule without the keys it applies to.
+// MaxDownloads is -1 for no limit and TTL is in seconds, 0 if the asset
+// lives until its downloads are used up.
+type RetentionRuleV1 struct {
+	Name         string   `json:"name"`
+	Types        []string `json:"types,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	Albums       []string `json:"albums,omitempty"`
+	MinSize      int64    `json:"min_size,omitempty"`
+	MaxSize      int64    `json:"max_size,omitempty"`
+	MaxDownloads int      `json:"max_downloads"`
+	TTL          int64    `json:"ttl"`
+}
+
+func retentionRuleV1(rule RetentionRule) RetentionRuleV1 {
+	maxDownloads := rule.MaxDownloads
+	if maxDownloads == 0 {
+		maxDownloads = 1
+	}
+	return RetentionRuleV1{
+		Name:         rule.Name,
+		Types:        rule.Types,
+		Tags:         rule.Tags,
+		Albums:       rule.Albums,
+		MinSize:      rule.MinSize,
+		MaxSize:      rule.MaxSize,
+		MaxDownloads: maxDownloads,
+		TTL:          int64(time.Duration(rule.TTL) / time.Second),
+	}
+}
+
+// capabilities describes the server to the client of a request, listing
+// the retention rules that can apply to its key.
+func (s *Server) capabilities(r *http.Request) *Capabilities {
+	c := &Capabilities{
+		Version:        Build().Version,
+		APIVersion:     apiVersion,
+		MaxFileSize:    s.config.MaxFileSize,
+		MaxSizes:       make(map[string]int64),
+		MaxBatchFiles:  s.config.MaxBatchFiles,
+		MaxSidecarSize: s.config.MaxSidecarSize,
+		AllowedTypes:   s.config.AllowedTypes,
+		UploadModes:    []string{"multipart", "form", "json"},
+		Retention: RetentionV1{
+			Default: retentionRuleV1(defaultRetention),
+			Rules:   []RetentionRuleV1{},
+		},
+		Features: map[string]bool{
+			"anonymous_uploads":  s.config.AnonymousUploads,
+			"async_checks":       s.config.AsyncChecks,
+			"blind_uploads":      s.config.BlindUploads,
+			"dry_run":            s.config.DryRun,
+			"gif_conversion":     len(s.config.ConvertGIFs) > 0,
+			"hls":                s.config.HLS,
+			"image_optimization": s.config.OptimizeImages != "",
+			"keep_originals":     s.config.KeepOriginals,
+			"nsfw_check":         len(s.config.NSFWCommand) > 0 || s.config.NSFWURL != "",
+			"pdf_previews":       s.config.PDFPreviews,
+			"probe_audio":        s.config.ProbeAudio,
+			"qr_codes":           s.config.QRCodes,
+			"scan":               len(s.config.ScanCommand) > 0,
+			"short_links":        s.config.ShortLinks,
+			"srcset":             len(s.config.SrcsetWidths) > 0,
+			"thumbnails":         len(s.config.ThumbnailSizes) > 0,
+			"transcription":      len(s.config.TranscribeCommand) > 0 || s.config.TranscribeURL != "",
+		},
+	}
+	for _, t := range s.config.AllowedTypes {
+		c.MaxSizes[t] = s.config.MaxFileSize
+	}
+	if s.config.GRPCPort != "" {
+		c.UploadModes = append(c.UploadModes, "grpc")
+	}
+	c.ResponseEncodings = []string{}
+	if s.config.CompressMinSize >= 0 {
+		c.ResponseEncodings = append(c.ResponseEncodings, "gzip")
+	}
+	actor := requestKeyActor(r)
+	for _, rule := range s.config.RetentionRules {
+		if len(rule.Keys) == 0 || slices.Contains(rule.Keys, actor) {
+			c.Retention.Rules = append(c.Retention.Rules, retentionRuleV1(rule))
+		}
+	}
+	return c
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cdnExpiry returns the expiry of CDN links issued now.  Expiries are
+// rounded to the link lifetime so links to the same asset share a cache
+// key for a while.
+func (s *Server) cdnExpiry(now time.Time) int64 {
+	ttl := int64(time.Duration(s.config.CDNURLTTL).Seconds())
+	return (now.Unix()/ttl + 2) * ttl
+}
+
+func (s *Server) cdnSignature(id string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.config.CDNSigningKey))
+	fmt.Fprintf(mac, "%s\n%d", id, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// redirectToCDN sends the client to the CDN, which pulls the file from
+// the origin endpoint on a cache miss.
+func (s *Server) redirectToCDN(w http.ResponseWriter, r *http.Request, id string) {
+	expires := s.cdnExpiry(s.now())
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", s.cdnSignature(id, expires))
+	target := strings.TrimSuffix(s.config.CDNURL, "/") + "/api/v1/origin/" + url.PathEscape(id) + "?" + q.Encode()
+
+	// Every redirect counts as a download, so it must not be cached
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// originHandler serves asset files to the CDN on presentation of a signed
+// link.  It doesn't count downloads; the redirect did.  Asset IDs never
+// change their contents, so responses are cacheable until the link
+// expires.
+func (s *Server) originHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	q := r.URL.Query()
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || !hmac.Equal([]byte(q.Get("sig")), []byte(s.cdnSignature(id, expires))) {
+		s.httpError(w, r, "Invalid signature", http.StatusForbidden)
+		return
+	}
+	remaining := time.Unix(expires, 0).Sub(s.now())
+	if remaining <= 0 {
+		s.httpError(w, r, "Link expired", http.StatusForbidden)
+		return
+	}
+
+	asset, ok := s.assets.get(id)
+	if !ok || asset.State != stateActive {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+
+	phase := newPhaseSpans(r.Context())
+	defer phase.end()
+	phase.start("open")
+	file, size, ok := s.openAssetFile(w, r, asset)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, immutable", int(remaining.Seconds())))
+	phase.start("send")
+	sent, _ := s.sendAssetFile(w, r, phase, id, file, size)
+	phase.end()
+	s.recordDownload(asset, sent)
+
+	if asset.usedUp() {
+		s.deleteDownloaded(r, id)
+	}
+}
+
+// cdnPullWindow is how long a used up asset is kept for the CDN to fetch
+// after the last redirect to it.
+func (s *Server) cdnPullWindow() time.Duration {
+	return 2 * time.Duration(s.config.CDNURLTTL)
+}
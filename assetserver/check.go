@@ -0,0 +1,169 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Check validates the configuration file at path, or the default one if
+// path is empty, without starting a server or modifying anything on disk.
+// It writes a report to w and returns whether the configuration is valid.
+func Check(path string, w io.Writer) bool {
+	failed := false
+	report := func(item string, err error) {
+		if err != nil {
+			failed = true
+			fmt.Fprintf(w, "FAIL  %s: %v\n", item, err)
+			return
+		}
+		fmt.Fprintf(w, "ok    %s\n", item)
+	}
+
+	cfg, err := LoadConfig(path)
+	for _, warning := range cfg.Warnings {
+		fmt.Fprintf(w, "warn  %s\n", warning)
+	}
+	s := newServer(cfg)
+	if err == nil {
+		err = s.checkConfig()
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		for _, err := range joined.Unwrap() {
+			report(cfg.Path, err)
+		}
+	} else {
+		report(cfg.Path, err)
+	}
+	if err != nil {
+		fmt.Fprintln(w, "configuration is invalid")
+		return false
+	}
+
+	report("upload_dir "+s.config.UploadDir, checkWritableDir(s.config.UploadDir))
+	if s.config.StagingDir != "" {
+		report("staging_dir "+s.config.StagingDir, checkWritableDir(s.config.StagingDir))
+	}
+	report("data_dir "+s.config.DataDir, checkWritableDir(s.config.DataDir))
+	if s.config.InboxDir != "" {
+		report("inbox_dir "+s.config.InboxDir, checkWritableDir(s.config.InboxDir))
+	}
+	for _, r := range s.config.Replicas {
+		if r.Backend == "dir" {
+			report("replica "+r.Name+" "+r.Dir, checkWritableDir(r.Dir))
+		}
+	}
+	report("audit_log "+s.config.AuditLog, checkWritableFile(s.config.AuditLog))
+	for _, name := range []string{"assets.json", "reports.json", "links.json", "usage.json"} {
+		path := filepath.Join(s.config.DataDir, name)
+		report(path, checkRecordStore(path))
+	}
+	if len(s.config.ScanCommand) > 0 {
+		_, err := exec.LookPath(s.config.ScanCommand[0])
+		report("scan_command "+s.config.ScanCommand[0], err)
+	}
+	if len(s.config.OptimizeCommand) > 0 {
+		_, err := exec.LookPath(s.config.OptimizeCommand[0])
+		report("optimize_command "+s.config.OptimizeCommand[0], err)
+	}
+	if len(s.config.ConvertGIFs) > 0 {
+		_, err := exec.LookPath(s.config.FFmpeg)
+		report("ffmpeg "+s.config.FFmpeg, err)
+	}
+	if len(s.config.NSFWCommand) > 0 {
+		_, err := exec.LookPath(s.config.NSFWCommand[0])
+		report("nsfw_command "+s.config.NSFWCommand[0], err)
+	}
+	if s.config.NSFWURL != "" {
+		_, err := url.ParseRequestURI(s.config.NSFWURL)
+		report("nsfw_url", err)
+	}
+	for _, rule := range s.config.ProvenanceRules {
+		if rule.Method == "c2pa" {
+			_, err := exec.LookPath(s.config.C2PACommand[0])
+			report("c2pa_command "+s.config.C2PACommand[0], err)
+			break
+		}
+	}
+	if s.config.PDFPreviews {
+		for _, tool := range []string{s.config.PDFInfo, s.config.PDFToPPM} {
+			_, err := exec.LookPath(tool)
+			report("pdf_previews "+tool, err)
+		}
+	}
+	if s.config.DebugListen != "" && !isLoopbackAddr(s.config.DebugListen) && s.config.AdminKey == "" {
+		report("debug_listen "+s.config.DebugListen, fmt.Errorf("not a loopback address and admin_key is not set"))
+	}
+	if s.config.ReportCaptchaSecret != "" {
+		_, err := url.ParseRequestURI(s.config.ReportCaptchaVerifyURL)
+		report("report_captcha_verify_url", err)
+	}
+
+	if failed {
+		fmt.Fprintln(w, "configuration has errors")
+		return false
+	}
+	fmt.Fprintln(w, "configuration is valid")
+	return true
+}
+
+// checkWritableDir verifies files can be created in dir.  A missing
+// directory passes if it could be created by the server at startup.
+func checkWritableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		parent := filepath.Dir(filepath.Clean(dir))
+		if err := checkWritableDir(parent); err != nil {
+			return fmt.Errorf("does not exist and cannot be created: %v", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("not a directory")
+	}
+
+	f, err := os.CreateTemp(dir, ".check-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %v", err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// checkWritableFile verifies path can be opened for appending, or created if
+// it does not exist yet.
+func checkWritableFile(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkWritableDir(filepath.Dir(path))
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// checkRecordStore verifies an existing record store parses.
+func checkRecordStore(path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var records map[string]json.RawMessage
+	return json.Unmarshal(data, &records)
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Verdict results
+const (
+	verdictClean       = "clean"
+	verdictNSFW        = "nsfw"
+	verdictQuarantined = "quarantined"
+	verdictRejected    = "rejected"
+	verdictUnchecked   = "unchecked"
+)
+
+// Verdict is the outcome of checking an upload with the scanner and
+// classifier.  It is part of the asset object and sent to webhook_url.
+type Verdict struct {
+	Result    string    `json:"result"`
+	Reason    string    `json:"reason,omitempty"`
+	NSFWScore *float64  `json:"nsfw_score,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// checkAsset runs the check stages of a pending asset's pipeline, then
+// activates it with its short link, thumbnails, stream and transcript, or quarantines or
+// rejects it.  Blind uploads are encrypted, so there is nothing to check.
+// The verdict is delivered to the webhook.
+func (s *Server) checkAsset(ctx context.Context, asset Asset) (Asset, error) {
+	p := &processing{asset: &asset, next: stateActive, verdict: Verdict{Result: verdictClean}}
+	if asset.Blind {
+		p.verdict.Result = verdictUnchecked
+	}
+	s.runPipeline(ctx, phaseCheck, p)
+	if p.reject {
+		return s.rejectAsset(ctx, asset, p.reason, p.verdict.NSFWScore)
+	}
+
+	// Clean files get a short link if enabled, except new content of an
+	// asset, which keeps the asset's
+	var shortCode string
+	if p.next == stateActive && s.config.ShortLinks && !asset.DryRun && asset.ReplaceOf == "" {
+		var err error
+		if shortCode, err = s.newShortLink(asset.ID); err != nil {
+			fmt.Printf("Error creating short link for %s: %v\n", asset.ID, err)
+		}
+	}
+
+	// Only clean files keep their thumbnails, which a check later in the
+	// pipeline may have quarantined
+	if p.next != stateActive {
+		s.removeThumbnails(Asset{ID: asset.ID, Thumbnails: p.thumbs})
+		s.removeStream(Asset{ID: asset.ID, Renditions: p.renditions})
+		if p.transcript != nil {
+			s.removeSidecars(Asset{ID: asset.ID, Sidecars: []Sidecar{*p.transcript}})
+		}
+		p.thumbs, p.pages, p.renditions, p.transcript, p.audio = nil, 0, nil, nil, nil
+	}
+
+	verdict := p.verdict
+	switch {
+	case p.next == stateQuarantined:
+		verdict.Result, verdict.Reason = verdictQuarantined, p.reason
+	case p.nsfw:
+		verdict.Result = verdictNSFW
+	}
+	verdict.CheckedAt = s.now().UTC()
+
+	// Clean files are compressed once nothing needs to read them anymore
+	var compressed string
+	var storedSize int64
+	if p.next == stateActive {
+		if compressed, storedSize = s.compressUpload(asset); compressed != "" {
+			defer os.Remove(compressed)
+		}
+	}
+
+	saved, err := s.assets.update(asset.ID, func(a *Asset) error {
+		a.Thumbnails = p.thumbs
+		a.Pages = p.pages
+		a.Renditions = p.renditions
+		a.Audio = p.audio
+		if p.transcript != nil {
+			a.addSidecar(*p.transcript)
+			if len(p.text) <= maxInlineTranscript {
+				a.Transcript = p.text
+			}
+		}
+		a.NSFW = p.nsfw
+		a.Verdict = &verdict
+		a.ShortCode = shortCode
+		a.applyRetention(s.retentionFor(a.ContentType, a.Size, a.Uploader, a.Tags))
+		if err := a.transition(p.next, p.reason, s.now()); err != nil {
+			return err
+		}
+		if compressed != "" {
+			if err := os.Rename(compressed, s.assetPath(a.ID)); err != nil {
+				fmt.Printf("Error storing %s compressed: %v\n", a.ID, err)
+				return nil
+			}
+			a.Encoding, a.StoredSize = encodingZstd, storedSize
+		}
+		return nil
+	})
+	if err != nil {
+		return saved, err
+	}
+	if saved.Encoding != "" && compressed != "" {
+		// Replicas hold the file as it is stored
+		if err := s.replicateAsset(ctx, Asset{ID: saved.ID}); err != nil {
+			fmt.Printf("Error replicating compressed %s: %v\n", saved.ID, err)
+		}
+	}
+	s.sendVerdict(saved)
+	s.announceAsset(saved)
+	if p.next == stateQuarantined {
+		s.infof("Asset %s quarantined: %s\n", asset.ID, p.reason)
+		s.audit(ctx, "scanner", auditStateChange, asset.ID, string(p.next)+": "+p.reason)
+		return saved, errQuarantined
+	}
+	return saved, nil
+}
+
+// rejectAsset deletes an upload the classifier refused.  The record is kept
+// so the uploader can look up why.
+func (s *Server) rejectAsset(ctx context.Context, asset Asset, reason string, score *float64) (Asset, error) {
+	s.infof("Asset %s %s\n", asset.ID, reason)
+	saved, err := s.assets.update(asset.ID, func(a *Asset) error {
+		a.Verdict = &Verdict{
+			Result:    verdictRejected,
+			Reason:    reason,
+			NSFWScore: score,
+			CheckedAt: s.now().UTC(),
+		}
+		return nil
+	})
+	if err != nil {
+		return saved, err
+	}
+	if saved, err = s.setAssetState(asset.ID, stateDeleted, reason); err != nil {
+		return saved, err
+	}
+	s.audit(ctx, "classifier", auditDelete, asset.ID, reason)
+	s.sendVerdict(saved)
+	return saved, errRejected
+}
+
+// resumePendingChecks checks the assets that were written but still
+// pending when the server last stopped.
+func (s *Server) resumePendingChecks(ctx context.Context) {
+	for _, asset := range s.assets.list() {
+		if asset.State != statePending || asset.SHA256 == "" {
+			continue
+		}
+		// The files of dry runs were in the staging area, cleaned since
+		if asset.DryRun {
+			s.discardDryRun(asset)
+			continue
+		}
+		s.infof("Resuming checks of %s\n", asset.ID)
+		s.checkAsset(ctx, asset)
+	}
+}
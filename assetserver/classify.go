@@ -0,0 +1,137 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const classifyTimeout = 30 * time.Second
+
+// errRejected is returned when a freshly uploaded file was refused by the
+// NSFW classifier.
+var errRejected = errors.New("file rejected by content classifier")
+
+// NSFW actions
+const (
+	nsfwReject     = "reject"
+	nsfwQuarantine = "quarantine"
+	nsfwTag        = "tag"
+)
+
+// NSFWRule decides what happens to images the classifier flags, by the key
+// they were uploaded with.  The first rule listing the uploader, or
+// listing no keys, applies; images no rule applies to aren't classified.
+type NSFWRule struct {
+	Keys   []string `json:"keys"`
+	Action string   `json:"action"`
+	// Threshold overrides nsfw_threshold
+	Threshold float64 `json:"threshold"`
+}
+
+func (s *Server) validateNSFWConfig() error {
+	if s.config.NSFWThreshold == 0 {
+		s.config.NSFWThreshold = 0.8
+	}
+	if s.config.NSFWThreshold < 0 || s.config.NSFWThreshold > 1 {
+		return fmt.Errorf("nsfw_threshold must be between 0 and 1")
+	}
+	for i, rule := range s.config.NSFWRules {
+		switch rule.Action {
+		case nsfwReject, nsfwQuarantine, nsfwTag:
+		default:
+			return fmt.Errorf("nsfw rule #%d: action must be reject, quarantine or tag", i+1)
+		}
+		if rule.Threshold < 0 || rule.Threshold > 1 {
+			return fmt.Errorf("nsfw rule #%d: threshold must be between 0 and 1", i+1)
+		}
+	}
+	if len(s.config.NSFWRules) > 0 && s.config.NSFWURL == "" && len(s.config.NSFWCommand) == 0 {
+		return fmt.Errorf("nsfw_rules need nsfw_url or nsfw_command")
+	}
+	return nil
+}
+
+func (s *Server) nsfwRuleFor(actor string) (NSFWRule, bool) {
+	for _, rule := range s.config.NSFWRules {
+		if len(rule.Keys) == 0 || slices.Contains(rule.Keys, actor) {
+			if rule.Threshold == 0 {
+				rule.Threshold = s.config.NSFWThreshold
+			}
+			return rule, true
+		}
+	}
+	return NSFWRule{}, false
+}
+
+// classifyImage returns the classifier's probability that an image is
+// NSFW, from 0 to 1.  nsfw_command gets the file path appended and prints
+// the score; nsfw_url is sent the file in a POST and answers with a JSON
+// object with a score.
+func (s *Server) classifyImage(ctx context.Context, path, contentType string) (float64, error) {
+	ctx, cancel := toolContext(ctx, classifyTimeout)
+	defer cancel()
+
+	if len(s.config.NSFWCommand) > 0 {
+		args := append(append([]string{}, s.config.NSFWCommand[1:]...), path)
+		out, err := exec.CommandContext(ctx, s.config.NSFWCommand[0], args...).Output()
+		if err != nil {
+			return 0, fmt.Errorf("error running classifier: %v", err)
+		}
+		score, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid classifier output %q", strings.TrimSpace(string(out)))
+		}
+		return score, checkScore(score)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.NSFWURL, f)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("classifier returned %s", resp.Status)
+	}
+
+	var result struct {
+		Score *float64 `json:"score"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("error decoding classifier response: %v", err)
+	}
+	if result.Score == nil {
+		return 0, fmt.Errorf("classifier response has no score")
+	}
+	return *result.Score, checkScore(*result.Score)
+}
+
+func checkScore(score float64) error {
+	if score < 0 || score > 1 {
+		return fmt.Errorf("classifier score %v is not between 0 and 1", score)
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// defaultCompressMinSize is the smallest JSON response compressed unless
+// compress_min_size is set.  Below it gzip's framing outweighs the savings.
+const defaultCompressMinSize = 1 << 10
+
+var gzipWriters = sync.Pool{
+	New: func() any {
+		return gzip.NewWriter(nil)
+	},
+}
+
+func (s *Server) validateCompressConfig() error {
+	if s.config.CompressMinSize == 0 {
+		s.config.CompressMinSize = defaultCompressMinSize
+	}
+	return nil
+}
+
+// acceptsEncoding reports whether a request's Accept-Encoding allows an
+// encoding, such as gzip.
+func acceptsEncoding(r *http.Request, encoding string) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		quality, err := strconv.ParseFloat(q, 64)
+		return err == nil && quality > 0
+	}
+	return false
+}
+
+// wantsPretty reports whether a request asked for indented JSON with the
+// pretty parameter.  Responses are compact otherwise.
+func wantsPretty(r *http.Request) bool {
+	if !r.URL.Query().Has("pretty") {
+		return false
+	}
+	pretty, err := strconv.ParseBool(r.URL.Query().Get("pretty"))
+	return err != nil || pretty
+}
+
+// prefersMinimal reports whether a request asked for responses without
+// their verbose fields with Prefer: return=minimal, as bots polling the
+// API do.  It notes the preference as applied.
+func prefersMinimal(w http.ResponseWriter, r *http.Request) bool {
+	w.Header().Add("Vary", "Prefer")
+	for _, pref := range r.Header.Values("Prefer") {
+		for p := range strings.SplitSeq(pref, ",") {
+			if strings.EqualFold(strings.ReplaceAll(strings.TrimSpace(p), " ", ""), "return=minimal") {
+				w.Header().Set("Preference-Applied", "return=minimal")
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// minimal drops the fields of an asset object that only some clients
+// need, leaving what a bot needs to hand out and track the download.
+func (v AssetV1) minimal() AssetV1 {
+	return AssetV1{
+		ID:           v.ID,
+		URL:          v.URL,
+		DeleteToken:  v.DeleteToken,
+		DeleteURL:    v.DeleteURL,
+		ExpiresAt:    v.ExpiresAt,
+		MaxDownloads: v.MaxDownloads,
+		Downloads:    v.Downloads,
+		Size:         v.Size,
+		SHA256:       v.SHA256,
+		ContentType:  v.ContentType,
+		State:        v.State,
+		Blind:        v.Blind,
+		DryRun:       v.DryRun,
+		Password:     v.Password,
+		NSFW:         v.NSFW,
+		Version:      v.Version,
+	}
+}
+
+// withJSONEncoding compresses JSON responses of at least compress_min_size
+// with gzip for clients accepting it, and indents them for requests with
+// the pretty parameter.  gzip is the only encoding offered, as the
+// capabilities report; clients accepting only others get identity.  Other responses, such as asset files, pass
+// through untouched so they can still be sent with sendfile.
+func (s *Server) withJSONEncoding(h http.Handler) http.Handler {
+	h = withPrettyJSON(h)
+	if s.config.CompressMinSize < 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsEncoding(r, "gzip") {
+			h.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressWriter{ResponseWriter: w, minSize: int(s.config.CompressMinSize)}
+		defer cw.close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+// withPrettyJSON indents the JSON responses of requests asking for it.
+// Those are buffered whole, which is fine for people reading them.
+func withPrettyJSON(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !wantsPretty(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		pw := &prettyWriter{ResponseWriter: w}
+		defer pw.close()
+		h.ServeHTTP(pw, r)
+	})
+}
+
+func isJSON(h http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return mediaType == "application/json" && h.Get("Content-Encoding") == ""
+}
+
+// bodyAllowed reports whether a response with status has a body.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// compressWriter holds back the start of a JSON response until it is
+// known to reach minSize, and then gzips it.  Smaller responses are sent
+// as they are when the handler returns.
+type compressWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	status int
+	buf    []byte
+	gz     *gzip.Writer
+
+	// passthrough is set once the response is sent as written
+	passthrough bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.status != 0 || w.passthrough {
+		return
+	}
+	if status >= 100 && status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if !isJSON(w.Header()) || !bodyAllowed(status) {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.status == 0 && !w.passthrough {
+		w.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case w.passthrough:
+		return w.ResponseWriter.Write(p)
+	case w.gz != nil:
+		return w.gz.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minSize {
+		if err := w.startGzip(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// ReadFrom passes files on to the connection, which can send them with
+// sendfile.
+func (w *compressWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.status == 0 && !w.passthrough {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return copyBuffer(w.ResponseWriter, r)
+	}
+	return copyBuffer(struct{ io.Writer }{w}, r)
+}
+
+func (w *compressWriter) startGzip() error {
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.gz = gzipWriters.Get().(*gzip.Writer)
+	w.gz.Reset(w.ResponseWriter)
+	_, err := w.gz.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// sendBuffered sends a response held back as it is.
+func (w *compressWriter) sendBuffered() error {
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.buf)
+	w.buf = nil
+	return err
+}
+
+// FlushError sends what was written so far, uncompressed if it was still
+// held back.
+func (w *compressWriter) FlushError() error {
+	switch {
+	case w.gz != nil:
+		if err := w.gz.Flush(); err != nil {
+			return err
+		}
+	case w.status != 0 && !w.passthrough:
+		if err := w.sendBuffered(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *compressWriter) close() {
+	switch {
+	case w.gz != nil:
+		w.gz.Close()
+		gzipWriters.Put(w.gz)
+		w.gz = nil
+	case w.status != 0 && !w.passthrough:
+		w.sendBuffered()
+	}
+}
+
+// prettyWriter holds back a JSON response to indent it once the handler
+// returns.
+type prettyWriter struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+
+	passthrough bool
+}
+
+func (w *prettyWriter) WriteHeader(status int) {
+	if w.status != 0 || w.passthrough {
+		return
+	}
+	if status >= 100 && status < 200 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if !isJSON(w.Header()) || !bodyAllowed(status) {
+		w.passthrough = true
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	w.status = status
+}
+
+func (w *prettyWriter) Write(p []byte) (int, error) {
+	if w.status == 0 && !w.passthrough {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+	return w.buf.Write(p)
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (w *prettyWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *prettyWriter) close() {
+	if w.status == 0 || w.passthrough {
+		return
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, w.buf.Bytes(), "", "  "); err != nil {
+		out = w.buf
+	}
+	w.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(w.status)
+	out.WriteTo(w.ResponseWriter)
+}
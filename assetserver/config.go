@@ -0,0 +1,230 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigPaths are tried in order when no -config flag is given.
+var defaultConfigPaths = []string{"config.json", "config.yaml", "config.yml", "config.toml"}
+
+// configSections are the groups options are nested under, and the options
+// of each.  Keys inside a section are treated exactly like top level keys,
+// so
+//
+//	auth:
+//	  api_key: secret
+//
+// is the same as api_key: secret.  Options outside their section still
+// work, but are deprecated.  Config itself stays flat, so that programs
+// embedding the server set options by the same names whatever the file
+// looks like; sections only exist in files.
+var configSections = map[string][]string{
+	"server": {"port", "domain", "trust_proxy", "language", "locale_dir",
+		"read_timeout", "write_timeout", "idle_timeout", "upload_timeout",
+		"read_header_timeout", "min_upload_rate", "upload_rate_grace", "max_conns_per_ip",
+		"grpc_port", "sftp_listen", "sftp_authorized_keys", "sftp_host_key",
+		"smtp_listen", "smtp_address", "smtp_secret", "smtp_senders", "smtp_relay",
+		"debug_listen", "log_level", "log_mime", "compress_min_size", "read_only", "read_only_message", "otlp_endpoint", "otlp_insecure", "trace_sample_ratio",
+		"qr_codes", "short_links", "short_link_length",
+		"hotlink_allowed_referers", "hotlink_require_referer", "hotlink_signing_key",
+		"cache_control_once", "cache_control_limited", "cache_control_unlimited",
+		"cdn_url", "cdn_signing_key", "cdn_url_ttl", "origins", "origin_country_header",
+		"proxy_register", "proxy_upstream", "caddy_admin_url", "caddy_server",
+		"traefik_config", "traefik_cert_resolver"},
+	"storage": {"upload_dir", "data_dir", "staging_dir", "staging_max_size",
+		"retention_rules", "trash_retention", "manifest_key", "manifest_trusted_keys",
+		"cold_after", "cold_backend", "cold_dir", "cold_s3_endpoint", "cold_s3_bucket",
+		"cold_s3_region", "cold_s3_prefix", "cold_s3_access_key", "cold_s3_secret_key",
+		"cold_s3_storage_class", "cold_s3_insecure", "cold_retry_after", "cold_proxy",
+		"replicas", "replica_writes", "dry_run", "storage_backend", "max_storage_size",
+		"compress_storage", "compress_storage_types",
+		"quota_warning", "inbox_dir", "inbox_interval"},
+	"auth": {"api_key", "admin_key", "auth_max_failures", "auth_failure_window",
+		"auth_lockout", "session_ttl", "vault_addr", "vault_token_file"},
+	"limits": {"max_file_size", "allowed_types", "allowed_extensions",
+		"content_type_order", "strict_content_type", "max_batch_files", "multipart_memory", "blind_uploads",
+		"max_sidecar_size", "max_header_bytes", "body_limits",
+		"anonymous_uploads", "anonymous_max_file_size", "anonymous_types",
+		"anonymous_ttl", "anonymous_rate_limit"},
+	"processing": {"optimize_images", "optimize_quality", "optimize_command",
+		"keep_originals", "convert_gifs", "convert_gif_min_size", "ffmpeg", "ffprobe",
+		"srcset_widths", "thumbnail_sizes", "pdf_previews", "pdftoppm", "pdfinfo",
+		"probe_audio", "hls", "hls_heights", "hls_segment_duration", "hls_min_audio_duration",
+		"transcribe_command", "transcribe_url", "transcribe_key",
+		"provenance_rules", "c2pa_command", "c2pa_sign_cert", "c2pa_private_key", "c2pa_sign_alg",
+		"pipelines", "processing_workers", "stage_timeouts", "stage_priorities"},
+	"reports": {"report_rate_limit", "report_captcha_secret", "report_captcha_verify_url",
+		"report_pow_difficulty"},
+	"scanning": {"scan_command", "nsfw_command", "nsfw_url", "nsfw_threshold", "nsfw_rules",
+		"async_checks", "webhook_url", "webhook_secret"},
+	"audit": {"audit_log"},
+	"bisonrelay": {"br_announce_gc", "br_clientrpc_url", "br_server_cert",
+		"br_client_cert", "br_client_key", "br_user_quota", "br_user_max_files"},
+}
+
+// optionSections maps every option to its section.
+var optionSections = func() map[string]string {
+	m := make(map[string]string)
+	for section, options := range configSections {
+		for _, option := range options {
+			m[option] = section
+		}
+	}
+	return m
+}()
+
+// optionSection returns the section of an option, including the _file
+// form of secret options.
+func optionSection(key string) (string, bool) {
+	if name, ok := strings.CutSuffix(key, "_file"); ok && slices.Contains(secretOptions, name) {
+		key = name
+	}
+	section, ok := optionSections[key]
+	return section, ok
+}
+
+// LoadConfig reads a JSON, YAML or TOML configuration file, or the first of
+// the default files that exists if path is empty.  The configuration is
+// checked by New.
+func LoadConfig(path string) (Config, error) {
+	if path == "" {
+		path = findConfigFile()
+	}
+	cfg := Config{Path: path}
+	if err := decodeConfigFile(path, &cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// findConfigFile returns the first default configuration file that exists.
+func findConfigFile() string {
+	for _, path := range defaultConfigPaths {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return defaultConfigPaths[0]
+}
+
+// decodeConfigFile parses a JSON, YAML or TOML file, chosen by extension,
+// into cfg.  All formats are normalized to JSON so the json struct tags on
+// Config are the single definition of every key.
+func decodeConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading config file: %v", err)
+	}
+
+	var raw map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = json.Unmarshal(data, &raw)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return fmt.Errorf("unsupported config file extension %q", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("error parsing config file: %v", err)
+	}
+
+	cfg.Warnings, err = flattenConfigSections(raw)
+	if err != nil {
+		return fmt.Errorf("error parsing config file: %v", err)
+	}
+	if err := resolveSecrets(raw); err != nil {
+		return fmt.Errorf("error resolving secrets: %v", err)
+	}
+
+	normalized, err := json.Marshal(raw)
+	if err != nil {
+		return fmt.Errorf("error parsing config file: %v", err)
+	}
+	if err := json.Unmarshal(normalized, cfg); err != nil {
+		return fmt.Errorf("error parsing config file: %v", err)
+	}
+	return nil
+}
+
+// flattenConfigSections hoists the keys of every section into the top level.
+// It returns warnings about options that aren't in their section, or aren't
+// options at all.
+func flattenConfigSections(raw map[string]any) ([]string, error) {
+	var warnings []string
+	for _, key := range slices.Sorted(maps.Keys(raw)) {
+		if _, ok := configSections[key]; ok {
+			continue
+		}
+		if section, ok := optionSection(key); ok {
+			warnings = append(warnings, fmt.Sprintf("option %s at the top level is deprecated, move it into the %s section", key, section))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("unknown option %s", key))
+		}
+	}
+
+	for _, section := range slices.Sorted(maps.Keys(configSections)) {
+		v, ok := raw[section]
+		if !ok {
+			continue
+		}
+		delete(raw, section)
+
+		// A section with every option commented out is empty, not invalid
+		if v == nil {
+			continue
+		}
+
+		values, ok := v.(map[string]any)
+		if !ok {
+			return warnings, fmt.Errorf("section %q must be a table of options", section)
+		}
+		for _, key := range slices.Sorted(maps.Keys(values)) {
+			if _, dup := raw[key]; dup {
+				return warnings, errors.New("option " + key + " is set more than once")
+			}
+			raw[key] = values[key]
+			switch want, ok := optionSection(key); {
+			case !ok:
+				warnings = append(warnings, fmt.Sprintf("unknown option %s in the %s section", key, section))
+			case want != section:
+				warnings = append(warnings, fmt.Sprintf("option %s in the %s section is deprecated, move it into the %s section", key, section, want))
+			}
+		}
+	}
+	return warnings, nil
+}
+
+// Duration is a time.Duration written as a string such as "90s" or "24h" in
+// configuration files.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"24h\"")
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"fmt"
+
+	"github.com/karamble/braibot-assetserver/internal/upload"
+)
+
+// Sources of an upload's content type, as listed in content_type_order.
+const (
+	typeFromPart   = "part"   // Content-Type of the multipart part
+	typeFromHeader = "header" // X-File-Type header
+	typeFromField  = "field"  // filetype or type form field
+	typeFromSniff  = "sniff"  // the file's own bytes
+)
+
+func (s *Server) validateContentTypeOrder() error {
+	if s.config.StrictContentType {
+		if len(s.config.ContentTypeOrder) > 0 {
+			return fmt.Errorf("content_type_order cannot be set with strict_content_type")
+		}
+		s.config.ContentTypeOrder = []string{typeFromSniff}
+		return nil
+	}
+	for i, source := range s.config.ContentTypeOrder {
+		switch source {
+		case typeFromPart, typeFromHeader, typeFromField:
+		case typeFromSniff:
+			if i != len(s.config.ContentTypeOrder)-1 {
+				return fmt.Errorf("content_type_order: sniff must come last")
+			}
+		default:
+			return fmt.Errorf("content_type_order: unknown source %q", source)
+		}
+	}
+	return nil
+}
+
+// uploadContentType resolves the type of an upload from the first of its
+// declared types that is set, going by content_type_order or else by
+// defaultOrder, and sniffs the data if none is.  Sources missing from the
+// order are never trusted.
+func (s *Server) uploadContentType(data []byte, declared map[string]string, defaultOrder ...string) string {
+	order := s.config.ContentTypeOrder
+	if len(order) == 0 {
+		order = defaultOrder
+	}
+	var types []string
+	for _, source := range order {
+		if source == typeFromSniff {
+			break
+		}
+		types = append(types, declared[source])
+	}
+	contentType := upload.ContentType(data, types...)
+	s.mimef("Content type %s detected from %v, declared %v\n", contentType, order, declared)
+	return contentType
+}
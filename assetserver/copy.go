@@ -0,0 +1,193 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// CopyOptions are the policy of a copy of an asset.  Tags, if set, replace
+// those of the asset and pick the retention rule; TTL and MaxDownloads may
+// only tighten what the rule allows.
+type CopyOptions struct {
+	Tags         []string
+	TTL          time.Duration
+	MaxDownloads int
+}
+
+// linkFile hard links a file, or the files of a directory, to a new path,
+// so that both names share the bytes until either is removed.
+func linkFile(from, to string) error {
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return os.Link(from, to)
+	}
+	return filepath.WalkDir(from, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(from, path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.Mkdir(filepath.Join(to, rel), 0755)
+		}
+		return os.Link(path, filepath.Join(to, rel))
+	})
+}
+
+// copyAsset stores the content of an active asset again under a new ID,
+// linking its files instead of writing them, as an upload by actor with a
+// retention of its own.  Earlier versions stay with the asset.
+func (s *Server) copyAsset(ctx context.Context, actor, id string, opts CopyOptions) (AssetV1, *uploadError) {
+	src, ok := s.assets.get(id)
+	if !ok || src.State != stateActive {
+		return AssetV1{}, &uploadError{http.StatusConflict, "not_active", "Only active assets can be copied", nil}
+	}
+	if src.Tier == tierCold {
+		return AssetV1{}, &uploadError{http.StatusConflict, "cold", "Asset is in cold storage", nil}
+	}
+
+	dst := src
+	var err error
+	if dst.ID, err = s.generateRandomFilename(src.OriginalName, src.ContentType); err != nil {
+		return AssetV1{}, &uploadError{http.StatusInternalServerError, "internal_error",
+			fmt.Sprintf("Error generating filename: %v", err), nil}
+	}
+	deleteToken, err := randomID()
+	if err != nil {
+		return AssetV1{}, &uploadError{http.StatusInternalServerError, "storage_error", fmt.Sprintf("Error copying file: %v", err), nil}
+	}
+	dst.Uploader = actor
+	dst.DeleteTokenHash = hashToken(deleteToken)
+	dst.UploadedAt = s.now().UTC()
+	dst.StateReason, dst.StateChanged = "", dst.UploadedAt
+	dst.Reports, dst.Downloads, dst.Delivery = 0, 0, nil
+	dst.ShortCode = ""
+	dst.Version, dst.Versions, dst.ReplacedAt = 0, nil, time.Time{}
+	dst.AccessedAt = time.Time{}
+	if opts.Tags != nil {
+		dst.Tags = opts.Tags
+	}
+	dst.applyRetention(s.retentionFor(dst.ContentType, dst.Size, actor, dst.Tags))
+	if opts.TTL > 0 && (dst.ExpiresAt.IsZero() || dst.UploadedAt.Add(opts.TTL).Before(dst.ExpiresAt)) {
+		dst.ExpiresAt = dst.UploadedAt.Add(opts.TTL)
+	}
+	if limit := dst.downloadLimit(); opts.MaxDownloads > 0 && (limit == unlimitedDownloads || opts.MaxDownloads < limit) {
+		dst.MaxDownloads = opts.MaxDownloads
+	}
+
+	// The copy counts against storage and quotas as an upload would,
+	// though its files take no space of their own
+	size := dst.Size
+	for _, v := range dst.Variants {
+		size += v.Size
+	}
+	release, err := s.reserveStorage(size)
+	if err != nil {
+		s.publishEvent(eventQuotaWarning, dst.ID, actor, 0, err.Error())
+		return AssetV1{}, &uploadError{http.StatusInsufficientStorage, "storage_full", "Storage full", nil}
+	}
+	defer release()
+	releaseUser, err := s.reserveUserStorage(dst.User, dst.ID, size)
+	if err != nil {
+		s.publishEvent(eventQuotaWarning, dst.ID, actor, 0, "user:"+dst.User+": "+err.Error())
+		return AssetV1{}, &uploadError{http.StatusForbidden, "quota_exceeded", "Storage quota of this user exceeded", nil}
+	}
+	defer releaseUser()
+
+	current := src
+	current.Versions = nil
+	from, to := s.assetFiles(current, false), s.assetFiles(dst, false)
+	for i := range from {
+		if err := linkFile(from[i], to[i]); err != nil && (i == 0 || !errors.Is(err, os.ErrNotExist)) {
+			s.removeAssetFiles(dst)
+			return AssetV1{}, &uploadError{http.StatusInternalServerError, "storage_error", fmt.Sprintf("Error copying file: %v", err), nil}
+		}
+	}
+	if err := s.replicateAsset(ctx, dst); err != nil {
+		s.removeAssetFiles(dst)
+		return AssetV1{}, &uploadError{http.StatusInternalServerError, "storage_error", fmt.Sprintf("Error copying file: %v", err), nil}
+	}
+	if s.config.ShortLinks {
+		if dst.ShortCode, err = s.newShortLink(dst.ID); err != nil {
+			fmt.Printf("Error creating short link for %s: %v\n", dst.ID, err)
+		}
+	}
+	if err := s.assets.insert(dst.ID, dst); err != nil {
+		s.removeAssetFiles(dst)
+		s.removeReplicas(dst)
+		return AssetV1{}, &uploadError{http.StatusInternalServerError, "storage_error", fmt.Sprintf("Error copying file: %v", err), nil}
+	}
+
+	s.audit(ctx, actor, auditCopy, dst.ID, "copy of "+src.ID)
+	s.publishEvent(auditCopy, dst.ID, actor, dst.Size, dst.ContentType)
+	s.announceAsset(dst)
+	return s.assetV1(&dst, deleteToken), nil
+}
+
+// removeAssetFiles removes the files of an asset that has no record.
+func (s *Server) removeAssetFiles(asset Asset) {
+	s.removeThumbnails(asset)
+	s.removeVariants(asset)
+	s.removeStream(asset)
+	s.removeSidecars(asset)
+	if err := os.Remove(s.assetPath(asset.ID)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error removing %s: %v\n", asset.ID, err)
+	}
+}
+
+// copyHandler copies an asset of the key for another audience: the tags
+// parameter picks its retention, which ttl and max_downloads may tighten.
+func (s *Server) copyHandler(w http.ResponseWriter, r *http.Request) {
+	asset, ok := s.ownedAsset(w, r, "")
+	if !ok {
+		return
+	}
+	var opts CopyOptions
+	if v := r.FormValue("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_ttl", "ttl must be a positive duration")
+			return
+		}
+		opts.TTL = d
+	}
+	if v := r.FormValue("max_downloads"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_max_downloads", "max_downloads must be a positive number")
+			return
+		}
+		opts.MaxDownloads = n
+	}
+	if v, ok := r.Form["tags"]; ok {
+		tags, uerr := parseTags(v)
+		if uerr != nil {
+			s.rejectUpload(w, r, uerr)
+			return
+		}
+		opts.Tags = append([]string{}, tags...)
+	}
+
+	saved, uerr := s.copyAsset(r.Context(), requestKeyActor(r), asset.ID, opts)
+	if uerr != nil {
+		s.rejectUpload(w, r, uerr)
+		return
+	}
+	sendEnvelope(w, http.StatusCreated, s.originAsset(r, saved))
+}
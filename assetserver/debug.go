@@ -0,0 +1,101 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"time"
+)
+
+// runtimeStats is the payload of /debug/stats.
+type runtimeStats struct {
+	Uptime       string `json:"uptime"`
+	Goroutines   int    `json:"goroutines"`
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapInuse    uint64 `json:"heap_inuse"`
+	HeapSys      uint64 `json:"heap_sys"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	TotalAlloc   uint64 `json:"total_alloc"`
+	Sys          uint64 `json:"sys"`
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"pause_total_ns"`
+	OpenFDs      int    `json:"open_fds"`
+	Panics       int64  `json:"panics"`
+
+	Processing ProcessingStats `json:"processing"`
+	Multipart  MultipartStats  `json:"multipart"`
+}
+
+func (s *Server) debugStatsHandler(w http.ResponseWriter, r *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	writeJSON(w, http.StatusOK, runtimeStats{
+		Uptime:       time.Since(s.startTime).Round(time.Second).String(),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapAlloc:    m.HeapAlloc,
+		HeapInuse:    m.HeapInuse,
+		HeapSys:      m.HeapSys,
+		HeapObjects:  m.HeapObjects,
+		TotalAlloc:   m.TotalAlloc,
+		Sys:          m.Sys,
+		NumGC:        m.NumGC,
+		PauseTotalNs: m.PauseTotalNs,
+		OpenFDs:      openFDs(),
+		Panics:       s.panics.Load(),
+		Processing:   s.workers.stats(),
+		Multipart:    s.multipartTemp.stats(),
+	})
+}
+
+// openFDs returns the number of open file descriptors, or -1 where the
+// platform does not expose them through /proc.
+func openFDs() int {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	return len(entries)
+}
+
+// serveDebug runs the profiling listener.  Listeners on loopback addresses
+// are open; anything else requires the admin key.
+func (s *Server) serveDebug(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/stats", s.debugStatsHandler)
+
+	var handler http.Handler = mux
+	if !isLoopbackAddr(addr) {
+		if s.config.AdminKey == "" {
+			return fmt.Errorf("debug_listen %s is not a loopback address and admin_key is not set", addr)
+		}
+		handler = s.adminOnly(mux.ServeHTTP)
+	}
+
+	s.infof("Debug listener starting on %s...\n", addr)
+	return http.ListenAndServe(addr, handler)
+}
+
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const pdfTimeout = time.Minute
+
+func isPDF(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/pdf"
+}
+
+// pdfPageCount reads the page count pdfinfo reports for a PDF.
+func (s *Server) pdfPageCount(ctx context.Context, path string) (int, error) {
+	ctx, cancel := toolContext(ctx, pdfTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, s.config.PDFInfo, path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", s.config.PDFInfo, err)
+	}
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), "Pages:"); ok {
+			return strconv.Atoi(strings.TrimSpace(v))
+		}
+	}
+	return 0, fmt.Errorf("%s reported no page count", s.config.PDFInfo)
+}
+
+// pdfThumbnails renders the first page of a PDF large enough for the
+// biggest thumbnail and generates the thumbnails from it.
+func (s *Server) pdfThumbnails(ctx context.Context, id, path string) ([]Thumbnail, error) {
+	dir, err := os.MkdirTemp("", "preview")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := toolContext(ctx, pdfTimeout)
+	defer cancel()
+
+	// pdftoppm adds the extension to the output name.  Scaling one past the
+	// largest size makes sure even that thumbnail is generated.
+	page := filepath.Join(dir, "page")
+	scale := strconv.Itoa(slices.Max(s.config.ThumbnailSizes) + 1)
+	out, err := exec.CommandContext(ctx, s.config.PDFToPPM, "-f", "1", "-l", "1", "-singlefile",
+		"-png", "-scale-to", scale, path, page).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", s.config.PDFToPPM, err, strings.TrimSpace(string(out)))
+	}
+	return s.generateThumbnails(id, page+".png")
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// dryRunUpload reports whether an upload is a dry run, asked for with the
+// X-Dry-Run header or the dry_run field, or made one by the dry_run option.
+func (s *Server) dryRunUpload(r *http.Request) (bool, *uploadError) {
+	v := r.Header.Get("X-Dry-Run")
+	if v == "" {
+		v = r.FormValue("dry_run")
+	}
+	if v == "" {
+		return s.config.DryRun, nil
+	}
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &uploadError{http.StatusBadRequest, "invalid_form", "Invalid dry run flag", nil}
+	}
+	return dryRun || s.config.DryRun, nil
+}
+
+// dryRunPath is where a file of a dry run is kept while it is checked.
+func (s *Server) dryRunPath(name string) string {
+	return filepath.Join(s.stagingDir(), ".dry-run-"+name)
+}
+
+// contentPath is where the file of an asset is, which is the staging area
+// for dry runs.
+func (s *Server) contentPath(asset *Asset) string {
+	if asset.DryRun {
+		return s.dryRunPath(asset.ID)
+	}
+	return s.assetPath(asset.ID)
+}
+
+// checkDryRun checks a dry run upload like any other, then discards it
+// without a trace in the usage, events or audit log.  Its file and variants
+// stay in the staging area rather than upload_dir, so they are neither
+// counted against max_storage_size and user quotas nor replicated.
+func (s *Server) checkDryRun(ctx context.Context, asset Asset, staged *stagedFile, variantFiles []variantFile) (AssetV1, error) {
+	defer staged.discard()
+	err := os.Rename(staged.path, s.contentPath(&asset))
+	if err == nil {
+		staged.path = s.contentPath(&asset)
+		asset.Variants, err = s.writeVariants(&asset, variantFiles)
+	}
+	if err != nil {
+		s.removeVariants(asset)
+		s.assets.remove(asset.ID)
+		return AssetV1{}, err
+	}
+
+	saved, err := s.assets.update(asset.ID, func(a *Asset) error {
+		a.Size = staged.size
+		a.SHA256 = staged.sha256
+		a.Variants = asset.Variants
+		return nil
+	})
+	if err == nil {
+		saved, err = s.checkAsset(ctx, saved)
+	}
+	if latest, ok := s.assets.get(asset.ID); ok {
+		s.discardDryRun(latest)
+	}
+	if err != nil {
+		return AssetV1{}, err
+	}
+	return s.assetV1(&saved, ""), nil
+}
+
+// discardDryRun removes every trace of a dry run upload once it has been
+// processed and checked.
+func (s *Server) discardDryRun(asset Asset) {
+	s.removeThumbnails(asset)
+	s.removeVariants(asset)
+	s.removeStream(asset)
+	s.removeSidecars(asset)
+	if err := os.Remove(s.contentPath(&asset)); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error removing dry run %s: %v\n", asset.ID, err)
+	}
+	if err := s.assets.remove(asset.ID); err != nil {
+		fmt.Printf("Error removing dry run %s: %v\n", asset.ID, err)
+	}
+}
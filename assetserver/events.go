@@ -0,0 +1,145 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// eventBuffer is how many events a subscriber may fall behind before
+	// further events are dropped for it.
+	eventBuffer = 256
+
+	// eventKeepAlive is how often an idle stream gets a comment, so proxies
+	// don't close it.
+	eventKeepAlive = 30 * time.Second
+)
+
+// Event types besides the audited actions upload, delete and state_change.
+const (
+	eventDownload     = "download"
+	eventQuotaWarning = "quota_warning"
+)
+
+// Event is an entry of the /events stream.  IDs increase by one, so a
+// subscriber can tell it missed events by a gap.
+type Event struct {
+	ID      uint64    `json:"id"`
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	AssetID string    `json:"asset_id,omitempty"`
+	Actor   string    `json:"actor,omitempty"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// eventHub fans events out to the streams subscribed to them.  Streams
+// that don't keep up lose events rather than holding up the server.
+type eventHub struct {
+	mu   sync.Mutex
+	next uint64
+	subs map[chan Event]struct{}
+}
+
+func (h *eventHub) subscribe() chan Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = make(map[chan Event]struct{})
+	}
+	ch := make(chan Event, eventBuffer)
+	h.subs[ch] = struct{}{}
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, ch)
+}
+
+func (h *eventHub) publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.next++
+	e.ID = h.next
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// publishEvent sends an event to the subscribed streams.
+func (s *Server) publishEvent(typ, assetID, actor string, bytes int64, detail string) {
+	s.events.publish(Event{
+		Type:    typ,
+		Time:    s.now().UTC(),
+		AssetID: assetID,
+		Actor:   actor,
+		Bytes:   bytes,
+		Detail:  detail,
+	})
+}
+
+// eventsHandler streams events as server-sent events.  The types query
+// parameter limits the stream to a comma separated list of types.
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	var types map[string]bool
+	if v := r.URL.Query().Get("types"); v != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(v, ",") {
+			types[strings.TrimSpace(t)] = true
+		}
+	}
+
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+
+	// The stream outlives any write_timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		fmt.Printf("Error clearing event stream write deadline: %v\n", err)
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case e := <-ch:
+			if types != nil && !types[e.Type] {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				fmt.Printf("Error encoding event %d: %v\n", e.ID, err)
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
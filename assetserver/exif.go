@@ -0,0 +1,203 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+var exifJPEGKey = []byte("Exif\x00\x00")
+
+// stripEXIF removes the EXIF metadata from a JPEG or PNG, which can carry
+// the location a photo was taken at and the camera it was taken with.  It
+// returns nil if the file has no EXIF metadata.
+func stripEXIF(contentType string, data []byte) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg", "image/jpg", "image/pjpeg":
+		return stripJPEGEXIF(data)
+	case "image/png":
+		return stripPNGEXIF(data)
+	}
+	return nil, nil
+}
+
+// stripJPEGEXIF drops the APP1 segments holding EXIF.  The segments up to
+// the start of the scan are walked; everything from there on is copied.
+func stripJPEGEXIF(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, fmt.Errorf("not a JPEG file")
+	}
+	out := append([]byte{}, data[:2]...)
+	stripped := false
+	pos := 2
+	for {
+		if pos+2 > len(data) || data[pos] != 0xff {
+			return nil, fmt.Errorf("invalid JPEG marker at offset %d", pos)
+		}
+		marker := data[pos+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte
+			pos++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// Standalone markers have no length
+			out = append(out, data[pos:pos+2]...)
+			pos += 2
+			continue
+		case marker == 0xda || marker == 0xd9:
+			// Start of scan or end of image
+			if !stripped {
+				return nil, nil
+			}
+			return append(out, data[pos:]...), nil
+		}
+		if pos+4 > len(data) {
+			return nil, fmt.Errorf("truncated JPEG file")
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if end > len(data) {
+			return nil, fmt.Errorf("truncated JPEG file")
+		}
+		if marker == 0xe1 && bytes.HasPrefix(data[pos+4:end], exifJPEGKey) {
+			stripped = true
+		} else {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+}
+
+// stripPNGEXIF drops the eXIf chunks of a PNG.
+func stripPNGEXIF(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("not a PNG file")
+	}
+	out := append([]byte{}, pngSignature...)
+	stripped := false
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, fmt.Errorf("truncated PNG file")
+		}
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:pos+4]))
+		if end > len(data) || end < pos {
+			return nil, fmt.Errorf("truncated PNG file")
+		}
+		if string(data[pos+4:pos+8]) == "eXIf" {
+			stripped = true
+		} else {
+			out = append(out, data[pos:end]...)
+		}
+		pos = end
+	}
+	if !stripped {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// exifOrientation returns the EXIF orientation of a JPEG or PNG, 1 to 8,
+// which viewers rotate and flip it by.  It returns 0 if there is none.
+func exifOrientation(contentType string, data []byte) int {
+	switch contentType {
+	case "image/jpeg", "image/jpg", "image/pjpeg":
+		return tiffOrientation(jpegEXIF(data))
+	case "image/png":
+		return tiffOrientation(pngEXIF(data))
+	}
+	return 0
+}
+
+// jpegEXIF returns the TIFF structure of the first EXIF APP1 segment of a
+// JPEG, if any.
+func jpegEXIF(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil
+	}
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xff {
+		marker := data[pos+1]
+		switch {
+		case marker == 0xff:
+			pos++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			pos += 2
+			continue
+		case marker == 0xda || marker == 0xd9:
+			return nil
+		}
+		end := pos + 2 + int(binary.BigEndian.Uint16(data[pos+2:pos+4]))
+		if end > len(data) {
+			return nil
+		}
+		if marker == 0xe1 && bytes.HasPrefix(data[pos+4:end], exifJPEGKey) {
+			return data[pos+4+len(exifJPEGKey) : end]
+		}
+		pos = end
+	}
+	return nil
+}
+
+// pngEXIF returns the content of the eXIf chunk of a PNG, if any.
+func pngEXIF(data []byte) []byte {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil
+	}
+	pos := len(pngSignature)
+	for pos+12 <= len(data) {
+		end := pos + 12 + int(binary.BigEndian.Uint32(data[pos:pos+4]))
+		if end > len(data) || end < pos {
+			return nil
+		}
+		switch string(data[pos+4 : pos+8]) {
+		case "eXIf":
+			return data[pos+8 : end-4]
+		case "IDAT":
+			// eXIf must come before the image data
+			return nil
+		}
+		pos = end
+	}
+	return nil
+}
+
+// tiffOrientation reads the Orientation tag of the first IFD of EXIF data.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	for i := range int(order.Uint16(tiff[ifd:])) {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// Orientation is tag 0x0112, a SHORT
+		if order.Uint16(tiff[entry:]) != 0x0112 {
+			continue
+		}
+		if v := int(order.Uint16(tiff[entry+8:])); order.Uint16(tiff[entry+2:]) == 3 && v >= 1 && v <= 8 {
+			return v
+		}
+		return 0
+	}
+	return 0
+}
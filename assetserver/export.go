@@ -0,0 +1,269 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ExportOptions selects the assets of an export.  Empty fields match
+// everything; only active assets are exported.
+type ExportOptions struct {
+	// Title heads the gallery page
+	Title string
+
+	// Since and Until bound the upload time
+	Since, Until time.Time
+
+	// Metadata are top level metadata values the assets must have, such as
+	// an album or event name set by the bot
+	Metadata map[string]string
+
+	// Tags the assets must all have
+	Tags []string
+}
+
+// ExportDir writes the assets opts selects to a directory as a static
+// gallery and returns how many it wrote.
+func (s *Server) ExportDir(ctx context.Context, opts ExportOptions, dir string) (int, error) {
+	return s.export(ctx, opts.filter(), opts.Title, dirSink(dir))
+}
+
+// ExportTarGz writes the assets opts selects to w as a gzipped tarball of
+// a static gallery and returns how many it wrote.
+func (s *Server) ExportTarGz(ctx context.Context, opts ExportOptions, w io.Writer) (int, error) {
+	return s.exportTarGz(ctx, opts.filter(), opts.Title, w)
+}
+
+func (o ExportOptions) filter() assetFilter {
+	return assetFilter{Since: o.Since, Until: o.Until, Metadata: o.Metadata, Tags: o.Tags}
+}
+
+// exportSink receives the files of an export.
+type exportSink interface {
+	add(name string, modTime time.Time, size int64, r io.Reader) error
+}
+
+// dirSink writes an export to a directory.
+type dirSink string
+
+func (d dirSink) add(name string, modTime time.Time, size int64, r io.Reader) error {
+	path := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(path, modTime, modTime)
+}
+
+// tarSink writes an export to a tarball.
+type tarSink struct {
+	tw *tar.Writer
+}
+
+func (t tarSink) add(name string, modTime time.Time, size int64, r io.Reader) error {
+	if err := t.tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	}); err != nil {
+		return err
+	}
+	_, err := io.Copy(t.tw, r)
+	return err
+}
+
+func (s *Server) exportTarGz(ctx context.Context, f assetFilter, title string, w io.Writer) (int, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	n, err := s.export(ctx, f, title, tarSink{tw})
+	if err != nil {
+		return n, err
+	}
+	if err := tw.Close(); err != nil {
+		return n, err
+	}
+	return n, gz.Close()
+}
+
+// exportedAsset is an entry of an export's gallery.
+type exportedAsset struct {
+	Asset
+	File string
+}
+
+func (e exportedAsset) Kind() string {
+	kind, _, _ := strings.Cut(e.ContentType, "/")
+	return kind
+}
+
+// exportGallery is the index.html of an export.
+var exportGallery = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; background: #fafafa; }
+.grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(240px, 1fr)); gap: 1em; }
+figure { margin: 0; padding: 0.5em; background: #fff; border: 1px solid #ddd; }
+figure img, figure video { width: 100%; height: auto; }
+figcaption { font-size: 0.85em; color: #444; overflow-wrap: anywhere; }
+dl { margin: 0.5em 0 0; } dt { font-weight: bold; } dd { margin: 0 0 0.25em; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{len .Assets}} assets, exported {{.Exported.Format "2006-01-02 15:04 MST"}}</p>
+<div class="grid">
+{{range .Assets}}<figure>
+{{if eq .Kind "image"}}<a href="{{.File}}"><img src="{{.File}}" alt="{{.OriginalName}}" loading="lazy"></a>
+{{else if eq .Kind "video"}}<video src="{{.File}}" controls preload="metadata"></video>
+{{else if eq .Kind "audio"}}<audio src="{{.File}}" controls preload="none"></audio>
+{{end}}<figcaption><a href="{{.File}}">{{or .OriginalName .ID}}</a><br>{{.UploadedAt.Format "2006-01-02 15:04"}}, {{.Size}} bytes
+{{if .Metadata}}<dl>{{range $k, $v := .Metadata}}<dt>{{$k}}</dt><dd>{{$v}}</dd>{{end}}</dl>{{end}}</figcaption>
+</figure>
+{{end}}</div>
+</body>
+</html>
+`))
+
+// export writes the active assets a filter selects, oldest first, to
+// files/, their records to assets.json and a gallery of them to
+// index.html.  Blind uploads are left out, since the server can't show
+// them, as are assets whose file can't be had.
+func (s *Server) export(ctx context.Context, f assetFilter, title string, sink exportSink) (int, error) {
+	f.State = stateActive
+	var selected []Asset
+	for _, asset := range s.assets.list() {
+		if f.match(&asset) && !asset.Blind {
+			selected = append(selected, asset)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].UploadedAt.Before(selected[j].UploadedAt)
+	})
+	if f.Limit > 0 && len(selected) > f.Limit {
+		selected = selected[:f.Limit]
+	}
+
+	var exported []exportedAsset
+	for _, asset := range selected {
+		if err := ctx.Err(); err != nil {
+			return len(exported), err
+		}
+		file, err := s.openExportFile(ctx, asset)
+		if err != nil {
+			s.infof("Leaving %s out of the export: %v\n", asset.ID, err)
+			continue
+		}
+		err = sink.add("files/"+asset.ID, asset.UploadedAt, asset.Size, file)
+		file.Close()
+		if err != nil {
+			return len(exported), fmt.Errorf("error exporting %s: %v", asset.ID, err)
+		}
+		exported = append(exported, exportedAsset{asset, "files/" + asset.ID})
+	}
+
+	now := s.now()
+	records := make([]Asset, 0, len(exported))
+	for _, e := range exported {
+		records = append(records, e.Asset)
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return len(exported), err
+	}
+	if err := sink.add("assets.json", now, int64(len(data)), bytes.NewReader(data)); err != nil {
+		return len(exported), err
+	}
+
+	if title == "" {
+		title = "Assets"
+	}
+	var page bytes.Buffer
+	err = exportGallery.Execute(&page, struct {
+		Title    string
+		Exported time.Time
+		Assets   []exportedAsset
+	}{title, now, exported})
+	if err != nil {
+		return len(exported), err
+	}
+	if err := sink.add("index.html", now, int64(page.Len()), &page); err != nil {
+		return len(exported), err
+	}
+	return len(exported), nil
+}
+
+// openExportFile opens the content of an asset's file, fetching it back
+// from cold storage or a replica if needed.
+func (s *Server) openExportFile(ctx context.Context, asset Asset) (io.ReadCloser, error) {
+	if asset.Tier == tierCold {
+		if err := s.warmAsset(ctx, asset.ID); err != nil {
+			return nil, err
+		}
+	}
+	file, err := openContent(s.assetPath(asset.ID), asset.Encoding)
+	if errors.Is(err, os.ErrNotExist) && s.restoreReplica(ctx, asset, asset.ID, s.assetPath(asset.ID)) == nil {
+		file, err = openContent(s.assetPath(asset.ID), asset.Encoding)
+	}
+	return file, err
+}
+
+// adminExportHandler sends the assets selected like for the admin search
+// as a gzipped tarball of a static gallery, titled by the title parameter.
+func (s *Server) adminExportHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f, msg := parseAssetFilter(q)
+	if msg != "" {
+		writeJSON(w, http.StatusBadRequest, Response{Message: msg})
+		return
+	}
+	if q.Get("limit") == "" {
+		f.Limit = 0
+	}
+
+	// The tarball outlives any write_timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		fmt.Printf("Error clearing export write deadline: %v\n", err)
+	}
+	name := "assets-" + s.now().UTC().Format("20060102-150405") + ".tar.gz"
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	n, err := s.exportTarGz(r.Context(), f, q.Get("title"), w)
+	if err != nil {
+		// Too late for an error status; the truncated tarball shows it
+		fmt.Printf("Error exporting assets: %v\n", err)
+		return
+	}
+	s.audit(r.Context(), "admin", auditExport, name, fmt.Sprintf("%d assets", n))
+}
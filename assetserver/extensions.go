@@ -0,0 +1,59 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"mime"
+	"path/filepath"
+	"strings"
+)
+
+// mimeExtensions is the canonical extension stored files of each known type
+// get, whatever extension the client sent.
+var mimeExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/jpg":       ".jpg",
+	"image/pjpeg":     ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"image/avif":      ".avif",
+	"image/svg+xml":   ".svg",
+	"audio/mpeg":      ".mp3",
+	"audio/ogg":       ".ogg",
+	"audio/wav":       ".wav",
+	"audio/x-wav":     ".wav",
+	"audio/webm":      ".weba",
+	"audio/aac":       ".aac",
+	"audio/mp4":       ".m4a",
+	"audio/flac":      ".flac",
+	"video/mp4":       ".mp4",
+	"video/webm":      ".webm",
+	"application/pdf": ".pdf",
+	"text/plain":      ".txt",
+	"text/markdown":   ".md",
+}
+
+// storedExtension picks the extension for a stored file.  Known types get
+// their canonical extension.  For anything else the client's extension is
+// only kept if it is in allowed_extensions, so names like x.html or x.php
+// can't be smuggled in under a permissive type such as
+// application/octet-stream.
+func (s *Server) storedExtension(originalFilename, contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		if ext, ok := mimeExtensions[mediaType]; ok {
+			return ext
+		}
+	}
+
+	ext := strings.ToLower(filepath.Ext(originalFilename))
+	for _, allowed := range s.config.AllowedExtensions {
+		if ext != "" && ext == strings.ToLower(allowed) {
+			return ext
+		}
+	}
+	return ""
+}
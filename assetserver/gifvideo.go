@@ -0,0 +1,188 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gifVideoFormats are the ffmpeg arguments converting a GIF to each video
+// format, and the type of the result.  The videos have no sound and are
+// meant to be played looped and muted in place of the GIF.
+var gifVideoFormats = map[string]struct {
+	contentType string
+	args        []string
+}{
+	"mp4": {"video/mp4", []string{"-nostdin", "-y", "-loglevel", "error", "-i", "{in}",
+		"-movflags", "+faststart", "-pix_fmt", "yuv420p", "-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2",
+		"-c:v", "libx264", "-crf", "23", "-an", "{out}"}},
+	"webm": {"video/webm", []string{"-nostdin", "-y", "-loglevel", "error", "-i", "{in}",
+		"-c:v", "libvpx-vp9", "-b:v", "0", "-crf", "35", "-an", "{out}"}},
+}
+
+func (s *Server) validateGIFVideoConfig() error {
+	for _, format := range s.config.ConvertGIFs {
+		if _, ok := gifVideoFormats[format]; !ok {
+			return fmt.Errorf("convert_gifs formats must be mp4 or webm, not %q", format)
+		}
+	}
+	if s.config.ConvertGIFMinSize == 0 {
+		s.config.ConvertGIFMinSize = 512 * 1024
+	}
+	if s.config.FFmpeg == "" {
+		s.config.FFmpeg = "ffmpeg"
+	}
+	return nil
+}
+
+// convertGIF renders a large animated GIF upload in each configured video
+// format.  Only videos smaller than the GIF are returned; the GIF itself
+// stays the asset's file.
+func (s *Server) convertGIF(ctx context.Context, asset *Asset, data []byte) []variantFile {
+	if len(s.config.ConvertGIFs) == 0 || int64(len(data)) < s.config.ConvertGIFMinSize || !animatedGIF(data) {
+		return nil
+	}
+
+	var variants []variantFile
+	for _, format := range s.config.ConvertGIFs {
+		f := gifVideoFormats[format]
+		out, err := s.runEncoder(ctx, append([]string{s.config.FFmpeg}, f.args...), data, ".gif", "."+format)
+		if err != nil {
+			fmt.Printf("Error converting %s to %s: %v\n", asset.OriginalName, format, err)
+			continue
+		}
+		if len(out) >= len(data) {
+			continue
+		}
+		s.infof("Converted %s from %d bytes to %d bytes of %s\n", asset.OriginalName, len(data), len(out), format)
+		variants = append(variants, variantFile{name: format, contentType: f.contentType, data: out})
+	}
+	return variants
+}
+
+// animatedGIF reports whether a GIF has more than one frame.  It walks the
+// block structure instead of decoding, so large GIFs cost no memory.
+func animatedGIF(data []byte) bool {
+	r := bufio.NewReader(bytes.NewReader(data))
+	header := make([]byte, 13)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.HasPrefix(header, []byte("GIF")) {
+		return false
+	}
+	if header[10]&0x80 != 0 {
+		if _, err := r.Discard(3 << (header[10]&7 + 1)); err != nil {
+			return false
+		}
+	}
+
+	frames := 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return false
+		}
+		switch b {
+		case 0x21: // Extension: label, then data sub-blocks
+			if _, err := r.ReadByte(); err != nil {
+				return false
+			}
+		case 0x2c: // Image: descriptor, color table, LZW code size, data
+			frames++
+			if frames > 1 {
+				return true
+			}
+			desc := make([]byte, 9)
+			if _, err := io.ReadFull(r, desc); err != nil {
+				return false
+			}
+			if desc[8]&0x80 != 0 {
+				if _, err := r.Discard(3 << (desc[8]&7 + 1)); err != nil {
+					return false
+				}
+			}
+			if _, err := r.ReadByte(); err != nil {
+				return false
+			}
+		default: // Trailer or garbage
+			return false
+		}
+		if !skipSubBlocks(r) {
+			return false
+		}
+	}
+}
+
+func skipSubBlocks(r *bufio.Reader) bool {
+	for {
+		n, err := r.ReadByte()
+		if err != nil {
+			return false
+		}
+		if n == 0 {
+			return true
+		}
+		if _, err := r.Discard(int(n)); err != nil {
+			return false
+		}
+	}
+}
+
+// negotiateVariant picks the video variant to serve at an asset's download
+// URL if the client explicitly accepts its type at least as much as the
+// asset's own.  Wildcards don't count, so browsers following a link still
+// get the file as uploaded.  An empty name means the asset's own file.
+func negotiateVariant(r *http.Request, asset Asset) string {
+	if !asset.hasVideoVariants() {
+		return ""
+	}
+	best, bestQ, ownQ := "", 0.0, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || strings.HasSuffix(mediaType, "/*") {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		if mediaType == strings.ToLower(asset.ContentType) {
+			ownQ = q
+		}
+		for _, v := range asset.Variants {
+			if v.ContentType == mediaType && strings.HasPrefix(mediaType, "video/") && q > bestQ {
+				best, bestQ = v.Name, q
+			}
+		}
+	}
+	if bestQ == 0 || bestQ < ownQ {
+		return ""
+	}
+	return best
+}
+
+// hasVideoVariants reports whether the download URL of an asset depends on
+// the Accept header.
+func (a *Asset) hasVideoVariants() bool {
+	for _, v := range a.Variants {
+		if strings.HasPrefix(v.ContentType, "video/") {
+			return true
+		}
+	}
+	return false
+}
+
+// assetFormat names an asset's own file among its variants, e.g. "gif".
+func (s *Server) assetFormat(a *Asset) string {
+	return strings.TrimPrefix(s.storedExtension("", a.ContentType), ".")
+}
@@ -0,0 +1,337 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+
+	pb "github.com/karamble/braibot-assetserver/proto/assetserver/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultListPageSize = 100
+	maxListPageSize     = 1000
+)
+
+// GRPCServer returns a gRPC server offering the AssetService, for programs
+// embedding the server to serve on a listener of their own.  ListenAndServe
+// serves it on grpc_port.  Panics in its methods are recovered and
+// reported as Internal errors.
+func (s *Server) GRPCServer(opts ...grpc.ServerOption) *grpc.Server {
+	opts = append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(s.grpcRecovery),
+		grpc.ChainStreamInterceptor(s.grpcStreamRecovery),
+	}, opts...)
+	gs := grpc.NewServer(opts...)
+	pb.RegisterAssetServiceServer(gs, grpcService{s: s})
+	return gs
+}
+
+// serveGRPC serves the gRPC API on grpc_port.
+func (s *Server) serveGRPC() error {
+	lis, err := net.Listen("tcp", s.config.GRPCPort)
+	if err != nil {
+		return err
+	}
+	return s.GRPCServer().Serve(lis)
+}
+
+// grpcService implements the AssetService on top of the same operations
+// as the HTTP API.
+type grpcService struct {
+	pb.UnimplementedAssetServiceServer
+	s *Server
+}
+
+// grpcActor checks the API key in a call's x-api-key metadata and returns
+// the actor to record in the audit log.
+func (s *Server) grpcActor(ctx context.Context, method string) (string, error) {
+	var key string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("x-api-key"); len(v) > 0 {
+			key = v[0]
+		}
+	}
+	client := grpcClient(ctx)
+	if s.authLockedOut(client) > 0 {
+		return "", grpcError(&uploadError{http.StatusTooManyRequests, "locked_out", "Too many failed authentication attempts", nil})
+	}
+	if !s.validAPIKey(key) {
+		s.audit(ctx, client, auditKeyUse, method, "rejected")
+		if key != "" {
+			s.authFailed(ctx, client, method)
+		}
+		return "", grpcError(&uploadError{http.StatusUnauthorized, "unauthorized", "Invalid API key", nil})
+	}
+	s.audit(ctx, keyActor(key), auditKeyUse, method, "accepted")
+	s.authSucceeded(client)
+	return keyActor(key), nil
+}
+
+// grpcClient identifies the peer of a call in the audit log.
+func grpcClient(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return "ip:" + host
+		}
+	}
+	return "ip:unknown"
+}
+
+// grpcError turns a failure as reported by the HTTP API into a gRPC
+// status, keeping its code as the reason of an ErrorInfo and its details
+// as the metadata.
+func grpcError(uerr *uploadError) error {
+	code := codes.Internal
+	switch uerr.status {
+	case http.StatusBadRequest, http.StatusUnsupportedMediaType:
+		code = codes.InvalidArgument
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusRequestTimeout:
+		code = codes.DeadlineExceeded
+	case http.StatusConflict, http.StatusGone, http.StatusUnprocessableEntity:
+		code = codes.FailedPrecondition
+	case http.StatusRequestEntityTooLarge, http.StatusTooManyRequests, http.StatusInsufficientStorage:
+		code = codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+	st, err := status.New(code, uerr.message).WithDetails(&errdetails.ErrorInfo{
+		Reason:   uerr.code,
+		Domain:   "braibot-assetserver",
+		Metadata: uerr.details.metadata(),
+	})
+	if err != nil {
+		return status.Error(code, uerr.message)
+	}
+	return st.Err()
+}
+
+// Upload reads the file's info from the first message of the stream and
+// pipes the chunks of the following ones into the upload.
+func (g grpcService) Upload(stream grpc.ClientStreamingServer[pb.UploadRequest, pb.Asset]) error {
+	ctx := stream.Context()
+	actor, err := g.s.grpcActor(ctx, "/braibot.assetserver.v1.AssetService/Upload")
+	if err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	info := first.GetInfo()
+	if info == nil {
+		return grpcError(&uploadError{http.StatusBadRequest, "missing_info", "The first message must carry the file info", nil})
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err == io.EOF {
+				pw.Close()
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			chunk, ok := req.GetPayload().(*pb.UploadRequest_Chunk)
+			if !ok {
+				pw.CloseWithError(errors.New("file info sent twice"))
+				return
+			}
+			if _, err := pw.Write(chunk.Chunk); err != nil {
+				return
+			}
+		}
+	}()
+
+	saved, uerr := g.s.putFile(ctx, actor, File{
+		Name:        info.GetFilename(),
+		ContentType: info.GetContentType(),
+		Metadata:    info.GetMetadataJson(),
+		Password:    info.GetPassword(),
+		Recipients:  info.GetRecipients(),
+		Tags:        info.GetTags(),
+		Data:        pr,
+	})
+	if uerr != nil {
+		return grpcError(uerr)
+	}
+	return stream.SendAndClose(assetProto(saved))
+}
+
+func (g grpcService) GetInfo(ctx context.Context, req *pb.GetInfoRequest) (*pb.Asset, error) {
+	if _, err := g.s.grpcActor(ctx, "/braibot.assetserver.v1.AssetService/GetInfo"); err != nil {
+		return nil, err
+	}
+	asset, ok := g.s.assets.get(req.GetId())
+	if !ok {
+		return nil, grpcError(&uploadError{http.StatusNotFound, "not_found", "Asset not found", nil})
+	}
+	return assetProto(g.s.assetV1(&asset, "")), nil
+}
+
+func (g grpcService) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if _, err := g.s.grpcActor(ctx, "/braibot.assetserver.v1.AssetService/Delete"); err != nil {
+		return nil, err
+	}
+	if uerr := g.s.deleteWithToken(ctx, req.GetId(), req.GetDeleteToken(), grpcClient(ctx)); uerr != nil {
+		return nil, grpcError(uerr)
+	}
+	return &pb.DeleteResponse{Id: req.GetId()}, nil
+}
+
+// List pages through the caller's assets, newest first.  The page token is
+// the ID of the last asset of the previous page.
+func (g grpcService) List(ctx context.Context, req *pb.ListRequest) (*pb.ListResponse, error) {
+	actor, err := g.s.grpcActor(ctx, "/braibot.assetserver.v1.AssetService/List")
+	if err != nil {
+		return nil, err
+	}
+	size := int(req.GetPageSize())
+	if size <= 0 {
+		size = defaultListPageSize
+	}
+	size = min(size, maxListPageSize)
+
+	var assets []Asset
+	for _, asset := range g.s.assets.list() {
+		if asset.Uploader != actor || (req.GetState() != "" && string(asset.State) != req.GetState()) {
+			continue
+		}
+		assets = append(assets, asset)
+	}
+	sort.Slice(assets, func(i, j int) bool {
+		if !assets[i].UploadedAt.Equal(assets[j].UploadedAt) {
+			return assets[i].UploadedAt.After(assets[j].UploadedAt)
+		}
+		return assets[i].ID < assets[j].ID
+	})
+	if token := req.GetPageToken(); token != "" {
+		i := indexOfAsset(assets, token)
+		if i < 0 {
+			return nil, grpcError(&uploadError{http.StatusBadRequest, "invalid_page_token", "Invalid page token", nil})
+		}
+		assets = assets[i+1:]
+	}
+
+	resp := &pb.ListResponse{}
+	for i := range assets {
+		if len(resp.Assets) == size {
+			resp.NextPageToken = assets[i-1].ID
+			break
+		}
+		resp.Assets = append(resp.Assets, assetProto(g.s.assetV1(&assets[i], "")))
+	}
+	return resp, nil
+}
+
+func indexOfAsset(assets []Asset, id string) int {
+	for i := range assets {
+		if assets[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// assetProto converts an asset object to its protobuf form.
+func assetProto(v AssetV1) *pb.Asset {
+	a := &pb.Asset{
+		Id:                v.ID,
+		Url:               v.URL,
+		DeleteToken:       v.DeleteToken,
+		DeleteUrl:         v.DeleteURL,
+		Downloads:         int32(v.Downloads),
+		Size:              v.Size,
+		Sha256:            v.SHA256,
+		ContentType:       v.ContentType,
+		State:             string(v.State),
+		Blind:             v.Blind,
+		DryRun:            v.DryRun,
+		PasswordProtected: v.Password,
+		ShortUrl:          v.ShortURL,
+		QrUrl:             v.QRURL,
+		Pages:             int32(v.Pages),
+		Width:             int32(v.Width),
+		Height:            int32(v.Height),
+		Orientation:       int32(v.Orientation),
+		Color:             v.Color,
+		Blurhash:          v.Blurhash,
+		Placeholder:       v.Placeholder,
+		Nsfw:              v.NSFW,
+		NsfwScore:         v.NSFWScore,
+		Recipients:        v.Recipients,
+		Tags:              v.Tags,
+		Srcset:            v.Srcset,
+		StreamUrl:         v.StreamURL,
+		Transcript:        v.Transcript,
+	}
+	if v.ExpiresAt != nil {
+		a.ExpiresAt = timestamppb.New(*v.ExpiresAt)
+	}
+	if v.MaxDownloads != nil {
+		n := int32(*v.MaxDownloads)
+		a.MaxDownloads = &n
+	}
+	for _, t := range v.Thumbnails {
+		a.Thumbnails = append(a.Thumbnails, &pb.Thumbnail{Url: t.URL, Width: int32(t.Width), Height: int32(t.Height)})
+	}
+	for _, variant := range v.Variants {
+		a.Variants = append(a.Variants, &pb.Variant{
+			Name:        variant.Name,
+			Url:         variant.URL,
+			ContentType: variant.ContentType,
+			Size:        variant.Size,
+			Width:       int32(variant.Width),
+			Height:      int32(variant.Height),
+		})
+	}
+	if v.Audio != nil {
+		a.Audio = &pb.AudioInfo{
+			Duration:   v.Audio.Duration,
+			SampleRate: int32(v.Audio.SampleRate),
+			Channels:   int32(v.Audio.Channels),
+		}
+	}
+	for _, m := range v.Mirrors {
+		a.Mirrors = append(a.Mirrors, &pb.Mirror{Origin: m.Origin, Url: m.URL})
+	}
+	for _, sc := range v.Sidecars {
+		a.Sidecars = append(a.Sidecars, &pb.Sidecar{
+			Name:        sc.Name,
+			Url:         sc.URL,
+			ContentType: sc.ContentType,
+			Size:        sc.Size,
+		})
+	}
+	if len(v.Metadata) > 0 {
+		if meta, err := json.Marshal(v.Metadata); err == nil {
+			a.MetadataJson = string(meta)
+		}
+	}
+	return a
+}
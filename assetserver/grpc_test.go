@@ -0,0 +1,111 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	pb "github.com/karamble/braibot-assetserver/proto/assetserver/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newGRPCClient connects to the test server's gRPC API over an in-memory
+// listener.
+func newGRPCClient(t *testing.T, s *testServer) pb.AssetServiceClient {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := s.srv.GRPCServer()
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewAssetServiceClient(conn)
+}
+
+// errorReason returns the ErrorInfo reason of a gRPC error.
+func errorReason(err error) string {
+	for _, d := range status.Convert(err).Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+func TestGRPC(t *testing.T) {
+	s := newTestServer(t, nil)
+	client := newGRPCClient(t, s)
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-api-key", testAPIKey)
+
+	if _, err := client.GetInfo(context.Background(), &pb.GetInfoRequest{Id: "x"}); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("call without key: %v, want Unauthenticated", err)
+	}
+
+	stream, err := client.Upload(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	msgs := []*pb.UploadRequest{
+		{Payload: &pb.UploadRequest_Info{Info: &pb.UploadInfo{
+			Filename:     "image.png",
+			ContentType:  "image/png",
+			MetadataJson: `{"prompt":"a cat"}`,
+		}}},
+		{Payload: &pb.UploadRequest_Chunk{Chunk: data[:5]}},
+		{Payload: &pb.UploadRequest_Chunk{Chunk: data[5:]}},
+	}
+	for _, m := range msgs {
+		if err := stream.Send(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	asset, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if asset.Size != int64(len(data)) || asset.DeleteToken == "" || asset.MetadataJson != `{"prompt":"a cat"}` {
+		t.Fatalf("uploaded asset %+v", asset)
+	}
+
+	info, err := client.GetInfo(ctx, &pb.GetInfoRequest{Id: asset.Id})
+	if err != nil || info.Sha256 != asset.Sha256 || info.DeleteToken != "" {
+		t.Fatalf("info %+v, %v", info, err)
+	}
+	list, err := client.List(ctx, &pb.ListRequest{})
+	if err != nil || len(list.Assets) != 1 || list.Assets[0].Id != asset.Id {
+		t.Fatalf("list %+v, %v", list, err)
+	}
+
+	_, err = client.Delete(ctx, &pb.DeleteRequest{Id: asset.Id, DeleteToken: "wrong"})
+	if status.Code(err) != codes.PermissionDenied || errorReason(err) != "invalid_token" {
+		t.Fatalf("delete with wrong token: %v, want PermissionDenied invalid_token", err)
+	}
+	if _, err := client.Delete(ctx, &pb.DeleteRequest{Id: asset.Id, DeleteToken: asset.DeleteToken}); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	resp := s.Get(asset.Url)
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("download after delete: %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	hlsTimeout  = 30 * time.Minute
+	hlsPlaylist = "index.m3u8"
+
+	// hlsAudio names the rendition of audio files
+	hlsAudio = "audio"
+)
+
+// hlsSegmentName matches the segment files packaging writes.
+var hlsSegmentName = regexp.MustCompile(`^[0-9]{3,}\.ts$`)
+
+// Rendition is one of the streams an asset is packaged in for HLS.
+type Rendition struct {
+	Name      string `json:"name"`
+	Width     int    `json:"width,omitempty"`
+	Height    int    `json:"height,omitempty"`
+	Bandwidth int    `json:"bandwidth"`
+}
+
+func (s *Server) validateHLSConfig() error {
+	if !s.config.HLS {
+		return nil
+	}
+	if len(s.config.HLSHeights) == 0 {
+		s.config.HLSHeights = []int{360, 720, 1080}
+	}
+	for _, height := range s.config.HLSHeights {
+		if height <= 0 || height%2 != 0 {
+			return fmt.Errorf("hls_heights must be positive and even")
+		}
+	}
+	slices.Sort(s.config.HLSHeights)
+	s.config.HLSHeights = slices.Compact(s.config.HLSHeights)
+	if s.config.HLSSegmentDuration < 0 || s.config.HLSMinAudioDuration < 0 {
+		return fmt.Errorf("hls durations cannot be negative")
+	}
+	if s.config.HLSSegmentDuration == 0 {
+		s.config.HLSSegmentDuration = Duration(6 * time.Second)
+	}
+	if s.config.HLSMinAudioDuration == 0 {
+		s.config.HLSMinAudioDuration = Duration(10 * time.Minute)
+	}
+	return nil
+}
+
+func (s *Server) hlsDir() string {
+	return filepath.Join(s.config.UploadDir, ".hls")
+}
+
+func (s *Server) streamURL(id string) string {
+	return fmt.Sprintf("https://%s/stream/%s/%s", s.config.Domain, id, hlsPlaylist)
+}
+
+// packageHLS packages a video in each of hls_heights up to its own height,
+// or an audio file of at least hls_min_audio_duration in a single audio
+// rendition, in upload_dir/.hls.  It returns no renditions for files that
+// aren't worth streaming.
+func (s *Server) packageHLS(ctx context.Context, asset Asset) ([]Rendition, error) {
+	ctx, cancel := toolContext(ctx, hlsTimeout)
+	defer cancel()
+
+	path := s.contentPath(&asset)
+	info, err := s.probeMedia(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	var renditions []Rendition
+	switch {
+	case info.Height > 0:
+		for _, height := range s.config.HLSHeights {
+			if height <= info.Height {
+				renditions = append(renditions, Rendition{Name: fmt.Sprintf("%dp", height), Height: height})
+			}
+		}
+		if len(renditions) == 0 {
+			height := info.Height &^ 1
+			renditions = append(renditions, Rendition{Name: fmt.Sprintf("%dp", height), Height: height})
+		}
+		for i := range renditions {
+			r := &renditions[i]
+			r.Width = int(math.Round(float64(info.Width)*float64(r.Height)/float64(info.Height)/2)) * 2
+		}
+	case info.Duration >= time.Duration(s.config.HLSMinAudioDuration):
+		renditions = append(renditions, Rendition{Name: hlsAudio})
+	default:
+		return nil, nil
+	}
+
+	// Package into a temporary directory so a stream is never served half
+	// written
+	dir := filepath.Join(s.hlsDir(), asset.ID)
+	tmp := dir + ".tmp"
+	os.RemoveAll(tmp)
+	defer os.RemoveAll(tmp)
+	segment := strconv.FormatFloat(time.Duration(s.config.HLSSegmentDuration).Seconds(), 'f', -1, 64)
+	for i := range renditions {
+		r := &renditions[i]
+		out := filepath.Join(tmp, r.Name)
+		if err := os.MkdirAll(out, 0755); err != nil {
+			return nil, err
+		}
+		args := []string{"-nostdin", "-y", "-loglevel", "error", "-i", path}
+		if r.Name == hlsAudio {
+			args = append(args, "-map", "0:a:0", "-vn")
+		} else {
+			args = append(args, "-map", "0:v:0", "-map", "0:a:0?",
+				"-vf", fmt.Sprintf("scale=%d:%d", r.Width, r.Height), "-pix_fmt", "yuv420p",
+				"-c:v", "libx264", "-preset", "veryfast", "-crf", "23")
+		}
+		args = append(args, "-c:a", "aac", "-b:a", "128k",
+			"-f", "hls", "-hls_time", segment, "-hls_playlist_type", "vod",
+			"-hls_segment_filename", filepath.Join(out, "%03d.ts"), filepath.Join(out, hlsPlaylist))
+		if output, err := exec.CommandContext(ctx, s.config.FFmpeg, args...).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("%s: %v: %s", s.config.FFmpeg, err, strings.TrimSpace(string(output)))
+		}
+		if r.Bandwidth, err = hlsBandwidth(out); err != nil {
+			return nil, fmt.Errorf("rendition %s: %v", r.Name, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmp, hlsPlaylist), masterPlaylist(renditions), 0644); err != nil {
+		return nil, err
+	}
+	os.RemoveAll(dir)
+	if err := os.Rename(tmp, dir); err != nil {
+		return nil, err
+	}
+	return renditions, nil
+}
+
+// hlsBandwidth returns the peak bit rate of the segments of a rendition's
+// playlist, which is what the BANDWIDTH attribute of a stream advertises.
+func hlsBandwidth(dir string) (int, error) {
+	f, err := os.Open(filepath.Join(dir, hlsPlaylist))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var peak float64
+	var duration float64
+	segments := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if v, ok := strings.CutPrefix(line, "#EXTINF:"); ok {
+			v, _, _ = strings.Cut(v, ",")
+			duration, _ = strconv.ParseFloat(v, 64)
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !hlsSegmentName.MatchString(line) {
+			return 0, fmt.Errorf("unexpected segment %q", line)
+		}
+		fi, err := os.Stat(filepath.Join(dir, line))
+		if err != nil {
+			return 0, err
+		}
+		if duration > 0 {
+			peak = max(peak, float64(fi.Size())*8/duration)
+		}
+		segments++
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	if segments == 0 {
+		return 0, fmt.Errorf("no segments")
+	}
+	return int(math.Ceil(peak)), nil
+}
+
+// masterPlaylist lists the renditions of a stream for players to pick from.
+func masterPlaylist(renditions []Rendition) []byte {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+	for _, r := range renditions {
+		fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d", r.Bandwidth)
+		if r.Height > 0 {
+			fmt.Fprintf(&b, ",RESOLUTION=%dx%d", r.Width, r.Height)
+		}
+		fmt.Fprintf(&b, "\n%s/%s\n", r.Name, hlsPlaylist)
+	}
+	return []byte(b.String())
+}
+
+func (s *Server) removeStream(asset Asset) {
+	if len(asset.Renditions) == 0 {
+		return
+	}
+	path := filepath.Join(s.hlsDir(), asset.ID)
+	if err := os.RemoveAll(path); err != nil {
+		fmt.Printf("Error removing stream %s: %v\n", path, err)
+	}
+}
+
+// streamable reports whether an asset may be streamed: like its
+// thumbnails, a stream can be fetched any number of times, so only assets
+// anyone with the link may download without limit are.
+func (a *Asset) streamable() bool {
+	return a.downloadLimit() == unlimitedDownloads && a.PasswordHash == "" && len(a.Recipients) == 0
+}
+
+// streamHandler serves the playlists and segments of an asset's stream.
+// Fetching them doesn't count as a download.
+func (s *Server) streamHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	asset, ok := s.assets.get(id)
+	if !validAssetID(id) || !ok || len(asset.Renditions) == 0 {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+	switch {
+	case asset.State == stateQuarantined:
+		s.httpError(w, r, "File unavailable for legal reasons", http.StatusUnavailableForLegalReasons)
+		return
+	case asset.State == stateDeleted, asset.expired(s.now()):
+		s.httpError(w, r, "File deleted", http.StatusGone)
+		return
+	case asset.State != stateActive, !asset.streamable():
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+	if !s.hotlinkAllowed(r, id) {
+		s.httpError(w, r, "Hotlinking not allowed", http.StatusForbidden)
+		return
+	}
+
+	// Only the playlists and segments packaging wrote are served
+	name := r.PathValue("path")
+	rendition, file, nested := strings.Cut(name, "/")
+	switch {
+	case name == hlsPlaylist:
+	case nested && slices.ContainsFunc(asset.Renditions, func(rd Rendition) bool { return rd.Name == rendition }) &&
+		(file == hlsPlaylist || hlsSegmentName.MatchString(file)):
+	default:
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+
+	if strings.HasSuffix(name, ".ts") {
+		w.Header().Set("Content-Type", "video/mp2t")
+	} else {
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	}
+	w.Header().Set("Cache-Control", s.cacheControl(&asset, s.now()))
+	http.ServeFile(w, r, filepath.Join(s.hlsDir(), id, filepath.FromSlash(name)))
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultEmbedTTL = 24 * time.Hour
+	maxEmbedTTL     = 30 * 24 * time.Hour
+)
+
+// hotlinkProtected reports whether downloads are checked for hotlinking.
+func (s *Server) hotlinkProtected() bool {
+	return len(s.config.HotlinkAllowedReferers) > 0 || s.config.HotlinkSigningKey != "" ||
+		s.config.HotlinkRequireReferer
+}
+
+// hotlinkAllowed reports whether a request for an asset's file may be
+// served: it comes from this server's own pages or an allowed referer, or
+// carries a valid embed token.  Requests without a Referer, such as API
+// clients and direct visits, are allowed unless hotlink_require_referer is
+// set.
+func (s *Server) hotlinkAllowed(r *http.Request, assetID string) bool {
+	if !s.hotlinkProtected() {
+		return true
+	}
+	if ref := r.Header.Get("Referer"); ref != "" {
+		if u, err := url.Parse(ref); err == nil && s.refererAllowed(u.Hostname()) {
+			return true
+		}
+	} else if !s.config.HotlinkRequireReferer {
+		return true
+	}
+	return s.validEmbedToken(r, assetID)
+}
+
+// refererAllowed matches a referring host against the configured hosts,
+// which may start with *. to allow all subdomains.
+func (s *Server) refererAllowed(host string) bool {
+	host = strings.ToLower(host)
+	if own, _, _ := strings.Cut(s.config.Domain, ":"); host == strings.ToLower(own) {
+		return true
+	}
+	for _, pattern := range s.config.HotlinkAllowedReferers {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) embedSignature(id string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.config.HotlinkSigningKey))
+	fmt.Fprintf(mac, "embed\n%s\n%d", id, expires)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *Server) validEmbedToken(r *http.Request, assetID string) bool {
+	if s.config.HotlinkSigningKey == "" {
+		return false
+	}
+	q := r.URL.Query()
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil || s.now().Unix() >= expires {
+		return false
+	}
+	return hmac.Equal([]byte(q.Get("sig")), []byte(s.embedSignature(assetID, expires)))
+}
+
+// embedHandler returns a signed download URL that may be embedded in
+// third-party pages despite hotlink protection.  The same query
+// parameters also unlock the asset's thumbnails.
+func (s *Server) embedHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+	if s.config.HotlinkSigningKey == "" {
+		s.sendEnvelopeError(w, r, http.StatusNotFound, "embed_disabled", "Embed links are not enabled")
+		return
+	}
+
+	id := r.PathValue("id")
+	asset, ok := s.assets.get(id)
+	if !ok || asset.State != stateActive {
+		s.sendEnvelopeError(w, r, http.StatusNotFound, "not_found", "Asset not found")
+		return
+	}
+
+	ttl := defaultEmbedTTL
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxEmbedTTL {
+			s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_ttl", "ttl must be a duration of up to 720h")
+			return
+		}
+		ttl = d
+	}
+
+	expires := s.now().Add(ttl).Truncate(time.Second).UTC()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	q.Set("sig", s.embedSignature(id, expires.Unix()))
+	sendEnvelope(w, http.StatusOK, map[string]any{
+		"url":        s.downloadURL(id) + "?" + q.Encode(),
+		"query":      q.Encode(),
+		"expires_at": expires,
+	})
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	idempotencyTTL       = 24 * time.Hour
+	maxIdempotencyKeyLen = 128
+)
+
+// idempotencyCache remembers upload responses by Idempotency-Key so a client
+// retrying after a lost response gets the original asset, including its
+// deletion token, instead of creating a duplicate.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	entries map[string]idempotentResponse
+}
+
+type idempotentResponse struct {
+	asset   AssetV1
+	created time.Time
+}
+
+// idempotencyKey returns the cache key for a request, scoped to the caller's
+// API key, or "" if the request carries no usable Idempotency-Key.
+func idempotencyKey(r *http.Request) string {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" || len(key) > maxIdempotencyKeyLen {
+		return ""
+	}
+	return uploadActor(r) + "/" + key
+}
+
+func (c *idempotencyCache) get(key string) (AssetV1, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || time.Since(e.created) > idempotencyTTL {
+		return AssetV1{}, false
+	}
+	return e.asset, true
+}
+
+func (c *idempotencyCache) put(key string, asset AssetV1) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, e := range c.entries {
+		if now.Sub(e.created) > idempotencyTTL {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = idempotentResponse{asset: asset, created: now}
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"math"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+const (
+	// blurhashX and blurhashY are the components of blurhashes across and
+	// down: enough for a placeholder, few enough to keep them short.
+	blurhashX = 4
+	blurhashY = 3
+
+	// blurhashSize is the side images are scaled down to before hashing,
+	// which loses nothing so few components can show
+	blurhashSize = 32
+
+	// placeholderSize is the longest side of placeholder previews and
+	// placeholderQuality their JPEG quality: they are shown blurred, so
+	// about half a kilobyte is plenty.
+	placeholderSize    = 16
+	placeholderQuality = 50
+)
+
+const base83Digits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// imageInfo sets the dimensions, EXIF orientation, average color, blurhash
+// and placeholder preview of an image asset from its data.
+func imageInfo(asset *Asset, data []byte) error {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error reading image header: %v", err)
+	}
+	asset.Width, asset.Height = cfg.Width, cfg.Height
+	asset.Orientation = exifOrientation(asset.ContentType, data)
+	if cfg.Width*cfg.Height > maxThumbnailSourcePixels {
+		return fmt.Errorf("image too large to hash: %dx%d", cfg.Width, cfg.Height)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error decoding image: %v", err)
+	}
+
+	b := src.Bounds()
+	small := image.NewNRGBA(image.Rect(0, 0, min(b.Dx(), blurhashSize), min(b.Dy(), blurhashSize)))
+	draw.ApproxBiLinear.Scale(small, small.Bounds(), src, b, draw.Src, nil)
+	hash, avg := blurhash(small)
+	asset.Blurhash, asset.Color = hash, fmt.Sprintf("#%02x%02x%02x", avg.R, avg.G, avg.B)
+	asset.Placeholder, err = placeholder(src, avg)
+	return err
+}
+
+// placeholder returns a tiny JPEG of an image as a data URI, for clients
+// that can't decode blurhashes to blur while the image loads.  Transparent
+// parts are filled with the image's average color.
+func placeholder(src image.Image, background color.RGBA) (string, error) {
+	b := src.Bounds()
+	w, h := placeholderSize, max(1, b.Dy()*placeholderSize/b.Dx())
+	if b.Dy() > b.Dx() {
+		w, h = max(1, b.Dx()*placeholderSize/b.Dy()), placeholderSize
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, b, draw.Over, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: placeholderQuality}); err != nil {
+		return "", err
+	}
+	return "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// blurhash returns the blurhash of an image, see https://blurha.sh, and its
+// average color, which is what the hash encodes first.
+func blurhash(img *image.NRGBA) (string, color.RGBA) {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	var factors [blurhashX * blurhashY][3]float64
+	for j := range blurhashY {
+		for i := range blurhashX {
+			f := &factors[j*blurhashX+i]
+			for y := range h {
+				for x := range w {
+					basis := math.Cos(math.Pi*float64(i*x)/float64(w)) * math.Cos(math.Pi*float64(j*y)/float64(h))
+					c := img.NRGBAAt(x, y)
+					f[0] += basis * srgbToLinear(c.R)
+					f[1] += basis * srgbToLinear(c.G)
+					f[2] += basis * srgbToLinear(c.B)
+				}
+			}
+			scale := 2 / float64(w*h)
+			if i == 0 && j == 0 {
+				scale = 1 / float64(w*h)
+			}
+			for k := range f {
+				f[k] *= scale
+			}
+		}
+	}
+
+	var b strings.Builder
+	base83(&b, (blurhashX-1)+(blurhashY-1)*9, 1)
+	var peak float64
+	for _, f := range factors[1:] {
+		peak = max(peak, math.Abs(f[0]), math.Abs(f[1]), math.Abs(f[2]))
+	}
+	quantized := max(0, min(82, int(math.Floor(peak*166-0.5))))
+	base83(&b, quantized, 1)
+	scale := float64(quantized+1) / 166
+
+	dc := factors[0]
+	r, g, bl := linearToSRGB(dc[0]), linearToSRGB(dc[1]), linearToSRGB(dc[2])
+	base83(&b, r<<16|g<<8|bl, 4)
+	for _, f := range factors[1:] {
+		q := func(v float64) int {
+			return max(0, min(18, int(math.Floor(signedSqrt(v/scale)*9+9.5))))
+		}
+		base83(&b, q(f[0])*19*19+q(f[1])*19+q(f[2]), 2)
+	}
+	return b.String(), color.RGBA{uint8(r), uint8(g), uint8(bl), 0xff}
+}
+
+func base83(b *strings.Builder, value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		b.WriteByte(base83Digits[value/int(math.Pow(83, float64(i)))%83])
+	}
+}
+
+func srgbToLinear(v uint8) float64 {
+	f := float64(v) / 255
+	if f <= 0.04045 {
+		return f / 12.92
+	}
+	return math.Pow((f+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) int {
+	v = max(0, min(1, v))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signedSqrt(v float64) float64 {
+	return math.Copysign(math.Sqrt(math.Abs(v)), v)
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// inboxActor is who files ingested from inbox_dir are uploaded by
+	inboxActor = "inbox"
+
+	// inboxMetaSuffix marks the metadata of the file of the same name
+	// without it
+	inboxMetaSuffix = ".meta.json"
+
+	// inboxRejectedDir is the directory in inbox_dir files that weren't
+	// stored are moved to
+	inboxRejectedDir = "rejected"
+)
+
+func (s *Server) validateInboxConfig() error {
+	if s.config.InboxDir == "" {
+		return nil
+	}
+	inbox, err := filepath.Abs(s.config.InboxDir)
+	if err != nil {
+		return fmt.Errorf("invalid inbox_dir: %v", err)
+	}
+	if uploads, err := filepath.Abs(s.config.UploadDir); err == nil && inbox == uploads {
+		return fmt.Errorf("inbox_dir cannot be upload_dir")
+	}
+	if s.config.InboxInterval < 0 {
+		return fmt.Errorf("inbox_interval cannot be negative")
+	}
+	if s.config.InboxInterval == 0 {
+		s.config.InboxInterval = Duration(5 * time.Second)
+	}
+	return nil
+}
+
+// inboxFile is what a scan of inbox_dir saw of a file.
+type inboxFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// watchInbox scans inbox_dir every inbox_interval until ctx is done.
+func (s *Server) watchInbox(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(s.config.InboxInterval))
+	defer ticker.Stop()
+	seen := make(map[string]inboxFile)
+	for {
+		// Files wait in the inbox while uploads are refused
+		if s.readOnly() == nil {
+			seen = s.scanInbox(ctx, seen)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// scanInbox ingests the files of inbox_dir that haven't changed since the
+// previous scan, which saw the files in seen, and returns what this scan
+// saw.  Files still being written are left for a later scan, and hidden
+// files are ignored, so writers can also create a file under a dot name
+// and rename it once complete.
+func (s *Server) scanInbox(ctx context.Context, seen map[string]inboxFile) map[string]inboxFile {
+	entries, err := os.ReadDir(s.config.InboxDir)
+	if err != nil {
+		fmt.Printf("Error reading inbox: %v\n", err)
+		return seen
+	}
+	now := make(map[string]inboxFile)
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, inboxMetaSuffix) {
+			continue
+		}
+		fi, err := e.Info()
+		if err != nil {
+			continue
+		}
+		f := inboxFile{fi.Size(), fi.ModTime()}
+		if prev, ok := seen[name]; !ok || prev != f {
+			now[name] = f
+			continue
+		}
+		s.ingestInboxFile(ctx, name)
+	}
+	return now
+}
+
+// ingestInboxFile stores a file of inbox_dir, with the JSON object of its
+// .meta.json file as metadata if there is one, and removes both.  Files
+// that aren't stored are moved to the rejected directory instead, so they
+// aren't tried again.
+func (s *Server) ingestInboxFile(ctx context.Context, name string) {
+	path := filepath.Join(s.config.InboxDir, name)
+	metaPath := path + inboxMetaSuffix
+	meta, err := os.ReadFile(metaPath)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error reading inbox metadata of %s: %v\n", name, err)
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		fmt.Printf("Error opening inbox file %s: %v\n", name, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.config.UploadTimeout))
+	saved, uerr := s.putFile(ctx, inboxActor, File{Name: name, Metadata: string(meta), Data: f})
+	cancel()
+	f.Close()
+	if uerr != nil {
+		s.infof("Rejected inbox file %s: %s\n", name, uerr.message)
+		s.rejectInboxFile(name)
+		s.rejectInboxFile(name + inboxMetaSuffix)
+		return
+	}
+	s.infof("Stored inbox file %s as %s\n", name, saved.ID)
+	if err := os.Remove(path); err != nil {
+		fmt.Printf("Error removing inbox file %s: %v\n", name, err)
+	}
+	os.Remove(metaPath)
+	s.sendUploaded(saved, inboxActor)
+}
+
+// rejectInboxFile moves a file of inbox_dir to its rejected directory.
+func (s *Server) rejectInboxFile(name string) {
+	err := os.Rename(filepath.Join(s.config.InboxDir, name), filepath.Join(s.config.InboxDir, inboxRejectedDir, name))
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Error moving rejected inbox file %s: %v\n", name, err)
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultRotationOverlap is how long a rotated key keeps working next
+	// to its replacement.
+	defaultRotationOverlap = 24 * time.Hour
+
+	// keyUseResolution is how stale a key's last use may be before it is
+	// written again, so busy keys don't rewrite the store on every request.
+	keyUseResolution = time.Minute
+)
+
+// APIKey is an API key managed through the admin API, next to the api_key
+// of the configuration.  Only a hash of the key is kept.  Its ID is the one
+// naming the key in the audit log and usage reports, as key:<id>.
+type APIKey struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name,omitempty"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// ExpiresAt ends the validity of a key, such as one being rotated out
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+
+	// ReplacedBy is the ID of the key this one was rotated to
+	ReplacedBy string `json:"replaced_by,omitempty"`
+}
+
+// valid reports whether a key is accepted at a time.
+func (k *APIKey) valid(now time.Time) bool {
+	return k.DisabledAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// validAPIKey reports whether a key is the configured api_key or a valid
+// managed key, noting when a managed key was last used.
+func (s *Server) validAPIKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	if subtle.ConstantTimeCompare([]byte(key), []byte(s.config.APIKey)) == 1 {
+		return true
+	}
+	hash := hashAPIKey(key)
+	id := strings.TrimPrefix(keyActor(key), "key:")
+	k, ok := s.apiKeys.get(id)
+	if !ok || subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hash)) != 1 {
+		return false
+	}
+	now := s.now()
+	if !k.valid(now) {
+		return false
+	}
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= keyUseResolution {
+		_, err := s.apiKeys.update(id, func(k *APIKey) error {
+			used := now.UTC()
+			k.LastUsedAt = &used
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Error recording use of key %s: %v\n", id, err)
+		}
+	}
+	return true
+}
+
+// createAPIKey generates a managed key and returns it with its record.  The
+// key itself is not stored and can't be had again.
+func (s *Server) createAPIKey(name string, expiresAt *time.Time) (string, APIKey, error) {
+	for {
+		b := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return "", APIKey{}, err
+		}
+		key := base64.RawURLEncoding.EncodeToString(b)
+		k := APIKey{
+			ID:        strings.TrimPrefix(keyActor(key), "key:"),
+			Name:      name,
+			Hash:      hashAPIKey(key),
+			CreatedAt: s.now().UTC(),
+			ExpiresAt: expiresAt,
+		}
+		// IDs are short enough to collide now and then, as do those of
+		// the configured api_key
+		if k.ID == strings.TrimPrefix(keyActor(s.config.APIKey), "key:") {
+			continue
+		}
+		err := s.apiKeys.insert(k.ID, k)
+		if errors.Is(err, errRecordExists) {
+			continue
+		}
+		return key, k, err
+	}
+}
+
+// newAPIKey is the response to creating or rotating a key, the only one
+// carrying the key itself.
+type newAPIKey struct {
+	Key string `json:"key"`
+	APIKey
+}
+
+func (s *Server) adminListKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys := s.apiKeys.list()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// adminCreateKeyHandler creates a key named by the name member of the
+// body, valid until expires_at if that is set.
+func (s *Server) adminCreateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name      string     `json:"name"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.bodyLimit(r, maxRequestSize))).Decode(&req); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid request body"})
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(s.now()) {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "expires_at must be in the future"})
+		return
+	}
+	key, k, err := s.createAPIKey(req.Name, req.ExpiresAt)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Message: err.Error()})
+		return
+	}
+	s.audit(r.Context(), "admin", auditKeyChange, "key:"+k.ID, "created")
+	writeJSON(w, http.StatusCreated, newAPIKey{key, k})
+}
+
+func (s *Server) adminDisableKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	k, err := s.apiKeys.update(id, func(k *APIKey) error {
+		if k.DisabledAt == nil {
+			now := s.now().UTC()
+			k.DisabledAt = &now
+		}
+		return nil
+	})
+	if errors.Is(err, errRecordNotFound) {
+		writeJSON(w, http.StatusNotFound, Response{Message: "Key not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Message: err.Error()})
+		return
+	}
+	s.audit(r.Context(), "admin", auditKeyChange, "key:"+id, "disabled")
+	writeJSON(w, http.StatusOK, k)
+}
+
+// adminRotateKeyHandler replaces a key with a new one of the same name.
+// The old key keeps working for the overlap of the body, 24h by default,
+// so bots can switch over without downtime.
+func (s *Server) adminRotateKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Overlap *Duration `json:"overlap"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.bodyLimit(r, maxRequestSize))).Decode(&req); err != nil && err != io.EOF {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid request body"})
+		return
+	}
+	overlap := defaultRotationOverlap
+	if req.Overlap != nil {
+		overlap = time.Duration(*req.Overlap)
+	}
+	if overlap < 0 {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "overlap cannot be negative"})
+		return
+	}
+
+	id := r.PathValue("id")
+	old, ok := s.apiKeys.get(id)
+	if !ok {
+		writeJSON(w, http.StatusNotFound, Response{Message: "Key not found"})
+		return
+	}
+	now := s.now()
+	if !old.valid(now) || old.ReplacedBy != "" {
+		writeJSON(w, http.StatusConflict, Response{Message: "Key is disabled, expired or already rotated"})
+		return
+	}
+	key, k, err := s.createAPIKey(old.Name, nil)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Message: err.Error()})
+		return
+	}
+	_, err = s.apiKeys.update(id, func(old *APIKey) error {
+		expires := now.Add(overlap).UTC()
+		if old.ExpiresAt == nil || expires.Before(*old.ExpiresAt) {
+			old.ExpiresAt = &expires
+		}
+		old.ReplacedBy = k.ID
+		return nil
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Message: err.Error()})
+		return
+	}
+	s.audit(r.Context(), "admin", auditKeyChange, "key:"+id, "rotated to key:"+k.ID+", overlap "+overlap.String())
+	writeJSON(w, http.StatusCreated, newAPIKey{key, k})
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// legacyUploader is recorded as the uploader of files stored before files
+// had records.
+const legacyUploader = "legacy"
+
+// adoptLegacyFiles records the files in upload_dir that have no record,
+// left by versions that served any file there once and then deleted it.
+// They become active assets under the retention that applies to them, by
+// default a single download as before, and are swept like any other.
+func (s *Server) adoptLegacyFiles() error {
+	entries, err := os.ReadDir(s.config.UploadDir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !validAssetID(e.Name()) {
+			continue
+		}
+		if _, ok := s.assets.get(e.Name()); ok {
+			continue
+		}
+		asset, err := s.legacyAsset(e.Name())
+		if err != nil {
+			return fmt.Errorf("error adopting %s: %v", e.Name(), err)
+		}
+		if err := s.assets.insert(asset.ID, asset); err != nil && !errors.Is(err, errRecordExists) {
+			return err
+		}
+		s.infof("Adopted %s, stored before files had records\n", asset.ID)
+	}
+	return nil
+}
+
+// legacyAsset builds the record of a file stored before files had
+// records.  Its type comes from its extension, or else its content.
+func (s *Server) legacyAsset(id string) (Asset, error) {
+	f, err := os.Open(s.assetPath(id))
+	if err != nil {
+		return Asset{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return Asset{}, err
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Asset{}, err
+	}
+	h := sha256.New()
+	h.Write(head[:n])
+	if _, err := io.Copy(h, f); err != nil {
+		return Asset{}, err
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(id))
+	if contentType == "" {
+		contentType = http.DetectContentType(head[:n])
+	}
+	asset := Asset{
+		ID:           id,
+		OriginalName: id,
+		ContentType:  contentType,
+		Size:         fi.Size(),
+		SHA256:       hex.EncodeToString(h.Sum(nil)),
+		UploadedAt:   fi.ModTime().UTC(),
+		State:        stateActive,
+		StateChanged: s.now().UTC(),
+		Uploader:     legacyUploader,
+	}
+	asset.applyRetention(s.retentionFor(asset.ContentType, asset.Size, asset.Uploader, nil))
+	return asset, nil
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	// defaultMaxHeaderBytes is far below net/http's megabyte; no client
+	// of the server sends more than a few kilobytes of headers.
+	defaultMaxHeaderBytes = 64 << 10
+
+	// maxRequestSize is the default limit on the bodies of requests other
+	// than uploads, which are small JSON documents.
+	maxRequestSize = 64 << 10
+)
+
+func (s *Server) validateLimitsConfig() error {
+	if s.config.MaxHeaderBytes < 0 {
+		return fmt.Errorf("max_header_bytes cannot be negative")
+	}
+	if s.config.MaxHeaderBytes == 0 {
+		s.config.MaxHeaderBytes = defaultMaxHeaderBytes
+	}
+	for prefix, limit := range s.config.BodyLimits {
+		if !strings.HasPrefix(prefix, "/") {
+			return fmt.Errorf("body_limits: %q is not a path", prefix)
+		}
+		if limit <= 0 {
+			return fmt.Errorf("body_limits: limit of %s must be positive", prefix)
+		}
+	}
+	return nil
+}
+
+// bodyLimit returns the limit on the body of a request: that of the
+// longest prefix of its path in body_limits, or def, the endpoint's own.
+func (s *Server) bodyLimit(r *http.Request, def int64) int64 {
+	limit, longest := def, -1
+	for prefix, l := range s.config.BodyLimits {
+		if len(prefix) > longest && strings.HasPrefix(r.URL.Path, prefix) {
+			limit, longest = l, len(prefix)
+		}
+	}
+	return limit
+}
+
+// withBodyLimits applies body_limits to every request it covers, including
+// those of endpoints without a limit of their own.
+func (s *Server) withBodyLimits(h http.Handler) http.Handler {
+	if len(s.config.BodyLimits) == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limit := s.bodyLimit(r, -1); limit > 0 && r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
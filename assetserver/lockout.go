@@ -0,0 +1,146 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxAuthLockout caps the doubling of lockouts in a row, and is how long a
+// client must stay out of trouble for its next lockout to start over.
+const maxAuthLockout = 24 * time.Hour
+
+// authFailures are the recent authentication failures of a client.
+type authFailures struct {
+	count    int
+	first    time.Time
+	last     time.Time
+	lockouts int
+	until    time.Time
+}
+
+// authGuard tracks authentication failures per client, as named in the
+// audit log, to lock out those guessing keys.
+type authGuard struct {
+	mu      sync.Mutex
+	clients map[string]*authFailures
+}
+
+func (s *Server) validateLockoutConfig() error {
+	if s.config.AuthMaxFailures == 0 {
+		s.config.AuthMaxFailures = 10
+	}
+	if s.config.AuthFailureWindow <= 0 {
+		s.config.AuthFailureWindow = Duration(10 * time.Minute)
+	}
+	if s.config.AuthLockout <= 0 {
+		s.config.AuthLockout = Duration(15 * time.Minute)
+	}
+	if time.Duration(s.config.AuthLockout) > maxAuthLockout {
+		return fmt.Errorf("auth_lockout cannot be longer than %v", maxAuthLockout)
+	}
+	return nil
+}
+
+// authLockedOut returns how long a client remains locked out, or 0.
+func (s *Server) authLockedOut(client string) time.Duration {
+	g := &s.authGuard
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	f, ok := g.clients[client]
+	if !ok {
+		return 0
+	}
+	return max(f.until.Sub(s.now()), 0)
+}
+
+// authFailed counts a failed authentication of a client against target.
+// Reaching auth_max_failures within auth_failure_window locks the client
+// out for auth_lockout, doubled for every lockout in a row, and alerts
+// the operator through the log, the audit log and webhook_url.
+func (s *Server) authFailed(ctx context.Context, client, target string) {
+	if s.config.AuthMaxFailures < 0 {
+		return
+	}
+	now := s.now()
+	g := &s.authGuard
+	g.mu.Lock()
+	if g.clients == nil {
+		g.clients = make(map[string]*authFailures)
+	}
+	f, ok := g.clients[client]
+	if !ok {
+		for c, old := range g.clients {
+			if now.Sub(old.last) > maxAuthLockout && now.After(old.until) {
+				delete(g.clients, c)
+			}
+		}
+		f = &authFailures{}
+		g.clients[client] = f
+	}
+	if now.Sub(f.last) > maxAuthLockout {
+		f.lockouts = 0
+	}
+	if f.count == 0 || now.Sub(f.first) > time.Duration(s.config.AuthFailureWindow) {
+		f.count, f.first = 0, now
+	}
+	f.count++
+	f.last = now
+	if f.count < s.config.AuthMaxFailures {
+		g.mu.Unlock()
+		return
+	}
+	failures := f.count
+	lockout := time.Duration(s.config.AuthLockout) << min(f.lockouts, 16)
+	lockout = min(lockout, maxAuthLockout)
+	f.lockouts++
+	f.count = 0
+	f.until = now.Add(lockout)
+	g.mu.Unlock()
+
+	detail := fmt.Sprintf("%d failures, locked out for %v", failures, lockout)
+	s.infof("Locking out %s after authentication failures on %s: %s\n", client, target, detail)
+	s.audit(ctx, client, auditLockout, target, detail)
+	s.sendWebhook(WebhookEvent{
+		Event:  "auth.lockout",
+		Client: client,
+		Detail: detail,
+	})
+}
+
+// authSucceeded forgets the failures of a client that authenticated.
+func (s *Server) authSucceeded(client string) {
+	g := &s.authGuard
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if f, ok := g.clients[client]; ok && !s.now().Before(f.until) {
+		f.count = 0
+	}
+}
+
+// withAuthLockout refuses requests carrying credentials from locked out
+// clients with 429, without looking at the credentials.  Requests without
+// any, such as downloads, are still served.
+func (s *Server) withAuthLockout(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _, basic := r.BasicAuth()
+		if r.Header.Get("X-API-Key") == "" && r.Header.Get("X-Admin-Key") == "" && !basic &&
+			bearerToken(r) == "" && r.Header.Get("X-Upload-Ticket") == "" && r.URL.Query().Get("ticket") == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if wait := s.authLockedOut("ip:" + s.clientIP(r)); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+			s.httpError(w, r, "Too many failed authentication attempts", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,182 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Log levels, from the most verbose.  Errors are always logged.
+const (
+	logDebug int32 = iota
+	logInfo
+	logError
+)
+
+var logLevelNames = []string{"debug", "info", "error"}
+
+// dumpBodyLimit is how much of a request body is dumped for the keys in
+// dump_bodies.
+const dumpBodyLimit = 64 << 10
+
+// logSettings are the logging options that can be changed at runtime
+// through /admin/logging.
+type logSettings struct {
+	level atomic.Int32
+	mime  atomic.Bool
+
+	// dumpKeys are the IDs of the API keys whose request bodies are dumped
+	mu       sync.Mutex
+	dumpKeys map[string]bool
+}
+
+// LoggingV1 is the payload of /admin/logging.
+type LoggingV1 struct {
+	Level         string   `json:"level"`
+	MIMEDetection bool     `json:"mime_detection"`
+	DumpBodies    []string `json:"dump_bodies"`
+}
+
+func (s *Server) validateLoggingConfig() error {
+	if s.config.LogLevel == "" {
+		s.config.LogLevel = "info"
+	}
+	level := slices.Index(logLevelNames, s.config.LogLevel)
+	if level < 0 {
+		return fmt.Errorf("log_level must be debug, info or error")
+	}
+	s.logs.level.Store(int32(level))
+	s.logs.mime.Store(s.config.LogMIME)
+	return nil
+}
+
+// debugf logs the details of requests, such as the uploads received.
+func (s *Server) debugf(format string, args ...any) {
+	if s.logs.level.Load() <= logDebug {
+		fmt.Printf(format, args...)
+	}
+}
+
+// infof logs what the server does, such as the assets it stores.
+func (s *Server) infof(format string, args ...any) {
+	if s.logs.level.Load() <= logInfo {
+		fmt.Printf(format, args...)
+	}
+}
+
+// mimef logs how the content types of uploads are detected and checked,
+// if log_mime is set.
+func (s *Server) mimef(format string, args ...any) {
+	if s.logs.mime.Load() {
+		fmt.Printf(format, args...)
+	}
+}
+
+// withBodyDump logs the start of the bodies of requests made with the API
+// keys in dump_bodies.  The request goes on reading the whole body.
+func (s *Server) withBodyDump(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("X-API-Key")
+		if key == "" || r.Body == nil || !s.dumpingBodies(strings.TrimPrefix(keyActor(key), "key:")) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		head, err := io.ReadAll(io.LimitReader(r.Body, dumpBodyLimit))
+		s.infof("Request %s %s %s by %s, Content-Type=%s, Content-Length=%d, body: %q\n",
+			requestID(r.Context()), r.Method, r.URL.Path, keyActor(key),
+			r.Header.Get("Content-Type"), r.ContentLength, head)
+		if err != nil {
+			fmt.Printf("Error dumping body of %s: %v\n", requestID(r.Context()), err)
+		}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) dumpingBodies(keyID string) bool {
+	s.logs.mu.Lock()
+	defer s.logs.mu.Unlock()
+	return s.logs.dumpKeys[keyID]
+}
+
+func (s *Server) logging() LoggingV1 {
+	s.logs.mu.Lock()
+	defer s.logs.mu.Unlock()
+	v := LoggingV1{
+		Level:         logLevelNames[s.logs.level.Load()],
+		MIMEDetection: s.logs.mime.Load(),
+		DumpBodies:    []string{},
+	}
+	for id := range s.logs.dumpKeys {
+		v.DumpBodies = append(v.DumpBodies, id)
+	}
+	slices.Sort(v.DumpBodies)
+	return v
+}
+
+func (s *Server) adminLoggingHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.logging())
+}
+
+// adminUpdateLoggingHandler changes the logging options given, until the
+// next restart.  dump_bodies lists every key to dump the bodies of, by
+// its ID, and an empty list stops dumping.
+func (s *Server) adminUpdateLoggingHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Level         *string   `json:"level"`
+		MIMEDetection *bool     `json:"mime_detection"`
+		DumpBodies    *[]string `json:"dump_bodies"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.bodyLimit(r, maxRequestSize))).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid request body"})
+		return
+	}
+	level := -1
+	if req.Level != nil {
+		if level = slices.Index(logLevelNames, *req.Level); level < 0 {
+			writeJSON(w, http.StatusBadRequest, Response{Message: "level must be debug, info or error"})
+			return
+		}
+	}
+	var dumpKeys map[string]bool
+	if req.DumpBodies != nil {
+		dumpKeys = make(map[string]bool)
+		for _, id := range *req.DumpBodies {
+			id = strings.TrimPrefix(id, "key:")
+			if _, ok := s.apiKeys.get(id); !ok && "key:"+id != keyActor(s.config.APIKey) {
+				writeJSON(w, http.StatusBadRequest, Response{Message: "Unknown key " + id})
+				return
+			}
+			dumpKeys[id] = true
+		}
+	}
+
+	if level >= 0 {
+		s.logs.level.Store(int32(level))
+	}
+	if req.MIMEDetection != nil {
+		s.logs.mime.Store(*req.MIMEDetection)
+	}
+	if dumpKeys != nil {
+		s.logs.mu.Lock()
+		s.logs.dumpKeys = dumpKeys
+		s.logs.mu.Unlock()
+	}
+
+	v := s.logging()
+	s.audit(r.Context(), "admin", auditLogging, "", fmt.Sprintf("level %s, mime_detection %t, dump_bodies %v", v.Level, v.MIMEDetection, v.DumpBodies))
+	writeJSON(w, http.StatusOK, v)
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultReadOnlyMessage is what uploads are refused with in maintenance
+// unless read_only_message says otherwise.
+const defaultReadOnlyMessage = "The server is in maintenance and not accepting uploads, try again later"
+
+// maintenanceMode is whether the server refuses uploads, which operators
+// turn on to drain it before migrations or disk maintenance.
+type maintenanceMode struct {
+	mu      sync.Mutex
+	enabled bool
+	message string
+	since   time.Time
+}
+
+// MaintenanceV1 is the payload of /admin/maintenance.
+type MaintenanceV1 struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message"`
+	Since   *time.Time `json:"since"`
+}
+
+func (s *Server) validateMaintenanceConfig() error {
+	if s.config.ReadOnlyMessage == "" {
+		s.config.ReadOnlyMessage = defaultReadOnlyMessage
+	}
+	s.maintenance.mu.Lock()
+	defer s.maintenance.mu.Unlock()
+	s.maintenance.enabled = s.config.ReadOnly
+	s.maintenance.message = s.config.ReadOnlyMessage
+	if s.maintenance.enabled {
+		s.maintenance.since = s.now().UTC()
+	}
+	return nil
+}
+
+func (s *Server) maintenanceV1() MaintenanceV1 {
+	s.maintenance.mu.Lock()
+	defer s.maintenance.mu.Unlock()
+	v := MaintenanceV1{Enabled: s.maintenance.enabled, Message: s.maintenance.message}
+	if v.Enabled {
+		since := s.maintenance.since
+		v.Since = &since
+	}
+	return v
+}
+
+// readOnly returns the error uploads are refused with while the server is
+// in maintenance, or nil.
+func (s *Server) readOnly() *uploadError {
+	s.maintenance.mu.Lock()
+	defer s.maintenance.mu.Unlock()
+	if !s.maintenance.enabled {
+		return nil
+	}
+	return &uploadError{http.StatusServiceUnavailable, "maintenance", s.maintenance.message, nil}
+}
+
+// storesFiles reports whether a request would store files: uploads, and
+// copies of assets and sidecars.
+func storesFiles(r *http.Request) bool {
+	if isUpload(r) {
+		return true
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/api/v1/assets/")
+	if !ok {
+		return false
+	}
+	_, name, _ := strings.Cut(rest, "/")
+	return (r.Method == http.MethodPost && name == "copy") ||
+		(r.Method == http.MethodPut && strings.HasPrefix(name, "sidecars/"))
+}
+
+// withMaintenance refuses requests storing files while the server is in
+// maintenance.  Everything else, downloads included, is served as usual.
+func (s *Server) withMaintenance(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if storesFiles(r) {
+			// Requests are not routed yet, so the API they came in on
+			// is told by the path
+			if uerr := s.readOnly(); uerr != nil && strings.HasPrefix(r.URL.Path, "/api/v1/") {
+				sendAPIError(w, uerr.status, s.uploadAPIError(r, uerr))
+				return
+			} else if uerr != nil {
+				s.rejectUpload(w, r, uerr)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) adminMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.maintenanceV1())
+}
+
+// adminSetMaintenanceHandler turns maintenance on or off until the next
+// restart, optionally with the message uploads are refused with.  An empty
+// message restores read_only_message.
+func (s *Server) adminSetMaintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Enabled *bool   `json:"enabled"`
+		Message *string `json:"message"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.bodyLimit(r, maxRequestSize))).Decode(&req); err != nil || req.Enabled == nil {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid request body"})
+		return
+	}
+
+	s.maintenance.mu.Lock()
+	if *req.Enabled && !s.maintenance.enabled {
+		s.maintenance.since = s.now().UTC()
+	}
+	s.maintenance.enabled = *req.Enabled
+	if req.Message != nil {
+		s.maintenance.message = strings.TrimSpace(*req.Message)
+		if s.maintenance.message == "" {
+			s.maintenance.message = s.config.ReadOnlyMessage
+		}
+	}
+	s.maintenance.mu.Unlock()
+
+	v := s.maintenanceV1()
+	s.audit(r.Context(), "admin", auditMaintenance, "", fmt.Sprintf("enabled %t, message %q", v.Enabled, v.Message))
+	writeJSON(w, http.StatusOK, v)
+}
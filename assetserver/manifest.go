@@ -0,0 +1,280 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+const manifestVersion = 1
+
+// maxManifestSize bounds manifests accepted for import.
+const maxManifestSize = 64 << 20
+
+// SignedManifest is the exported form of a manifest.  The signature covers
+// the exact bytes of Manifest, so it can be verified without re-encoding.
+type SignedManifest struct {
+	Manifest  json.RawMessage `json:"manifest"`
+	Key       string          `json:"key"`
+	Signature string          `json:"signature"`
+}
+
+// Manifest lists every asset record of a server along with the checksums
+// of their files.
+type Manifest struct {
+	Version   int       `json:"version"`
+	Origin    string    `json:"origin"`
+	CreatedAt time.Time `json:"created_at"`
+	Assets    []Asset   `json:"assets"`
+}
+
+// manifestKey loads the server's manifest signing key, creating it on
+// first use.
+func (s *Server) manifestKey() (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(s.config.ManifestKey)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(s.config.ManifestKey, data, 0600); err != nil {
+			return nil, fmt.Errorf("error writing manifest key: %v", err)
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest key: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("manifest key %s is not PEM encoded", s.config.ManifestKey)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing manifest key: %v", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("manifest key %s is not an Ed25519 key", s.config.ManifestKey)
+	}
+	return key, nil
+}
+
+func encodePublicKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// adminExportManifestHandler exports all asset records, signed with the
+// server's manifest key.
+func (s *Server) adminExportManifestHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := s.manifestKey()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Message: err.Error()})
+		return
+	}
+
+	m := Manifest{
+		Version:   manifestVersion,
+		Origin:    s.config.Domain,
+		CreatedAt: s.now().UTC(),
+		Assets:    s.assets.list(),
+	}
+	sort.Slice(m.Assets, func(i, j int) bool {
+		return m.Assets[i].UploadedAt.Before(m.Assets[j].UploadedAt)
+	})
+	// Records older than checksums get one computed now
+	for i := range m.Assets {
+		a := &m.Assets[i]
+		if a.SHA256 == "" && a.State != stateDeleted {
+			if a.SHA256, err = fileChecksum(s.assetPath(a.ID), a.Encoding); err != nil {
+				fmt.Printf("Error computing checksum of %s: %v\n", a.ID, err)
+			}
+		}
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Message: err.Error()})
+		return
+	}
+
+	s.audit(r.Context(), "admin", auditManifest, s.config.Domain, fmt.Sprintf("exported %d assets", len(m.Assets)))
+	w.Header().Set("Content-Disposition", "attachment; filename=manifest.json")
+	writeJSON(w, http.StatusOK, SignedManifest{
+		Manifest:  payload,
+		Key:       encodePublicKey(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	})
+}
+
+// adminManifestKeyHandler returns the public half of the manifest key, to
+// be added to manifest_trusted_keys of servers importing from this one.
+func (s *Server) adminManifestKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := s.manifestKey()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Message: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"key": encodePublicKey(key.Public().(ed25519.PublicKey))})
+}
+
+// verifyManifest checks the signature of a manifest against the trusted
+// keys, which always include this server's own key.
+func (s *Server) verifyManifest(sm *SignedManifest) (*Manifest, error) {
+	trusted := append([]string{}, s.config.ManifestTrustedKeys...)
+	if key, err := s.manifestKey(); err == nil {
+		trusted = append(trusted, encodePublicKey(key.Public().(ed25519.PublicKey)))
+	}
+	isTrusted := false
+	for _, k := range trusted {
+		if k == sm.Key {
+			isTrusted = true
+			break
+		}
+	}
+	if !isTrusted {
+		return nil, fmt.Errorf("manifest is signed by an untrusted key")
+	}
+
+	pub, err := base64.StdEncoding.DecodeString(sm.Key)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid manifest key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(sm.Signature)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(pub), sm.Manifest, sig) {
+		return nil, fmt.Errorf("invalid manifest signature")
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(sm.Manifest, &m); err != nil {
+		return nil, fmt.Errorf("error parsing manifest: %v", err)
+	}
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+	return &m, nil
+}
+
+// skippedAsset is an asset an import did not take over, and why.
+type skippedAsset struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// adminImportManifestHandler adds the asset records of a signed manifest.
+// The asset files must have been copied into upload_dir beforehand; each is
+// verified against its checksum.  Records that already exist are left
+// alone.
+func (s *Server) adminImportManifestHandler(w http.ResponseWriter, r *http.Request) {
+	var sm SignedManifest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.bodyLimit(r, maxManifestSize))).Decode(&sm); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid manifest"})
+		return
+	}
+	m, err := s.verifyManifest(&sm)
+	if err != nil {
+		writeJSON(w, http.StatusForbidden, Response{Message: err.Error()})
+		return
+	}
+
+	result := struct {
+		Imported int            `json:"imported"`
+		Skipped  []skippedAsset `json:"skipped"`
+	}{Skipped: []skippedAsset{}}
+	for _, asset := range m.Assets {
+		if reason := s.importAsset(r.Context(), asset); reason != "" {
+			result.Skipped = append(result.Skipped, skippedAsset{asset.ID, reason})
+			continue
+		}
+		result.Imported++
+	}
+
+	s.infof("Imported %d of %d assets from %s\n", result.Imported, len(m.Assets), m.Origin)
+	s.audit(r.Context(), "admin", auditManifest, m.Origin,
+		fmt.Sprintf("imported %d of %d assets", result.Imported, len(m.Assets)))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// importAsset adds one manifest record, returning why it was skipped if it
+// was.  Thumbnails, variants, sidecars, streams, earlier versions and
+// trashed files are not carried over.
+func (s *Server) importAsset(ctx context.Context, asset Asset) string {
+	if !validAssetID(asset.ID) {
+		return "invalid id"
+	}
+	if _, ok := s.assets.get(asset.ID); ok {
+		return "already exists"
+	}
+
+	asset.Thumbnails = nil
+	asset.Variants = nil
+	asset.Renditions = nil
+	asset.Sidecars = nil
+	asset.Versions = nil
+	asset.TrashedAt = time.Time{}
+	if asset.State == statePending {
+		return "upload was incomplete"
+	}
+	if asset.Tier == tierCold {
+		// The cold store is shared with the exporting server or the
+		// file was lost
+		if s.cold == nil {
+			return "file in cold storage"
+		}
+	} else if asset.State != stateDeleted {
+		sum, err := fileChecksum(s.assetPath(asset.ID), asset.Encoding)
+		if err != nil {
+			return "file missing"
+		}
+		if sum != asset.SHA256 {
+			return "checksum mismatch"
+		}
+		if asset.State == stateActive {
+			if asset.Thumbnails, err = s.assetThumbnails(ctx, asset); err != nil {
+				fmt.Printf("Error generating thumbnails for %s: %v\n", asset.ID, err)
+			}
+		}
+	}
+
+	if err := s.assets.put(asset.ID, asset); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// fileChecksum returns the hash of the content of a file stored with an
+// encoding, if any.
+func fileChecksum(path, encoding string) (string, error) {
+	f, err := openContent(path, encoding)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
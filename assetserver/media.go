@@ -0,0 +1,105 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const probeTimeout = 30 * time.Second
+
+// AudioInfo describes the sound of an audio asset, for players to show
+// before loading it.  Duration is in seconds.
+type AudioInfo struct {
+	Duration   float64 `json:"duration"`
+	SampleRate int     `json:"sample_rate,omitempty"`
+	Channels   int     `json:"channels,omitempty"`
+}
+
+func (s *Server) validateMediaConfig() error {
+	if s.config.FFprobe == "" {
+		s.config.FFprobe = "ffprobe"
+	}
+	return nil
+}
+
+// mediaInfo is what ffprobe tells of a file.  Width and Height are those
+// of its video, not counting cover art, and SampleRate and Channels those
+// of its first audio stream.
+type mediaInfo struct {
+	Width      int
+	Height     int
+	Duration   time.Duration
+	SampleRate int
+	Channels   int
+}
+
+// probeMedia asks ffprobe for the video size, sound and duration of a file.
+func (s *Server) probeMedia(ctx context.Context, path string) (mediaInfo, error) {
+	var info mediaInfo
+	out, err := exec.CommandContext(ctx, s.config.FFprobe, "-v", "error",
+		"-show_entries", "stream=codec_type,width,height,sample_rate,channels:stream_disposition=attached_pic:format=duration",
+		"-of", "json", path).Output()
+	if err != nil {
+		return info, fmt.Errorf("%s: %v", s.config.FFprobe, err)
+	}
+	var probe struct {
+		Streams []struct {
+			CodecType   string `json:"codec_type"`
+			Width       int    `json:"width"`
+			Height      int    `json:"height"`
+			SampleRate  string `json:"sample_rate"`
+			Channels    int    `json:"channels"`
+			Disposition struct {
+				AttachedPic int `json:"attached_pic"`
+			} `json:"disposition"`
+		} `json:"streams"`
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return info, fmt.Errorf("%s: %v", s.config.FFprobe, err)
+	}
+	for _, st := range probe.Streams {
+		switch {
+		case st.CodecType == "video" && st.Disposition.AttachedPic == 0 && st.Height > 0 && info.Height == 0:
+			info.Width, info.Height = st.Width, st.Height
+		case st.CodecType == "audio" && info.Channels == 0:
+			info.SampleRate, _ = strconv.Atoi(st.SampleRate)
+			info.Channels = st.Channels
+		}
+	}
+	if secs, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		info.Duration = time.Duration(secs * float64(time.Second))
+	}
+	return info, nil
+}
+
+// audioInfo probes the sound of an audio file.  Durations are rounded to
+// milliseconds.
+func (s *Server) audioInfo(ctx context.Context, path string) (*AudioInfo, error) {
+	ctx, cancel := toolContext(ctx, probeTimeout)
+	defer cancel()
+
+	info, err := s.probeMedia(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Duration <= 0 {
+		return nil, fmt.Errorf("%s reported no duration", s.config.FFprobe)
+	}
+	return &AudioInfo{
+		Duration:   math.Round(info.Duration.Seconds()*1000) / 1000,
+		SampleRate: info.SampleRate,
+		Channels:   info.Channels,
+	}, nil
+}
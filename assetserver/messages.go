@@ -0,0 +1,125 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// builtinCatalogs are the translations shipped with the server, one file
+// per language mapping English messages to the language.
+//
+//go:embed locales/*.json
+var builtinCatalogs embed.FS
+
+// loadCatalogs reads the built-in translations and those in locale_dir,
+// which add languages or replace built-in messages.
+func (s *Server) loadCatalogs() error {
+	s.catalogs = make(map[string]map[string]string)
+	if err := s.readCatalogs(builtinCatalogs, "locales"); err != nil {
+		return err
+	}
+	if s.config.LocaleDir != "" {
+		if err := s.readCatalogs(os.DirFS(s.config.LocaleDir), "."); err != nil {
+			return fmt.Errorf("locale_dir: %v", err)
+		}
+	}
+
+	s.config.Language = strings.ToLower(s.config.Language)
+	if s.config.Language == "" {
+		s.config.Language = "en"
+	}
+	if _, ok := s.catalogs[s.config.Language]; !ok && s.config.Language != "en" {
+		return fmt.Errorf("no messages for language %q", s.config.Language)
+	}
+	return nil
+}
+
+func (s *Server) readCatalogs(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, dir+"/*.json")
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("error parsing %s: %v", name, err)
+		}
+		lang := strings.ToLower(strings.TrimSuffix(filepath.Base(name), ".json"))
+		if s.catalogs[lang] == nil {
+			s.catalogs[lang] = make(map[string]string)
+		}
+		for k, v := range messages {
+			s.catalogs[lang][k] = v
+		}
+	}
+	return nil
+}
+
+// requestLanguage picks the language of the messages sent to a client from
+// its Accept-Language header, falling back to the configured language.  A
+// tag such as de-AT also matches a catalog for de.
+func (s *Server) requestLanguage(r *http.Request) string {
+	type choice struct {
+		tag string
+		q   float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if tag != "" && tag != "*" && q > 0 {
+			choices = append(choices, choice{strings.ToLower(tag), q})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool { return choices[i].q > choices[j].q })
+
+	for _, c := range choices {
+		primary, _, _ := strings.Cut(c.tag, "-")
+		for _, tag := range []string{c.tag, primary} {
+			if _, ok := s.catalogs[tag]; ok || tag == "en" {
+				return tag
+			}
+		}
+	}
+	return s.config.Language
+}
+
+// localize translates a message into the client's language and formats
+// it with args, if any.  Messages without a translation are sent in
+// English.
+func (s *Server) localize(r *http.Request, format string, args ...any) string {
+	if msg, ok := s.catalogs[s.requestLanguage(r)][format]; ok {
+		format = msg
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// httpError is http.Error with the message in the client's language.
+func (s *Server) httpError(w http.ResponseWriter, r *http.Request, message string, code int) {
+	http.Error(w, s.localize(r, message), code)
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// maxMetadataSize bounds the metadata stored with an asset.
+const maxMetadataSize = 8 << 10
+
+// uploadMetadata returns the metadata form field of an upload: a JSON
+// object the server stores with the asset and returns with it, such as
+// the prompt and model a generated image came from.
+func uploadMetadata(r *http.Request) (map[string]any, *uploadError) {
+	return parseMetadata(r.FormValue("metadata"))
+}
+
+func parseMetadata(s string) (map[string]any, *uploadError) {
+	if s == "" {
+		return nil, nil
+	}
+	if len(s) > maxMetadataSize {
+		return nil, &uploadError{http.StatusRequestEntityTooLarge, "metadata_too_large", "Metadata too large", nil}
+	}
+
+	var meta map[string]any
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.UseNumber()
+	if err := dec.Decode(&meta); err != nil || meta == nil || dec.More() {
+		return nil, &uploadError{http.StatusBadRequest, "invalid_metadata", "Metadata must be a JSON object", nil}
+	}
+	return meta, nil
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+
+	"github.com/karamble/braibot-assetserver/internal/upload"
+)
+
+// defaultMultipartMemory is how much of the files of a multipart upload are
+// kept in memory unless multipart_memory is set, as net/http does.
+const defaultMultipartMemory = 32 << 20
+
+func (s *Server) validateMultipartConfig() error {
+	if s.config.MultipartMemory == 0 {
+		s.config.MultipartMemory = defaultMultipartMemory
+	}
+	if s.config.MultipartMemory < 0 {
+		return fmt.Errorf("multipart_memory cannot be negative")
+	}
+	return nil
+}
+
+// MultipartStats counts the temporary files the parts of multipart uploads
+// too large to keep in memory are written to.
+type MultipartStats struct {
+	Files        int64 `json:"files"`
+	Bytes        int64 `json:"bytes"`
+	PeakBytes    int64 `json:"peak_bytes"`
+	Spilled      int64 `json:"spilled_total"`
+	SpilledBytes int64 `json:"spilled_bytes_total"`
+	RemoveErrors int64 `json:"remove_errors_total"`
+}
+
+// multipartTemp accounts for the temporary files of multipart uploads.
+type multipartTemp struct {
+	files, bytes, peak          atomic.Int64
+	spilled, spilledBytes, errs atomic.Int64
+}
+
+func (m *multipartTemp) stats() MultipartStats {
+	return MultipartStats{
+		Files:        m.files.Load(),
+		Bytes:        m.bytes.Load(),
+		PeakBytes:    m.peak.Load(),
+		Spilled:      m.spilled.Load(),
+		SpilledBytes: m.spilledBytes.Load(),
+		RemoveErrors: m.errs.Load(),
+	}
+}
+
+// multipartFile is a temporary file of a multipart upload in the staging
+// area, where the staging area's crash cleanup covers it.
+type multipartFile struct {
+	f       *os.File
+	n       int64
+	temp    *multipartTemp
+	removed bool
+}
+
+func (s *Server) newMultipartFile() (upload.TempFile, error) {
+	f, err := os.CreateTemp(s.stagingDir(), ".multipart-*")
+	if err != nil {
+		return nil, err
+	}
+	s.multipartTemp.files.Add(1)
+	s.multipartTemp.spilled.Add(1)
+	return &multipartFile{f: f, temp: &s.multipartTemp}, nil
+}
+
+func (f *multipartFile) Write(p []byte) (int, error) {
+	n, err := f.f.Write(p)
+	f.n += int64(n)
+	f.temp.spilledBytes.Add(int64(n))
+	used := f.temp.bytes.Add(int64(n))
+	for peak := f.temp.peak.Load(); used > peak && !f.temp.peak.CompareAndSwap(peak, used); {
+		peak = f.temp.peak.Load()
+	}
+	return n, err
+}
+
+func (f *multipartFile) Close() error {
+	return f.f.Close()
+}
+
+func (f *multipartFile) Open() (io.ReadCloser, error) {
+	return os.Open(f.f.Name())
+}
+
+func (f *multipartFile) Remove() error {
+	if f.removed {
+		return nil
+	}
+	f.f.Close()
+	if err := os.Remove(f.f.Name()); err != nil && !os.IsNotExist(err) {
+		f.temp.errs.Add(1)
+		fmt.Printf("Error removing multipart temporary file: %v\n", err)
+		return err
+	}
+	f.removed = true
+	f.temp.files.Add(-1)
+	f.temp.bytes.Add(-f.n)
+	return nil
+}
+
+// parseMultipartUpload reads a multipart upload, keeping multipart_memory
+// bytes of its files in memory and writing the rest to the staging area.
+// Its fields are set as the request's form, as ParseMultipartForm does.  The
+// caller must remove the form's files, which reading does itself if it
+// fails.
+func (s *Server) parseMultipartUpload(r *http.Request) (*upload.MultipartForm, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	form, err := upload.ReadMultipart(mr, s.config.MultipartMemory, s.newMultipartFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// Body fields take precedence over the query string
+	r.PostForm = url.Values(form.Value)
+	r.Form = make(url.Values)
+	for k, v := range form.Value {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+	for k, v := range r.URL.Query() {
+		r.Form[k] = append(r.Form[k], v...)
+	}
+	r.MultipartForm = &multipart.Form{Value: form.Value}
+	return form, nil
+}
@@ -0,0 +1,177 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const optimizeTimeout = 2 * time.Minute
+
+// optimizeFormats maps the optimize_images formats to the type of the files
+// they produce.
+var optimizeFormats = map[string]string{
+	"jpeg": "image/jpeg",
+	"webp": "image/webp",
+	"avif": "image/avif",
+}
+
+// defaultOptimizeCommands are the encoders used for formats Go can't write.
+var defaultOptimizeCommands = map[string][]string{
+	"webp": {"cwebp", "-quiet", "-q", "{quality}", "{in}", "-o", "{out}"},
+	"avif": {"avifenc", "-q", "{quality}", "{in}", "{out}"},
+}
+
+func (s *Server) validateOptimizeConfig() error {
+	if s.config.OptimizeImages == "" {
+		return nil
+	}
+	if _, ok := optimizeFormats[s.config.OptimizeImages]; !ok {
+		return fmt.Errorf("optimize_images must be jpeg, webp or avif")
+	}
+	if s.config.OptimizeQuality == 0 {
+		s.config.OptimizeQuality = 80
+	}
+	if s.config.OptimizeQuality < 1 || s.config.OptimizeQuality > 100 {
+		return fmt.Errorf("optimize_quality must be between 1 and 100")
+	}
+	if len(s.config.OptimizeCommand) == 0 {
+		s.config.OptimizeCommand = defaultOptimizeCommands[s.config.OptimizeImages]
+	}
+	return nil
+}
+
+// keepOriginalUpload reports whether an upload is to be kept as the
+// original variant if processing replaces it, as asked for with the
+// X-Keep-Original header or the keep_original field, or else as set by
+// keep_originals.
+func (s *Server) keepOriginalUpload(r *http.Request) (bool, *uploadError) {
+	v := r.Header.Get("X-Keep-Original")
+	if v == "" {
+		v = r.FormValue("keep_original")
+	}
+	if v == "" {
+		return s.config.KeepOriginals, nil
+	}
+	keep, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, &uploadError{http.StatusBadRequest, "invalid_form", "Invalid keep original flag", nil}
+	}
+	return keep, nil
+}
+
+// optimizeUpload re-encodes a PNG upload in the configured format.  The
+// result is only used if it is smaller than the upload; the upload is then
+// returned as the original variant if it is to be kept.  Anything else,
+// including encoder failures, leaves the asset as uploaded.
+func (s *Server) optimizeUpload(ctx context.Context, asset *Asset, data []byte) ([]byte, []variantFile) {
+	if s.config.OptimizeImages == "" || asset.Blind || asset.ContentType != "image/png" {
+		return data, nil
+	}
+	contentType := optimizeFormats[s.config.OptimizeImages]
+	if !s.isAllowedFileType(contentType) {
+		return data, nil
+	}
+
+	out, err := s.optimizeImage(ctx, data)
+	if err != nil {
+		fmt.Printf("Error optimizing %s: %v\n", asset.OriginalName, err)
+		return data, nil
+	}
+	if out == nil || len(out) >= len(data) {
+		return data, nil
+	}
+	s.infof("Optimized %s from %d to %d bytes\n", asset.OriginalName, len(data), len(out))
+
+	var variants []variantFile
+	if asset.keepOriginal {
+		variants = append(variants, variantFile{name: variantOriginal, contentType: asset.ContentType, data: data})
+	}
+	asset.ContentType = contentType
+	return out, variants
+}
+
+// optimizeImage encodes an image in the configured format.  It returns nil
+// for images that can't be converted without losing transparency.
+func (s *Server) optimizeImage(ctx context.Context, data []byte) ([]byte, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error reading image header: %v", err)
+	}
+	if cfg.Width*cfg.Height > maxThumbnailSourcePixels {
+		return nil, fmt.Errorf("image too large to optimize: %dx%d", cfg.Width, cfg.Height)
+	}
+
+	if s.config.OptimizeImages != "jpeg" || len(s.config.OptimizeCommand) > 0 {
+		return s.runOptimizeCommand(ctx, data)
+	}
+
+	// JPEG has no alpha channel
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %v", err)
+	}
+	if o, ok := img.(interface{ Opaque() bool }); !ok || !o.Opaque() {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: s.config.OptimizeQuality}); err != nil {
+		return nil, err
+	}
+
+	// Go only writes baseline JPEG; jpegtran makes it progressive
+	if _, err := exec.LookPath("jpegtran"); err != nil {
+		return buf.Bytes(), nil
+	}
+	return s.runEncoder(ctx, []string{"jpegtran", "-progressive", "-optimize", "-copy", "none", "-outfile", "{out}", "{in}"},
+		buf.Bytes(), ".jpg", ".jpg")
+}
+
+func (s *Server) runOptimizeCommand(ctx context.Context, data []byte) ([]byte, error) {
+	return s.runEncoder(ctx, s.config.OptimizeCommand, data, ".png", s.storedExtension("", optimizeFormats[s.config.OptimizeImages]))
+}
+
+// runEncoder runs an encoder command on data, substituting the paths of
+// its input and output files and the quality into its arguments.  The files
+// get the extensions of their formats, which some encoders go by.
+func (s *Server) runEncoder(ctx context.Context, command []string, data []byte, inExt, outExt string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "optimize")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "in"+inExt), filepath.Join(dir, "out"+outExt)
+	if err := os.WriteFile(in, data, 0600); err != nil {
+		return nil, err
+	}
+
+	r := strings.NewReplacer("{in}", in, "{out}", out, "{quality}", strconv.Itoa(s.config.OptimizeQuality))
+	args := make([]string, len(command)-1)
+	for i, arg := range command[1:] {
+		args[i] = r.Replace(arg)
+	}
+
+	ctx, cancel := toolContext(ctx, optimizeTimeout)
+	defer cancel()
+	if output, err := exec.CommandContext(ctx, command[0], args...).CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return nil, fmt.Errorf("%s: %v: %s", command[0], err, msg)
+		}
+		return nil, fmt.Errorf("%s: %v", command[0], err)
+	}
+	return os.ReadFile(out)
+}
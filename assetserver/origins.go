@@ -0,0 +1,144 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// originHeader names the origin a client wants the URLs of a response on.
+const originHeader = "X-Asset-Origin"
+
+// Origin is another public host serving the same assets, such as a mirror
+// in another region reading the replicas.
+type Origin struct {
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
+
+	// Countries are the ISO 3166 codes of the clients sent to this origin
+	Countries []string `json:"countries"`
+}
+
+// MirrorV1 is the download URL of an asset on another origin.
+type MirrorV1 struct {
+	Origin string `json:"origin"`
+	URL    string `json:"url"`
+}
+
+func (s *Server) validateOrigins() error {
+	names := make(map[string]bool)
+	for i := range s.config.Origins {
+		o := &s.config.Origins[i]
+		if o.Name == "" || o.Domain == "" {
+			return fmt.Errorf("origin %d: name and domain cannot be empty", i+1)
+		}
+		if names[o.Name] {
+			return fmt.Errorf("origin %s is configured twice", o.Name)
+		}
+		names[o.Name] = true
+		for j, c := range o.Countries {
+			if len(c) != 2 {
+				return fmt.Errorf("origin %s: %q is not a two letter country code", o.Name, c)
+			}
+			o.Countries[j] = strings.ToUpper(c)
+		}
+	}
+	if s.config.OriginCountryHeader != "" && len(s.config.Origins) == 0 {
+		return fmt.Errorf("origins cannot be empty with origin_country_header")
+	}
+	return nil
+}
+
+// requestOrigin picks the origin whose URLs a response carries: the one
+// named by the X-Asset-Origin header or origin parameter, else the first
+// serving the country in origin_country_header.  It returns false for the
+// server's own domain.
+func (s *Server) requestOrigin(r *http.Request) (Origin, bool) {
+	name := r.Header.Get(originHeader)
+	if name == "" {
+		name = r.URL.Query().Get("origin")
+	}
+	var country string
+	if s.config.OriginCountryHeader != "" {
+		country = strings.ToUpper(strings.TrimSpace(r.Header.Get(s.config.OriginCountryHeader)))
+	}
+	for _, o := range s.config.Origins {
+		if name != "" && o.Name == name {
+			return o, true
+		}
+	}
+	if name != "" || country == "" {
+		return Origin{}, false
+	}
+	for _, o := range s.config.Origins {
+		for _, c := range o.Countries {
+			if c == country {
+				return o, true
+			}
+		}
+	}
+	return Origin{}, false
+}
+
+// mirrors lists the download URLs of an asset on every other origin.
+func (s *Server) mirrors(id string) []MirrorV1 {
+	var mirrors []MirrorV1
+	for _, o := range s.config.Origins {
+		mirrors = append(mirrors, MirrorV1{Origin: o.Name, URL: onOrigin(s.downloadURL(id), s.config.Domain, o.Domain)})
+	}
+	return mirrors
+}
+
+// onOrigin moves a URL on domain to the origin on another domain.  Other
+// URLs, such as those of the CDN, are left alone.
+func onOrigin(u, domain, origin string) string {
+	if rest, ok := strings.CutPrefix(u, "https://"+domain+"/"); ok {
+		return "https://" + origin + "/" + rest
+	}
+	return u
+}
+
+// originAsset moves the URLs of an asset object to the origin picked for
+// a request.
+func (s *Server) originAsset(r *http.Request, v AssetV1) AssetV1 {
+	o, ok := s.requestOrigin(r)
+	if !ok {
+		return v
+	}
+	move := func(u string) string {
+		return onOrigin(u, s.config.Domain, o.Domain)
+	}
+	v.URL = move(v.URL)
+	v.DeleteURL = move(v.DeleteURL)
+	v.ShortURL = move(v.ShortURL)
+	v.QRURL = move(v.QRURL)
+	v.StreamURL = move(v.StreamURL)
+	v.Thumbnails = append([]ThumbnailV1(nil), v.Thumbnails...)
+	for i := range v.Thumbnails {
+		v.Thumbnails[i].URL = move(v.Thumbnails[i].URL)
+	}
+	v.Variants = append([]VariantV1(nil), v.Variants...)
+	for i := range v.Variants {
+		v.Variants[i].URL = move(v.Variants[i].URL)
+	}
+	v.Sidecars = append([]SidecarV1(nil), v.Sidecars...)
+	for i := range v.Sidecars {
+		v.Sidecars[i].URL = move(v.Sidecars[i].URL)
+	}
+	v.Versions = append([]VersionV1(nil), v.Versions...)
+	for i := range v.Versions {
+		v.Versions[i].URL = move(v.Versions[i].URL)
+	}
+	if v.Srcset != nil {
+		srcset := make(map[string]string, len(v.Srcset))
+		for k, u := range v.Srcset {
+			srcset[k] = move(u)
+		}
+		v.Srcset = srcset
+	}
+	return v
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength is the longest password bcrypt can hash.
+const maxPasswordLength = 72
+
+// uploadPassword returns the bcrypt hash of the password form field of an
+// upload, or "" if none was set.
+func uploadPassword(r *http.Request) (string, *uploadError) {
+	return hashPassword(r.FormValue("password"))
+}
+
+// hashPassword returns the bcrypt hash of an upload's password, or "" if it
+// has none.
+func hashPassword(password string) (string, *uploadError) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) > maxPasswordLength {
+		return "", &uploadError{http.StatusBadRequest, "invalid_password",
+			fmt.Sprintf("Password longer than %d bytes", maxPasswordLength), nil}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", &uploadError{http.StatusInternalServerError, "internal_error", "Error hashing password", nil}
+	}
+	return string(hash), nil
+}
+
+// checkAssetPassword reports whether a request for a password protected
+// asset supplied the right password, as the password query parameter, the
+// X-Asset-Password header or the field of the prompt page.  Otherwise the
+// response has been written: the prompt page for browsers and a plain
+// 401 for everyone else.
+func (s *Server) checkAssetPassword(w http.ResponseWriter, r *http.Request, asset Asset) bool {
+	if asset.PasswordHash == "" {
+		return true
+	}
+
+	password := r.Header.Get("X-Asset-Password")
+	if password == "" {
+		password = r.FormValue("password")
+	}
+	message := ""
+	if password != "" {
+		if !s.passwordLimiter.allow(s.clientIP(r)) {
+			w.Header().Set("Retry-After", "60")
+			s.httpError(w, r, "Too many password attempts", http.StatusTooManyRequests)
+			return false
+		}
+		if bcrypt.CompareHashAndPassword([]byte(asset.PasswordHash), []byte(password)) == nil {
+			return true
+		}
+		message = "Wrong password."
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if !acceptsHTML(r) {
+		s.httpError(w, r, "Password required", http.StatusUnauthorized)
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprintf(w, passwordPage, html.EscapeString(message))
+	return false
+}
+
+func acceptsHTML(r *http.Request) bool {
+	for _, v := range r.Header.Values("Accept") {
+		if strings.Contains(v, "text/html") {
+			return true
+		}
+	}
+	return false
+}
+
+// passwordPage posts the password back to the download URL.
+const passwordPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Password required</title>
+</head>
+<body style="font-family: sans-serif; max-width: 24em; margin: 4em auto;">
+<p>This file is password protected.</p>
+<p style="color: #b00;">%s</p>
+<form method="post">
+<input type="password" name="password" autofocus required>
+<button type="submit">Download</button>
+</form>
+</body>
+</html>
+`
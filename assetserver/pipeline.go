@@ -0,0 +1,407 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"slices"
+	"strings"
+)
+
+// processPhase says when a processing stage runs.
+type processPhase int
+
+const (
+	// phaseTransform stages rewrite the upload before it is stored
+	phaseTransform processPhase = iota
+	// phaseCheck stages examine the stored file before it is activated
+	phaseCheck
+)
+
+// Processor is one stage of the processing pipeline of uploads.  Stages
+// skip uploads they don't apply to, and handle their own failures: errors
+// are logged and processing goes on with the next stage.
+type Processor interface {
+	// Name is how the stage is listed in pipelines
+	Name() string
+	Phase() processPhase
+	Process(ctx context.Context, s *Server, p *processing) error
+}
+
+// processing is an upload going through the pipeline.
+type processing struct {
+	asset *Asset
+
+	// Transform phase: the upload and any variants made of it
+	data     []byte
+	variants []variantFile
+
+	// Check phase: the state the asset moves to and the findings.  Check
+	// stages stop running once the asset is no longer headed for active.
+	next       AssetState
+	reason     string
+	reject     bool
+	nsfw       bool
+	verdict    Verdict
+	thumbs     []Thumbnail
+	pages      int
+	renditions []Rendition
+	transcript *Sidecar
+	text       string
+	audio      *AudioInfo
+}
+
+// processors are the available stages, by name.
+var processors = processorsByName(
+	exifStripProcessor{},
+	optimizeProcessor{},
+	gifVideoProcessor{},
+	srcsetProcessor{},
+	imageInfoProcessor{},
+	provenanceProcessor{},
+	scanProcessor{},
+	nsfwProcessor{},
+	thumbnailProcessor{},
+	pageCountProcessor{},
+	audioInfoProcessor{},
+	transcribeProcessor{},
+	hlsProcessor{},
+)
+
+func processorsByName(ps ...Processor) map[string]Processor {
+	m := make(map[string]Processor, len(ps))
+	for _, p := range ps {
+		m[p.Name()] = p
+	}
+	return m
+}
+
+// defaultPipeline is used for types no configured pipeline covers.  Every
+// stage but exif_strip, in the order they always ran.
+var defaultPipeline = []string{"optimize", "gif_video", "srcset", "image_info", "provenance", "scan", "nsfw_check", "thumbnail", "page_count", "audio_info", "transcribe", "hls"}
+
+func (s *Server) validatePipelines() error {
+	for key, stages := range s.config.Pipelines {
+		check := false
+		for _, name := range stages {
+			p, ok := processors[name]
+			if !ok {
+				return fmt.Errorf("pipeline %s: unknown stage %q", key, name)
+			}
+			if p.Phase() == phaseCheck {
+				check = true
+			} else if check {
+				return fmt.Errorf("pipeline %s: stage %s changes the file and must come before the checks", key, name)
+			}
+		}
+	}
+	return nil
+}
+
+// pipelineFor returns the stages uploads of a type go through.  A pipeline
+// for the exact type wins over one for its family, such as image, which
+// wins over the default pipeline.
+func (s *Server) pipelineFor(contentType string) []Processor {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(contentType)
+	}
+	family, _, _ := strings.Cut(mediaType, "/")
+
+	names := defaultPipeline
+	for _, key := range []string{mediaType, family, "default"} {
+		if stages, ok := s.config.Pipelines[key]; ok {
+			names = stages
+			break
+		}
+	}
+	stages := make([]Processor, 0, len(names))
+	for _, name := range names {
+		stages = append(stages, processors[name])
+	}
+	return stages
+}
+
+// runPipeline runs the stages of one phase of an asset's pipeline.  Each
+// phase uses the pipeline of the asset's type at that point, so a PNG that
+// was optimized to JPEG is checked by the JPEG pipeline.  Blind uploads are
+// encrypted, so nothing is done with them.  Anonymous uploads are scanned
+// whatever their pipeline.
+func (s *Server) runPipeline(ctx context.Context, phase processPhase, p *processing) {
+	if p.asset.Blind {
+		return
+	}
+	spans := newPhaseSpans(ctx)
+	defer spans.end()
+	stages := s.pipelineFor(p.asset.ContentType)
+	if isAnonymous(p.asset.Uploader) && !slices.Contains(stages, Processor(scanProcessor{})) {
+		// Anonymous uploads are always scanned
+		stages = append([]Processor{scanProcessor{}}, stages...)
+	}
+	for _, stage := range stages {
+		if stage.Phase() != phase {
+			continue
+		}
+		if phase == phaseCheck && (p.next != stateActive || p.reject) {
+			return
+		}
+		spans.start(stage.Name())
+		if err := s.runStage(ctx, stage, p); err != nil {
+			spans.fail(err)
+			fmt.Printf("Error in %s stage for %s: %v\n", stage.Name(), p.asset.ID, err)
+			// A check that could not run might have failed the asset
+			if phase == phaseCheck && (errors.Is(err, errNoWorker) || errors.Is(err, errPanicked)) {
+				p.next, p.reason = stateQuarantined, stage.Name()+" not run: "+err.Error()
+			}
+		}
+	}
+}
+
+// transformsUpload reports whether a transform stage may rewrite an upload,
+// which then has to be read into memory before it is stored.  Every
+// transform stage works on images, so other uploads are stored as they are
+// read.
+func (s *Server) transformsUpload(asset *Asset) bool {
+	if asset.Blind || !strings.HasPrefix(asset.ContentType, "image/") {
+		return false
+	}
+	for _, stage := range s.pipelineFor(asset.ContentType) {
+		if stage.Phase() == phaseTransform {
+			return true
+		}
+	}
+	return false
+}
+
+// processUpload runs the transform stages on an upload, returning the data
+// to store and the variants to keep alongside.  asset is updated when a
+// stage changes its type, and remembers the hash of the data as uploaded
+// when a stage changes that.
+func (s *Server) processUpload(ctx context.Context, asset *Asset, data []byte) ([]byte, []variantFile) {
+	p := &processing{asset: asset, data: data}
+	s.runPipeline(ctx, phaseTransform, p)
+	if !bytes.Equal(p.data, data) {
+		sum := sha256.Sum256(data)
+		asset.SourceSHA256 = hex.EncodeToString(sum[:])
+	}
+	return p.data, p.variants
+}
+
+type exifStripProcessor struct{}
+
+func (exifStripProcessor) Name() string        { return "exif_strip" }
+func (exifStripProcessor) Phase() processPhase { return phaseTransform }
+func (exifStripProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	out, err := stripEXIF(p.asset.ContentType, p.data)
+	if err != nil || out == nil {
+		return err
+	}
+	p.data = out
+	return nil
+}
+
+type optimizeProcessor struct{}
+
+func (optimizeProcessor) Name() string        { return "optimize" }
+func (optimizeProcessor) Phase() processPhase { return phaseTransform }
+func (optimizeProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	data, variants := s.optimizeUpload(ctx, p.asset, p.data)
+	p.data = data
+	p.variants = append(p.variants, variants...)
+	return nil
+}
+
+type gifVideoProcessor struct{}
+
+func (gifVideoProcessor) Name() string        { return "gif_video" }
+func (gifVideoProcessor) Phase() processPhase { return phaseTransform }
+func (gifVideoProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	if p.asset.ContentType == "image/gif" {
+		p.variants = append(p.variants, s.convertGIF(ctx, p.asset, p.data)...)
+	}
+	return nil
+}
+
+type srcsetProcessor struct{}
+
+func (srcsetProcessor) Name() string        { return "srcset" }
+func (srcsetProcessor) Phase() processPhase { return phaseTransform }
+func (srcsetProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	// Animated GIFs are left to gif_video
+	if len(s.config.SrcsetWidths) == 0 || !thumbnailable(p.asset.ContentType) || p.asset.ContentType == "image/gif" {
+		return nil
+	}
+	variants, cfg, err := s.resizeImage(p.data)
+	if err != nil {
+		return err
+	}
+	p.asset.Width, p.asset.Height = cfg.Width, cfg.Height
+	p.variants = append(p.variants, variants...)
+	return nil
+}
+
+type imageInfoProcessor struct{}
+
+func (imageInfoProcessor) Name() string        { return "image_info" }
+func (imageInfoProcessor) Phase() processPhase { return phaseTransform }
+func (imageInfoProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	// Described as stored, so after any stage rewriting the image
+	if !thumbnailable(p.asset.ContentType) {
+		return nil
+	}
+	return imageInfo(p.asset, p.data)
+}
+
+type provenanceProcessor struct{}
+
+func (provenanceProcessor) Name() string        { return "provenance" }
+func (provenanceProcessor) Phase() processPhase { return phaseTransform }
+func (provenanceProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	p.data = s.addProvenance(ctx, *p.asset, p.asset.Uploader, p.data)
+	return nil
+}
+
+type scanProcessor struct{}
+
+func (scanProcessor) Name() string        { return "scan" }
+func (scanProcessor) Phase() processPhase { return phaseCheck }
+
+// Process scans the file and its variants, quarantining anything
+// suspicious.  A failed scan quarantines too.
+func (scanProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	reason, err := s.scanFile(ctx, s.contentPath(p.asset))
+	for _, v := range p.asset.Variants {
+		if reason != "" || err != nil {
+			break
+		}
+		reason, err = s.scanFile(ctx, s.variantFilePath(p.asset, v.Name))
+	}
+	if err != nil {
+		reason = "scan failed: " + err.Error()
+	}
+	if reason != "" {
+		p.next, p.reason = stateQuarantined, reason
+	}
+	return err
+}
+
+type nsfwProcessor struct{}
+
+func (nsfwProcessor) Name() string        { return "nsfw_check" }
+func (nsfwProcessor) Phase() processPhase { return phaseCheck }
+
+// Process classifies images if a rule covers their uploader.  If the
+// classifier fails, only tagged uploads go ahead.
+func (nsfwProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	rule, ok := s.nsfwRuleFor(p.asset.Uploader)
+	if !ok || !strings.HasPrefix(p.asset.ContentType, "image/") {
+		return nil
+	}
+	score, err := s.classifyImage(ctx, s.contentPath(p.asset), p.asset.ContentType)
+	if err != nil {
+		if rule.Action != nsfwTag {
+			p.next, p.reason = stateQuarantined, "classification failed: "+err.Error()
+		}
+		return err
+	}
+	p.verdict.NSFWScore = &score
+	if score < rule.Threshold {
+		return nil
+	}
+	p.nsfw = true
+	switch rule.Action {
+	case nsfwReject:
+		p.reject = true
+		p.reason = fmt.Sprintf("rejected by classifier: score %.2f", score)
+	case nsfwQuarantine:
+		p.next, p.reason = stateQuarantined, fmt.Sprintf("nsfw: score %.2f", score)
+	}
+	return nil
+}
+
+type thumbnailProcessor struct{}
+
+func (thumbnailProcessor) Name() string        { return "thumbnail" }
+func (thumbnailProcessor) Phase() processPhase { return phaseCheck }
+func (thumbnailProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	thumbs, err := s.assetThumbnails(ctx, *p.asset)
+	p.thumbs = thumbs
+	return err
+}
+
+type pageCountProcessor struct{}
+
+func (pageCountProcessor) Name() string        { return "page_count" }
+func (pageCountProcessor) Phase() processPhase { return phaseCheck }
+func (pageCountProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	if !s.config.PDFPreviews || !isPDF(p.asset.ContentType) {
+		return nil
+	}
+	pages, err := s.pdfPageCount(ctx, s.contentPath(p.asset))
+	p.pages = pages
+	return err
+}
+
+type hlsProcessor struct{}
+
+func (hlsProcessor) Name() string        { return "hls" }
+func (hlsProcessor) Phase() processPhase { return phaseCheck }
+
+// Process packages video and long audio for streaming.  Streams may be
+// fetched without limit, so only assets that may be downloaded without
+// limit are packaged, and never anonymous uploads.
+func (hlsProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	a := p.asset
+	if !s.config.HLS || !(strings.HasPrefix(a.ContentType, "video/") || strings.HasPrefix(a.ContentType, "audio/")) ||
+		isAnonymous(a.Uploader) || a.PasswordHash != "" || len(a.Recipients) > 0 ||
+		s.retentionFor(a.ContentType, a.Size, a.Uploader, a.Tags).MaxDownloads != unlimitedDownloads {
+		return nil
+	}
+	renditions, err := s.packageHLS(ctx, *a)
+	p.renditions = renditions
+	return err
+}
+
+type audioInfoProcessor struct{}
+
+func (audioInfoProcessor) Name() string        { return "audio_info" }
+func (audioInfoProcessor) Phase() processPhase { return phaseCheck }
+func (audioInfoProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	if !s.config.ProbeAudio || !strings.HasPrefix(p.asset.ContentType, "audio/") {
+		return nil
+	}
+	info, err := s.audioInfo(ctx, s.contentPath(p.asset))
+	p.audio = info
+	return err
+}
+
+type transcribeProcessor struct{}
+
+func (transcribeProcessor) Name() string        { return "transcribe" }
+func (transcribeProcessor) Phase() processPhase { return phaseCheck }
+
+// Process transcribes audio into a transcript sidecar.
+func (transcribeProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	if len(s.config.TranscribeCommand) == 0 && s.config.TranscribeURL == "" ||
+		!strings.HasPrefix(p.asset.ContentType, "audio/") {
+		return nil
+	}
+	text, err := s.transcribe(ctx, s.contentPath(p.asset), p.asset.ContentType)
+	if err != nil || text == "" {
+		return err
+	}
+	sidecar, err := s.writeTranscript(p.asset.ID, text)
+	if err != nil {
+		return err
+	}
+	p.transcript, p.text = &sidecar, text
+	return nil
+}
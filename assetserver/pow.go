@@ -0,0 +1,120 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// powTTL is how long a proof-of-work challenge may be solved and used.
+	powTTL = 10 * time.Minute
+
+	maxPowDifficulty  = 32
+	maxPowSolutionLen = 64
+)
+
+// powChallenges issues and checks proof-of-work challenges.  Challenges
+// are signed rather than stored, so asking for them costs the server
+// nothing; only the solved ones are remembered, until they expire, so
+// each can be used once.
+type powChallenges struct {
+	key []byte
+
+	mu   sync.Mutex
+	used map[string]time.Time
+}
+
+func newPowChallenges() *powChallenges {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &powChallenges{key: key, used: make(map[string]time.Time)}
+}
+
+func (p *powChallenges) sign(payload string, difficulty int) string {
+	mac := hmac.New(sha256.New, p.key)
+	fmt.Fprintf(mac, "%s\n%d", payload, difficulty)
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// issue returns a challenge of a difficulty, in leading zero bits, valid
+// until expires.
+func (p *powChallenges) issue(difficulty int, expires time.Time) string {
+	b := make([]byte, 24)
+	binary.BigEndian.PutUint64(b, uint64(expires.Unix()))
+	rand.Read(b[8:])
+	payload := hex.EncodeToString(b)
+	return payload + "." + p.sign(payload, difficulty)
+}
+
+// verify checks that a challenge was issued for a difficulty, is unexpired
+// and unused, and that SHA-256 of the challenge, a colon and the solution
+// starts with that many zero bits.  A valid solution uses up the
+// challenge.
+func (p *powChallenges) verify(challenge, solution string, difficulty int, now time.Time) error {
+	if challenge == "" || solution == "" {
+		return errors.New("missing proof of work")
+	}
+	payload, sig, ok := strings.Cut(challenge, ".")
+	b, err := hex.DecodeString(payload)
+	if !ok || err != nil || len(b) != 24 || !hmac.Equal([]byte(sig), []byte(p.sign(payload, difficulty))) {
+		return errors.New("unknown challenge")
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(b)), 0)
+	if now.After(expires) {
+		return errors.New("expired challenge")
+	}
+	if len(solution) > maxPowSolutionLen || leadingZeroBits(sha256.Sum256([]byte(challenge+":"+solution))) < difficulty {
+		return errors.New("wrong solution")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, seen := p.used[challenge]; seen {
+		return errors.New("challenge already used")
+	}
+	for c, exp := range p.used {
+		if now.After(exp) {
+			delete(p.used, c)
+		}
+	}
+	p.used[challenge] = expires
+	return nil
+}
+
+func leadingZeroBits(sum [sha256.Size]byte) int {
+	n := 0
+	for _, b := range sum {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+// powHandler hands out a challenge for the anonymous endpoints that
+// require proof of work.
+func (s *Server) powHandler(w http.ResponseWriter, r *http.Request) {
+	expires := s.now().Add(powTTL).Truncate(time.Second).UTC()
+	w.Header().Set("Cache-Control", "no-store")
+	sendEnvelope(w, http.StatusOK, map[string]any{
+		"challenge":  s.pow.issue(s.config.ReportPowDifficulty, expires),
+		"difficulty": s.config.ReportPowDifficulty,
+		"algorithm":  "sha256",
+		"expires_at": expires,
+	})
+}
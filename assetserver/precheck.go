@@ -0,0 +1,69 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/karamble/braibot-assetserver/internal/upload"
+)
+
+// reusable reports whether an asset can be handed out again for an upload
+// of the same content by the same uploader: it is active, may be downloaded
+// any number of times and isn't restricted to a password or recipients.
+// Assets with a download limit are meant for their first recipients.
+func (a *Asset) reusable(actor, sum string, now time.Time) bool {
+	return a.Uploader == actor && (a.SHA256 == sum || a.SourceSHA256 == sum) &&
+		a.downloadable(now) == nil && a.downloadLimit() == unlimitedDownloads &&
+		a.PasswordHash == "" && len(a.Recipients) == 0
+}
+
+// precheckHandler lets a client offer the SHA-256 and size of a file before
+// sending it.  If the key already stored that content and the asset can be
+// reused, the asset is returned and nothing needs uploading.  Otherwise the
+// response carries a ticket for uploading exactly that file.
+func (s *Server) precheckHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+
+	sum := strings.ToLower(r.FormValue("sha256"))
+	if b, err := hex.DecodeString(sum); err != nil || len(b) != 32 {
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_sha256", "sha256 must be a hex encoded SHA-256 hash")
+		return
+	}
+	size, err := strconv.ParseInt(r.FormValue("size"), 10, 64)
+	if err != nil || size <= 0 {
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_size", "size must be a positive number of bytes")
+		return
+	}
+	if size > s.config.MaxFileSize {
+		s.rejectUpload(w, r, fileTooLarge(&upload.SizeError{Size: size, Limit: s.config.MaxFileSize}, s.config.MaxFileSize))
+		return
+	}
+
+	actor := requestKeyActor(r)
+	for _, asset := range s.assets.list() {
+		if asset.reusable(actor, sum, s.now()) {
+			sendEnvelope(w, http.StatusOK, map[string]any{
+				"exists": true,
+				"asset":  s.assetV1(&asset, ""),
+			})
+			return
+		}
+	}
+
+	grant, ok := s.mintTicket(w, r, uploadTicket{actor: actor, maxSize: size, sha256: sum}, defaultTicketTTL)
+	if !ok {
+		return
+	}
+	grant["exists"] = false
+	sendEnvelope(w, http.StatusOK, grant)
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"slices"
+	"strings"
+)
+
+// digitalSourceAI is the IPTC digital source type of media created by a
+// generative model.
+const digitalSourceAI = "http://cv.iptc.org/newscodes/digitalsourcetype/trainedAlgorithmicMedia"
+
+// ProvenanceRule marks the images uploaded with some keys as AI generated.
+// Rules are evaluated in order and the first one listing the uploader, or
+// listing no keys, applies.
+type ProvenanceRule struct {
+	Keys []string `json:"keys"`
+
+	// Method is "xmp" to embed IPTC metadata in PNG and JPEG files, or
+	// "c2pa" to add a signed Content Credentials manifest with c2patool.
+	Method string `json:"method"`
+
+	// Generator names the generating service, and Model the model used
+	// unless the upload's metadata has a model.
+	Generator string `json:"generator"`
+	Model     string `json:"model"`
+}
+
+var defaultC2PACommand = []string{"c2patool", "{in}", "-m", "{manifest}", "-o", "{out}", "-f"}
+
+func (s *Server) validateProvenanceRules(rules []ProvenanceRule) error {
+	for i := range rules {
+		rule := &rules[i]
+		switch rule.Method {
+		case "xmp", "c2pa":
+		default:
+			return fmt.Errorf("provenance rule #%d: method must be xmp or c2pa", i+1)
+		}
+		if rule.Generator == "" {
+			rule.Generator = "braibot"
+		}
+	}
+	if len(s.config.C2PACommand) == 0 {
+		s.config.C2PACommand = defaultC2PACommand
+	}
+	return nil
+}
+
+func (s *Server) provenanceFor(actor string) (ProvenanceRule, bool) {
+	for _, rule := range s.config.ProvenanceRules {
+		if len(rule.Keys) == 0 || slices.Contains(rule.Keys, actor) {
+			return rule, true
+		}
+	}
+	return ProvenanceRule{}, false
+}
+
+// provenance is what an image is marked with.
+type provenance struct {
+	generator    string
+	model        string
+	promptSHA256 string
+}
+
+// addProvenance marks an image uploaded by actor as AI generated if a rule
+// asks for it.  The model and a hash of the prompt are taken from the
+// upload's metadata; the prompt itself is not embedded.  Files that can't
+// be marked are stored as they are.
+func (s *Server) addProvenance(ctx context.Context, asset Asset, actor string, data []byte) []byte {
+	rule, ok := s.provenanceFor(actor)
+	if !ok || asset.Blind || !strings.HasPrefix(asset.ContentType, "image/") {
+		return data
+	}
+
+	p := provenance{generator: rule.Generator, model: rule.Model}
+	if model, ok := asset.Metadata["model"].(string); ok && model != "" {
+		p.model = model
+	}
+	if prompt, ok := asset.Metadata["prompt"].(string); ok && prompt != "" {
+		sum := sha256.Sum256([]byte(prompt))
+		p.promptSHA256 = hex.EncodeToString(sum[:])
+	}
+
+	var out []byte
+	var err error
+	switch rule.Method {
+	case "xmp":
+		out, err = embedXMP(asset.ContentType, data, p)
+	case "c2pa":
+		out, err = s.embedC2PA(ctx, asset, data, p)
+	}
+	if err != nil {
+		fmt.Printf("Error adding provenance to %s: %v\n", asset.OriginalName, err)
+		return data
+	}
+	return out
+}
+
+// xmpPacket describes the image as AI generated in the IPTC vocabulary,
+// which is what image viewers and social networks look for.
+func xmpPacket(p provenance) []byte {
+	attr := func(name, value string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(value))
+		return fmt.Sprintf("\n    %s=\"%s\"", name, b.String())
+	}
+	var b strings.Builder
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"")
+	b.WriteString(attr("xmlns:Iptc4xmpExt", "http://iptc.org/std/Iptc4xmpExt/2008-02-29/"))
+	b.WriteString(attr("xmlns:xmp", "http://ns.adobe.com/xap/1.0/"))
+	b.WriteString(attr("xmlns:braibot", "https://github.com/karamble/braibot-assetserver/ns/1.0/"))
+	b.WriteString(attr("Iptc4xmpExt:DigitalSourceType", digitalSourceAI))
+	b.WriteString(attr("xmp:CreatorTool", p.generator))
+	if p.model != "" {
+		b.WriteString(attr("braibot:Model", p.model))
+	}
+	if p.promptSHA256 != "" {
+		b.WriteString(attr("braibot:PromptSHA256", p.promptSHA256))
+	}
+	b.WriteString("/>\n </rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>")
+	return []byte(b.String())
+}
+
+var (
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+	xmpPNGKey    = []byte("XML:com.adobe.xmp\x00")
+	xmpJPEGKey   = []byte("http://ns.adobe.com/xap/1.0/\x00")
+)
+
+// embedXMP adds an XMP packet to a PNG or JPEG.  Files that already carry
+// XMP are left alone rather than ending up with two conflicting packets.
+func embedXMP(contentType string, data []byte, p provenance) ([]byte, error) {
+	packet := xmpPacket(p)
+	switch contentType {
+	case "image/png":
+		if bytes.Contains(data, xmpPNGKey) {
+			return nil, fmt.Errorf("file already has XMP metadata")
+		}
+		// The iTXt chunk goes right after IHDR, which is always first
+		const ihdrEnd = 8 + 4 + 4 + 13 + 4
+		if len(data) < ihdrEnd || !bytes.HasPrefix(data, pngSignature) || string(data[12:16]) != "IHDR" {
+			return nil, fmt.Errorf("not a PNG file")
+		}
+		// Keyword, no compression, empty language and translated keyword
+		text := append(append(append([]byte{}, xmpPNGKey...), 0, 0, 0, 0), packet...)
+		chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)))
+		chunk = append(chunk, "iTXt"...)
+		chunk = append(chunk, text...)
+		chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+		return slices.Concat(data[:ihdrEnd], chunk, data[ihdrEnd:]), nil
+
+	case "image/jpeg", "image/jpg", "image/pjpeg":
+		if bytes.Contains(data, xmpJPEGKey) {
+			return nil, fmt.Errorf("file already has XMP metadata")
+		}
+		if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+			return nil, fmt.Errorf("not a JPEG file")
+		}
+		payload := append(append([]byte{}, xmpJPEGKey...), packet...)
+		if len(payload) > 0xffff-2 {
+			return nil, fmt.Errorf("XMP packet too large")
+		}
+		// APP1 goes after SOI and the JFIF APP0 segment, if any
+		pos := 2
+		if data[2] == 0xff && data[3] == 0xe0 && len(data) >= 6 {
+			pos += 2 + int(binary.BigEndian.Uint16(data[4:6]))
+			if pos > len(data) {
+				return nil, fmt.Errorf("truncated JPEG file")
+			}
+		}
+		segment := binary.BigEndian.AppendUint16([]byte{0xff, 0xe1}, uint16(len(payload)+2))
+		segment = append(segment, payload...)
+		return slices.Concat(data[:pos], segment, data[pos:]), nil
+	}
+	return nil, fmt.Errorf("XMP can't be embedded in %s", contentType)
+}
+
+// embedC2PA signs a Content Credentials manifest into the image with
+// c2pa_command.  The manifest records that the image was created by a
+// generative model, along with the model and prompt hash.
+func (s *Server) embedC2PA(ctx context.Context, asset Asset, data []byte, p provenance) ([]byte, error) {
+	generation := map[string]string{"generator": p.generator}
+	if p.model != "" {
+		generation["model"] = p.model
+	}
+	if p.promptSHA256 != "" {
+		generation["prompt_sha256"] = p.promptSHA256
+	}
+	manifest := map[string]any{
+		"claim_generator": "braibot-assetserver",
+		"assertions": []any{
+			map[string]any{
+				"label": "c2pa.actions",
+				"data": map[string]any{
+					"actions": []any{map[string]any{
+						"action":            "c2pa.created",
+						"digitalSourceType": digitalSourceAI,
+						"softwareAgent":     p.generator,
+					}},
+				},
+			},
+			map[string]any{"label": "org.braibot.generation", "data": generation},
+		},
+	}
+	if asset.OriginalName != "" {
+		manifest["title"] = asset.OriginalName
+	}
+	if s.config.C2PASignCert != "" {
+		manifest["sign_cert"] = s.config.C2PASignCert
+		manifest["private_key"] = s.config.C2PAPrivateKey
+		manifest["alg"] = s.config.C2PASignAlg
+	}
+
+	f, err := os.CreateTemp("", "c2pa-*.json")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	err = json.NewEncoder(f).Encode(manifest)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	command := make([]string, len(s.config.C2PACommand))
+	for i, arg := range s.config.C2PACommand {
+		command[i] = strings.ReplaceAll(arg, "{manifest}", f.Name())
+	}
+	ext := s.storedExtension("", asset.ContentType)
+	return s.runEncoder(ctx, command, data, ext, ext)
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// proxyRouteID names the route registered with the proxy, so registering
+// again on the next start replaces it.
+const proxyRouteID = "braibot-assetserver"
+
+// proxyRegisterTimeout bounds registering with the proxy at startup.
+const proxyRegisterTimeout = 30 * time.Second
+
+func (s *Server) validateProxyRegisterConfig() error {
+	if s.config.ProxyUpstream == "" {
+		s.config.ProxyUpstream = s.config.Port
+		if strings.HasPrefix(s.config.ProxyUpstream, ":") {
+			s.config.ProxyUpstream = "localhost" + s.config.ProxyUpstream
+		}
+	}
+	switch s.config.ProxyRegister {
+	case "":
+	case "caddy":
+		if s.config.CaddyAdminURL == "" {
+			s.config.CaddyAdminURL = "http://localhost:2019"
+		}
+		if s.config.CaddyServer == "" {
+			s.config.CaddyServer = "srv0"
+		}
+	case "traefik":
+		if s.config.TraefikConfig == "" {
+			return fmt.Errorf("traefik_config cannot be empty with the traefik proxy_register")
+		}
+	default:
+		return fmt.Errorf("unknown proxy_register %q", s.config.ProxyRegister)
+	}
+	return nil
+}
+
+// registerProxy routes domain to the server on the proxy in front of it,
+// which terminates TLS.
+func (s *Server) registerProxy(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, proxyRegisterTimeout)
+	defer cancel()
+	switch s.config.ProxyRegister {
+	case "caddy":
+		return s.registerCaddy(ctx)
+	case "traefik":
+		return s.writeTraefikConfig()
+	}
+	return nil
+}
+
+// registerCaddy adds a reverse_proxy route for domain to caddy_server
+// through Caddy's admin API, replacing the route of an earlier start.
+// Caddy passes the client address in X-Forwarded-For, which it sets
+// itself; X-Real-IP is set too for trust_proxy.
+func (s *Server) registerCaddy(ctx context.Context) error {
+	route := map[string]any{
+		"@id":   proxyRouteID,
+		"match": []any{map[string]any{"host": []string{s.config.Domain}}},
+		"handle": []any{map[string]any{
+			"handler":   "reverse_proxy",
+			"upstreams": []any{map[string]any{"dial": s.config.ProxyUpstream}},
+			"headers": map[string]any{
+				"request": map[string]any{
+					"set": map[string][]string{"X-Real-IP": {"{http.request.remote.host}"}},
+				},
+			},
+		}},
+		"terminal": true,
+	}
+	body, err := json.Marshal(route)
+	if err != nil {
+		return err
+	}
+
+	admin := strings.TrimSuffix(s.config.CaddyAdminURL, "/")
+	resp, err := s.caddyRequest(ctx, http.MethodDelete, admin+"/id/"+proxyRouteID, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	resp, err = s.caddyRequest(ctx, http.MethodPost, admin+"/config/apps/http/servers/"+s.config.CaddyServer+"/routes", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var msg struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&msg)
+		return fmt.Errorf("caddy answered %s: %s", resp.Status, msg.Error)
+	}
+	return nil
+}
+
+func (s *Server) caddyRequest(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// writeTraefikConfig writes a router and service for domain to
+// traefik_config, for Traefik's file provider to pick up.  The file is
+// replaced in one step so Traefik never reads half of it.
+func (s *Server) writeTraefikConfig() error {
+	router := map[string]any{
+		"rule":    fmt.Sprintf("Host(`%s`)", s.config.Domain),
+		"service": proxyRouteID,
+		"tls":     map[string]any{},
+	}
+	if s.config.TraefikCertResolver != "" {
+		router["tls"] = map[string]any{"certResolver": s.config.TraefikCertResolver}
+	}
+	cfg := map[string]any{
+		"http": map[string]any{
+			"routers": map[string]any{proxyRouteID: router},
+			"services": map[string]any{proxyRouteID: map[string]any{
+				"loadBalancer": map[string]any{
+					"servers": []any{map[string]any{"url": "http://" + s.config.ProxyUpstream}},
+				},
+			}},
+		},
+	}
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.config.TraefikConfig), ".traefik-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.config.TraefikConfig)
+}
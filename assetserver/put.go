@@ -0,0 +1,119 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/karamble/braibot-assetserver/internal/upload"
+)
+
+// File is a file stored with Put.
+type File struct {
+	// Name is the original name of the file, if known
+	Name string
+
+	// ContentType is trusted like the type of a multipart part, and the
+	// type is detected from the data if it is empty or not trusted
+	ContentType string
+
+	// Metadata is a JSON object stored with the asset, if not empty
+	Metadata string
+
+	// Password protects downloads, if not empty
+	Password string
+
+	// Recipients restricts downloads to these identity keys, if any
+	Recipients []string
+
+	// Tags are stored with the asset
+	Tags []string
+
+	// KeepOriginal keeps the file as the original variant if processing
+	// replaces it, if set, in place of keep_originals
+	KeepOriginal *bool
+
+	Data io.Reader
+
+	// replaceOf is the asset the file is new content for, if any
+	replaceOf string
+}
+
+// Put stores a file on behalf of actor, as recorded in the audit log,
+// without going through HTTP.  The asset object returned includes the
+// deletion token.
+func (s *Server) Put(ctx context.Context, actor string, f File) (AssetV1, error) {
+	saved, uerr := s.putFile(ctx, actor, f)
+	if uerr != nil {
+		return AssetV1{}, errors.New(uerr.message)
+	}
+	return saved, nil
+}
+
+// putFile stores a file for Put and the gRPC API, reporting failures as
+// the HTTP API would.
+func (s *Server) putFile(ctx context.Context, actor string, f File) (AssetV1, *uploadError) {
+	if uerr := s.readOnly(); uerr != nil {
+		return AssetV1{}, uerr
+	}
+	opts, uerr := s.fileUploadOptions(f)
+	if uerr != nil {
+		return AssetV1{}, uerr
+	}
+
+	// Only the head of the file is read to find its type, the rest as it
+	// is stored unless processing needs all of it
+	head, data, err := upload.Head(f.Data)
+	if uerr := readFileError(err, s.config.MaxFileSize); uerr != nil {
+		return AssetV1{}, uerr
+	}
+	data = &uploadReader{r: data, max: s.config.MaxFileSize}
+
+	asset := Asset{OriginalName: f.Name, Uploader: actor, ReplaceOf: f.replaceOf}
+	asset.ContentType = s.uploadContentType(head, map[string]string{typeFromPart: f.ContentType}, typeFromPart)
+	opts.apply(&asset)
+	if !s.isAllowedFileType(asset.ContentType) {
+		return AssetV1{}, typeNotAllowed(fmt.Sprintf("File type not allowed: %s", asset.ContentType),
+			asset.ContentType, s.config.AllowedTypes)
+	}
+	var variants []variantFile
+	if s.transformsUpload(&asset) {
+		fileData, err := io.ReadAll(data)
+		if uerr := readFileError(err, s.config.MaxFileSize); uerr != nil {
+			return AssetV1{}, uerr
+		}
+		fileData, variants = s.processUpload(ctx, &asset, fileData)
+		data = bytes.NewReader(fileData)
+	}
+	if asset.ID, err = s.generateRandomFilename(asset.OriginalName, asset.ContentType); err != nil {
+		return AssetV1{}, &uploadError{http.StatusInternalServerError, "internal_error",
+			fmt.Sprintf("Error generating filename: %v", err), nil}
+	}
+	saved, err := s.saveAsset(ctx, actor, asset, data, variants...)
+	if err != nil {
+		return AssetV1{}, s.saveError(nil, err, s.config.MaxFileSize)
+	}
+	return saved, nil
+}
+
+// readFileError reports a failure to read a file for putFile, or nil if
+// there was none.
+func readFileError(err error, maxSize int64) *uploadError {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, upload.ErrTooLarge):
+		return &uploadError{http.StatusRequestEntityTooLarge, "file_too_large",
+			fmt.Sprintf("File too large (max: %d bytes)", maxSize), &ErrorDetails{Limit: maxSize}}
+	case uploadTimedOut(err):
+		return &uploadError{http.StatusRequestTimeout, "upload_timeout", "Upload timed out", nil}
+	}
+	return &uploadError{http.StatusBadRequest, "read_error", fmt.Sprintf("Error reading file: %v", err), nil}
+}
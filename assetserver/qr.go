@@ -0,0 +1,52 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	defaultQRSize = 256
+	maxQRSize     = 1024
+)
+
+func (s *Server) qrURL(id string) string {
+	return s.downloadURL(id) + "/qr.png"
+}
+
+// qrHandler serves a QR code of an active asset's download URL, so a link
+// shown on a desktop can be opened on a phone.  Fetching it doesn't count
+// as a download.
+func (s *Server) qrHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	asset, ok := s.assets.get(id)
+	if !ok || asset.State != stateActive {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+
+	size := defaultQRSize
+	if v := r.URL.Query().Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 64 || n > maxQRSize {
+			http.Error(w, s.localize(r, "size must be between 64 and %d", maxQRSize), http.StatusBadRequest)
+			return
+		}
+		size = n
+	}
+
+	png, err := qrcode.Encode(s.downloadURL(id), qrcode.Medium, size)
+	if err != nil {
+		s.httpError(w, r, "Error generating QR code", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(png)
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// challengeTTL is how long a download challenge may be signed and used.
+	challengeTTL = 5 * time.Minute
+
+	// maxChallenges bounds the challenges waiting to be used.
+	maxChallenges = 10000
+)
+
+// uploadRecipients returns the identity keys the recipients form fields of
+// an upload restrict downloads to.
+func uploadRecipients(r *http.Request) ([]string, *uploadError) {
+	return parseRecipients(r.Form["recipients"])
+}
+
+// parseRecipients reads Bison Relay identity keys, the hex encoded Ed25519
+// public keys clients sign with, given one per value or comma separated.
+func parseRecipients(values []string) ([]string, *uploadError) {
+	var keys []string
+	for _, v := range values {
+		for _, key := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+			key = strings.ToLower(key)
+			if b, err := hex.DecodeString(key); err != nil || len(b) != ed25519.PublicKeySize {
+				return nil, &uploadError{http.StatusBadRequest, "invalid_recipient", "Invalid recipient key", nil}
+			}
+			if !slices.Contains(keys, key) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// challengeMessage is what a recipient signs to download an asset.
+func challengeMessage(id, challenge string) string {
+	return "braibot-assetserver download " + id + " " + challenge
+}
+
+// challenge is a nonce issued for downloading an asset.
+type challenge struct {
+	assetID string
+	expires time.Time
+}
+
+// challenges are the download challenges issued and not used yet.  Each
+// can be used once, so a signature seen in transit can't be replayed.
+type challenges struct {
+	mu      sync.Mutex
+	pending map[string]challenge
+}
+
+func (c *challenges) issue(assetID string, now time.Time) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		c.pending = make(map[string]challenge)
+	}
+	for nonce, ch := range c.pending {
+		if now.After(ch.expires) {
+			delete(c.pending, nonce)
+		}
+	}
+	if len(c.pending) >= maxChallenges {
+		return "", false
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	c.pending[nonce] = challenge{assetID, now.Add(challengeTTL)}
+	return nonce, true
+}
+
+// valid reports whether a challenge was issued for an asset and can still
+// be used.
+func (c *challenges) valid(nonce, assetID string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch, ok := c.pending[nonce]
+	return ok && ch.assetID == assetID && !now.After(ch.expires)
+}
+
+// use consumes a challenge, reporting false if it was already used.
+func (c *challenges) use(nonce string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.pending[nonce]; !ok {
+		return false
+	}
+	delete(c.pending, nonce)
+	return true
+}
+
+// challengeHandler issues a challenge for downloading an asset restricted
+// to recipients.
+func (s *Server) challengeHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	asset, ok := s.assets.get(id)
+	if !ok || asset.State != stateActive {
+		s.sendEnvelopeError(w, r, http.StatusNotFound, "not_found", "Asset not found")
+		return
+	}
+	if len(asset.Recipients) == 0 {
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "not_restricted", "File is not restricted to recipients")
+		return
+	}
+	now := s.now()
+	nonce, ok := s.challenges.issue(id, now)
+	if !ok {
+		s.sendEnvelopeError(w, r, http.StatusServiceUnavailable, "too_many_challenges", "Too many pending challenges, try again later")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	sendEnvelope(w, http.StatusOK, map[string]any{
+		"challenge":  nonce,
+		"message":    challengeMessage(id, nonce),
+		"expires_at": now.Add(challengeTTL).UTC(),
+	})
+}
+
+// checkRecipient reports whether a request for an asset restricted to
+// recipients proved ownership of one of their keys: X-Identity-Key names
+// the key, X-Identity-Challenge a challenge issued for the asset and
+// X-Identity-Signature is the hex Ed25519 signature of its message.
+// Otherwise the error response has been written.
+func (s *Server) checkRecipient(w http.ResponseWriter, r *http.Request, asset Asset) bool {
+	if len(asset.Recipients) == 0 {
+		return true
+	}
+	w.Header().Set("Cache-Control", "no-store")
+
+	key := strings.ToLower(r.Header.Get("X-Identity-Key"))
+	nonce := r.Header.Get("X-Identity-Challenge")
+	sig := r.Header.Get("X-Identity-Signature")
+	if key == "" || nonce == "" || sig == "" {
+		s.httpError(w, r, "Identity signature required", http.StatusUnauthorized)
+		return false
+	}
+	if !slices.Contains(asset.Recipients, key) {
+		s.httpError(w, r, "Not a recipient of this file", http.StatusForbidden)
+		return false
+	}
+	pub, _ := hex.DecodeString(key)
+	sigBytes, err := hex.DecodeString(sig)
+	if err != nil || !s.challenges.valid(nonce, asset.ID, s.now()) ||
+		!ed25519.Verify(pub, []byte(challengeMessage(asset.ID, nonce)), sigBytes) ||
+		!s.challenges.use(nonce) {
+		s.httpError(w, r, "Invalid identity signature", http.StatusForbidden)
+		return false
+	}
+	return true
+}
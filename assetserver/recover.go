@@ -0,0 +1,119 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errPanicked is returned by a stage that panicked.
+var errPanicked = errors.New("panicked")
+
+// recovered logs a panic with the stack of the goroutine it happened on and
+// counts it in /debug/stats.  what says what was being done, such as the
+// request being served.
+func (s *Server) recovered(ctx context.Context, what string, rec any) {
+	s.panics.Add(1)
+	id := requestID(ctx)
+	if id == "" {
+		id = "none"
+	}
+	fmt.Printf("Panic in %s (request %s): %v\n%s", what, id, rec, debug.Stack())
+}
+
+// withRecovery answers requests whose handler panicked with a 500 in the
+// format of the endpoint, instead of dropping the connection.  A response
+// already under way can only be cut off.
+func (s *Server) withRecovery(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryWriter{ResponseWriter: w}
+		defer func() {
+			rec := recover()
+			if rec == nil || rec == http.ErrAbortHandler {
+				if rec != nil {
+					panic(rec)
+				}
+				return
+			}
+			s.recovered(r.Context(), r.Method+" "+r.URL.Path, rec)
+			if rw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			for _, h := range []string{"Content-Disposition", "Content-Encoding", "Content-Length", "Content-Range"} {
+				w.Header().Del(h)
+			}
+			if strings.HasPrefix(r.URL.Path, "/api/v1/") {
+				sendAPIError(w, http.StatusInternalServerError,
+					&APIError{Code: "internal_error", Message: s.localize(r, "Internal server error")})
+				return
+			}
+			writeJSON(w, http.StatusInternalServerError, Response{Message: s.localize(r, "Internal server error")})
+		}()
+		h.ServeHTTP(rw, r)
+	})
+}
+
+// recoveryWriter notes whether a response has been started.
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *recoveryWriter) WriteHeader(status int) {
+	if status >= http.StatusOK {
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recoveryWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+// ReadFrom passes files on to the connection, which can send them with
+// sendfile.
+func (w *recoveryWriter) ReadFrom(r io.Reader) (int64, error) {
+	w.wroteHeader = true
+	return copyBuffer(w.ResponseWriter, r)
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (w *recoveryWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// grpcRecovery turns a panic in a unary gRPC method into an Internal error.
+func (s *Server) grpcRecovery(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			s.recovered(ctx, info.FullMethod, rec)
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// grpcStreamRecovery turns a panic in a streaming gRPC method into an
+// Internal error.
+func (s *Server) grpcStreamRecovery(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			s.recovered(ss.Context(), info.FullMethod, rec)
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(srv, ss)
+}
@@ -0,0 +1,291 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// replicaTimeout bounds writing an upload to the replicas
+	replicaTimeout = 5 * time.Minute
+
+	// replicaRetryAfter is how long a replica that failed is passed over
+	// when restoring files
+	replicaRetryAfter = time.Minute
+)
+
+// ReplicaConfig is a store every upload is also written to, a directory or
+// an S3 bucket.
+type ReplicaConfig struct {
+	Name    string `json:"name"`
+	Backend string `json:"backend"`
+	Dir     string `json:"dir"`
+	s3Options
+}
+
+// replica is an open replica and its health.
+type replica struct {
+	name  string
+	store fileStore
+
+	mu        sync.Mutex
+	downUntil time.Time
+}
+
+func (s *Server) validateReplicas() error {
+	names := make(map[string]bool)
+	for i := range s.config.Replicas {
+		r := &s.config.Replicas[i]
+		if r.Name == "" {
+			r.Name = r.Backend + "-" + fmt.Sprint(i+1)
+		}
+		if names[r.Name] {
+			return fmt.Errorf("replica %s is listed twice", r.Name)
+		}
+		names[r.Name] = true
+		switch r.Backend {
+		case "dir":
+			if r.Dir == "" {
+				return fmt.Errorf("replica %s: dir cannot be empty", r.Name)
+			}
+		case "s3":
+			if r.Endpoint == "" || r.Bucket == "" {
+				return fmt.Errorf("replica %s: s3_endpoint and s3_bucket are required", r.Name)
+			}
+			if env, ok := strings.CutPrefix(r.SecretKey, "env:"); ok {
+				if r.SecretKey, ok = os.LookupEnv(env); !ok {
+					return fmt.Errorf("replica %s: environment variable %s is not set", r.Name, env)
+				}
+			}
+		default:
+			return fmt.Errorf("replica %s: backend must be dir or s3", r.Name)
+		}
+	}
+	if s.config.ReplicaWrites == 0 || s.config.ReplicaWrites > len(s.config.Replicas) {
+		s.config.ReplicaWrites = len(s.config.Replicas)
+	}
+	if s.config.ReplicaWrites < 0 {
+		return fmt.Errorf("replica_writes cannot be negative")
+	}
+	return nil
+}
+
+func (s *Server) openReplicas() error {
+	s.replicas = nil
+	for _, rc := range s.config.Replicas {
+		r := &replica{name: rc.Name}
+		switch rc.Backend {
+		case "dir":
+			if err := os.MkdirAll(rc.Dir, 0700); err != nil {
+				return fmt.Errorf("error creating replica %s: %v", rc.Name, err)
+			}
+			r.store = dirStore(rc.Dir)
+		case "s3":
+			store, err := newS3Store(rc.s3Options)
+			if err != nil {
+				return fmt.Errorf("error configuring replica %s: %v", rc.Name, err)
+			}
+			r.store = store
+		}
+		s.replicas = append(s.replicas, r)
+	}
+	return nil
+}
+
+func (r *replica) healthy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Now().After(r.downUntil)
+}
+
+// failed passes over the replica for restores for a while.
+func (r *replica) failed(err error) {
+	fmt.Printf("Replica %s failed: %v\n", r.name, err)
+	r.mu.Lock()
+	r.downUntil = time.Now().Add(replicaRetryAfter)
+	r.mu.Unlock()
+}
+
+// replicaFiles are the names and local paths of an asset's files that are
+// replicated.  Thumbnails can be regenerated and are not.
+func (s *Server) replicaFiles(asset Asset) map[string]string {
+	files := map[string]string{asset.ID: s.assetPath(asset.ID)}
+	for _, v := range asset.Variants {
+		files[variantName(asset.ID, v.Name)] = s.variantPath(asset.ID, v.Name)
+	}
+	return files
+}
+
+// replicateAsset writes a new asset's files to every replica at once.  It
+// fails unless replica_writes of them stored all the files, in which case
+// the copies that were made are removed again.
+func (s *Server) replicateAsset(ctx context.Context, asset Asset) error {
+	if len(s.replicas) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, replicaTimeout)
+	defer cancel()
+
+	files := s.replicaFiles(asset)
+	errs := make([]error, len(s.replicas))
+	var wg sync.WaitGroup
+	for i, r := range s.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name, path := range files {
+				if errs[i] = putReplicaFile(ctx, r, name, path); errs[i] != nil {
+					r.failed(errs[i])
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	written := 0
+	for _, err := range errs {
+		if err == nil {
+			written++
+		}
+	}
+	if written < s.config.ReplicaWrites {
+		s.removeReplicas(asset)
+		return fmt.Errorf("stored on %d of %d replicas: %v", written, s.config.ReplicaWrites, errors.Join(errs...))
+	}
+	return nil
+}
+
+func putReplicaFile(ctx context.Context, r *replica, name, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return r.store.put(ctx, name, f, fi.Size())
+}
+
+// removeReplicas deletes an asset's files from the replicas.
+func (s *Server) removeReplicas(asset Asset) {
+	if len(s.replicas) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), replicaTimeout)
+	defer cancel()
+	for _, r := range s.replicas {
+		for name := range s.replicaFiles(asset) {
+			if err := r.store.remove(ctx, name); err != nil {
+				fmt.Printf("Error removing %s from replica %s: %v\n", name, r.name, err)
+			}
+		}
+	}
+}
+
+// restoreReplica brings back a missing local file of an asset from the
+// first healthy replica that has it, trying the others if none does.  The
+// asset's own file is checked against its checksum.
+func (s *Server) restoreReplica(ctx context.Context, asset Asset, name, path string) error {
+	if len(s.replicas) == 0 {
+		return os.ErrNotExist
+	}
+	ordered := make([]*replica, 0, len(s.replicas))
+	var down []*replica
+	for _, r := range s.replicas {
+		if r.healthy() {
+			ordered = append(ordered, r)
+		} else {
+			down = append(down, r)
+		}
+	}
+	ordered = append(ordered, down...)
+
+	var errs []error
+	for _, r := range ordered {
+		sum, encoding := "", ""
+		if name == asset.ID {
+			sum, encoding = asset.SHA256, asset.Encoding
+		}
+		err := fetchReplicaFile(ctx, r, name, path, sum, encoding)
+		if err == nil {
+			s.infof("Restored %s from replica %s\n", name, r.name)
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("no replica could restore %s: %v", name, errors.Join(errs...))
+}
+
+// fetchReplicaFile fetches a file from a replica, checking the content of
+// what is stored with encoding against sum if it is set.  The replica is
+// only passed over for reads after failing to answer or send the file; not
+// having it, or a bad copy, says nothing about its health.
+func fetchReplicaFile(ctx context.Context, r *replica, name, path, sum, encoding string) error {
+	rc, err := r.store.get(ctx, name)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			r.failed(err)
+		}
+		return err
+	}
+	defer rc.Close()
+	src := &replicaReader{Reader: rc}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".replica-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if src.err != nil {
+		r.failed(src.err)
+	}
+	if err != nil {
+		return err
+	}
+	got := hex.EncodeToString(hash.Sum(nil))
+	if encoding != "" && sum != "" {
+		if got, err = fileChecksum(tmp.Name(), encoding); err != nil {
+			return err
+		}
+	}
+	if sum != "" && got != sum {
+		return fmt.Errorf("checksum mismatch of %s", name)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// replicaReader keeps the error of reading from a replica apart from one
+// writing the local copy.
+type replicaReader struct {
+	io.Reader
+	err error
+}
+
+func (r *replicaReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
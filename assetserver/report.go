@@ -0,0 +1,176 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Report statuses.  A report starts open and is resolved by an operator
+// through the admin API.
+const (
+	reportOpen        = "open"
+	reportQuarantined = "quarantined"
+	reportDeleted     = "deleted"
+	reportDismissed   = "dismissed"
+)
+
+const maxReportReasonLen = 1000
+
+// Report is an abuse report filed against an asset.  Resolution fields are
+// kept on the record so every takedown has an audit trail.
+type Report struct {
+	ID         string    `json:"id"`
+	AssetID    string    `json:"asset_id"`
+	Reason     string    `json:"reason"`
+	Reporter   string    `json:"reporter"`
+	CreatedAt  time.Time `json:"created_at"`
+	Status     string    `json:"status"`
+	ResolvedAt time.Time `json:"resolved_at,omitzero"`
+	ResolvedBy string    `json:"resolved_by,omitempty"`
+}
+
+func (s *Server) reportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ip := s.clientIP(r)
+	if !s.reportLimiter.allow(ip) {
+		s.httpError(w, r, "Too many reports", http.StatusTooManyRequests)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, s.bodyLimit(r, maxRequestSize))
+	if err := r.ParseForm(); err != nil {
+		s.sendJSONResponse(w, r, false, "Error parsing form", "")
+		return
+	}
+
+	if s.config.ReportCaptchaSecret != "" {
+		if err := s.verifyCaptcha(r.FormValue("captcha_response"), ip); err != nil {
+			s.infof("Captcha verification failed for %s: %v\n", ip, err)
+			s.sendJSONResponse(w, r, false, "Captcha verification failed", "")
+			return
+		}
+	}
+	if s.config.ReportPowDifficulty > 0 {
+		err := s.pow.verify(r.FormValue("pow_challenge"), r.FormValue("pow_solution"), s.config.ReportPowDifficulty, s.now())
+		if err != nil {
+			s.infof("Proof of work rejected for %s: %v\n", ip, err)
+			s.sendJSONResponse(w, r, false, "Proof of work required", "")
+			return
+		}
+	}
+
+	// Accept either the bare asset ID or the download URL as posted in chat
+	assetID := assetIDFromRef(r.FormValue("file"))
+	if !validAssetID(assetID) {
+		s.sendJSONResponse(w, r, false, "File not found", "")
+		return
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		s.sendJSONResponse(w, r, false, "A reason is required", "")
+		return
+	}
+	if len(reason) > maxReportReasonLen {
+		// Cut at a rune boundary so a multi-byte character is not split.
+		n := maxReportReasonLen
+		for n > 0 && !utf8.RuneStart(reason[n]) {
+			n--
+		}
+		reason = reason[:n]
+	}
+
+	if _, err := s.assets.update(assetID, func(a *Asset) error {
+		a.Reports++
+		return nil
+	}); err != nil {
+		s.sendJSONResponse(w, r, false, "File not found", "")
+		return
+	}
+
+	id, err := randomID()
+	if err != nil {
+		s.sendJSONResponse(w, r, false, "Error filing report", "")
+		return
+	}
+	report := Report{
+		ID:        id,
+		AssetID:   assetID,
+		Reason:    reason,
+		Reporter:  ip,
+		CreatedAt: s.now().UTC(),
+		Status:    reportOpen,
+	}
+	if err := s.reports.put(id, report); err != nil {
+		fmt.Printf("Error saving report for %s: %v\n", assetID, err)
+		s.sendJSONResponse(w, r, false, "Error filing report", "")
+		return
+	}
+
+	s.infof("Asset %s reported by %s: %s\n", assetID, ip, reason)
+	s.audit(r.Context(), "ip:"+ip, auditReport, assetID, reason)
+	s.sendJSONResponse(w, r, true, "Report received", "")
+}
+
+// verifyCaptcha checks a captcha response token against a siteverify
+// endpoint.  hCaptcha, reCAPTCHA and Turnstile all share this protocol.
+func (s *Server) verifyCaptcha(token, remoteIP string) error {
+	if token == "" {
+		return fmt.Errorf("missing captcha response")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.PostForm(s.config.ReportCaptchaVerifyURL, url.Values{
+		"secret":   {s.config.ReportCaptchaSecret},
+		"response": {token},
+		"remoteip": {remoteIP},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("error decoding siteverify response: %v", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("captcha rejected")
+	}
+	return nil
+}
+
+// resolveReports marks every open report against an asset with the given
+// status.
+func (s *Server) resolveReports(assetID, status, resolvedBy string) {
+	now := s.now().UTC()
+	for _, rep := range s.reports.list() {
+		if rep.AssetID != assetID || rep.Status != reportOpen {
+			continue
+		}
+		_, err := s.reports.update(rep.ID, func(rp *Report) error {
+			rp.Status = status
+			rp.ResolvedAt = now
+			rp.ResolvedBy = resolvedBy
+			return nil
+		})
+		if err != nil {
+			fmt.Printf("Error resolving report %s: %v\n", rep.ID, err)
+		}
+	}
+}
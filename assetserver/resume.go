@@ -0,0 +1,215 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ByteRange is a part of a file, from Start up to but not including End.
+type ByteRange struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// Delivery is the download journal of an asset with limited downloads: the
+// parts of one of its files sent since its last complete download.  File is
+// the variant name, or empty for the asset's own file.
+type Delivery struct {
+	File   string      `json:"file,omitempty"`
+	Ranges []ByteRange `json:"ranges"`
+}
+
+// add merges a range into the journal, which is kept sorted and without
+// overlaps.
+func (d *Delivery) add(br ByteRange) {
+	ranges := append(d.Ranges, br)
+	slices.SortFunc(ranges, func(a, b ByteRange) int { return cmp.Compare(a.Start, b.Start) })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End {
+			last.End = max(last.End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	d.Ranges = merged
+}
+
+// complete reports whether every byte of a file of the given size was sent.
+func (d *Delivery) complete(size int64) bool {
+	if size == 0 {
+		return true
+	}
+	return len(d.Ranges) == 1 && d.Ranges[0].Start <= 0 && d.Ranges[0].End >= size
+}
+
+// requestedRange returns the part of a file of the given size a download
+// asks for with a Range header.  Only single ranges are honored; a request
+// for several ranges, or with If-Range, gets the whole file.  ok is false
+// if the range can't be satisfied.
+func requestedRange(r *http.Request, size int64) (ByteRange, bool, bool) {
+	whole := ByteRange{0, size}
+	spec, found := strings.CutPrefix(r.Header.Get("Range"), "bytes=")
+	if !found || strings.Contains(spec, ",") || r.Header.Get("If-Range") != "" {
+		return whole, false, true
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return whole, false, true
+	}
+	if first == "" {
+		// A suffix: the last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return whole, true, false
+		}
+		return ByteRange{max(size-n, 0), size}, true, true
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return whole, true, false
+	}
+	end := size
+	if last != "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < start {
+			return whole, true, false
+		}
+		end = min(n+1, size)
+	}
+	return ByteRange{start, end}, true, true
+}
+
+// checkDownload fails like claimDownload if an asset can't be downloaded,
+// without counting a download.
+func (s *Server) checkDownload(id string) (Asset, error) {
+	asset, ok := s.assets.get(id)
+	if !ok {
+		return asset, fmt.Errorf("asset not found")
+	}
+	return asset, asset.downloadable(s.now())
+}
+
+// errDownloadsReserved is returned when every download left of an asset is
+// held by a download being sent.
+var errDownloadsReserved = errors.New("downloads left are being sent")
+
+// reserveDownload holds one of the downloads left of an asset for a whole
+// file download about to be sent until release is called, so concurrent
+// downloads can't deliver it more often than allowed.
+func (s *Server) reserveDownload(id string) (release func(), err error) {
+	s.downloadsMu.Lock()
+	defer s.downloadsMu.Unlock()
+	asset, err := s.checkDownload(id)
+	if err != nil {
+		return nil, err
+	}
+	if asset.Downloads+s.downloadsReserved[id] >= asset.downloadLimit() {
+		return nil, errDownloadsReserved
+	}
+	if s.downloadsReserved == nil {
+		s.downloadsReserved = make(map[string]int)
+	}
+	s.downloadsReserved[id]++
+	return func() {
+		s.downloadsMu.Lock()
+		if s.downloadsReserved[id]--; s.downloadsReserved[id] == 0 {
+			delete(s.downloadsReserved, id)
+		}
+		s.downloadsMu.Unlock()
+	}, nil
+}
+
+// recordDelivery journals the part of a file sent to a client, counting a
+// download once the whole file has been delivered.  counted reports
+// whether this delivery completed a download.
+func (s *Server) recordDelivery(id, file string, size int64, sent ByteRange) (asset Asset, counted bool, err error) {
+	asset, err = s.assets.update(id, func(a *Asset) error {
+		// A concurrent request may have completed the last download
+		if err := a.downloadable(s.now()); err != nil {
+			return err
+		}
+		if a.Delivery == nil || a.Delivery.File != file {
+			a.Delivery = &Delivery{File: file}
+		}
+		a.Delivery.add(sent)
+		if !a.Delivery.complete(size) {
+			return nil
+		}
+		a.Delivery = nil
+		a.Downloads++
+		a.AccessedAt = s.now().UTC()
+		counted = true
+		return nil
+	})
+	return asset, counted, err
+}
+
+// sendDownload sends a file of an asset and counts the download.  Assets
+// with unlimited downloads are counted before sending.  Otherwise the
+// download only counts once every byte of the file was sent, in one
+// response or over several resumed with Range requests, so an interrupted
+// single download doesn't destroy a file its recipient never got.  Until
+// then the parts sent are kept in the asset's delivery journal.
+func (s *Server) sendDownload(w http.ResponseWriter, r *http.Request, phase *phaseSpans, asset Asset, variant, filename string, file io.ReadSeeker, size int64) {
+	if asset.downloadLimit() == unlimitedDownloads {
+		asset, ok := s.claimAssetDownload(w, r, asset.ID)
+		if !ok {
+			return
+		}
+		phase.start("send")
+		w.Header().Set("Cache-Control", s.cacheControl(&asset, s.now()))
+		sent, _ := s.sendAssetFile(w, r, phase, filename, file, size)
+		s.recordDownload(asset, sent)
+		return
+	}
+
+	// Whole file downloads hold one of the downloads left while they are
+	// sent, so concurrent ones can't deliver more than allowed
+	release := func() {}
+	var err error
+	if br, _, _ := requestedRange(r, size); br.Start == 0 && br.End == size {
+		release, err = s.reserveDownload(asset.ID)
+	} else {
+		_, err = s.checkDownload(asset.ID)
+	}
+	if err != nil {
+		s.downloadError(w, r, err)
+		return
+	}
+	defer release()
+	phase.start("send")
+	w.Header().Set("Cache-Control", s.cacheControl(&asset, s.now()))
+	sent, ok := s.sendAssetFile(w, r, phase, filename, file, size)
+	s.recordDownload(asset, sent)
+	if !ok {
+		return
+	}
+	// The journal is kept in content bytes, which a file sent compressed
+	// only delivers once all of it was sent
+	if f, ok := file.(*encodedFile); ok {
+		if sent, ok = f.delivered(sent, size); !ok {
+			return
+		}
+		size = f.size
+	}
+	asset, counted, err := s.recordDelivery(asset.ID, variant, size, sent)
+	if err != nil {
+		fmt.Printf("Error recording download of %s: %v\n", filename, err)
+		return
+	}
+	if counted && asset.usedUp() {
+		s.deleteDownloaded(r, asset.ID)
+	}
+}
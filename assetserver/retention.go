@@ -0,0 +1,293 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unlimitedDownloads is the max_downloads value of rules and assets
+// without a download limit.
+const unlimitedDownloads = -1
+
+// sweepInterval is how often expired assets are looked for.
+const sweepInterval = time.Minute
+
+// RetentionRule decides how long an asset is kept and how often it may be
+// downloaded.  Rules are evaluated in order at upload time and the first
+// one whose criteria all match applies.  Empty criteria match everything.
+type RetentionRule struct {
+	Name string `json:"name"`
+
+	// Criteria
+	Types   []string `json:"types"`
+	MinSize int64    `json:"min_size"`
+	MaxSize int64    `json:"max_size"`
+	Keys    []string `json:"keys"`
+	Tags    []string `json:"tags"`
+	Albums  []string `json:"albums"`
+
+	// MaxDownloads is the number of downloads before the asset is deleted,
+	// -1 for no limit.  The default is a single download.
+	MaxDownloads int `json:"max_downloads"`
+	// TTL deletes the asset this long after upload even if downloads are
+	// left.  Zero keeps it until its downloads are used up.
+	TTL Duration `json:"ttl"`
+
+	// CacheControl overrides the Cache-Control header of downloads.
+	CacheControl string `json:"cache_control"`
+}
+
+// defaultRetention applies when no rule matches: the original behavior of
+// deleting an asset once it has been downloaded.
+var defaultRetention = RetentionRule{Name: "default"}
+
+func validateRetentionRules(rules []RetentionRule) error {
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		switch {
+		case rule.MaxDownloads < unlimitedDownloads:
+			return fmt.Errorf("retention rule %s: max_downloads must be -1 or more", name)
+		case rule.TTL < 0:
+			return fmt.Errorf("retention rule %s: ttl cannot be negative", name)
+		case rule.MaxSize > 0 && rule.MaxSize < rule.MinSize:
+			return fmt.Errorf("retention rule %s: max_size is smaller than min_size", name)
+		case rule.MaxDownloads == unlimitedDownloads && rule.TTL == 0 && len(rule.Tags) == 0 && len(rule.Albums) == 0:
+			return fmt.Errorf("retention rule %s: an unlimited download rule needs a ttl, tags or albums", name)
+		}
+		for i, tag := range rule.Tags {
+			rule.Tags[i] = strings.ToLower(tag)
+			if !validTag(rule.Tags[i]) {
+				return fmt.Errorf("retention rule %s: invalid tag %q", name, tag)
+			}
+		}
+		for i, album := range rule.Albums {
+			rule.Albums[i] = strings.ToLower(album)
+			if !validTag(albumTagPrefix + rule.Albums[i]) {
+				return fmt.Errorf("retention rule %s: invalid album %q", name, album)
+			}
+		}
+	}
+	return nil
+}
+
+// matches reports whether an upload of the given type and size by actor,
+// as recorded in the audit log, and with tags falls under the rule.  The
+// rule matches assets with any of its tags, and in any of its albums.
+func (rule *RetentionRule) matches(contentType string, size int64, actor string, tags []string) bool {
+	if len(rule.Types) > 0 && !matchContentType(contentType, rule.Types) {
+		return false
+	}
+	if size < rule.MinSize || (rule.MaxSize > 0 && size > rule.MaxSize) {
+		return false
+	}
+	if len(rule.Keys) > 0 {
+		found := false
+		for _, key := range rule.Keys {
+			if key == actor {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(rule.Tags) > 0 && !slices.ContainsFunc(rule.Tags, func(tag string) bool {
+		return slices.Contains(tags, tag)
+	}) {
+		return false
+	}
+	if len(rule.Albums) > 0 && !slices.ContainsFunc(rule.Albums, func(album string) bool {
+		return slices.Contains(tags, albumTagPrefix+album)
+	}) {
+		return false
+	}
+	return true
+}
+
+// retentionFor returns the rule that applies to an upload.
+func (s *Server) retentionFor(contentType string, size int64, actor string, tags []string) RetentionRule {
+	if isAnonymous(actor) {
+		return s.anonymousRetention()
+	}
+	for _, rule := range s.config.RetentionRules {
+		if rule.matches(contentType, size, actor, tags) {
+			return rule
+		}
+	}
+	return defaultRetention
+}
+
+// applyRetention records the outcome of a rule on an asset being stored,
+// or whose tags changed.
+func (a *Asset) applyRetention(rule RetentionRule) {
+	a.Retention = rule.Name
+	a.MaxDownloads = rule.MaxDownloads
+	a.CacheControl = rule.CacheControl
+	a.ExpiresAt = time.Time{}
+	if rule.TTL > 0 {
+		a.ExpiresAt = a.UploadedAt.Add(time.Duration(rule.TTL))
+	}
+}
+
+// matchContentType compares a content type against a list of types that
+// may contain wildcards such as image/*.
+func matchContentType(contentType string, types []string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t == contentType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(t, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadLimit is the number of downloads an asset allows, or -1.
+func (a *Asset) downloadLimit() int {
+	if a.MaxDownloads == 0 {
+		return 1
+	}
+	return a.MaxDownloads
+}
+
+// cacheControl returns the Cache-Control header for a download of the
+// asset.  Single download links must never be served from a cache, while
+// assets without a download limit never change and may be cached until
+// they expire.
+func (s *Server) cacheControl(a *Asset, now time.Time) string {
+	value := a.CacheControl
+	if value == "" {
+		switch a.downloadLimit() {
+		case 1:
+			value = s.config.CacheControlOnce
+		case unlimitedDownloads:
+			value = s.config.CacheControlUnlimited
+		default:
+			value = s.config.CacheControlLimited
+		}
+	}
+	if !a.ExpiresAt.IsZero() {
+		value = clampMaxAge(value, int64(a.ExpiresAt.Sub(now).Seconds()))
+	}
+	return value
+}
+
+// clampMaxAge lowers the max-age and s-maxage directives of a Cache-Control
+// value to at most limit seconds.
+func clampMaxAge(value string, limit int64) string {
+	limit = max(limit, 0)
+	directives := strings.Split(value, ",")
+	for i, d := range directives {
+		d = strings.TrimSpace(d)
+		name, arg, ok := strings.Cut(d, "=")
+		if !ok || (!strings.EqualFold(name, "max-age") && !strings.EqualFold(name, "s-maxage")) {
+			directives[i] = d
+			continue
+		}
+		if n, err := strconv.ParseInt(arg, 10, 64); err == nil && n > limit {
+			d = fmt.Sprintf("%s=%d", name, limit)
+		}
+		directives[i] = d
+	}
+	return strings.Join(directives, ", ")
+}
+
+// expired reports whether the asset's time limit has passed.
+func (a *Asset) expired(now time.Time) bool {
+	return !a.ExpiresAt.IsZero() && !now.Before(a.ExpiresAt)
+}
+
+var (
+	errDownloadsUsed = errors.New("no downloads left")
+	errExpired       = errors.New("asset expired")
+)
+
+// claimDownload counts a download of an active asset, failing once the
+// asset is used up or expired.  The returned record reflects the claim.
+func (s *Server) claimDownload(id string) (Asset, error) {
+	return s.assets.update(id, func(a *Asset) error {
+		if err := a.downloadable(s.now()); err != nil {
+			return err
+		}
+		a.Downloads++
+		a.AccessedAt = s.now().UTC()
+		return nil
+	})
+}
+
+// downloadable fails if the asset can't be downloaded now.
+func (a *Asset) downloadable(now time.Time) error {
+	if a.State != stateActive {
+		return fmt.Errorf("asset is %s", a.State)
+	}
+	if a.expired(now) {
+		return errExpired
+	}
+	if a.usedUp() {
+		return errDownloadsUsed
+	}
+	return nil
+}
+
+// usedUp reports whether an asset has no downloads left.
+func (a *Asset) usedUp() bool {
+	limit := a.downloadLimit()
+	return limit != unlimitedDownloads && a.Downloads >= limit
+}
+
+// runSweeper periodically deletes active assets past their time limit,
+// empties the trash and moves idle files to cold storage.  Quarantined
+// assets are left for operators to review.
+func (s *Server) runSweeper(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		s.sweepExpired()
+		s.purgeTrash()
+		s.tierColdAssets()
+		s.recordStoredBytes()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) sweepExpired() {
+	now := s.now()
+	for _, asset := range s.assets.list() {
+		if asset.State != stateActive {
+			continue
+		}
+		reason := "expired"
+		if !asset.expired(now) {
+			// Used up assets the CDN never fetched
+			if s.config.CDNURL == "" || !asset.usedUp() || now.Before(asset.AccessedAt.Add(s.cdnPullWindow())) {
+				continue
+			}
+			reason = "downloaded"
+		}
+		if err := s.deleteAsset(asset.ID, reason); err != nil {
+			fmt.Printf("Error deleting %s asset %s: %v\n", reason, asset.ID, err)
+			continue
+		}
+		s.audit(context.Background(), "system", auditDelete, asset.ID, reason)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// s3Store keeps files in an S3 compatible bucket.  With an archive storage
+// class such as GLACIER, reading an object first requires a restore, which
+// is requested on the first download attempt.
+type s3Store struct {
+	client       *minio.Client
+	bucket       string
+	prefix       string
+	storageClass string
+}
+
+// s3Options configure an s3Store.
+type s3Options struct {
+	Endpoint     string `json:"s3_endpoint"`
+	Bucket       string `json:"s3_bucket"`
+	Region       string `json:"s3_region"`
+	Prefix       string `json:"s3_prefix"`
+	AccessKey    string `json:"s3_access_key"`
+	SecretKey    string `json:"s3_secret_key"`
+	StorageClass string `json:"s3_storage_class"`
+	Insecure     bool   `json:"s3_insecure"`
+}
+
+func (s *Server) newS3ColdStore() (*s3Store, error) {
+	if s.config.ColdS3Endpoint == "" || s.config.ColdS3Bucket == "" {
+		return nil, fmt.Errorf("cold_s3_endpoint and cold_s3_bucket are required")
+	}
+	return newS3Store(s3Options{
+		Endpoint:     s.config.ColdS3Endpoint,
+		Bucket:       s.config.ColdS3Bucket,
+		Region:       s.config.ColdS3Region,
+		Prefix:       s.config.ColdS3Prefix,
+		AccessKey:    s.config.ColdS3AccessKey,
+		SecretKey:    s.config.ColdS3SecretKey,
+		StorageClass: s.config.ColdS3StorageClass,
+		Insecure:     s.config.ColdS3Insecure,
+	})
+}
+
+func newS3Store(o s3Options) (*s3Store, error) {
+	client, err := minio.New(o.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(o.AccessKey, o.SecretKey, ""),
+		Secure: !o.Insecure,
+		Region: o.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3Store{client: client, bucket: o.Bucket, prefix: o.Prefix, storageClass: o.StorageClass}, nil
+}
+
+func (s *s3Store) put(ctx context.Context, id string, r io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+id, r, size, minio.PutObjectOptions{
+		ContentType:  "application/octet-stream",
+		StorageClass: s.storageClass,
+	})
+	return err
+}
+
+func (s *s3Store) get(ctx context.Context, id string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.prefix+id, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// GetObject is lazy; stat to surface errors such as an archived object
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		switch minio.ToErrorResponse(err).Code {
+		case "NoSuchKey":
+			return nil, fmt.Errorf("%s: %w", id, os.ErrNotExist)
+		case "InvalidObjectState":
+			return nil, s.restore(ctx, id)
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+// restore asks S3 to make an archived object readable again and returns
+// errColdRestoring if the request was accepted or is already underway.
+func (s *s3Store) restore(ctx context.Context, id string) error {
+	req := minio.RestoreRequest{}
+	req.SetDays(1)
+	req.SetGlacierJobParameters(minio.GlacierJobParameters{Tier: minio.TierStandard})
+	err := s.client.RestoreObject(ctx, s.bucket, s.prefix+id, "", req)
+	if err != nil && minio.ToErrorResponse(err).Code != "RestoreAlreadyInProgress" {
+		return err
+	}
+	return errColdRestoring
+}
+
+func (s *s3Store) remove(ctx context.Context, id string) error {
+	return s.client.RemoveObject(ctx, s.bucket, s.prefix+id, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const scanTimeout = 2 * time.Minute
+
+// errQuarantined is returned when a freshly uploaded file was quarantined
+// by the content scanner.
+var errQuarantined = errors.New("file quarantined by content scanner")
+
+// scanFile runs the configured scan command with the file path appended to
+// its arguments.  It follows the clamscan convention: exit status 0 means
+// clean, anything else is a finding and the output is returned as the
+// reason.  An empty reason with a nil error means the file is clean.
+func (s *Server) scanFile(ctx context.Context, path string) (string, error) {
+	if len(s.config.ScanCommand) == 0 {
+		return "", nil
+	}
+
+	ctx, cancel := toolContext(ctx, scanTimeout)
+	defer cancel()
+
+	args := append(append([]string{}, s.config.ScanCommand[1:]...), path)
+	out, err := exec.CommandContext(ctx, s.config.ScanCommand[0], args...).CombinedOutput()
+	if err == nil {
+		return "", nil
+	}
+
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return "", fmt.Errorf("error running scanner: %v", err)
+	}
+
+	reason := strings.TrimSpace(string(out))
+	if reason == "" {
+		reason = fmt.Sprintf("scanner exited with status %d", exitErr.ExitCode())
+	}
+	return "scanner: " + reason, nil
+}
@@ -0,0 +1,333 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// scopedTokenPrefix tells scoped tokens from session tokens, which are
+	// sent the same way
+	scopedTokenPrefix = "scope_"
+
+	defaultScopedTokenTTL = 30 * 24 * time.Hour
+	maxScopedTokenTTL     = 365 * 24 * time.Hour
+
+	// albumTagPrefix makes an album of the assets tagged with it
+	albumTagPrefix = "album:"
+)
+
+// Access granted by scoped tokens.  Read tokens may look at their album
+// or asset; append tokens may only add to it: upload to the album or
+// attach sidecars to the asset.
+const (
+	accessRead   = "read"
+	accessAppend = "append"
+)
+
+// ScopedToken is a credential limited to one album, the assets tagged
+// album:<name>, or one asset, which a key mints to hand to someone without
+// sharing the key.  It acts as the key that minted it, within its scope,
+// for as long as that key is valid.  Only a hash of the token is kept.
+type ScopedToken struct {
+	ID        string     `json:"id"`
+	Hash      string     `json:"hash"`
+	Owner     string     `json:"owner"`
+	Album     string     `json:"album,omitempty"`
+	AssetID   string     `json:"asset_id,omitempty"`
+	Access    string     `json:"access"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// ScopedTokenV1 is the client view of a scoped token.
+type ScopedTokenV1 struct {
+	Token     string     `json:"token,omitempty"`
+	ID        string     `json:"id"`
+	Album     string     `json:"album,omitempty"`
+	AssetID   string     `json:"asset_id,omitempty"`
+	Access    string     `json:"access"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (t *ScopedToken) v1() ScopedTokenV1 {
+	return ScopedTokenV1{
+		ID:        t.ID,
+		Album:     t.Album,
+		AssetID:   t.AssetID,
+		Access:    t.Access,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+		RevokedAt: t.RevokedAt,
+	}
+}
+
+// allows reports whether a token grants access to an asset.  Album
+// tokens cover the assets in the album at the time of the request that
+// the token's key uploaded, as others may tag assets into any album.
+func (t *ScopedToken) allows(access string, asset *Asset) bool {
+	if t.Access != access || asset.Uploader != t.Owner {
+		return false
+	}
+	if t.AssetID != "" {
+		return asset.ID == t.AssetID
+	}
+	return slices.Contains(asset.Tags, albumTagPrefix+t.Album)
+}
+
+// scopedTokenActor identifies a scoped token in the audit log.
+func scopedTokenActor(id string) string {
+	return "scope:" + id
+}
+
+type scopedTokenKey struct{}
+
+// withScopedToken looks up the scoped token a request carries as
+// Authorization: Bearer, if it is valid, for the handlers accepting one.
+func (s *Server) withScopedToken(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if !strings.HasPrefix(token, scopedTokenPrefix) || r.Header.Get("X-API-Key") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if t, ok := s.scopedToken(token); ok {
+			r = r.WithContext(context.WithValue(r.Context(), scopedTokenKey{}, t))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// scopedToken returns the record of a token that has not expired or been
+// revoked, and whose key is still valid.
+func (s *Server) scopedToken(token string) (ScopedToken, bool) {
+	t, ok := s.scopedTokens.get(strings.TrimPrefix(keyActor(token), "key:"))
+	if !ok || t.Hash != hashAPIKey(token) || t.RevokedAt != nil || !s.now().Before(t.ExpiresAt) {
+		return ScopedToken{}, false
+	}
+	return t, s.keyActive(t.Owner)
+}
+
+// requestScopedToken returns the scoped token a request carries, if any.
+func requestScopedToken(r *http.Request) (ScopedToken, bool) {
+	t, ok := r.Context().Value(scopedTokenKey{}).(ScopedToken)
+	return t, ok
+}
+
+// checkScopedToken reports whether a request carries a scoped token
+// granting access to an asset, and records the use in the audit log.
+func (s *Server) checkScopedToken(r *http.Request, access string, asset *Asset) bool {
+	t, ok := requestScopedToken(r)
+	if !ok || !t.allows(access, asset) {
+		return false
+	}
+	s.audit(r.Context(), scopedTokenActor(t.ID), auditKeyUse, r.URL.Path, "accepted for "+t.Owner)
+	return true
+}
+
+// scopedUpload reports whether an upload carries an append token for an
+// album, which stores its files in the album for the token's key.
+func (s *Server) scopedUpload(r *http.Request) bool {
+	if _, ok := scopedAlbumTag(r); !ok {
+		return false
+	}
+	t, _ := requestScopedToken(r)
+	s.audit(r.Context(), scopedTokenActor(t.ID), auditKeyUse, r.URL.Path, "accepted for "+t.Owner)
+	return true
+}
+
+// scopedAlbumTag returns the tag of the album an upload with an append
+// token goes to.
+func scopedAlbumTag(r *http.Request) (string, bool) {
+	t, ok := requestScopedToken(r)
+	if !ok || t.Access != accessAppend || t.Album == "" {
+		return "", false
+	}
+	return albumTagPrefix + t.Album, true
+}
+
+// scopedTokenHandler mints a token for the album or asset parameter with
+// the access parameter, read or append, valid for ttl (default 30 days).
+// Assets can only be shared by the key that uploaded them, and albums by
+// the key that owns them: the first to create or share them.
+func (s *Server) scopedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+	owner := requestKeyActor(r)
+	now := s.now().UTC()
+	t := ScopedToken{
+		Owner:     owner,
+		Album:     strings.ToLower(r.FormValue("album")),
+		AssetID:   r.FormValue("asset"),
+		Access:    r.FormValue("access"),
+		CreatedAt: now,
+		ExpiresAt: now.Add(defaultScopedTokenTTL).Truncate(time.Second),
+	}
+	switch {
+	case (t.Album == "") == (t.AssetID == ""):
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_scope", "Give either an album or an asset")
+		return
+	case t.Album != "" && !validTag(albumTagPrefix+t.Album):
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_scope", "Invalid album name")
+		return
+	case t.Access != accessRead && t.Access != accessAppend:
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_access", "access must be read or append")
+		return
+	}
+	if t.AssetID != "" {
+		asset, ok := s.assets.get(t.AssetID)
+		if !ok || asset.State == stateDeleted {
+			s.sendEnvelopeError(w, r, http.StatusNotFound, "not_found", "Asset not found")
+			return
+		}
+		if asset.Uploader != owner {
+			s.sendEnvelopeError(w, r, http.StatusForbidden, "forbidden", "Asset belongs to another key")
+			return
+		}
+	}
+	if t.Album != "" {
+		if err := s.claimAlbum(t.Album, owner); errors.Is(err, errAlbumOwned) {
+			s.sendEnvelopeError(w, r, http.StatusForbidden, "forbidden", "Album belongs to another key")
+			return
+		} else if err != nil {
+			fmt.Printf("Error recording album %s: %v\n", t.Album, err)
+			s.sendEnvelopeError(w, r, http.StatusInternalServerError, "internal_error", "Error storing token")
+			return
+		}
+	}
+	if v := r.FormValue("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxScopedTokenTTL {
+			s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_ttl", "ttl must be a duration of up to 8760h")
+			return
+		}
+		t.ExpiresAt = now.Add(d).Truncate(time.Second)
+	}
+
+	token, err := s.insertScopedToken(&t)
+	if err != nil {
+		s.sendEnvelopeError(w, r, http.StatusInternalServerError, "internal_error", "Error storing token")
+		return
+	}
+	scope := "album " + t.Album
+	if t.AssetID != "" {
+		scope = "asset " + t.AssetID
+	}
+	s.audit(r.Context(), owner, auditKeyChange, scopedTokenActor(t.ID), "minted "+t.Access+" token for "+scope)
+	v := t.v1()
+	v.Token = token
+	w.Header().Set("Cache-Control", "no-store")
+	sendEnvelope(w, http.StatusCreated, v)
+}
+
+// insertScopedToken generates a token for a record and stores the record
+// under the token's ID.
+func (s *Server) insertScopedToken(t *ScopedToken) (string, error) {
+	for {
+		b := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return "", err
+		}
+		token := scopedTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+		t.ID = strings.TrimPrefix(keyActor(token), "key:")
+		t.Hash = hashAPIKey(token)
+		err := s.scopedTokens.insert(t.ID, *t)
+		if errors.Is(err, errRecordExists) {
+			continue
+		}
+		return token, err
+	}
+}
+
+// listScopedTokensHandler lists the tokens minted by the key of a request,
+// newest first.
+func (s *Server) listScopedTokensHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+	owner := requestKeyActor(r)
+	list := []ScopedTokenV1{}
+	for _, t := range s.scopedTokens.list() {
+		if t.Owner == owner {
+			list = append(list, t.v1())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	sendEnvelope(w, http.StatusOK, list)
+}
+
+// revokeScopedTokenHandler revokes a token minted by the key of a request.
+func (s *Server) revokeScopedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+	id := r.PathValue("id")
+	owner := requestKeyActor(r)
+	t, err := s.scopedTokens.update(id, func(t *ScopedToken) error {
+		if t.Owner != owner {
+			return errRecordNotFound
+		}
+		if t.RevokedAt == nil {
+			now := s.now().UTC()
+			t.RevokedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		s.sendEnvelopeError(w, r, http.StatusNotFound, "not_found", "Token not found")
+		return
+	}
+	s.audit(r.Context(), owner, auditKeyChange, scopedTokenActor(id), "revoked")
+	sendEnvelope(w, http.StatusOK, t.v1())
+}
+
+// albumHandler lists the active assets of an album, for the API key or a
+// read token of the album, which only sees those its key uploaded.  Those
+// of an album uploaded as one come first, in their order, then the others
+// newest first.
+func (s *Server) albumHandler(w http.ResponseWriter, r *http.Request) {
+	album := strings.ToLower(r.PathValue("name"))
+	t, scoped := requestScopedToken(r)
+	if scoped = scoped && t.Access == accessRead && t.Album == album; scoped {
+		s.audit(r.Context(), scopedTokenActor(t.ID), auditKeyUse, r.URL.Path, "accepted for "+t.Owner)
+	} else if !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+
+	var assets []Asset
+	for _, asset := range s.assets.list() {
+		if scoped && asset.Uploader != t.Owner {
+			continue
+		}
+		if asset.State == stateActive && slices.Contains(asset.Tags, albumTagPrefix+album) {
+			assets = append(assets, asset)
+		}
+	}
+	s.sortAlbum(album, assets)
+	list := []AssetV1{}
+	for _, asset := range assets {
+		list = append(list, s.originAsset(r, s.assetV1(&asset, "")))
+	}
+	sendEnvelope(w, http.StatusOK, list)
+}
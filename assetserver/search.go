@@ -0,0 +1,164 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// assetFilter selects assets for the admin search.  Empty fields match
+// everything.
+type assetFilter struct {
+	Text             string
+	Types            []string
+	Uploader         string
+	User             string
+	State            AssetState
+	Since, Until     time.Time
+	MinSize, MaxSize int64
+	Metadata         map[string]string
+	Tags             []string
+	Limit            int
+}
+
+func (f *assetFilter) match(a *Asset) bool {
+	switch {
+	case len(f.Types) > 0 && !matchContentType(a.ContentType, f.Types):
+		return false
+	case f.Uploader != "" && a.Uploader != f.Uploader:
+		return false
+	case f.User != "" && a.User != f.User:
+		return false
+	case f.State != "" && a.State != f.State:
+		return false
+	case !f.Since.IsZero() && a.UploadedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !a.UploadedAt.Before(f.Until):
+		return false
+	case f.MinSize > 0 && a.Size < f.MinSize:
+		return false
+	case f.MaxSize > 0 && a.Size > f.MaxSize:
+		return false
+	case !a.hasTags(f.Tags):
+		return false
+	}
+	for key, want := range f.Metadata {
+		v, ok := a.Metadata[key]
+		if !ok || !strings.EqualFold(fmt.Sprint(v), want) {
+			return false
+		}
+	}
+	if f.Text != "" && !a.containsText(f.Text) {
+		return false
+	}
+	return true
+}
+
+// containsText reports whether the original name or any top level
+// metadata value contains s, ignoring case.
+func (a *Asset) containsText(s string) bool {
+	s = strings.ToLower(s)
+	if strings.Contains(strings.ToLower(a.OriginalName), s) {
+		return true
+	}
+	for _, v := range a.Metadata {
+		if str, ok := v.(string); ok && strings.Contains(strings.ToLower(str), s) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAssetFilter reads an asset filter from query parameters: q (text in
+// the original name or metadata values), type (repeatable, wildcards
+// allowed), uploader, user (identity key), state, since and until (RFC
+// 3339 upload times), min_size and max_size (bytes), meta (repeatable
+// key:value pairs matching top level metadata), tag (repeatable, all must
+// be set) and limit.  It returns a message for the client if a parameter
+// is invalid.
+func parseAssetFilter(q url.Values) (assetFilter, string) {
+	f := assetFilter{
+		Text:     q.Get("q"),
+		Types:    q["type"],
+		Uploader: q.Get("uploader"),
+		User:     strings.ToLower(q.Get("user")),
+		State:    AssetState(q.Get("state")),
+		Limit:    100,
+	}
+
+	var err error
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, "Invalid since time"
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, "Invalid until time"
+		}
+	}
+	if v := q.Get("min_size"); v != "" {
+		if f.MinSize, err = strconv.ParseInt(v, 10, 64); err != nil || f.MinSize < 0 {
+			return f, "Invalid min_size"
+		}
+	}
+	if v := q.Get("max_size"); v != "" {
+		if f.MaxSize, err = strconv.ParseInt(v, 10, 64); err != nil || f.MaxSize < 0 {
+			return f, "Invalid max_size"
+		}
+	}
+	for _, v := range q["meta"] {
+		key, value, ok := strings.Cut(v, ":")
+		if !ok || key == "" {
+			return f, "meta must have the form key:value"
+		}
+		if f.Metadata == nil {
+			f.Metadata = make(map[string]string)
+		}
+		f.Metadata[key] = value
+	}
+	if len(q["tag"]) > 0 {
+		tags, uerr := parseTags(q["tag"])
+		if uerr != nil {
+			return f, uerr.message
+		}
+		f.Tags = tags
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit <= 0 {
+			return f, "Invalid limit"
+		}
+	}
+	return f, ""
+}
+
+// adminSearchHandler finds assets by their metadata, newest first.
+func (s *Server) adminSearchHandler(w http.ResponseWriter, r *http.Request) {
+	f, msg := parseAssetFilter(r.URL.Query())
+	if msg != "" {
+		writeJSON(w, http.StatusBadRequest, Response{Message: msg})
+		return
+	}
+
+	matches := []Asset{}
+	for _, asset := range s.assets.list() {
+		if f.match(&asset) {
+			matches = append(matches, asset)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].UploadedAt.After(matches[j].UploadedAt)
+	})
+	if len(matches) > f.Limit {
+		matches = matches[:f.Limit]
+	}
+	writeJSON(w, http.StatusOK, matches)
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// secretOptions are the options that may be supplied indirectly rather than
+// written into the configuration file.  For each option:
+//
+//   - ASSETSERVER_<OPTION> in the environment overrides the file
+//   - <option>_file reads the value from a file, e.g. a Docker secret
+//   - a value of env:VAR reads environment variable VAR
+//   - a value of vault:<path>#<field> reads a field of a Vault secret
+var secretOptions = []string{"api_key", "admin_key", "report_captcha_secret", "cold_s3_secret_key", "cdn_signing_key", "hotlink_signing_key", "webhook_secret", "transcribe_key", "smtp_secret"}
+
+// resolveSecrets replaces indirect secret references in the raw
+// configuration with their values.
+func resolveSecrets(raw map[string]any) error {
+	var vault *vaultClient
+	for _, name := range secretOptions {
+		fileKey := name + "_file"
+		if v, ok := raw[fileKey]; ok {
+			delete(raw, fileKey)
+			if _, dup := raw[name]; dup {
+				return fmt.Errorf("only one of %s and %s may be set", name, fileKey)
+			}
+			path, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("%s must be a path", fileKey)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("error reading %s: %v", fileKey, err)
+			}
+			raw[name] = strings.TrimSpace(string(data))
+		}
+
+		if v, ok := os.LookupEnv("ASSETSERVER_" + strings.ToUpper(name)); ok {
+			raw[name] = v
+		}
+
+		value, ok := raw[name].(string)
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(value, "env:"):
+			v, ok := os.LookupEnv(strings.TrimPrefix(value, "env:"))
+			if !ok {
+				return fmt.Errorf("%s: environment variable %s is not set", name, strings.TrimPrefix(value, "env:"))
+			}
+			raw[name] = v
+
+		case strings.HasPrefix(value, "vault:"):
+			if vault == nil {
+				var err error
+				if vault, err = newVaultClient(raw); err != nil {
+					return fmt.Errorf("%s: %v", name, err)
+				}
+			}
+			v, err := vault.read(strings.TrimPrefix(value, "vault:"))
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			raw[name] = v
+		}
+	}
+	return nil
+}
+
+// vaultClient reads secrets from a HashiCorp Vault KV engine.
+type vaultClient struct {
+	addr   string
+	token  string
+	client *http.Client
+}
+
+// newVaultClient configures a client from the vault_addr and
+// vault_token_file options, falling back to the VAULT_ADDR and VAULT_TOKEN
+// environment variables the vault CLI uses.
+func newVaultClient(raw map[string]any) (*vaultClient, error) {
+	addr, _ := raw["vault_addr"].(string)
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("vault reference used but vault_addr is not set")
+	}
+
+	token := os.Getenv("VAULT_TOKEN")
+	if path, _ := raw["vault_token_file"].(string); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading vault_token_file: %v", err)
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	if token == "" {
+		return nil, fmt.Errorf("vault reference used but no vault token is available")
+	}
+
+	return &vaultClient{
+		addr:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// read fetches a reference of the form <path>#<field>, e.g.
+// secret/data/assetserver#api_key.  Both KV version 1 and 2 responses are
+// understood.
+func (c *vaultClient) read(ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("vault reference %q must have the form path#field", ref)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.addr+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error contacting vault: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s for %s", resp.Status, path)
+	}
+
+	var body struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("error decoding vault response: %v", err)
+	}
+
+	// KV version 2 nests the secret under data.data
+	data := body.Data
+	if nested, ok := data["data"].(map[string]any); ok {
+		data = nested
+	}
+	v, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("vault secret %s has no field %s", path, field)
+	}
+	return v, nil
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// selfTestTimeout bounds each stage of a self-test
+	selfTestTimeout = time.Minute
+
+	// selfTestPoll is how often a self-test looks for the checks of its
+	// upload to finish
+	selfTestPoll = 100 * time.Millisecond
+)
+
+// SelfTest makes a round trip through the server with the configuration
+// at path, or the default one if path is empty: it uploads a small image,
+// waits for its checks, downloads it and verifies its SHA-256, and deletes
+// it.  The server at baseURL is tested if it is set, otherwise one started
+// on a loopback port for the test, using the configured storage either
+// way.  It writes the outcome and duration of each stage to w and returns
+// whether all passed.
+func SelfTest(ctx context.Context, path, baseURL string, w io.Writer) bool {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		fmt.Fprintf(w, "FAIL  %s: %v\n", cfg.Path, err)
+		return false
+	}
+	if baseURL == "" {
+		srv, err := New(cfg)
+		if err != nil {
+			fmt.Fprintf(w, "FAIL  %s: %v\n", cfg.Path, err)
+			return false
+		}
+		defer srv.Close()
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			fmt.Fprintf(w, "FAIL  listen: %v\n", err)
+			return false
+		}
+		hs := &http.Server{Handler: srv.Handler()}
+		go hs.Serve(ln)
+		defer hs.Close()
+		baseURL = "http://" + ln.Addr().String()
+	}
+	t := &selfTest{
+		client:  &http.Client{Timeout: selfTestTimeout},
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  cfg.APIKey,
+	}
+	return t.run(ctx, w)
+}
+
+// selfTest is the state of a self-test passed from stage to stage.
+type selfTest struct {
+	client  *http.Client
+	baseURL string
+	apiKey  string
+
+	data  []byte
+	sum   string
+	asset AssetV1
+}
+
+func (t *selfTest) run(ctx context.Context, w io.Writer) bool {
+	stages := []struct {
+		name string
+		run  func(context.Context) (string, error)
+	}{
+		{"upload", t.upload},
+		{"check", t.check},
+		{"fetch", t.fetch},
+		{"delete", t.delete},
+		{"gone", t.gone},
+	}
+	start := time.Now()
+	for _, stage := range stages {
+		begin := time.Now()
+		ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+		note, err := stage.run(ctx)
+		cancel()
+		took := time.Since(begin).Round(time.Millisecond)
+		if err != nil {
+			fmt.Fprintf(w, "FAIL  %-7s %8v  %v\n", stage.name, took, err)
+			fmt.Fprintln(w, "self-test failed")
+			return false
+		}
+		if note != "" {
+			note = "  " + note
+		}
+		fmt.Fprintf(w, "ok    %-7s %8v%s\n", stage.name, took, note)
+	}
+	fmt.Fprintf(w, "self-test passed in %v\n", time.Since(start).Round(time.Millisecond))
+	return true
+}
+
+// upload stores an image of random pixels, so its hash is new and no
+// deduplication or cache can answer for the server.
+func (t *selfTest) upload(ctx context.Context) (string, error) {
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	if _, err := rand.Read(img.Pix); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	t.data = buf.Bytes()
+	sum := sha256.Sum256(t.data)
+	t.sum = hex.EncodeToString(sum[:])
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", `form-data; name="file"; filename="selftest.png"`)
+	h.Set("Content-Type", "image/png")
+	part, err := mw.CreatePart(h)
+	if err != nil {
+		return "", err
+	}
+	part.Write(t.data)
+	mw.Close()
+
+	resp, err := t.do(ctx, http.MethodPost, "/api/v1/upload", mw.FormDataContentType(), &body)
+	if err != nil {
+		return "", err
+	}
+	if err := decodeSelfTest(resp, http.StatusCreated, &t.asset); err != nil {
+		return "", err
+	}
+	if t.asset.SHA256 != t.sum {
+		return "", fmt.Errorf("stored SHA-256 %s, sent %s", t.asset.SHA256, t.sum)
+	}
+	return t.asset.ID, nil
+}
+
+// check waits for the checks of the upload, which may run after the
+// response with async_checks.
+func (t *selfTest) check(ctx context.Context) (string, error) {
+	for t.asset.State == statePending {
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("checks not done: %v", ctx.Err())
+		case <-time.After(selfTestPoll):
+		}
+		if err := t.info(ctx); err != nil {
+			return "", err
+		}
+	}
+	if t.asset.State != stateActive {
+		return "", fmt.Errorf("asset %s", t.asset.State)
+	}
+	return "", nil
+}
+
+func (t *selfTest) fetch(ctx context.Context) (string, error) {
+	resp, err := t.do(ctx, http.MethodGet, "/api/v1/download/"+t.asset.ID, "", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download answered %s", resp.Status)
+	}
+	hash := sha256.New()
+	n, err := io.Copy(hash, resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != t.sum {
+		return "", fmt.Errorf("downloaded SHA-256 %s, sent %s", sum, t.sum)
+	}
+	return fmt.Sprintf("%d bytes, SHA-256 verified", n), nil
+}
+
+// delete deletes the asset with its token.  A single download asset is
+// deleted by its download instead, which happens once the response has
+// been sent, so that is waited for.
+func (t *selfTest) delete(ctx context.Context) (string, error) {
+	if t.asset.MaxDownloads != nil && *t.asset.MaxDownloads == 1 {
+		for {
+			if err := t.info(ctx); err != nil {
+				return "", err
+			}
+			if t.asset.State == stateDeleted {
+				return "deleted by its download", nil
+			}
+			select {
+			case <-ctx.Done():
+				return "", fmt.Errorf("not deleted after its download: %v", ctx.Err())
+			case <-time.After(selfTestPoll):
+			}
+		}
+	}
+
+	resp, err := t.do(ctx, http.MethodDelete, "/api/v1/assets/"+t.asset.ID+"?token="+url.QueryEscape(t.asset.DeleteToken), "", nil)
+	if err != nil {
+		return "", err
+	}
+	return "", decodeSelfTest(resp, http.StatusOK, nil)
+}
+
+func (t *selfTest) gone(ctx context.Context) (string, error) {
+	resp, err := t.do(ctx, http.MethodGet, "/api/v1/download/"+t.asset.ID, "", nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone {
+		return "", fmt.Errorf("download after delete answered %s", resp.Status)
+	}
+	return "", nil
+}
+
+// info refreshes the asset object.
+func (t *selfTest) info(ctx context.Context) error {
+	resp, err := t.do(ctx, http.MethodGet, "/api/v1/assets/"+t.asset.ID, "", nil)
+	if err != nil {
+		return err
+	}
+	var asset AssetV1
+	if err := decodeSelfTest(resp, http.StatusOK, &asset); err != nil {
+		return err
+	}
+	asset.DeleteToken = t.asset.DeleteToken
+	t.asset = asset
+	return nil
+}
+
+func (t *selfTest) do(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", t.apiKey)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return t.client.Do(req)
+}
+
+// decodeSelfTest reads the envelope of an /api/v1 response into data,
+// failing unless it has the status expected.
+func decodeSelfTest(resp *http.Response, status int, data any) error {
+	defer resp.Body.Close()
+	var env struct {
+		Data  json.RawMessage `json:"data"`
+		Error *APIError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+		return fmt.Errorf("%s: %v", resp.Status, err)
+	}
+	if resp.StatusCode != status {
+		if env.Error != nil {
+			return fmt.Errorf("%s: %s", resp.Status, env.Error.Message)
+		}
+		return errors.New(resp.Status)
+	}
+	if data == nil {
+		return nil
+	}
+	return json.Unmarshal(env.Data, data)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"io"
+	"sync"
+)
+
+// sendChunk is how much of a file is handed to the connection at once, so
+// the progress of a transfer stays current while the kernel copies it.
+const sendChunk = 4 << 20
+
+// copyBuffers are the buffers of copies neither side can do on its own.
+var copyBuffers = sync.Pool{
+	New: func() any {
+		b := make([]byte, 32<<10)
+		return &b
+	},
+}
+
+// copyBuffer is io.Copy with a pooled buffer.  Like io.Copy, it lets dst
+// or src do the copy if they can, as a connection does with sendfile.
+func copyBuffer(dst io.Writer, src io.Reader) (int64, error) {
+	buf := copyBuffers.Get().(*[]byte)
+	defer copyBuffers.Put(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
+
+// sendFileRange writes length bytes of f from offset to w.  The file is
+// passed as a limited reader, which net/http sends with sendfile when f is
+// an *os.File and w leads to a plain TCP connection, rather than read into
+// memory.
+func sendFileRange(w io.Writer, f io.ReadSeeker, offset, length int64) (int64, error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var sent int64
+	for sent < length {
+		n, err := copyBuffer(w, io.LimitReader(f, min(sendChunk, length-sent)))
+		sent += n
+		if err != nil {
+			return sent, err
+		}
+		if n == 0 {
+			return sent, io.ErrUnexpectedEOF
+		}
+	}
+	return sent, nil
+}
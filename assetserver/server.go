@@ -0,0 +1,2065 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/karamble/braibot-assetserver/internal/upload"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+type Config struct {
+	// Path is the file the configuration was read from, if any, and
+	// Warnings are about deprecated and unknown options in it
+	Path     string   `json:"-"`
+	Warnings []string `json:"-"`
+
+	MaxFileSize  int64    `json:"max_file_size"`
+	APIKey       string   `json:"api_key"`
+	UploadDir    string   `json:"upload_dir"`
+	Port         string   `json:"port"`
+	Domain       string   `json:"domain"`
+	AllowedTypes []string `json:"allowed_types"`
+	DataDir      string   `json:"data_dir"`
+	AdminKey     string   `json:"admin_key"`
+
+	// Clients presenting a wrong key auth_max_failures times (default 10,
+	// -1 for no limit) within auth_failure_window are locked out for
+	// auth_lockout, doubling with every lockout in a row
+	AuthMaxFailures   int      `json:"auth_max_failures"`
+	AuthFailureWindow Duration `json:"auth_failure_window"`
+	AuthLockout       Duration `json:"auth_lockout"`
+
+	// How long a session token from /api/v1/auth lasts unused (default
+	// 15m, at most 24h, which also bounds a session in use)
+	SessionTTL Duration `json:"session_ttl"`
+
+	// Uploads without an API key, off unless anonymous_uploads is set.
+	// They need a scan_command, are held to anonymous_max_file_size and
+	// anonymous_types, expire after anonymous_ttl and are limited to
+	// anonymous_rate_limit per client per hour.
+	AnonymousUploads     bool     `json:"anonymous_uploads"`
+	AnonymousMaxFileSize int64    `json:"anonymous_max_file_size"`
+	AnonymousTypes       []string `json:"anonymous_types"`
+	AnonymousTTL         Duration `json:"anonymous_ttl"`
+	AnonymousRateLimit   int      `json:"anonymous_rate_limit"`
+
+	// Timeouts for reading a request, writing a response and keeping an
+	// idle connection open.  Uploads instead get upload_timeout to arrive
+	// and be stored.
+	ReadTimeout   Duration `json:"read_timeout"`
+	WriteTimeout  Duration `json:"write_timeout"`
+	IdleTimeout   Duration `json:"idle_timeout"`
+	UploadTimeout Duration `json:"upload_timeout"`
+
+	// Defenses against clients tying up connections: the time to send the
+	// request headers, the average rate in bytes per second uploads must
+	// reach after upload_rate_grace (-1 for none) and the connections a
+	// client may hold open at once (-1 for no limit).
+	ReadHeaderTimeout Duration `json:"read_header_timeout"`
+	MinUploadRate     int64    `json:"min_upload_rate"`
+	UploadRateGrace   Duration `json:"upload_rate_grace"`
+	MaxConnsPerIP     int      `json:"max_conns_per_ip"`
+
+	// Largest request headers in bytes, and limits on request bodies in
+	// bytes by path prefix, e.g. /api/v1/keys, in place of each endpoint's
+	// own: max_file_size for uploads and 64 KB for other requests.
+	MaxHeaderBytes int              `json:"max_header_bytes"`
+	BodyLimits     map[string]int64 `json:"body_limits"`
+
+	// Process and check every upload, then discard it, for testing
+	// integrations without storing anything
+	DryRun bool `json:"dry_run"`
+
+	// Address to serve the gRPC API on, off if empty
+	GRPCPort string `json:"grpc_port"`
+
+	// Address of an SFTP listener ingesting the files written to it, off
+	// if empty, the keys it accepts as authorized_keys lines, and its host
+	// key, created on first use
+	SFTPListen         string   `json:"sftp_listen"`
+	SFTPAuthorizedKeys []string `json:"sftp_authorized_keys"`
+	SFTPHostKey        string   `json:"sftp_host_key"`
+
+	// Address of an SMTP listener storing the attachments of mail from
+	// smtp_senders to smtp_address with smtp_secret after a plus in its
+	// local part, off if empty, and the relay its replies go through
+	SMTPListen  string   `json:"smtp_listen"`
+	SMTPAddress string   `json:"smtp_address"`
+	SMTPSecret  string   `json:"smtp_secret"`
+	SMTPSenders []string `json:"smtp_senders"`
+	SMTPRelay   string   `json:"smtp_relay"`
+
+	// Language of messages to clients whose Accept-Language has none we
+	// have, and a directory of <language>.json message catalogs
+	Language  string `json:"language"`
+	LocaleDir string `json:"locale_dir"`
+
+	// Client extensions kept for types without a canonical extension
+	AllowedExtensions []string `json:"allowed_extensions"`
+
+	// Where the type of an upload is taken from, first to last: "part",
+	// "header", "field" and "sniff".  strict_content_type only trusts
+	// sniffing.
+	ContentTypeOrder  []string `json:"content_type_order"`
+	StrictContentType bool     `json:"strict_content_type"`
+
+	// Directory uploads are written to before they are moved to
+	// upload_dir, and the most bytes of uploads it may hold at once
+	StagingDir     string `json:"staging_dir"`
+	StagingMaxSize int64  `json:"staging_max_size"`
+
+	// Where assets are kept: "disk", the default, or "memory" for a
+	// throwaway store in RAM that is gone once the server stops.  At most
+	// max_storage_size bytes of assets are kept, if set.
+	StorageBackend string `json:"storage_backend"`
+	MaxStorageSize int64  `json:"max_storage_size"`
+
+	// Store files of compress_storage_types compressed with zstd when that
+	// makes them smaller, sending them as they are to clients accepting
+	// zstd and decompressed to others
+	CompressStorage      bool     `json:"compress_storage"`
+	CompressStorageTypes []string `json:"compress_storage_types"`
+
+	// Uploads are answered with a warning once max_storage_size or the
+	// quota of their user is this full, from 0 to 1; -1 turns warnings off
+	QuotaWarning float64 `json:"quota_warning"`
+
+	// Directory other programs drop files into, which are stored as
+	// uploads and removed from it, off if empty, and how often it is
+	// scanned for new files
+	InboxDir      string   `json:"inbox_dir"`
+	InboxInterval Duration `json:"inbox_interval"`
+
+	// Most files accepted in one multipart upload, and the bytes of them
+	// kept in memory; the rest are written to the staging area
+	MaxBatchFiles   int   `json:"max_batch_files"`
+	MultipartMemory int64 `json:"multipart_memory"`
+
+	// Accept opaque, client-side encrypted uploads
+	BlindUploads bool `json:"blind_uploads"`
+
+	// Serve QR codes of download URLs and link them in asset objects
+	QRCodes bool `json:"qr_codes"`
+
+	// Refuse downloads linked from other sites unless the referer is
+	// allowed or the link carries a token signed with hotlink_signing_key
+	HotlinkAllowedReferers []string `json:"hotlink_allowed_referers"`
+	HotlinkRequireReferer  bool     `json:"hotlink_require_referer"`
+	HotlinkSigningKey      string   `json:"hotlink_signing_key"`
+
+	// Give assets a /s/{code} link redirecting to the download URL
+	ShortLinks      bool `json:"short_links"`
+	ShortLinkLength int  `json:"short_link_length"`
+
+	// Longest edge of the thumbnails generated for images, in pixels
+	ThumbnailSizes []int  `json:"thumbnail_sizes"`
+	TrustProxy     bool   `json:"trust_proxy"`
+	AuditLog       string `json:"audit_log"`
+	DebugListen    string `json:"debug_listen"`
+
+	// Least important messages logged: "debug" adds the details of each
+	// request, "info" (the default) what the server does and "error" only
+	// errors.  log_mime logs how the content types of uploads are
+	// detected.  Both can be changed at runtime through /admin/logging.
+	LogLevel string `json:"log_level"`
+	LogMIME  bool   `json:"log_mime"`
+
+	// Smallest JSON response gzipped for clients accepting it, in bytes
+	// (default 1 KB, -1 to never compress)
+	CompressMinSize int64 `json:"compress_min_size"`
+
+	// Start refusing uploads with read_only_message while still serving
+	// downloads, until turned off through /admin/maintenance
+	ReadOnly        bool   `json:"read_only"`
+	ReadOnlyMessage string `json:"read_only_message"`
+
+	// OpenTelemetry trace export
+	OTLPEndpoint     string  `json:"otlp_endpoint"`
+	OTLPInsecure     bool    `json:"otlp_insecure"`
+	TraceSampleRatio float64 `json:"trace_sample_ratio"`
+
+	// Abuse reporting
+	ReportRateLimit        int    `json:"report_rate_limit"`
+	ReportCaptchaSecret    string `json:"report_captcha_secret"`
+	ReportCaptchaVerifyURL string `json:"report_captcha_verify_url"`
+
+	// Leading zero bits of the proof of work reports need, off if 0
+	ReportPowDifficulty int `json:"report_pow_difficulty"`
+
+	// Vault server for vault: secret references
+	VaultAddr      string `json:"vault_addr"`
+	VaultTokenFile string `json:"vault_token_file"`
+
+	// Command run on every upload, with the file path appended.  A non-zero
+	// exit status quarantines the file.
+	ScanCommand []string `json:"scan_command"`
+
+	// Rules deciding how long assets are kept, first match wins
+	RetentionRules []RetentionRule `json:"retention_rules"`
+
+	// Cache-Control of downloads of single download, limited and
+	// unlimited assets
+	CacheControlOnce      string `json:"cache_control_once"`
+	CacheControlLimited   string `json:"cache_control_limited"`
+	CacheControlUnlimited string `json:"cache_control_unlimited"`
+
+	// How long deleted files are kept for recovery; zero deletes at once
+	TrashRetention Duration `json:"trash_retention"`
+
+	// Ed25519 key signing exported manifests, and the public keys of
+	// servers whose manifests may be imported
+	ManifestKey         string   `json:"manifest_key"`
+	ManifestTrustedKeys []string `json:"manifest_trusted_keys"`
+
+	// Announce public assets to other servers in this Bison Relay group
+	// chat, through the clientrpc websocket of a brclient at
+	// br_clientrpc_url, trusting br_server_cert and logging in with
+	// br_client_cert and br_client_key
+	BRAnnounceGC   string `json:"br_announce_gc"`
+	BRClientRPCURL string `json:"br_clientrpc_url"`
+	BRServerCert   string `json:"br_server_cert"`
+	BRClientCert   string `json:"br_client_cert"`
+	BRClientKey    string `json:"br_client_key"`
+
+	// Bison Relay users braibot uploads for may store up to br_user_quota
+	// bytes in up to br_user_max_files files, if set
+	BRUserQuota    int64 `json:"br_user_quota"`
+	BRUserMaxFiles int   `json:"br_user_max_files"`
+
+	// Route domain to this server on the proxy in front of it at startup:
+	// "caddy" through the admin API at caddy_admin_url, adding the route to
+	// caddy_server, or "traefik" by writing a file provider configuration to
+	// traefik_config.  proxy_upstream is the address the proxy connects to.
+	ProxyRegister       string `json:"proxy_register"`
+	ProxyUpstream       string `json:"proxy_upstream"`
+	CaddyAdminURL       string `json:"caddy_admin_url"`
+	CaddyServer         string `json:"caddy_server"`
+	TraefikConfig       string `json:"traefik_config"`
+	TraefikCertResolver string `json:"traefik_cert_resolver"`
+
+	// Other public origins serving the same assets, such as mirrors in
+	// other regions, and the request header carrying the client's country
+	// as found by GeoIP in front of the server
+	Origins             []Origin `json:"origins"`
+	OriginCountryHeader string   `json:"origin_country_header"`
+
+	// Move files untouched for cold_after to a cold backend, "dir" or "s3"
+	ColdAfter          Duration `json:"cold_after"`
+	ColdBackend        string   `json:"cold_backend"`
+	ColdDir            string   `json:"cold_dir"`
+	ColdS3Endpoint     string   `json:"cold_s3_endpoint"`
+	ColdS3Bucket       string   `json:"cold_s3_bucket"`
+	ColdS3Region       string   `json:"cold_s3_region"`
+	ColdS3Prefix       string   `json:"cold_s3_prefix"`
+	ColdS3AccessKey    string   `json:"cold_s3_access_key"`
+	ColdS3SecretKey    string   `json:"cold_s3_secret_key"`
+	ColdS3StorageClass string   `json:"cold_s3_storage_class"`
+	ColdS3Insecure     bool     `json:"cold_s3_insecure"`
+	// Retry-After sent while an archived file is being restored
+	ColdRetryAfter Duration `json:"cold_retry_after"`
+	// Stream downloads of cold files from the cold backend, passing
+	// ranges through, instead of bringing them back to upload_dir
+	ColdProxy bool `json:"cold_proxy"`
+
+	// Stores every upload is also written to, tried in this order to
+	// restore a lost file, and how many must have stored an upload for it
+	// to succeed
+	Replicas      []ReplicaConfig `json:"replicas"`
+	ReplicaWrites int             `json:"replica_writes"`
+
+	// Redirect downloads to a CDN pulling from the origin endpoint, with
+	// links signed by cdn_signing_key and valid for cdn_url_ttl
+	CDNURL        string   `json:"cdn_url"`
+	CDNSigningKey string   `json:"cdn_signing_key"`
+	CDNURLTTL     Duration `json:"cdn_url_ttl"`
+
+	// Re-encode PNG uploads as "jpeg", "webp" or "avif" at
+	// optimize_quality.  optimize_command replaces the encoder, with {in},
+	// {out} and {quality} substituted.  keep_originals keeps the upload as
+	// the original variant unless the upload asks otherwise.
+	OptimizeImages  string   `json:"optimize_images"`
+	OptimizeQuality int      `json:"optimize_quality"`
+	OptimizeCommand []string `json:"optimize_command"`
+	KeepOriginals   bool     `json:"keep_originals"`
+
+	// Convert animated GIFs of at least convert_gif_min_size bytes to the
+	// video formats in convert_gifs, "mp4" and "webm", using ffmpeg
+	ConvertGIFs       []string `json:"convert_gifs"`
+	ConvertGIFMinSize int64    `json:"convert_gif_min_size"`
+	FFmpeg            string   `json:"ffmpeg"`
+
+	// Largest subtitle or transcript file that can be attached to an
+	// asset, in bytes (default 1 MB)
+	MaxSidecarSize int64 `json:"max_sidecar_size"`
+
+	// Probe the duration, sample rate and channels of audio uploads with
+	// ffprobe
+	ProbeAudio bool `json:"probe_audio"`
+
+	// Package video, and audio of at least hls_min_audio_duration, for
+	// streaming with HLS in renditions of hls_heights, using ffmpeg and
+	// ffprobe
+	HLS                 bool     `json:"hls"`
+	HLSHeights          []int    `json:"hls_heights"`
+	HLSSegmentDuration  Duration `json:"hls_segment_duration"`
+	HLSMinAudioDuration Duration `json:"hls_min_audio_duration"`
+	FFprobe             string   `json:"ffprobe"`
+
+	// Widths images are also resized to, in pixels, listed as a srcset in
+	// the asset object
+	SrcsetWidths []int `json:"srcset_widths"`
+
+	// Count the pages of PDFs and render their first page for thumbnails
+	// with the poppler tools
+	PDFPreviews bool   `json:"pdf_previews"`
+	PDFToPPM    string `json:"pdftoppm"`
+	PDFInfo     string `json:"pdfinfo"`
+
+	// Mark images uploaded with some keys as AI generated.  The c2pa
+	// method signs with c2pa_sign_cert and c2pa_private_key, or c2patool's
+	// test certificate if they are not set.
+	ProvenanceRules []ProvenanceRule `json:"provenance_rules"`
+	C2PACommand     []string         `json:"c2pa_command"`
+	C2PASignCert    string           `json:"c2pa_sign_cert"`
+	C2PAPrivateKey  string           `json:"c2pa_private_key"`
+	C2PASignAlg     string           `json:"c2pa_sign_alg"`
+
+	// NSFW image classifier, either a command printing a score or a
+	// service answering with one, and what to do about flagged images
+	NSFWCommand   []string   `json:"nsfw_command"`
+	NSFWURL       string     `json:"nsfw_url"`
+	NSFWThreshold float64    `json:"nsfw_threshold"`
+	NSFWRules     []NSFWRule `json:"nsfw_rules"`
+
+	// Speech to text of audio uploads, either a command printing the text,
+	// such as whisper.cpp, or a service answering with it.  The transcript
+	// is stored as the transcript.txt sidecar.
+	TranscribeCommand []string `json:"transcribe_command"`
+	TranscribeURL     string   `json:"transcribe_url"`
+	TranscribeKey     string   `json:"transcribe_key"`
+
+	// Answer uploads before they are checked, and post the verdicts of
+	// the checks to webhook_url signed with webhook_secret
+	AsyncChecks   bool   `json:"async_checks"`
+	WebhookURL    string `json:"webhook_url"`
+	WebhookSecret string `json:"webhook_secret"`
+
+	// Processing stages uploads go through, by type, type family such as
+	// "image" or "default"
+	Pipelines map[string][]string `json:"pipelines"`
+
+	// Stages that may run at once (default the number of CPUs, -1 for no
+	// limit), how long each stage may take, by name, and which stages get
+	// a free worker first: higher priorities, by default thumbnails and
+	// other quick stages before transcodes
+	ProcessingWorkers int                 `json:"processing_workers"`
+	StageTimeouts     map[string]Duration `json:"stage_timeouts"`
+	StagePriorities   map[string]int      `json:"stage_priorities"`
+}
+
+type Response struct {
+	Success     bool     `json:"success"`
+	Message     string   `json:"message"`
+	URL         string   `json:"url,omitempty"`
+	MaxFileSize int64    `json:"max_file_size,omitempty"`
+	Schema      string   `json:"schema,omitempty"`
+	Asset       *AssetV1 `json:"asset,omitempty"`
+
+	// What the server accepts, as reported by /test
+	Capabilities *Capabilities `json:"capabilities,omitempty"`
+
+	// Per-file results of a batch upload
+	Results []UploadResult `json:"results,omitempty"`
+
+	// Limits an upload is getting close to
+	Warnings []Warning `json:"warnings,omitempty"`
+}
+
+// Server is an asset server.  Each server has its own configuration and
+// files, so several may run in one process.
+type Server struct {
+	config Config
+
+	// now is the clock uploads are dated and expire by.  Tests replace it
+	// to move assets through their lifetime without waiting.
+	now       func() time.Time
+	startTime time.Time
+
+	// panics counts the panics recovered from, as /debug/stats reports
+	panics atomic.Int64
+
+	assets     *recordStore[Asset]
+	reports    *recordStore[Report]
+	shortLinks *recordStore[ShortLink]
+	usage      *recordStore[Usage]
+	apiKeys    *recordStore[APIKey]
+
+	// scopedTokens are the tokens limited to an album or asset
+	scopedTokens *recordStore[ScopedToken]
+
+	// users are the Bison Relay users files are stored for
+	users *recordStore[User]
+
+	// albums order the assets of albums uploaded as one
+	albums  *recordStore[Album]
+	auditor *auditLog
+
+	// cold is nil unless tiering is configured
+	cold fileStore
+
+	// warming tracks retrievals from cold storage in progress, so
+	// concurrent downloads of a cold asset fetch it once
+	warming struct {
+		sync.Mutex
+		inFlight map[string]chan struct{}
+	}
+
+	// replicas are in the order files are restored from
+	replicas []*replica
+
+	// catalogs are the translations by lower case language tag.  English
+	// needs none.
+	catalogs map[string]map[string]string
+
+	reportLimiter    *rateLimiter
+	anonymousLimiter *rateLimiter
+
+	// workers run the processing stages of uploads
+	workers workerPool
+
+	// pow issues the proof-of-work challenges of anonymous endpoints
+	pow *powChallenges
+
+	// passwordLimiter bounds password attempts per client across all
+	// assets
+	passwordLimiter *rateLimiter
+
+	uploadReplies *idempotencyCache
+
+	// stagingUsed is the number of bytes of uploads being staged
+	stagingUsed atomic.Int64
+
+	// multipartTemp counts the files multipart uploads spill to
+	multipartTemp multipartTemp
+
+	// storageReserved is the number of bytes of uploads being stored that
+	// their records don't count yet
+	storageMu       sync.Mutex
+	storageReserved int64
+	userReserved    map[string]userReservation
+
+	// downloadsReserved counts the whole file downloads being sent of each
+	// asset with limited downloads
+	downloadsMu       sync.Mutex
+	downloadsReserved map[string]int
+
+	// memoryDir holds everything the memory storage_backend stores
+	memoryDir string
+
+	// stats caches the asset statistics of /admin/stats
+	stats assetStats
+
+	// logs are the logging options, which may change at runtime
+	logs logSettings
+
+	// maintenance is whether uploads are refused, which may change at
+	// runtime
+	maintenance maintenanceMode
+
+	// transfers are the uploads and downloads in progress
+	transfers transfers
+
+	// events feeds the /events streams
+	events eventHub
+
+	// challenges are issued for downloads restricted to recipients
+	challenges challenges
+
+	// tickets are the single use upload tickets minted
+	tickets tickets
+
+	// sessions are the session tokens API keys were exchanged for
+	sessions sessions
+
+	// authGuard locks out clients guessing keys
+	authGuard authGuard
+
+	// sftpKeys maps the keys authorized for SFTP to their audit actors
+	sftpKeys map[string]string
+
+	// background tracks work that outlives the request that started it,
+	// so Close can wait for it
+	background sync.WaitGroup
+}
+
+// New checks a configuration, filling in defaults, and opens the
+// directories, stores and logs it names.  The server answers requests
+// through Handler; Run starts its background jobs.
+func New(cfg Config) (*Server, error) {
+	for _, warning := range cfg.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+	s := newServer(cfg)
+	if err := s.checkConfig(); err != nil {
+		return nil, err
+	}
+	if err := s.open(); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// newServer returns a server for cfg that has not been checked or opened.
+func newServer(cfg Config) *Server {
+	s := &Server{
+		config:          cfg,
+		now:             time.Now,
+		startTime:       time.Now(),
+		passwordLimiter: newRateLimiter(60, 10),
+		pow:             newPowChallenges(),
+		uploadReplies:   &idempotencyCache{entries: make(map[string]idempotentResponse)},
+	}
+	s.warming.inFlight = make(map[string]chan struct{})
+	return s
+}
+
+// Run runs the background jobs of the server, which sweep expired assets,
+// finish checks interrupted by a restart and ingest files dropped into
+// inbox_dir, and the debug listener if
+// debug_listen is set, until ctx is done or the debug listener fails.
+// It first removes what a crash left in the staging area, so it must be
+// called before the server takes uploads.
+func (s *Server) Run(ctx context.Context) error {
+	if err := s.cleanStaging(); err != nil {
+		return err
+	}
+	return s.run(ctx)
+}
+
+// run is Run once the staging area is clean.
+func (s *Server) run(ctx context.Context) error {
+	go s.resumePendingChecks(ctx)
+	go s.runSweeper(ctx)
+	if s.config.InboxDir != "" {
+		go s.watchInbox(ctx)
+	}
+
+	if s.config.DebugListen == "" {
+		<-ctx.Done()
+		return nil
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.serveDebug(s.config.DebugListen)
+	}()
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errc:
+		return err
+	}
+}
+
+// ListenAndServe runs the server on its own: it sets up tracing, listens on
+// the configured port and runs the background jobs until either fails.
+// Programs embedding the server use Handler and Run instead.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if err := s.setupTracing(); err != nil {
+		return err
+	}
+	// Clean the staging area before listening, as Run would, rather than
+	// under uploads already coming in
+	if err := s.cleanStaging(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errc := make(chan error, 5)
+	go func() {
+		errc <- s.run(ctx)
+	}()
+	if s.config.GRPCPort != "" {
+		go func() {
+			s.infof("gRPC server starting on port %s...\n", s.config.GRPCPort)
+			errc <- s.serveGRPC()
+		}()
+	}
+	if s.config.SFTPListen != "" {
+		go func() {
+			errc <- s.serveSFTP(ctx)
+		}()
+	}
+	if s.config.SMTPListen != "" {
+		go func() {
+			errc <- s.serveSMTP(ctx)
+		}()
+	}
+	go func() {
+		s.infof("Server starting on port %s...\n", s.config.Port)
+		srv := &http.Server{
+			Handler:           s.Handler(),
+			ReadHeaderTimeout: time.Duration(s.config.ReadHeaderTimeout),
+			ReadTimeout:       time.Duration(s.config.ReadTimeout),
+			WriteTimeout:      time.Duration(s.config.WriteTimeout),
+			IdleTimeout:       time.Duration(s.config.IdleTimeout),
+			MaxHeaderBytes:    s.config.MaxHeaderBytes,
+		}
+		ln, err := net.Listen("tcp", s.config.Port)
+		if err != nil {
+			errc <- err
+			return
+		}
+		if s.config.MaxConnsPerIP > 0 {
+			ln = newConnLimitListener(ln, s.config.MaxConnsPerIP)
+		}
+		if s.config.ProxyRegister != "" {
+			if err := s.registerProxy(ctx); err != nil {
+				fmt.Printf("Error registering with %s: %v\n", s.config.ProxyRegister, err)
+			} else {
+				s.infof("Registered %s with %s\n", s.config.Domain, s.config.ProxyRegister)
+			}
+		}
+		errc <- srv.Serve(ln)
+	}()
+	return <-errc
+}
+
+// Close waits for work started by requests to finish and closes the files
+// the server holds open.
+func (s *Server) Close() error {
+	s.background.Wait()
+	return errors.Join(s.assets.close(), s.reports.close(), s.shortLinks.close(),
+		s.usage.close(), s.apiKeys.close(), s.scopedTokens.close(), s.users.close(), s.albums.close(), s.auditor.close(), s.removeMemoryStorage())
+}
+
+// checkConfig validates the configuration and fills in defaults.  Every
+// problem found is reported, not just the first.
+func (s *Server) checkConfig() error {
+	var errs []error
+	errs = append(errs, s.validateStorageConfig())
+	errs = append(errs, s.validateQuotaWarning())
+	errs = append(errs, s.validateLoggingConfig())
+	errs = append(errs, s.validateMaintenanceConfig())
+	errs = append(errs, s.validateCompressConfig())
+	errs = append(errs, s.validateStorageCompressionConfig())
+	errs = append(errs, s.validateSessionConfig())
+	errs = append(errs, s.validateUserConfig())
+	errs = append(errs, s.validateMultipartConfig())
+	if s.config.MaxFileSize <= 0 {
+		errs = append(errs, fmt.Errorf("max_file_size must be greater than 0"))
+	}
+	if s.config.APIKey == "" {
+		errs = append(errs, fmt.Errorf("api_key cannot be empty"))
+	}
+	if s.config.UploadDir == "" {
+		errs = append(errs, fmt.Errorf("upload_dir cannot be empty"))
+	}
+	if s.config.Port == "" {
+		s.config.Port = ":8080" // Default port
+	}
+	if s.config.Domain == "" {
+		errs = append(errs, fmt.Errorf("domain cannot be empty"))
+	}
+	if s.config.MaxBatchFiles <= 0 {
+		s.config.MaxBatchFiles = 10
+	}
+	if s.config.DataDir == "" {
+		s.config.DataDir = "./data"
+	}
+	if s.config.TraceSampleRatio <= 0 || s.config.TraceSampleRatio > 1 {
+		s.config.TraceSampleRatio = 1
+	}
+	if s.config.AuditLog == "" {
+		s.config.AuditLog = filepath.Join(s.config.DataDir, "audit.log")
+	}
+	if s.config.ManifestKey == "" {
+		s.config.ManifestKey = filepath.Join(s.config.DataDir, "manifest.key")
+	}
+	if s.config.ReportRateLimit <= 0 {
+		s.config.ReportRateLimit = 10 // Reports per hour per client
+	}
+	if s.config.ReportCaptchaVerifyURL == "" {
+		s.config.ReportCaptchaVerifyURL = "https://api.hcaptcha.com/siteverify"
+	}
+	if s.config.ReportPowDifficulty < 0 || s.config.ReportPowDifficulty > maxPowDifficulty {
+		errs = append(errs, fmt.Errorf("report_pow_difficulty must be between 0 and %d", maxPowDifficulty))
+	}
+
+	errs = append(errs, validateRetentionRules(s.config.RetentionRules))
+	errs = append(errs, s.validateContentTypeOrder())
+	errs = append(errs, s.validateOptimizeConfig())
+	errs = append(errs, s.validateGIFVideoConfig())
+	errs = append(errs, s.validateSrcsetConfig())
+	errs = append(errs, s.validateMediaConfig())
+	errs = append(errs, s.validateHLSConfig())
+	errs = append(errs, s.validateSidecarConfig())
+	errs = append(errs, s.validateTranscribeConfig())
+	errs = append(errs, s.loadCatalogs())
+	errs = append(errs, s.validateReplicas())
+	errs = append(errs, s.validateOrigins())
+	errs = append(errs, s.validateProxyRegisterConfig())
+	errs = append(errs, s.validateAnnounceConfig())
+	errs = append(errs, s.validatePipelines())
+	errs = append(errs, s.validateWorkerConfig())
+	errs = append(errs, s.validateNSFWConfig())
+	errs = append(errs, s.validateSFTPConfig())
+	errs = append(errs, s.validateSMTPConfig())
+	errs = append(errs, s.validateLockoutConfig())
+	errs = append(errs, s.validateSlowClientConfig())
+	errs = append(errs, s.validateLimitsConfig())
+	errs = append(errs, s.validateAnonymousConfig())
+	errs = append(errs, s.validateInboxConfig())
+	if s.config.WebhookURL != "" && s.config.WebhookSecret == "" {
+		errs = append(errs, fmt.Errorf("webhook_secret is required with webhook_url"))
+	}
+	errs = append(errs, s.validateProvenanceRules(s.config.ProvenanceRules))
+	if s.config.C2PASignCert != "" && s.config.C2PAPrivateKey == "" {
+		errs = append(errs, fmt.Errorf("c2pa_private_key is required with c2pa_sign_cert"))
+	}
+	if s.config.C2PASignAlg == "" {
+		s.config.C2PASignAlg = "es256"
+	}
+	if s.config.PDFToPPM == "" {
+		s.config.PDFToPPM = "pdftoppm"
+	}
+	if s.config.PDFInfo == "" {
+		s.config.PDFInfo = "pdfinfo"
+	}
+	if s.config.ShortLinkLength == 0 {
+		s.config.ShortLinkLength = 6
+	}
+	if s.config.ShortLinkLength < 4 {
+		errs = append(errs, fmt.Errorf("short_link_length must be at least 4"))
+	}
+	if s.config.CacheControlOnce == "" {
+		s.config.CacheControlOnce = "no-store"
+	}
+	if s.config.CacheControlLimited == "" {
+		s.config.CacheControlLimited = "private, no-cache"
+	}
+	if s.config.CacheControlUnlimited == "" {
+		s.config.CacheControlUnlimited = "public, max-age=31536000, immutable"
+	}
+	if s.config.TrashRetention < 0 {
+		errs = append(errs, fmt.Errorf("trash_retention cannot be negative"))
+	}
+	if s.config.ColdAfter < 0 {
+		errs = append(errs, fmt.Errorf("cold_after cannot be negative"))
+	}
+	if s.config.ColdBackend == "dir" && s.config.ColdDir == "" {
+		errs = append(errs, fmt.Errorf("cold_dir cannot be empty with the dir cold_backend"))
+	}
+	if s.config.CDNURL != "" && s.config.CDNSigningKey == "" {
+		errs = append(errs, fmt.Errorf("cdn_signing_key is required with cdn_url"))
+	}
+	if s.config.CDNURLTTL < Duration(time.Second) {
+		s.config.CDNURLTTL = Duration(time.Hour)
+	}
+	if s.config.ColdRetryAfter <= 0 {
+		s.config.ColdRetryAfter = Duration(15 * time.Minute)
+	}
+	if s.config.ReadTimeout < 0 || s.config.WriteTimeout < 0 || s.config.IdleTimeout < 0 || s.config.UploadTimeout < 0 {
+		errs = append(errs, fmt.Errorf("timeouts cannot be negative"))
+	}
+	if s.config.ReadTimeout == 0 {
+		s.config.ReadTimeout = Duration(time.Minute)
+	}
+	if s.config.IdleTimeout == 0 {
+		s.config.IdleTimeout = Duration(2 * time.Minute)
+	}
+	if s.config.UploadTimeout == 0 {
+		s.config.UploadTimeout = Duration(10 * time.Minute)
+	}
+
+	// Set default allowed types if not specified
+	if len(s.config.AllowedTypes) == 0 {
+		s.config.AllowedTypes = []string{
+			// Images
+			"image/jpeg", "image/jpg", "image/pjpeg",
+			"image/png",
+			"image/gif",
+			"image/webp",
+			"image/svg+xml",
+			// Generic image type pattern
+			"image/*",
+			// Binary data (for compatibility)
+			"application/octet-stream",
+			// Audio
+			"audio/mpeg", "audio/ogg", "audio/wav", "audio/webm", "audio/aac",
+			// Documents
+			"application/pdf",
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// open creates the directories and opens the stores and logs of the
+// configuration.
+func (s *Server) open() error {
+	if err := s.openMemoryStorage(); err != nil {
+		return err
+	}
+	// Create uploads directory if it doesn't exist
+	if err := os.MkdirAll(s.config.UploadDir, 0755); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.thumbnailDir(), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.stagingDir(), 0700); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.variantDir(), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.hlsDir(), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.sidecarDir(), 0755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.trashDir(), 0700); err != nil {
+		return err
+	}
+	if s.config.InboxDir != "" {
+		if err := os.MkdirAll(filepath.Join(s.config.InboxDir, inboxRejectedDir), 0755); err != nil {
+			return err
+		}
+	}
+
+	// Create data directory and load asset metadata
+	if err := os.MkdirAll(s.config.DataDir, 0755); err != nil {
+		return err
+	}
+	if err := s.openAssetStores(); err != nil {
+		return err
+	}
+	if err := s.adoptLegacyFiles(); err != nil {
+		return err
+	}
+	if err := s.openColdStore(); err != nil {
+		return err
+	}
+	if err := s.openReplicas(); err != nil {
+		return err
+	}
+
+	// Open the audit log and record the configuration in effect
+	var err error
+	if s.auditor, err = openAuditLog(s.config.AuditLog); err != nil {
+		return err
+	}
+	s.audit(context.Background(), "system", auditConfigLoad, s.config.Path, "")
+
+	s.reportLimiter = newRateLimiter(s.config.ReportRateLimit, s.config.ReportRateLimit)
+	s.anonymousLimiter = newRateLimiter(s.config.AnonymousRateLimit, s.config.AnonymousRateLimit)
+	s.workers.size = s.config.ProcessingWorkers
+	return nil
+}
+
+// randomID returns 16 random bytes encoded for use in URLs.
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(b), nil
+}
+
+func (s *Server) generateRandomFilename(originalFilename, contentType string) (string, error) {
+	// Get file extension
+	ext := s.storedExtension(originalFilename, contentType)
+
+	// Create random filename with normalized extension
+	randomName, err := randomID()
+	if err != nil {
+		return "", err
+	}
+	return randomName + ext, nil
+}
+
+func (s *Server) isAllowedFileType(contentType string) bool {
+	s.mimef("Checking if content type is allowed: %s\n", contentType)
+	s.mimef("Allowed types: %v\n", s.config.AllowedTypes)
+
+	// Convert to lowercase for case-insensitive comparison, ignoring
+	// parameters such as the charset of text/plain
+	contentTypeLower := strings.ToLower(contentType)
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentTypeLower = mediaType
+	}
+
+	for _, allowedType := range s.config.AllowedTypes {
+		// Convert allowed type to lowercase as well
+		allowedTypeLower := strings.ToLower(allowedType)
+
+		if contentTypeLower == allowedTypeLower {
+			s.mimef("Content type %s is allowed\n", contentType)
+			return true
+		}
+	}
+
+	// Also check if it's a more generic match (e.g., image/*)
+	for _, allowedType := range s.config.AllowedTypes {
+		allowedTypeLower := strings.ToLower(allowedType)
+
+		// Check if it's a wildcard type (e.g., image/*)
+		if strings.HasSuffix(allowedTypeLower, "/*") {
+			prefix := strings.TrimSuffix(allowedTypeLower, "/*")
+			if strings.HasPrefix(contentTypeLower, prefix) {
+				s.mimef("Content type %s is allowed via wildcard %s\n", contentType, allowedType)
+				return true
+			}
+		}
+	}
+
+	s.mimef("Content type %s is NOT allowed\n", contentType)
+	return false
+}
+
+func (s *Server) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Spend the upload ticket, if any, take a scoped token for an album or
+	// else check the API key unless anonymous uploads are allowed.  An
+	// expired or unknown ticket is refused rather than taken for an
+	// anonymous upload.
+	if ticketed := s.redeemTicket(r); ticketed != nil {
+		r = ticketed
+	} else if uploadTicketNonce(r) != "" {
+		s.authFailed(r.Context(), "ip:"+s.clientIP(r), r.URL.Path)
+		if isVersioned(r) {
+			s.sendEnvelopeError(w, r, http.StatusUnauthorized, "invalid_ticket", "Invalid or expired upload ticket")
+			return
+		}
+		s.httpError(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	} else if s.scopedUpload(r) {
+		// Stored in the album of the token for the key that minted it
+	} else if s.config.AnonymousUploads && r.Header.Get("X-API-Key") == "" && bearerToken(r) == "" && uploadTicketNonce(r) == "" {
+		if r = s.anonymousUpload(w, r); r == nil {
+			return
+		}
+	} else if !s.checkAPIKey(r) {
+		if isVersioned(r) {
+			s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+			return
+		}
+		s.httpError(w, r, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	// Check content type
+	contentType := r.Header.Get("Content-Type")
+
+	// Print debug info
+	s.debugf("Upload request received: Content-Type=%s, Content-Length=%d\n",
+		contentType, r.ContentLength)
+
+	// Replay the original response to a retried upload
+	if key := idempotencyKey(r); key != "" {
+		if asset, ok := s.uploadReplies.get(key); ok {
+			w.Header().Set("Idempotent-Replayed", "true")
+			s.sendUploadResponse(w, r, asset)
+			return
+		}
+	}
+
+	// Handle based on content type
+	switch upload.Classify(contentType) {
+	case upload.Multipart:
+		s.handleMultipartUpload(w, r)
+	case upload.Form:
+		s.handleFormUrlEncodedUpload(w, r)
+	case upload.JSON:
+		s.handleJSONUpload(w, r)
+	default:
+		s.sendUploadError(w, r, http.StatusUnsupportedMediaType, "unsupported_content_type", "Unsupported content type")
+	}
+}
+
+// uploadResponseGrace is how long past its deadline an upload may take to
+// send the response reporting that it timed out.
+const uploadResponseGrace = 10 * time.Second
+
+// withUploadDeadline gives uploads upload_timeout to arrive and be stored,
+// replacing the server's read and write timeouts for their connection.
+// Only the connection's own ResponseWriter can set its deadlines, so this
+// wraps the tracing handler rather than the upload handler.
+func (s *Server) withUploadDeadline(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isUpload(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		deadline := time.Now().Add(time.Duration(s.config.UploadTimeout))
+		rc := http.NewResponseController(w)
+		if err := rc.SetReadDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			fmt.Printf("Error setting upload read deadline: %v\n", err)
+		}
+		if err := rc.SetWriteDeadline(deadline.Add(uploadResponseGrace)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			fmt.Printf("Error setting upload write deadline: %v\n", err)
+		}
+		ctx, cancel := context.WithDeadline(r.Context(), deadline)
+		defer cancel()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isUpload reports whether a request uploads files: to the upload
+// endpoints, as a new album or as new content of an asset.
+func isUpload(r *http.Request) bool {
+	if r.Method == http.MethodPut {
+		rest, ok := strings.CutPrefix(r.URL.Path, "/api/v1/assets/")
+		return ok && rest != "" && !strings.Contains(rest, "/")
+	}
+	if r.Method != http.MethodPost {
+		return false
+	}
+	switch r.URL.Path {
+	case "/upload", "/api/v1/upload", "/api/v1/albums":
+		return true
+	}
+	return false
+}
+
+// uploadTimedOut reports whether an upload failed because its deadline
+// passed.
+func uploadTimedOut(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// multipartOverhead is the allowance for part headers and form fields on top
+// of the file data of a multipart upload.
+const multipartOverhead = 1 << 20
+
+// uploadError is a rejected upload as reported to the client.
+type uploadError struct {
+	status  int
+	code    string
+	message string
+	details *ErrorDetails
+}
+
+// fileTooLarge refuses a file over limit bytes.  Its size is reported if
+// err tells it.
+func fileTooLarge(err error, limit int64) *uploadError {
+	details := &ErrorDetails{Limit: limit}
+	var sizeErr *upload.SizeError
+	if errors.As(err, &sizeErr) {
+		details.Size = sizeErr.Size
+	}
+	return &uploadError{http.StatusRequestEntityTooLarge, "file_too_large", "File too large", details}
+}
+
+// typeNotAllowed refuses a file of a detected type outside allowed.
+func typeNotAllowed(message, detected string, allowed []string) *uploadError {
+	return &uploadError{http.StatusUnsupportedMediaType, "type_not_allowed", message,
+		&ErrorDetails{DetectedType: detected, AllowedTypes: allowed}}
+}
+
+// saveError reports a failure of saveAsset to store an upload of at most
+// maxSize bytes.  r is the upload request, or nil for files stored with
+// Put, whose callers learn why reading the file failed.
+func (s *Server) saveError(r *http.Request, err error, maxSize int64) *uploadError {
+	switch {
+	case r == nil && (errors.Is(err, upload.ErrTooLarge) || errors.Is(err, errUploadRead)):
+		return readFileError(err, maxSize)
+	case errors.Is(err, errHashMismatch):
+		return &uploadError{http.StatusBadRequest, "hash_mismatch", "File does not match the hash of the ticket", nil}
+	case errors.Is(err, upload.ErrTooLarge):
+		return fileTooLarge(err, maxSize)
+	case errors.Is(err, errQuarantined):
+		return &uploadError{http.StatusUnprocessableEntity, "quarantined", "File rejected by content scanner", nil}
+	case errors.Is(err, errRejected):
+		return &uploadError{http.StatusUnprocessableEntity, "rejected", "File rejected by content classifier", nil}
+	case errors.Is(err, errStagingFull):
+		return &uploadError{http.StatusServiceUnavailable, "staging_full", "Too many uploads in progress, try again later", nil}
+	case errors.Is(err, errStorageFull):
+		return &uploadError{http.StatusInsufficientStorage, "storage_full", "Storage full", nil}
+	case errors.Is(err, errUserQuota):
+		return &uploadError{http.StatusForbidden, "quota_exceeded", "Storage quota of this user exceeded", nil}
+	case uploadTimedOut(err):
+		return &uploadError{http.StatusRequestTimeout, "upload_timeout", "Upload timed out", nil}
+	case errors.Is(err, errUploadRead):
+		fmt.Printf("Error reading file data: %v\n", err)
+		return &uploadError{http.StatusBadRequest, "read_error", "Error reading file", nil}
+	}
+	message := fmt.Sprintf("Error saving file: %v", err)
+	if r != nil {
+		message = s.localize(r, "Error saving file: %v", err)
+	}
+	return &uploadError{http.StatusInternalServerError, "storage_error", message, nil}
+}
+
+// uploadOptions are the settings of an upload besides its file.
+type uploadOptions struct {
+	blind        bool
+	metadata     map[string]any
+	passwordHash string
+	recipients   []string
+	user         string
+	tags         []string
+	dryRun       bool
+	keepOriginal bool
+}
+
+// requestUploadOptions reads the options of an upload from the fields and
+// headers of its request.
+func (s *Server) requestUploadOptions(r *http.Request) (uploadOptions, *uploadError) {
+	var opts uploadOptions
+	var uerr *uploadError
+	if opts.blind, uerr = s.blindUpload(r); uerr != nil {
+		return opts, uerr
+	}
+	if opts.metadata, uerr = uploadMetadata(r); uerr != nil {
+		return opts, uerr
+	}
+	if opts.passwordHash, uerr = uploadPassword(r); uerr != nil {
+		return opts, uerr
+	}
+	if opts.recipients, uerr = uploadRecipients(r); uerr != nil {
+		return opts, uerr
+	}
+	if opts.user, uerr = s.uploadUser(r); uerr != nil {
+		return opts, uerr
+	}
+	if opts.tags, uerr = uploadTags(r); uerr != nil {
+		return opts, uerr
+	}
+	if opts.dryRun, uerr = s.dryRunUpload(r); uerr != nil {
+		return opts, uerr
+	}
+	opts.keepOriginal, uerr = s.keepOriginalUpload(r)
+	return opts, uerr
+}
+
+// fileUploadOptions reads the options of a file stored with Put.
+func (s *Server) fileUploadOptions(f File) (uploadOptions, *uploadError) {
+	opts := uploadOptions{keepOriginal: s.config.KeepOriginals}
+	var uerr *uploadError
+	if opts.metadata, uerr = parseMetadata(f.Metadata); uerr != nil {
+		return opts, uerr
+	}
+	if opts.passwordHash, uerr = hashPassword(f.Password); uerr != nil {
+		return opts, uerr
+	}
+	if opts.recipients, uerr = parseRecipients(f.Recipients); uerr != nil {
+		return opts, uerr
+	}
+	if opts.tags, uerr = parseTags(f.Tags); uerr != nil {
+		return opts, uerr
+	}
+	if f.KeepOriginal != nil {
+		opts.keepOriginal = *f.KeepOriginal
+	}
+	return opts, nil
+}
+
+// apply sets the options on the asset of an upload.  Blind uploads are
+// told apart before, as they decide how the file is looked at.
+func (o *uploadOptions) apply(asset *Asset) {
+	asset.Metadata = o.metadata
+	asset.PasswordHash = o.passwordHash
+	asset.Recipients = o.recipients
+	asset.User = o.user
+	asset.Tags = o.tags
+	asset.DryRun = o.dryRun
+	asset.keepOriginal = o.keepOriginal
+}
+
+// UploadResult is the outcome for one file of a batch upload.
+type UploadResult struct {
+	Filename string    `json:"filename"`
+	Success  bool      `json:"success"`
+	Asset    *AssetV1  `json:"asset,omitempty"`
+	Error    *APIError `json:"error,omitempty"`
+}
+
+// readMultipartFiles reads the file parts of a multipart upload, either
+// repeated file parts or files[], and whether there is a single file part.
+// It writes the response and returns a nil form if that fails; otherwise
+// the caller must remove the form's files.
+func (s *Server) readMultipartFiles(w http.ResponseWriter, r *http.Request) (*upload.MultipartForm, []*upload.Part, bool) {
+	// Limit request body size to a full batch of files
+	r.Body = http.MaxBytesReader(w, r.Body,
+		s.bodyLimit(r, s.uploadMaxSize(r)*int64(s.uploadMaxFiles(r))+multipartOverhead))
+
+	// Parse multipart form, spilling large files to the staging area
+	form, err := s.parseMultipartUpload(r)
+	if err != nil {
+		fmt.Printf("Error parsing multipart form: %v\n", err)
+		if uploadTimedOut(err) {
+			s.sendUploadError(w, r, http.StatusRequestTimeout, "upload_timeout", "Upload timed out")
+			return nil, nil, false
+		}
+		if errors.Is(err, upload.ErrMultipart) {
+			s.sendUploadError(w, r, http.StatusBadRequest, "invalid_multipart", "Invalid multipart body")
+			return nil, nil, false
+		}
+		s.rejectUpload(w, r, fileTooLarge(err, s.uploadMaxSize(r)))
+		return nil, nil, false
+	}
+
+	maxFiles := s.uploadMaxFiles(r)
+	headers, single, err := upload.MultipartFiles(form, maxFiles)
+	if errors.Is(err, upload.ErrTooManyFiles) {
+		s.debugf("Too many files (max: %d)\n", maxFiles)
+		s.rejectUpload(w, r, &uploadError{http.StatusRequestEntityTooLarge, "too_many_files",
+			s.localize(r, "At most %d files per upload", maxFiles),
+			&ErrorDetails{Files: len(form.File["file"]) + len(form.File["files[]"]), Limit: int64(maxFiles)}})
+		form.RemoveAll()
+		return nil, nil, false
+	}
+	if err != nil {
+		s.debugf("No file in multipart form\n")
+		s.sendUploadError(w, r, http.StatusBadRequest, "missing_file", "Error retrieving file")
+		form.RemoveAll()
+		return nil, nil, false
+	}
+	return form, headers, single
+}
+
+func (s *Server) handleMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	phase := newPhaseSpans(r.Context())
+	defer phase.end()
+	phase.start("parse")
+	form, headers, single := s.readMultipartFiles(w, r)
+	if form == nil {
+		return
+	}
+	defer form.RemoveAll()
+	phase.end()
+
+	// A single file part keeps the original response format
+	if single {
+		saved, uerr := s.uploadMultipartFile(r, headers[0])
+		if uerr != nil {
+			s.rejectUpload(w, r, uerr)
+			return
+		}
+		phase.start("respond")
+		s.sendUploadResponse(w, r, saved)
+		return
+	}
+
+	// Each file of a batch succeeds or fails on its own
+	results := make([]UploadResult, 0, len(headers))
+	for _, header := range headers {
+		result := UploadResult{Filename: header.Filename}
+		saved, uerr := s.uploadMultipartFile(r, header)
+		if uerr != nil {
+			result.Error = s.uploadAPIError(r, uerr)
+		} else {
+			result.Success = true
+			result.Asset = &saved
+		}
+		results = append(results, result)
+	}
+
+	phase.start("respond")
+	s.sendBatchResponse(w, r, results)
+}
+
+// uploadMultipartFile validates and stores one file part.
+func (s *Server) uploadMultipartFile(r *http.Request, header *upload.Part) (AssetV1, *uploadError) {
+	phase := newPhaseSpans(r.Context())
+	defer phase.end()
+	phase.start("read")
+
+	// Only the head of the file is read to find its type; the rest is read
+	// as it is stored, hashed on the way, unless processing needs it all
+	maxSize := s.uploadMaxSize(r)
+	file, err := upload.OpenPart(header, maxSize)
+	if errors.Is(err, upload.ErrNoFile) {
+		fmt.Printf("Error retrieving file from form: %v\n", err)
+		return AssetV1{}, &uploadError{http.StatusBadRequest, "missing_file", "Error retrieving file", nil}
+	}
+	if errors.Is(err, upload.ErrTooLarge) {
+		s.debugf("File too large (max: %d)\n", maxSize)
+		return AssetV1{}, fileTooLarge(err, maxSize)
+	}
+	defer file.Close()
+	head, data, err := upload.Head(file)
+	if err != nil {
+		fmt.Printf("Error reading file data: %v\n", err)
+		return AssetV1{}, &uploadError{http.StatusBadRequest, "read_error", "Error reading file", nil}
+	}
+
+	phase.start("validate")
+
+	opts, uerr := s.requestUploadOptions(r)
+	if uerr != nil {
+		return AssetV1{}, uerr
+	}
+
+	// Blind uploads are stored as opaque bytes without looking at them
+	asset := Asset{OriginalName: header.Filename}
+	if opts.blind {
+		asset = Asset{ContentType: blindContentType, Blind: true}
+	} else {
+		// By default the part header, then the X-File-Type header, then the
+		// filetype form field and finally sniffing the data
+		asset.ContentType = s.uploadContentType(head, map[string]string{
+			typeFromPart:   header.Header.Get("Content-Type"),
+			typeFromHeader: r.Header.Get("X-File-Type"),
+			typeFromField:  r.FormValue("filetype"),
+		}, typeFromPart, typeFromHeader, typeFromField)
+		s.mimef("Content type of %s: %s\n", header.Filename, asset.ContentType)
+
+		// Check file type
+		if !s.isAllowedFileType(asset.ContentType) {
+			s.debugf("File type not allowed: %s\n", asset.ContentType)
+			return AssetV1{}, typeNotAllowed("File type not allowed", asset.ContentType, s.config.AllowedTypes)
+		}
+	}
+	if !ticketAllowsType(r, asset.ContentType) {
+		return AssetV1{}, typeNotAllowed("File type not allowed for this upload", asset.ContentType, uploadAllowedTypes(r))
+	}
+
+	// Processing may change the type, so it comes before naming the file
+	actor := uploadActor(r)
+	opts.apply(&asset)
+	asset.Uploader = actor
+	phase.end()
+	var variants []variantFile
+	if s.transformsUpload(&asset) {
+		fileData, err := io.ReadAll(data)
+		if err != nil {
+			fmt.Printf("Error reading file data: %v\n", err)
+			return AssetV1{}, &uploadError{http.StatusBadRequest, "read_error", "Error reading file", nil}
+		}
+		if !ticketAllowsData(r, fileData) {
+			return AssetV1{}, &uploadError{http.StatusBadRequest, "hash_mismatch", "File does not match the hash of the ticket", nil}
+		}
+		fileData, variants = s.processUpload(r.Context(), &asset, fileData)
+		data = bytes.NewReader(fileData)
+	} else {
+		asset.wantSHA256 = ticketSHA256(r)
+		data = &uploadReader{r: data, max: maxSize}
+	}
+
+	// Generate random filename
+	randomFilename, err := s.generateRandomFilename(asset.OriginalName, asset.ContentType)
+	if err != nil {
+		return AssetV1{}, &uploadError{http.StatusInternalServerError, "internal_error", "Error generating filename", nil}
+	}
+
+	// Save file and generate URL
+	asset.ID = randomFilename
+	phase.end()
+	saved, err := s.saveAsset(r.Context(), actor, asset, data, variants...)
+	if err != nil {
+		return AssetV1{}, s.saveError(r, err, maxSize)
+	}
+	return saved, nil
+}
+
+func (s *Server) handleFormUrlEncodedUpload(w http.ResponseWriter, r *http.Request) {
+	phase := newPhaseSpans(r.Context())
+	defer phase.end()
+	phase.start("parse")
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		fmt.Printf("Error parsing form: %v\n", err)
+		if uploadTimedOut(err) {
+			s.sendUploadError(w, r, http.StatusRequestTimeout, "upload_timeout", "Upload timed out")
+			return
+		}
+		s.sendUploadError(w, r, http.StatusBadRequest, "invalid_form", "Error parsing form")
+		return
+	}
+
+	// Get the file, which comes base64 encoded
+	file, err := upload.ParseForm(r.Form, r.Header, s.uploadMaxSize(r))
+	if s.sendBase64Error(w, r, err) {
+		return
+	}
+	s.debugf("Form data received: filename=%s, type=%s, data length=%d\n",
+		file.Name, file.Type, len(file.Data))
+	s.saveBase64Upload(w, r, phase, file)
+}
+
+// handleJSONUpload stores a file sent as base64 in a JSON object.  Its other
+// members are handled like the fields of a form upload.
+func (s *Server) handleJSONUpload(w http.ResponseWriter, r *http.Request) {
+	phase := newPhaseSpans(r.Context())
+	defer phase.end()
+	phase.start("parse")
+
+	maxSize := s.uploadMaxSize(r)
+	r.Body = http.MaxBytesReader(w, r.Body,
+		s.bodyLimit(r, int64(base64.StdEncoding.EncodedLen(int(maxSize)))+multipartOverhead))
+	file, fields, err := upload.ParseJSON(r.Body, maxSize)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		s.rejectUpload(w, r, fileTooLarge(err, maxSize))
+		return
+	}
+	if uploadTimedOut(err) {
+		s.sendUploadError(w, r, http.StatusRequestTimeout, "upload_timeout", "Upload timed out")
+		return
+	}
+	if errors.Is(err, upload.ErrJSON) {
+		fmt.Printf("Error parsing JSON upload: %v\n", err)
+		s.sendUploadError(w, r, http.StatusBadRequest, "invalid_json", "Invalid JSON body")
+		return
+	}
+	if s.sendBase64Error(w, r, err) {
+		return
+	}
+	s.debugf("JSON data received: filename=%s, type=%s, data length=%d\n",
+		file.Name, file.Type, len(file.Data))
+	r.Form = fields
+	s.saveBase64Upload(w, r, phase, file)
+}
+
+// sendBase64Error reports the errors of a file sent as base64, returning
+// whether there was one.
+func (s *Server) sendBase64Error(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, upload.ErrNoFile):
+		s.sendUploadError(w, r, http.StatusBadRequest, "missing_file", "No file data provided")
+	case errors.Is(err, upload.ErrBase64):
+		fmt.Printf("Error decoding base64 data: %v\n", err)
+		s.sendUploadError(w, r, http.StatusBadRequest, "invalid_base64", "Error decoding base64 data")
+	case errors.Is(err, upload.ErrTooLarge):
+		s.debugf("File too large (max: %d)\n", s.uploadMaxSize(r))
+		s.rejectUpload(w, r, fileTooLarge(err, s.uploadMaxSize(r)))
+	default:
+		s.sendUploadError(w, r, http.StatusBadRequest, "read_error", "Error reading file")
+	}
+	return true
+}
+
+// saveBase64Upload validates and stores the file of a form or JSON upload,
+// whose other fields are in r.Form.
+func (s *Server) saveBase64Upload(w http.ResponseWriter, r *http.Request, phase *phaseSpans, file upload.File) {
+	fileData := file.Data
+	phase.start("validate")
+
+	opts, uerr := s.requestUploadOptions(r)
+	if uerr != nil {
+		s.rejectUpload(w, r, uerr)
+		return
+	}
+
+	// Blind uploads are stored as opaque bytes without looking at them
+	asset := Asset{OriginalName: file.Name}
+	if opts.blind {
+		asset = Asset{ContentType: blindContentType, Blind: true}
+	} else {
+		// By default the type field, then the X-File-Type header and
+		// finally sniffing the data
+		asset.ContentType = s.uploadContentType(fileData, map[string]string{
+			typeFromField:  r.Form.Get("type"),
+			typeFromHeader: r.Header.Get("X-File-Type"),
+		}, typeFromField, typeFromHeader)
+
+		// Check file type
+		if !s.isAllowedFileType(asset.ContentType) {
+			s.debugf("File type not allowed: %s\n", asset.ContentType)
+			s.rejectUpload(w, r, typeNotAllowed("File type not allowed", asset.ContentType, s.config.AllowedTypes))
+			return
+		}
+	}
+	if !ticketAllowsType(r, asset.ContentType) {
+		s.rejectUpload(w, r, typeNotAllowed("File type not allowed for this upload", asset.ContentType, uploadAllowedTypes(r)))
+		return
+	}
+	if !ticketAllowsData(r, fileData) {
+		s.sendUploadError(w, r, http.StatusBadRequest, "hash_mismatch", "File does not match the hash of the ticket")
+		return
+	}
+
+	// Processing may change the type, so it comes before naming the file
+	actor := uploadActor(r)
+	opts.apply(&asset)
+	asset.Uploader = actor
+	phase.end()
+	fileData, variants := s.processUpload(r.Context(), &asset, fileData)
+
+	// Generate random filename
+	randomFilename, err := s.generateRandomFilename(asset.OriginalName, asset.ContentType)
+	if err != nil {
+		s.sendUploadError(w, r, http.StatusInternalServerError, "internal_error", "Error generating filename")
+		return
+	}
+
+	// Save file and generate URL
+	asset.ID = randomFilename
+	phase.end()
+	saved, err := s.saveAsset(r.Context(), actor, asset, bytes.NewReader(fileData), variants...)
+	if err != nil {
+		s.rejectUpload(w, r, s.saveError(r, err, s.uploadMaxSize(r)))
+		return
+	}
+
+	phase.start("respond")
+	s.sendUploadResponse(w, r, saved)
+}
+
+// saveAsset writes an uploaded file and any variants of it and records their
+// metadata on behalf of actor, then checks them.  It returns the client view
+// of the stored asset, including its deletion token.  Dry runs, and every
+// upload with dry_run set, are checked in the staging area by checkDryRun.
+func (s *Server) saveAsset(ctx context.Context, actor string, asset Asset, data io.Reader, variantFiles ...variantFile) (AssetV1, error) {
+	phase := newPhaseSpans(ctx)
+	defer phase.end()
+	phase.start("store")
+	phase.set(attribute.String("asset.id", asset.ID), attribute.String("asset.content_type", asset.ContentType))
+
+	// Create file path
+	filepath := s.assetPath(asset.ID)
+
+	deleteToken, err := randomID()
+	if err != nil {
+		return AssetV1{}, err
+	}
+
+	// Record the asset as pending until it has been written and scanned
+	asset.DryRun = asset.DryRun || s.config.DryRun
+	asset.UploadedAt = s.now().UTC()
+	asset.State = statePending
+	asset.StateChanged = asset.UploadedAt
+	asset.DeleteTokenHash = hashToken(deleteToken)
+	asset.Uploader = actor
+	if err := s.assets.put(asset.ID, asset); err != nil {
+		return AssetV1{}, err
+	}
+
+	// Write the file to the staging area, hashing it on the way, and only
+	// move it into place once it is complete
+	staged, err := s.stageUpload(ctx, data)
+	if errors.Is(err, errStagingFull) {
+		s.publishEvent(eventQuotaWarning, asset.ID, actor, 0,
+			fmt.Sprintf("staging area full: %d of %d bytes in use", s.stagingUsed.Load(), s.config.StagingMaxSize))
+	}
+	if err == nil && asset.wantSHA256 != "" && staged.sha256 != asset.wantSHA256 {
+		staged.discard()
+		err = errHashMismatch
+	}
+	if err == nil && asset.DryRun {
+		phase.end()
+		return s.checkDryRun(ctx, asset, staged, variantFiles)
+	}
+	release := func() {}
+	if err == nil {
+		if release, err = s.reserveStorage(staged.size); err != nil {
+			staged.discard()
+			release = func() {}
+			s.publishEvent(eventQuotaWarning, asset.ID, actor, 0, err.Error())
+		}
+	}
+	if err == nil {
+		var releaseUser func()
+		if releaseUser, err = s.reserveUserStorage(asset.User, asset.ID, staged.size); err != nil {
+			staged.discard()
+			release()
+			release = func() {}
+			s.publishEvent(eventQuotaWarning, asset.ID, actor, 0, "user:"+asset.User+": "+err.Error())
+		} else {
+			releaseStorage := release
+			release = func() { releaseUser(); releaseStorage() }
+		}
+	}
+	if err == nil {
+		err = staged.commit(filepath)
+	}
+	if err != nil {
+		release()
+		phase.fail(err)
+		os.Remove(filepath)
+		s.assets.remove(asset.ID)
+		return AssetV1{}, err
+	}
+	n, sum := staged.size, staged.sha256
+	phase.set(attribute.Int64("asset.size", n))
+
+	// Uploads are only stored once replica_writes replicas have them
+	variants, err := s.writeVariants(&asset, variantFiles)
+	if err == nil {
+		phase.start("replicate")
+		err = s.replicateAsset(ctx, Asset{ID: asset.ID, Variants: variants})
+	}
+	if err != nil {
+		release()
+		phase.fail(err)
+		s.removeVariants(Asset{ID: asset.ID, Variants: variants})
+		os.Remove(filepath)
+		s.assets.remove(asset.ID)
+		return AssetV1{}, err
+	}
+
+	saved, err := s.assets.update(asset.ID, func(a *Asset) error {
+		a.Size = n
+		a.SHA256 = sum
+		a.Variants = variants
+		return nil
+	})
+	release()
+	if err != nil {
+		return AssetV1{}, err
+	}
+	phase.end()
+
+	// New content of an asset is audited once it has replaced the old
+	if asset.ReplaceOf == "" {
+		s.audit(ctx, actor, auditUpload, asset.ID, fmt.Sprintf("%s, %d bytes", asset.ContentType, n))
+		s.publishEvent(auditUpload, asset.ID, actor, n, asset.ContentType)
+	}
+	s.recordUpload(actor, n)
+
+	// With async_checks the upload is answered while it is still pending,
+	// unless it replaces content, which only happens once it is checked
+	if s.config.AsyncChecks && asset.ReplaceOf == "" {
+		go s.checkAsset(context.WithoutCancel(ctx), saved)
+		return s.assetV1(&saved, deleteToken), nil
+	}
+	if saved, err = s.checkAsset(ctx, saved); err != nil {
+		return AssetV1{}, err
+	}
+	return s.assetV1(&saved, deleteToken), nil
+}
+
+func (s *Server) downloadHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract filename from URL
+	filename := r.PathValue("id")
+	if !validAssetID(filename) {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+
+	// Only active files with metadata records are served; files stored
+	// before records were kept are given one when the server opens
+	asset, ok := s.assets.get(filename)
+	if !ok {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+	switch asset.State {
+	case stateActive:
+	case stateQuarantined:
+		s.httpError(w, r, "File unavailable for legal reasons", http.StatusUnavailableForLegalReasons)
+		return
+	case stateDeleted:
+		s.httpError(w, r, "File deleted", http.StatusGone)
+		return
+	default:
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+
+	if !s.hotlinkAllowed(r, filename) {
+		s.httpError(w, r, "Hotlinking not allowed", http.StatusForbidden)
+		return
+	}
+	if !s.checkAssetPassword(w, r, asset) || !s.checkRecipient(w, r, asset) {
+		return
+	}
+
+	// Earlier versions of replaced content are kept on local disk, and the
+	// current one is served as usual
+	if v := r.URL.Query().Get("version"); v != "" && v != strconv.Itoa(asset.version()) {
+		s.sendVersion(w, r, asset, v)
+		return
+	}
+
+	// Variants are always served from local disk.  Clients accepting video
+	// get a GIF's video variant, and the GIF itself is also available under
+	// its format's name.
+	name := r.PathValue("variant")
+	if name == "" {
+		if asset.hasVideoVariants() {
+			w.Header().Add("Vary", "Accept")
+		}
+		name = negotiateVariant(r, asset)
+	}
+	if name != "" && name != s.assetFormat(&asset) {
+		s.sendVariant(w, r, asset, name)
+		return
+	}
+
+	// Behind a CDN the download is counted here and the CDN fetches the
+	// file from the origin endpoint
+	if s.config.CDNURL != "" {
+		if _, ok := s.claimAssetDownload(w, r, filename); ok {
+			s.redirectToCDN(w, r, filename)
+		}
+		return
+	}
+
+	phase := newPhaseSpans(r.Context())
+	defer phase.end()
+	phase.start("open")
+
+	file, size, ok := s.openAssetFile(w, r, asset)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	// Stream file to response, deleting it once its downloads are used up
+	s.sendDownload(w, r, phase, asset, "", filename, file, size)
+}
+
+// openAssetFile opens the file of an active asset for sending and returns
+// its size.  Files in cold storage are fetched back first, or with
+// cold_proxy read from the cold store as they are sent.  Compressed files
+// are decompressed unless the client takes them as they are.  On failure
+// the error response has been written.
+func (s *Server) openAssetFile(w http.ResponseWriter, r *http.Request, asset Asset) (io.ReadSeekCloser, int64, bool) {
+	file, size, ok := s.openStoredFile(w, r, asset)
+	if !ok {
+		return nil, 0, false
+	}
+	content, size, err := storedContent(w, r, file, asset.Encoding, size, asset.Size)
+	if err != nil {
+		file.Close()
+		fmt.Printf("Error opening %s: %v\n", asset.ID, err)
+		s.httpError(w, r, "Error reading file", http.StatusInternalServerError)
+		return nil, 0, false
+	}
+	return content, size, true
+}
+
+// openStoredFile opens the file of an active asset as it is stored for
+// openAssetFile.
+func (s *Server) openStoredFile(w http.ResponseWriter, r *http.Request, asset Asset) (io.ReadSeekCloser, int64, bool) {
+	if asset.Tier == tierCold {
+		var file io.ReadSeekCloser
+		var err error
+		if s.config.ColdProxy {
+			file, err = s.openColdFile(r.Context(), asset.ID)
+		} else {
+			err = s.warmAsset(r.Context(), asset.ID)
+		}
+		if errors.Is(err, errColdRestoring) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Duration(s.config.ColdRetryAfter).Seconds())))
+			s.httpError(w, r, "File is being retrieved from archive, try again later", http.StatusServiceUnavailable)
+			return nil, 0, false
+		}
+		if err != nil {
+			fmt.Printf("Error retrieving %s from cold storage: %v\n", asset.ID, err)
+			s.httpError(w, r, "Error retrieving file", http.StatusInternalServerError)
+			return nil, 0, false
+		}
+		if file != nil {
+			return file, asset.storedSize(), true
+		}
+	}
+
+	// Open the file, restoring it from a replica if it was lost
+	file, err := os.Open(s.assetPath(asset.ID))
+	if errors.Is(err, os.ErrNotExist) && s.restoreReplica(r.Context(), asset, asset.ID, s.assetPath(asset.ID)) == nil {
+		file, err = os.Open(s.assetPath(asset.ID))
+	}
+	if err != nil {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return nil, 0, false
+	}
+
+	// Get file info for Content-Length
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		s.httpError(w, r, "Error reading file info", http.StatusInternalServerError)
+		return nil, 0, false
+	}
+	return file, fileInfo.Size(), true
+}
+
+// claimAssetDownload counts a download, writing the error response if the
+// asset has none left.
+func (s *Server) claimAssetDownload(w http.ResponseWriter, r *http.Request, id string) (Asset, bool) {
+	asset, err := s.claimDownload(id)
+	if err != nil {
+		s.downloadError(w, r, err)
+		return asset, false
+	}
+	return asset, true
+}
+
+// downloadError writes the response to a download of an asset that can't
+// be downloaded.
+func (s *Server) downloadError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errExpired) || errors.Is(err, errDownloadsUsed) {
+		s.httpError(w, r, "File deleted", http.StatusGone)
+		return
+	}
+	if errors.Is(err, errDownloadsReserved) {
+		s.httpError(w, r, "File is being downloaded, try again later", http.StatusConflict)
+		return
+	}
+	s.httpError(w, r, "File not found", http.StatusNotFound)
+}
+
+// sendAssetFile sends a file, or the part of it asked for with a Range
+// header.  It returns the part that was written, and false if nothing was
+// to be sent.
+func (s *Server) sendAssetFile(w http.ResponseWriter, r *http.Request, phase *phaseSpans, filename string, file io.ReadSeeker, size int64) (ByteRange, bool) {
+	br, partial, ok := requestedRange(r, size)
+	w.Header().Set("Accept-Ranges", "bytes")
+	if !ok {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		s.httpError(w, r, "Requested range not satisfiable", http.StatusRequestedRangeNotSatisfiable)
+		return ByteRange{}, false
+	}
+
+	// Set headers for file download
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if f, ok := file.(*encodedFile); ok {
+		w.Header().Set("Content-Encoding", f.encoding)
+	}
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", br.End-br.Start))
+	status := http.StatusOK
+	if partial {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", br.Start, br.End-1, size))
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+
+	// The response is flushed so that the file is only deleted once it has
+	// been handed to the connection
+	phase.set(attribute.Int64("asset.size", size))
+	n, err := sendFileRange(w, file, br.Start, br.End-br.Start)
+	if err == nil {
+		err = http.NewResponseController(w).Flush()
+	}
+	if err != nil {
+		phase.fail(err)
+	}
+	br.End = br.Start + n
+	return br, n > 0 || err == nil
+}
+
+// deleteAttempts is how often deleting a downloaded asset is tried.
+const deleteAttempts = 5
+
+// deleteDownloaded deletes an asset whose downloads are used up, once the
+// last download has been sent.  Failures are retried with growing delays.
+func (s *Server) deleteDownloaded(r *http.Request, filename string) {
+	ctx := context.WithoutCancel(r.Context())
+	s.background.Go(func() {
+		delay := time.Second
+		for attempt := 1; ; attempt++ {
+			err := s.deleteAsset(filename, "downloaded")
+			if err == nil {
+				break
+			}
+			if attempt == deleteAttempts {
+				fmt.Printf("Giving up deleting %s after download: %v\n", filename, err)
+				return
+			}
+			fmt.Printf("Error deleting %s after download, retrying in %v: %v\n", filename, delay, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+		s.audit(ctx, "system", auditDelete, filename, "downloaded")
+	})
+}
+
+func (s *Server) testHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.httpError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Check API key
+	if !s.checkAPIKey(r) {
+		s.sendJSONResponse(w, r, false, "Invalid API key", "")
+		return
+	}
+
+	// If we get here, the API key is valid
+	resp := Response{
+		Success:     true,
+		MaxFileSize: s.config.MaxFileSize,
+	}
+	if !prefersMinimal(w, r) {
+		resp.Message = s.localize(r, "API key is valid")
+		resp.Capabilities = s.capabilities(r)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// checkAPIKey validates the X-API-Key header against api_key and the
+// managed keys, or the session token standing in for one, and records the
+// attempt in the audit log.
+func (s *Server) checkAPIKey(r *http.Request) bool {
+	client := "ip:" + s.clientIP(r)
+	if sess, ok := requestSession(r); ok {
+		s.audit(r.Context(), sess.actor, auditKeyUse, r.URL.Path, "accepted session "+sessionActor(bearerToken(r)))
+		s.authSucceeded(client)
+		return true
+	}
+	key := r.Header.Get("X-API-Key")
+	if !s.validAPIKey(key) {
+		s.audit(r.Context(), client, auditKeyUse, r.URL.Path, "rejected")
+		if _, scoped := requestScopedToken(r); key != "" || bearerToken(r) != "" && !scoped {
+			s.authFailed(r.Context(), client, r.URL.Path)
+		}
+		return false
+	}
+	s.audit(r.Context(), keyActor(key), auditKeyUse, r.URL.Path, "accepted")
+	s.authSucceeded(client)
+	return true
+}
+
+// sendUploadResponse sends the v1 asset object of a successful upload and
+// remembers it for retries carrying the same Idempotency-Key.
+func (s *Server) sendUploadResponse(w http.ResponseWriter, r *http.Request, asset AssetV1) {
+	if key := idempotencyKey(r); key != "" {
+		s.uploadReplies.put(key, asset)
+	}
+	warnings := s.quotaWarnings(r, asset)
+	asset = s.originAsset(r, asset)
+	if prefersMinimal(w, r) {
+		asset = asset.minimal()
+	}
+
+	if isVersioned(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(Envelope{
+			APIVersion: apiVersion,
+			Success:    true,
+			Data:       asset,
+			Warnings:   warnings,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{
+		Success:  true,
+		Message:  s.localize(r, "File uploaded successfully"),
+		URL:      asset.URL,
+		Schema:   "v1",
+		Asset:    &asset,
+		Warnings: warnings,
+	})
+}
+
+// sendBatchResponse reports the per-file results of a batch upload.  The
+// request as a whole only succeeds if every file did.
+func (s *Server) sendBatchResponse(w http.ResponseWriter, r *http.Request, results []UploadResult) {
+	uploaded := 0
+	for _, res := range results {
+		if res.Success {
+			uploaded++
+		}
+	}
+	message := s.localize(r, "%d of %d files uploaded", uploaded, len(results))
+	var saved []AssetV1
+	for _, res := range results {
+		if res.Asset != nil {
+			saved = append(saved, *res.Asset)
+		}
+	}
+	warnings := s.quotaWarnings(r, saved...)
+	minimal := prefersMinimal(w, r)
+	for i := range results {
+		if results[i].Asset != nil {
+			asset := s.originAsset(r, *results[i].Asset)
+			if minimal {
+				asset = asset.minimal()
+			}
+			results[i].Asset = &asset
+		}
+	}
+
+	if isVersioned(r) {
+		status := http.StatusCreated
+		if uploaded < len(results) {
+			status = http.StatusMultiStatus
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(Envelope{
+			APIVersion: apiVersion,
+			Success:    uploaded == len(results),
+			Data:       results,
+			Warnings:   warnings,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{
+		Success:  uploaded == len(results),
+		Message:  message,
+		Schema:   "v1",
+		Results:  results,
+		Warnings: warnings,
+	})
+}
+
+func (s *Server) sendJSONResponse(w http.ResponseWriter, r *http.Request, success bool, message string, url string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Response{
+		Success: success,
+		Message: s.localize(r, message),
+		URL:     url,
+	})
+}
+
+// Handler returns the handler serving every endpoint the configuration
+// enables.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.registerAPIHandlers(mux)
+	mux.HandleFunc("/upload", deprecated("/api/v1/upload", s.uploadHandler))
+	mux.HandleFunc("GET /download/{id}", deprecated("/api/v1/download/{id}", s.downloadHandler))
+	mux.HandleFunc("POST /download/{id}", deprecated("/api/v1/download/{id}", s.downloadHandler))
+	mux.HandleFunc("DELETE /download/{id}", deprecated("/api/v1/assets/{id}", s.deleteHandler))
+	if s.config.QRCodes {
+		mux.HandleFunc("GET /download/{id}/qr.png", deprecated("/api/v1/download/{id}/qr.png", s.qrHandler))
+	}
+	if s.config.ShortLinks {
+		mux.HandleFunc("GET /s/{code}", s.shortLinkHandler)
+	}
+	if s.config.HLS {
+		mux.HandleFunc("GET /stream/{id}/{path...}", s.streamHandler)
+	}
+	mux.HandleFunc("/test", s.testHandler)
+	mux.HandleFunc("GET /version", s.versionHandler)
+	mux.HandleFunc("/report", s.reportHandler)
+	if s.config.AdminKey != "" {
+		s.registerAdminHandlers(mux)
+	}
+	return s.trackTransfers(s.withUploadDeadline(otelhttp.NewHandler(withAPIVersion(withRequestID(s.withRecovery(s.withBodyDump(s.withAuthLockout(s.withSession(s.withScopedToken(s.withBodyLimits(s.withJSONEncoding(s.withMaintenance(mux)))))))))), "assetserver")))
+}
@@ -0,0 +1,4321 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"maps"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+	"unicode/utf8"
+
+	"github.com/karamble/braibot-assetserver/internal/testserver"
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/net/websocket"
+)
+
+const testAPIKey = "test-api-key"
+
+// testServer is a server running the full HTTP stack on a fresh
+// configuration whose files live in temporary directories.
+type testServer struct {
+	*testserver.Server
+	srv   *Server
+	clock *testserver.Clock
+}
+
+// newTestServer starts a test server.  configure may change the
+// configuration before it is checked.
+func newTestServer(t *testing.T, configure func(*Config)) *testServer {
+	t.Helper()
+	dirs := testserver.TempDirs(t)
+	cfg := Config{
+		MaxFileSize: 1 << 20,
+		APIKey:      testAPIKey,
+		UploadDir:   dirs.Upload,
+		DataDir:     dirs.Data,
+		Domain:      "assets.example.com",
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+	srv, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+
+	clock := testserver.NewClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	srv.now = clock.Now
+	return &testServer{testserver.New(t, srv.Handler(), testAPIKey), srv, clock}
+}
+
+// uploadV1 uploads a file through /api/v1 and returns its asset object.
+func uploadV1(t *testing.T, s *testServer, name string, data []byte) AssetV1 {
+	t.Helper()
+	resp := s.UploadMultipart("/api/v1/upload", "file", map[string][]byte{name: data})
+	var env struct {
+		Data  AssetV1   `json:"data"`
+		Error *APIError `json:"error"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload of %s: %d %+v", name, resp.StatusCode, env.Error)
+	}
+	return env.Data
+}
+
+// waitDeleted waits for a used up asset to be deleted, which happens after
+// its last download has been answered.
+func waitDeleted(t *testing.T, s *testServer, id string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		s.srv.background.Wait()
+		if asset, _ := s.srv.assets.get(id); asset.State == stateDeleted {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("used up asset %s not deleted", id)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// step is an action on an uploaded asset and the status it should get.
+type step struct {
+	advance time.Duration
+	status  int
+}
+
+func TestUploadDownloadExpiry(t *testing.T) {
+	data := []byte("hello, world\n")
+	tests := []struct {
+		name  string
+		rules []RetentionRule
+		steps []step
+	}{{
+		name: "single download",
+		steps: []step{
+			{status: http.StatusOK},
+			{status: http.StatusGone},
+		},
+	}, {
+		name:  "download limit",
+		rules: []RetentionRule{{Name: "thrice", MaxDownloads: 3}},
+		steps: []step{
+			{status: http.StatusOK},
+			{status: http.StatusOK},
+			{status: http.StatusOK},
+			{status: http.StatusGone},
+		},
+	}, {
+		name:  "ttl",
+		rules: []RetentionRule{{Name: "hour", MaxDownloads: unlimitedDownloads, TTL: Duration(time.Hour)}},
+		steps: []step{
+			{status: http.StatusOK},
+			{advance: 59 * time.Minute, status: http.StatusOK},
+			{advance: time.Minute, status: http.StatusGone},
+		},
+	}, {
+		name:  "ttl before downloads are used",
+		rules: []RetentionRule{{Name: "twice", MaxDownloads: 2, TTL: Duration(time.Hour)}},
+		steps: []step{
+			{advance: 2 * time.Hour, status: http.StatusGone},
+		},
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t, func(c *Config) { c.RetentionRules = test.rules })
+			asset := uploadV1(t, s, "hello.txt", data)
+			if asset.Size != int64(len(data)) {
+				t.Errorf("size %d, want %d", asset.Size, len(data))
+			}
+
+			for i, step := range test.steps {
+				s.clock.Advance(step.advance)
+				resp := s.Get(asset.URL)
+				body := testserver.Body(t, resp)
+				if resp.StatusCode != step.status {
+					t.Fatalf("download %d: status %d, want %d", i+1, resp.StatusCode, step.status)
+				}
+				if step.status == http.StatusOK && !bytes.Equal(body, data) {
+					t.Fatalf("download %d: got %q, want %q", i+1, body, data)
+				}
+			}
+		})
+	}
+}
+
+func TestRetentionAlbums(t *testing.T) {
+	rules := []RetentionRule{{Name: "galleries", Albums: []string{"Showcase"}, MaxDownloads: unlimitedDownloads}}
+	s := newTestServer(t, func(c *Config) { c.RetentionRules = rules })
+	for _, tc := range []struct {
+		name string
+		tags []string
+		want string
+	}{
+		{"in the album", []string{"album:showcase"}, "galleries"},
+		{"among other albums", []string{"album:drafts", "album:showcase"}, "galleries"},
+		{"in another album", []string{"album:drafts"}, "default"},
+		{"tagged with the name only", []string{"showcase"}, "default"},
+		{"in no album", nil, "default"},
+	} {
+		if rule := s.srv.retentionFor("image/png", 10, keyActor(testAPIKey), tc.tags); rule.Name != tc.want {
+			t.Errorf("%s: rule %s, want %s", tc.name, rule.Name, tc.want)
+		}
+	}
+
+	// An album stands in for the ttl of an unlimited rule, as tags do, and
+	// must be a valid name
+	if err := validateRetentionRules([]RetentionRule{{Albums: []string{"a b"}, MaxDownloads: 2}}); err == nil {
+		t.Error("invalid album name accepted")
+	}
+}
+
+func TestSweepExpired(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.RetentionRules = []RetentionRule{{MaxDownloads: unlimitedDownloads, TTL: Duration(time.Hour)}}
+	})
+	asset := uploadV1(t, s, "hello.txt", []byte("hello"))
+
+	s.srv.sweepExpired()
+	if a, _ := s.srv.assets.get(asset.ID); a.State != stateActive {
+		t.Fatalf("state %s before expiry, want %s", a.State, stateActive)
+	}
+	s.clock.Advance(2 * time.Hour)
+	s.srv.sweepExpired()
+	if a, _ := s.srv.assets.get(asset.ID); a.State != stateDeleted {
+		t.Fatalf("state %s after expiry, want %s", a.State, stateDeleted)
+	}
+	if resp := s.Get(asset.URL); resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone {
+		t.Fatalf("download after sweep: status %d", resp.StatusCode)
+	}
+}
+
+func TestLegacyFiles(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		// A file stored before files had records
+		if err := os.WriteFile(filepath.Join(c.UploadDir, "old.txt"), []byte("from before"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	})
+	asset, ok := s.srv.assets.get("old.txt")
+	if !ok || asset.State != stateActive || asset.Uploader != legacyUploader || asset.Size != 11 ||
+		!strings.HasPrefix(asset.ContentType, "text/plain") {
+		t.Fatalf("adopted %+v", asset)
+	}
+
+	// It is served once, as before
+	resp := s.Get(s.srv.downloadURL("old.txt"))
+	if body := testserver.Body(t, resp); resp.StatusCode != http.StatusOK || string(body) != "from before" {
+		t.Fatalf("download: %d %q", resp.StatusCode, body)
+	}
+	if resp := s.Get(s.srv.downloadURL("old.txt")); resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone {
+		t.Fatalf("second download: status %d", resp.StatusCode)
+	}
+}
+
+func TestLegacyFormUpload(t *testing.T) {
+	s := newTestServer(t, nil)
+	data := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	resp := s.UploadForm("/upload", "image.png", "", data)
+	var r Response
+	testserver.DecodeJSON(t, resp, &r)
+	if !r.Success || r.URL == "" {
+		t.Fatalf("upload failed: %+v", r)
+	}
+	if r.Asset == nil || r.Asset.ContentType != "image/png" {
+		t.Fatalf("asset %+v, want an image/png", r.Asset)
+	}
+
+	resp = s.Get(r.URL)
+	if body := testserver.Body(t, resp); resp.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+		t.Fatalf("download: status %d, body %q", resp.StatusCode, body)
+	}
+}
+
+func TestUploadRejected(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"unsupported content type", "text/plain", "hello", http.StatusUnsupportedMediaType},
+		{"no file in JSON", "application/json", "{}", http.StatusBadRequest},
+		{"no file data", "application/x-www-form-urlencoded", "filename=a.txt", http.StatusBadRequest},
+		{"bad base64", "application/x-www-form-urlencoded", "data=%21%21", http.StatusBadRequest},
+		{"no file part", "multipart/form-data; boundary=x", "--x--\r\n", http.StatusBadRequest},
+	}
+	s := newTestServer(t, nil)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := s.Do(http.MethodPost, "/api/v1/upload", test.contentType, bytes.NewBufferString(test.body))
+			if resp.StatusCode != test.status {
+				t.Fatalf("status %d, want %d", resp.StatusCode, test.status)
+			}
+		})
+	}
+}
+
+func TestUploadTimeout(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.UploadTimeout = Duration(100 * time.Millisecond)
+	})
+
+	// The client sends the start of a file and stalls
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("--x\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nstart"))
+
+	resp := s.Do(http.MethodPost, "/api/v1/upload", "multipart/form-data; boundary=x", pr)
+	var env struct {
+		Error *APIError `json:"error"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusRequestTimeout || env.Error == nil || env.Error.Code != "upload_timeout" {
+		t.Fatalf("status %d %+v, want 408 upload_timeout", resp.StatusCode, env.Error)
+	}
+}
+
+func TestCancelTransfer(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminKey = "test-admin-key"
+	})
+	admin := func(method, ref string) *http.Response {
+		req, err := http.NewRequest(method, s.URL+ref, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Admin-Key", "test-admin-key")
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	// An upload that stalls after its first bytes
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("--x\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nstart"))
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/upload", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	req.Header.Set("X-API-Key", testAPIKey)
+	go func() {
+		if resp, err := s.Client().Do(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	var list []Transfer
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		list = nil
+		testserver.DecodeJSON(t, admin(http.MethodGet, "/admin/transfers"), &list)
+		if len(list) == 1 && list[0].Bytes > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("upload not listed: %+v", list)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if list[0].Direction != transferUpload {
+		t.Fatalf("direction %q, want upload", list[0].Direction)
+	}
+
+	id := list[0].ID
+	if resp := admin(http.MethodDelete, "/admin/transfers/"+id); resp.StatusCode != http.StatusOK {
+		t.Fatalf("cancel: status %d", resp.StatusCode)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		list = nil
+		testserver.DecodeJSON(t, admin(http.MethodGet, "/admin/transfers"), &list)
+		if len(list) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("cancelled upload still running")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if resp := admin(http.MethodDelete, "/admin/transfers/"+id); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("second cancel: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestContentTypeOrder(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	tests := []struct {
+		name      string
+		configure func(*Config)
+		want      string
+	}{
+		{"declared type first", nil, "image/gif"},
+		{"declared type untrusted", func(cfg *Config) { cfg.ContentTypeOrder = []string{"part", "sniff"} }, "image/png"},
+		{"strict", func(cfg *Config) { cfg.StrictContentType = true }, "image/png"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := newTestServer(t, test.configure)
+			var r Response
+			testserver.DecodeJSON(t, s.UploadForm("/upload", "image.png", "image/gif", png), &r)
+			if r.Asset == nil || r.Asset.ContentType != test.want {
+				t.Fatalf("asset %+v, want a %s", r.Asset, test.want)
+			}
+		})
+	}
+}
+
+func TestJSONUpload(t *testing.T) {
+	s := newTestServer(t, nil)
+	data := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	body, err := json.Marshal(map[string]any{
+		"filename":    "image.png",
+		"data_base64": base64.StdEncoding.EncodeToString(data),
+		"metadata":    map[string]string{"prompt": "a cat"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := s.Do(http.MethodPost, "/api/v1/upload", "application/json", bytes.NewReader(body))
+	var env struct {
+		Data  AssetV1   `json:"data"`
+		Error *APIError `json:"error"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload: %d %+v", resp.StatusCode, env.Error)
+	}
+	if env.Data.ContentType != "image/png" || env.Data.Metadata["prompt"] != "a cat" {
+		t.Fatalf("asset %+v, want an image/png with its metadata", env.Data)
+	}
+	resp = s.Get(env.Data.URL)
+	if got := testserver.Body(t, resp); resp.StatusCode != http.StatusOK || !bytes.Equal(got, data) {
+		t.Fatalf("download: status %d, body %q", resp.StatusCode, got)
+	}
+
+	resp = s.Do(http.MethodPost, "/api/v1/upload", "application/json", bytes.NewBufferString(`{"data_base64": 5}`))
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusBadRequest || env.Error == nil || env.Error.Code != "invalid_json" {
+		t.Fatalf("bad body: status %d %+v, want 400 invalid_json", resp.StatusCode, env.Error)
+	}
+}
+
+func TestRecipients(t *testing.T) {
+	s := newTestServer(t, func(c *Config) {
+		c.RetentionRules = []RetentionRule{{MaxDownloads: 2}}
+	})
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := hex.EncodeToString(pub)
+	data := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	body, err := json.Marshal(map[string]any{
+		"filename":    "image.png",
+		"data_base64": base64.StdEncoding.EncodeToString(data),
+		"recipients":  []string{strings.ToUpper(key)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp := s.Do(http.MethodPost, "/api/v1/upload", "application/json", bytes.NewReader(body))
+	var env struct {
+		Data  AssetV1   `json:"data"`
+		Error *APIError `json:"error"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload: %d %+v", resp.StatusCode, env.Error)
+	}
+	asset := env.Data
+	if len(asset.Recipients) != 1 || asset.Recipients[0] != key || len(asset.Thumbnails) != 0 {
+		t.Fatalf("asset %+v, want restricted to %s without thumbnails", asset, key)
+	}
+
+	challenge := func() string {
+		t.Helper()
+		resp := s.Do(http.MethodPost, "/api/v1/download/"+asset.ID+"/challenge", "", nil)
+		var env struct {
+			Data struct {
+				Challenge string `json:"challenge"`
+				Message   string `json:"message"`
+			} `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		if resp.StatusCode != http.StatusOK || env.Data.Message != challengeMessage(asset.ID, env.Data.Challenge) {
+			t.Fatalf("challenge: status %d %+v", resp.StatusCode, env.Data)
+		}
+		return env.Data.Challenge
+	}
+	download := func(pub ed25519.PublicKey, priv ed25519.PrivateKey, nonce string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, s.URL+"/api/v1/download/"+asset.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if priv != nil {
+			sig := ed25519.Sign(priv, []byte(challengeMessage(asset.ID, nonce)))
+			req.Header.Set("X-Identity-Key", hex.EncodeToString(pub))
+			req.Header.Set("X-Identity-Challenge", nonce)
+			req.Header.Set("X-Identity-Signature", hex.EncodeToString(sig))
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	if resp := download(nil, nil, ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("no signature: status %d, want 401", resp.StatusCode)
+	}
+	if resp := download(otherPub, otherPriv, challenge()); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("other key: status %d, want 403", resp.StatusCode)
+	}
+	if resp := download(pub, otherPriv, challenge()); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("bad signature: status %d, want 403", resp.StatusCode)
+	}
+	nonce := challenge()
+	resp = download(pub, priv, nonce)
+	if got := testserver.Body(t, resp); resp.StatusCode != http.StatusOK || !bytes.Equal(got, data) {
+		t.Fatalf("recipient download: status %d, body %q", resp.StatusCode, got)
+	}
+	if resp := download(pub, priv, nonce); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("replayed challenge: status %d, want 403", resp.StatusCode)
+	}
+
+	resp = s.Do(http.MethodPost, "/api/v1/upload", "application/json",
+		bytes.NewBufferString(`{"data_base64": "aGk=", "recipients": ["abc"]}`))
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusBadRequest || env.Error == nil || env.Error.Code != "invalid_recipient" {
+		t.Fatalf("bad recipient: status %d %+v, want 400 invalid_recipient", resp.StatusCode, env.Error)
+	}
+}
+
+func TestUploadTickets(t *testing.T) {
+	s := newTestServer(t, nil)
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+
+	mint := func(params string) string {
+		t.Helper()
+		resp := s.Do(http.MethodPost, "/api/v1/tickets?"+params, "", nil)
+		var env struct {
+			Data struct {
+				Ticket  string `json:"ticket"`
+				MaxSize int64  `json:"max_size"`
+			} `json:"data"`
+			Error *APIError `json:"error"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		if resp.StatusCode != http.StatusCreated || env.Data.Ticket == "" {
+			t.Fatalf("mint %s: status %d %+v", params, resp.StatusCode, env.Error)
+		}
+		return env.Data.Ticket
+	}
+	// upload sends a file with a ticket and no API key
+	upload := func(ticket, name string, data []byte) (*http.Response, AssetV1) {
+		t.Helper()
+		body, err := json.Marshal(map[string]any{
+			"filename":    name,
+			"data_base64": base64.StdEncoding.EncodeToString(data),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/upload", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Upload-Ticket", ticket)
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var env struct {
+			Data AssetV1 `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		return resp, env.Data
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/tickets", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("mint without key: status %d, want 401", resp.StatusCode)
+	}
+	if resp := s.Do(http.MethodPost, "/api/v1/tickets?ttl=48h", "", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("mint with long ttl: status %d, want 400", resp.StatusCode)
+	}
+
+	ticket := mint("types=image/*")
+	if resp, _ := upload(ticket, "doc.pdf", []byte("%PDF-1.4\n")); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("pdf with image ticket: status %d, want 415", resp.StatusCode)
+	}
+	if resp, _ := upload(ticket, "image.png", png); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("spent ticket: status %d, want 401", resp.StatusCode)
+	}
+
+	ticket = mint("types=image/png&max_size=1000")
+	resp, asset := upload(ticket, "image.png", png)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("ticket upload: status %d, want 201", resp.StatusCode)
+	}
+	if stored, _ := s.srv.assets.get(asset.ID); stored.Uploader != keyActor(testAPIKey) {
+		t.Fatalf("ticket upload by %q, want the minting key", stored.Uploader)
+	}
+	if resp, _ := upload(ticket, "image.png", png); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("reused ticket: status %d, want 401", resp.StatusCode)
+	}
+
+	ticket = mint("max_size=8")
+	if resp, _ := upload(ticket, "image.png", png); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized upload: status %d, want 413", resp.StatusCode)
+	}
+}
+
+func TestAPIKeyRotation(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminKey = "test-admin-key"
+	})
+	admin := func(method, path, body string, v any) int {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Admin-Key", "test-admin-key")
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if v != nil {
+			testserver.DecodeJSON(t, resp, v)
+		}
+		return resp.StatusCode
+	}
+	// accepted reports whether a key gets past authentication
+	accepted := func(key string) bool {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, s.URL+"/api/v1/assets/missing.png", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", key)
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode != http.StatusUnauthorized
+	}
+
+	var created newAPIKey
+	if status := admin(http.MethodPost, "/admin/keys", `{"name": "bot"}`, &created); status != http.StatusCreated || created.Key == "" {
+		t.Fatalf("create: status %d %+v", status, created)
+	}
+	if !accepted(created.Key) || !accepted(testAPIKey) || accepted("made-up") {
+		t.Fatal("created key, api_key or a made-up key not handled as expected")
+	}
+	var keys []APIKey
+	admin(http.MethodGet, "/admin/keys", "", &keys)
+	if len(keys) != 1 || keys[0].ID != created.ID || keys[0].LastUsedAt == nil {
+		t.Fatalf("keys %+v, want the created key with its last use", keys)
+	}
+
+	var rotated newAPIKey
+	if status := admin(http.MethodPost, "/admin/keys/"+created.ID+"/rotate", `{"overlap": "1h"}`, &rotated); status != http.StatusCreated {
+		t.Fatalf("rotate: status %d", status)
+	}
+	if rotated.Name != "bot" || !accepted(rotated.Key) || !accepted(created.Key) {
+		t.Fatal("both keys should work during the overlap")
+	}
+	if status := admin(http.MethodPost, "/admin/keys/"+created.ID+"/rotate", "", nil); status != http.StatusConflict {
+		t.Fatalf("second rotation: status %d, want 409", status)
+	}
+	s.clock.Advance(2 * time.Hour)
+	if accepted(created.Key) || !accepted(rotated.Key) {
+		t.Fatal("the old key should have expired after the overlap")
+	}
+
+	if status := admin(http.MethodPost, "/admin/keys/"+rotated.ID+"/disable", "", nil); status != http.StatusOK {
+		t.Fatalf("disable: status %d", status)
+	}
+	if accepted(rotated.Key) {
+		t.Fatal("disabled key still accepted")
+	}
+}
+
+func TestAuthLockout(t *testing.T) {
+	webhooks := make(chan WebhookEvent, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event WebhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		webhooks <- event
+	}))
+	defer receiver.Close()
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AuthMaxFailures = 3
+		cfg.AuthLockout = Duration(time.Minute)
+		cfg.WebhookURL = receiver.URL
+		cfg.WebhookSecret = "secret"
+	})
+	get := func(key string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, s.URL+"/api/v1/assets/missing.png", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", key)
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for i := 0; i < 3; i++ {
+		if resp := get("guess"); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("guess %d: status %d, want 401", i+1, resp.StatusCode)
+		}
+	}
+	resp := get(testAPIKey)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "60" {
+		t.Fatalf("locked out: status %d, Retry-After %q, want 429 after 60s",
+			resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	select {
+	case event := <-webhooks:
+		if event.Event != "auth.lockout" || event.Client != "ip:127.0.0.1" {
+			t.Fatalf("webhook %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook for the lockout")
+	}
+	entries, err := s.srv.auditor.query(auditFilter{Action: auditLockout, Limit: 10})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("lockout audit entries %+v, %v", entries, err)
+	}
+
+	// The next lockout in a row lasts twice as long
+	s.clock.Advance(2 * time.Minute)
+	if resp := get(testAPIKey); resp.StatusCode == http.StatusTooManyRequests {
+		t.Fatal("still locked out after the lockout")
+	}
+	for i := 0; i < 3; i++ {
+		get("guess")
+	}
+	if resp := get(testAPIKey); resp.Header.Get("Retry-After") != "120" {
+		t.Fatalf("second lockout: Retry-After %q, want 120", resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestDeletionToken(t *testing.T) {
+	s := newTestServer(t, nil)
+	asset := uploadV1(t, s, "note.txt", []byte("delete me later"))
+	if asset.DeleteToken == "" || !strings.HasSuffix(asset.DeleteURL, "?token="+url.QueryEscape(asset.DeleteToken)) {
+		t.Fatalf("upload with delete token %q, delete_url %q", asset.DeleteToken, asset.DeleteURL)
+	}
+	// remove deletes the asset with a token in the X-Delete-Token header
+	remove := func(token string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodDelete, s.URL+"/api/v1/assets/"+asset.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("X-Delete-Token", token)
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, token := range []string{"", "wrong", strings.ToUpper(asset.DeleteToken)} {
+		if status := remove(token); status != http.StatusForbidden {
+			t.Fatalf("delete with token %q: status %d, want 403", token, status)
+		}
+	}
+	if stored, _ := s.srv.assets.get(asset.ID); stored.State != stateActive {
+		t.Fatalf("asset %s after bad deletion tokens", stored.State)
+	}
+	if status := remove(asset.DeleteToken); status != http.StatusOK {
+		t.Fatalf("delete with the token: status %d, want 200", status)
+	}
+	if resp := s.Get(asset.URL); resp.StatusCode != http.StatusGone {
+		t.Fatalf("download after deletion: status %d, want 410", resp.StatusCode)
+	}
+	if status := remove(asset.DeleteToken); status != http.StatusGone {
+		t.Fatalf("second deletion: status %d, want 410", status)
+	}
+}
+
+func TestTrashRestore(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminKey = "test-admin-key"
+		cfg.TrashRetention = Duration(24 * time.Hour)
+	})
+	admin := func(method, ref string, v any) int {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+ref, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Admin-Key", "test-admin-key")
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != nil {
+			testserver.DecodeJSON(t, resp, v)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// A one-time download lands in the trash rather than being destroyed
+	data := []byte("downloaded once too often")
+	asset := uploadV1(t, s, "once.txt", data)
+	if body := testserver.Body(t, s.Get(asset.URL)); !bytes.Equal(body, data) {
+		t.Fatalf("first download: %q", body)
+	}
+	waitDeleted(t, s, asset.ID)
+	if resp := s.Get(asset.URL); resp.StatusCode != http.StatusGone {
+		t.Fatalf("download of used up asset: status %d, want 410", resp.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(s.srv.trashDir(), asset.ID)); err != nil {
+		t.Fatalf("file not in the trash: %v", err)
+	}
+	var trashed []Asset
+	if admin(http.MethodGet, "/admin/trash", &trashed); len(trashed) != 1 || trashed[0].ID != asset.ID {
+		t.Fatalf("trash %+v, want the downloaded asset", trashed)
+	}
+
+	if status := admin(http.MethodPost, "/admin/assets/"+asset.ID+"/restore", nil); status != http.StatusOK {
+		t.Fatalf("restore: status %d, want 200", status)
+	}
+	if stored, _ := s.srv.assets.get(asset.ID); stored.State != stateActive {
+		t.Fatalf("restored asset is %s", stored.State)
+	}
+	if body := testserver.Body(t, s.Get(asset.URL)); !bytes.Equal(body, data) {
+		t.Fatalf("download of restored asset: %q", body)
+	}
+	waitDeleted(t, s, asset.ID)
+
+	// Past the recovery window it is gone for good
+	s.clock.Advance(25 * time.Hour)
+	s.srv.purgeTrash()
+	if status := admin(http.MethodPost, "/admin/assets/"+asset.ID+"/restore", nil); status == http.StatusOK {
+		t.Fatal("asset restored after the trash was purged")
+	}
+	if _, err := os.Stat(filepath.Join(s.srv.trashDir(), asset.ID)); !os.IsNotExist(err) {
+		t.Fatalf("file still in the trash: %v", err)
+	}
+}
+
+func TestManifestMigration(t *testing.T) {
+	// admin sends a request to the admin API and decodes the answer into v
+	admin := func(s *testServer, method, ref string, body []byte, v any) int {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+ref, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Admin-Key", "test-admin-key")
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if v != nil {
+			testserver.DecodeJSON(t, resp, v)
+		}
+		return resp.StatusCode
+	}
+	withAdmin := func(cfg *Config) { cfg.AdminKey = "test-admin-key" }
+
+	from := newTestServer(t, withAdmin)
+	data := []byte("moving house")
+	kept := uploadV1(t, from, "kept.txt", data)
+	damaged := uploadV1(t, from, "damaged.txt", []byte("bit rot"))
+	var exported json.RawMessage
+	if status := admin(from, http.MethodGet, "/admin/manifest", nil, &exported); status != http.StatusOK {
+		t.Fatalf("manifest export: status %d", status)
+	}
+	var sm SignedManifest
+	if err := json.Unmarshal(exported, &sm); err != nil {
+		t.Fatal(err)
+	}
+
+	to := newTestServer(t, func(cfg *Config) {
+		withAdmin(cfg)
+		cfg.ManifestTrustedKeys = []string{sm.Key}
+	})
+	for _, asset := range []AssetV1{kept, damaged} {
+		data, err := os.ReadFile(from.srv.assetPath(asset.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if asset.ID == damaged.ID {
+			data[0] ^= 1
+		}
+		if err := os.WriteFile(to.srv.assetPath(asset.ID), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A manifest changed after signing, or signed by a key the server
+	// doesn't trust, is refused
+	tampered := sm
+	tampered.Manifest = bytes.Replace(sm.Manifest, []byte(`"kept.txt"`), []byte(`"evil.exe"`), 1)
+	if bytes.Equal(tampered.Manifest, sm.Manifest) {
+		t.Fatal("original name not in the manifest")
+	}
+	body, _ := json.Marshal(tampered)
+	if status := admin(to, http.MethodPost, "/admin/manifest", body, nil); status != http.StatusForbidden {
+		t.Fatalf("tampered manifest: status %d, want 403", status)
+	}
+	untrusted := newTestServer(t, withAdmin)
+	if status := admin(untrusted, http.MethodPost, "/admin/manifest", exported, nil); status != http.StatusForbidden {
+		t.Fatalf("manifest from an untrusted server: status %d, want 403", status)
+	}
+	if len(to.srv.assets.list())+len(untrusted.srv.assets.list()) != 0 {
+		t.Fatal("records imported from a refused manifest")
+	}
+
+	var result struct {
+		Imported int            `json:"imported"`
+		Skipped  []skippedAsset `json:"skipped"`
+	}
+	if status := admin(to, http.MethodPost, "/admin/manifest", exported, &result); status != http.StatusOK {
+		t.Fatalf("manifest import: status %d", status)
+	}
+	if result.Imported != 1 || len(result.Skipped) != 1 || result.Skipped[0] != (skippedAsset{damaged.ID, "checksum mismatch"}) {
+		t.Fatalf("import result %+v, want the damaged file skipped", result)
+	}
+	if body := testserver.Body(t, to.Get("/api/v1/download/"+kept.ID)); !bytes.Equal(body, data) {
+		t.Fatalf("download of imported asset: %q", body)
+	}
+}
+
+func TestShortLinks(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.ShortLinks = true
+		cfg.ShortLinkLength = 4
+	})
+	noFollow := *s.Client()
+	noFollow.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	follow := func(ref string) *http.Response {
+		t.Helper()
+		u, err := url.Parse(ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := noFollow.Get(s.URL + u.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	asset := uploadV1(t, s, "short.txt", []byte("link me"))
+	code, ok := strings.CutPrefix(asset.ShortURL, "https://assets.example.com/s/")
+	if !ok || len(code) != 4 {
+		t.Fatalf("short link %q, want a 4 character code", asset.ShortURL)
+	}
+	if resp := follow(asset.ShortURL); resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != asset.URL {
+		t.Fatalf("short link: status %d to %q, want 302 to %s", resp.StatusCode, resp.Header.Get("Location"), asset.URL)
+	}
+	if resp := follow("/s/no-such-link"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown short link: status %d, want 404", resp.StatusCode)
+	}
+	// The link goes with the asset's last download
+	s.Get(asset.URL)
+	if resp := follow(asset.ShortURL); resp.StatusCode != http.StatusGone {
+		t.Fatalf("short link of used up asset: status %d, want 410", resp.StatusCode)
+	}
+
+	// With every code of a length taken, a longer one is used
+	s.srv.config.ShortLinkLength = 1
+	for _, c := range shortLinkAlphabet {
+		if err := s.srv.shortLinks.insert(string(c), ShortLink{Code: string(c), AssetID: asset.ID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	asset = uploadV1(t, s, "crowded.txt", []byte("no room"))
+	if code := path.Base(asset.ShortURL); len(code) != 2 {
+		t.Fatalf("short link %q with all single characters taken, want 2", asset.ShortURL)
+	}
+	if resp := follow(asset.ShortURL); resp.Header.Get("Location") != asset.URL {
+		t.Fatalf("longer short link leads to %q, want %s", resp.Header.Get("Location"), asset.URL)
+	}
+}
+
+func TestVerdictWebhook(t *testing.T) {
+	type delivery struct {
+		timestamp, signature string
+		body                 []byte
+	}
+	deliveries := make(chan delivery, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		deliveries <- delivery{r.Header.Get("X-Webhook-Timestamp"), r.Header.Get("X-Webhook-Signature"), body}
+	}))
+	defer receiver.Close()
+
+	const secret = "webhook-secret"
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.WebhookURL = receiver.URL
+		cfg.WebhookSecret = secret
+		cfg.AsyncChecks = true
+		cfg.ScanCommand = []string{"false"}
+	})
+	asset := uploadV1(t, s, "flagged.txt", []byte("looks bad"))
+
+	var d delivery
+	select {
+	case d = <-deliveries:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook delivered")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s.%s", d.timestamp, d.body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); d.timestamp == "" || d.signature != want {
+		t.Fatalf("webhook signature %q at %q, want %s", d.signature, d.timestamp, want)
+	}
+	var event WebhookEvent
+	if err := json.Unmarshal(d.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Event != "asset.verdict" || event.AssetID != asset.ID || event.State != stateQuarantined ||
+		event.Verdict == nil || event.Verdict.Result != verdictQuarantined {
+		t.Fatalf("webhook %s, want the quarantine of %s", d.body, asset.ID)
+	}
+
+	// The verdict can be looked up too
+	var info struct {
+		Data AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, s.Get("/api/v1/assets/"+asset.ID), &info)
+	if info.Data.Verdict == nil || info.Data.Verdict.Result != verdictQuarantined {
+		t.Fatalf("info verdict %+v, want quarantined", info.Data.Verdict)
+	}
+}
+
+func TestReportProofOfWork(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.ReportPowDifficulty = 8
+	})
+	asset := uploadV1(t, s, "a.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"))
+
+	resp := s.Get("/api/v1/pow")
+	var env struct {
+		Data struct {
+			Challenge  string `json:"challenge"`
+			Difficulty int    `json:"difficulty"`
+		} `json:"data"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusOK || env.Data.Difficulty != 8 {
+		t.Fatalf("challenge: status %d %+v", resp.StatusCode, env.Data)
+	}
+	challenge := env.Data.Challenge
+	var solution, wrong string
+	for i := 0; solution == "" || wrong == ""; i++ {
+		if sum := sha256.Sum256([]byte(challenge + ":" + strconv.Itoa(i))); sum[0] == 0 {
+			solution = strconv.Itoa(i)
+		} else {
+			wrong = strconv.Itoa(i)
+		}
+	}
+
+	report := func(fields url.Values) bool {
+		t.Helper()
+		fields.Set("file", asset.URL)
+		fields.Set("reason", "spam")
+		resp := s.Do(http.MethodPost, "/report", "application/x-www-form-urlencoded", strings.NewReader(fields.Encode()))
+		var res Response
+		testserver.DecodeJSON(t, resp, &res)
+		return res.Success
+	}
+	if report(url.Values{}) {
+		t.Fatal("report without proof of work accepted")
+	}
+	if report(url.Values{"pow_challenge": {challenge}, "pow_solution": {wrong}}) {
+		t.Fatal("report with a wrong solution accepted")
+	}
+	if !report(url.Values{"pow_challenge": {challenge}, "pow_solution": {solution}}) {
+		t.Fatal("report with a valid proof of work refused")
+	}
+	if report(url.Values{"pow_challenge": {challenge}, "pow_solution": {solution}}) {
+		t.Fatal("proof of work used twice")
+	}
+}
+
+func TestReportReasonTruncated(t *testing.T) {
+	s := newTestServer(t, nil)
+	asset := uploadV1(t, s, "a.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"))
+
+	// A two-byte rune straddles the limit
+	reason := strings.Repeat("a", maxReportReasonLen-1) + "é"
+	fields := url.Values{"file": {asset.URL}, "reason": {reason}}
+	resp := s.Do(http.MethodPost, "/report", "application/x-www-form-urlencoded", strings.NewReader(fields.Encode()))
+	var res Response
+	testserver.DecodeJSON(t, resp, &res)
+	if !res.Success {
+		t.Fatalf("report refused: %+v", res)
+	}
+	reports := s.srv.reports.list()
+	if len(reports) != 1 {
+		t.Fatalf("%d reports, want 1", len(reports))
+	}
+	if got := reports[0].Reason; !utf8.ValidString(got) || len(got) != maxReportReasonLen-1 {
+		t.Fatalf("reason cut to %d bytes, valid UTF-8 %v", len(got), utf8.ValidString(got))
+	}
+}
+
+func TestAnonymousUploads(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	// upload sends a file without an API key
+	upload := func(s *testServer, name string, data []byte) (*http.Response, AssetV1) {
+		t.Helper()
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(data)
+		mw.Close()
+		req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/upload", &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var env struct {
+			Data AssetV1 `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		return resp, env.Data
+	}
+
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AnonymousUploads = true
+		cfg.AnonymousMaxFileSize = 64
+		cfg.AnonymousRateLimit = 3
+		cfg.AnonymousTTL = Duration(time.Hour)
+		cfg.ScanCommand = []string{"true"}
+	})
+	resp, asset := upload(s, "paste.png", png)
+	if resp.StatusCode != http.StatusCreated || asset.ExpiresAt == nil || asset.MaxDownloads != nil {
+		t.Fatalf("anonymous upload: status %d %+v, want 201 expiring without a download limit", resp.StatusCode, asset)
+	}
+	if stored, _ := s.srv.assets.get(asset.ID); stored.Uploader != "anon:127.0.0.1" {
+		t.Fatalf("uploader %q, want the client address", stored.Uploader)
+	}
+	// A bad ticket is a failed login, not an anonymous upload
+	for _, path := range []string{"/api/v1/upload?ticket=bogus", "/api/v1/upload"} {
+		req, err := http.NewRequest(http.MethodPost, s.URL+path, bytes.NewReader(png))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "image/png")
+		if !strings.Contains(path, "ticket") {
+			req.Header.Set("X-Upload-Ticket", "bogus")
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("upload with a bad ticket via %s: status %d, want 401", path, resp.StatusCode)
+		}
+	}
+	if f := s.srv.authGuard.clients["ip:127.0.0.1"]; f == nil || f.count != 2 {
+		t.Fatalf("auth failures %+v, want both bad tickets counted", f)
+	}
+	if resp, _ := upload(s, "doc.pdf", []byte("%PDF-1.4\n")); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("anonymous pdf: status %d, want 415", resp.StatusCode)
+	}
+	if resp, _ := upload(s, "big.png", append(png, make([]byte, 64)...)); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized anonymous upload: status %d, want 413", resp.StatusCode)
+	}
+	if resp, _ := upload(s, "paste.png", png); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("fourth anonymous upload: status %d, want 429", resp.StatusCode)
+	}
+	if asset := uploadV1(t, s, "keyed.png", png); asset.ExpiresAt != nil {
+		t.Fatalf("keyed upload %+v, want the default retention", asset)
+	}
+
+	// Scanning can't be configured away
+	s = newTestServer(t, func(cfg *Config) {
+		cfg.AnonymousUploads = true
+		cfg.ScanCommand = []string{"false"}
+		cfg.Pipelines = map[string][]string{"default": {"thumbnail"}}
+	})
+	if resp, _ := upload(s, "paste.png", png); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("flagged anonymous upload: status %d, want 422", resp.StatusCode)
+	}
+	if asset := uploadV1(t, s, "keyed.png", png); asset.State != stateActive {
+		t.Fatalf("keyed upload %+v, want it unscanned", asset)
+	}
+}
+
+func TestAssetTags(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminKey = "test-admin-key"
+		cfg.RetentionRules = []RetentionRule{{Name: "keep", Tags: []string{"Keep"}, MaxDownloads: unlimitedDownloads}}
+	})
+	admin := func(method, ref, body string) *http.Response {
+		req, err := http.NewRequest(method, s.URL+ref, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Admin-Key", "test-admin-key")
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	upload := func(tags string) (*http.Response, AssetV1) {
+		t.Helper()
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "a.png")
+		fw.Write([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"))
+		mw.WriteField("tags", tags)
+		mw.Close()
+		resp := s.Do(http.MethodPost, "/api/v1/upload", mw.FormDataContentType(), &body)
+		defer resp.Body.Close()
+		var env struct {
+			Data AssetV1 `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		return resp, env.Data
+	}
+
+	resp, tagged := upload("Album:Summer, bot")
+	if resp.StatusCode != http.StatusCreated || !slices.Equal(tagged.Tags, []string{"album:summer", "bot"}) {
+		t.Fatalf("tagged upload: status %d, tags %q", resp.StatusCode, tagged.Tags)
+	}
+	if resp, _ := upload("no spaces/slashes"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid tag: status %d, want 400", resp.StatusCode)
+	}
+	_, kept := upload("keep")
+	if kept.MaxDownloads != nil {
+		t.Fatalf("asset tagged keep %+v, want no download limit", kept)
+	}
+
+	var found []Asset
+	testserver.DecodeJSON(t, admin(http.MethodGet, "/admin/search?tag=bot&tag=album:summer", ""), &found)
+	if len(found) != 1 || found[0].ID != tagged.ID {
+		t.Fatalf("search by tags found %+v", found)
+	}
+
+	// Tagging an asset keep lifts its download limit, untagging restores it
+	var asset Asset
+	resp = admin(http.MethodPatch, "/admin/assets/"+tagged.ID+"/tags", `{"add": ["keep"], "remove": ["bot"]}`)
+	testserver.DecodeJSON(t, resp, &asset)
+	if resp.StatusCode != http.StatusOK || !slices.Equal(asset.Tags, []string{"album:summer", "keep"}) || asset.Retention != "keep" {
+		t.Fatalf("tagging: status %d, %+v", resp.StatusCode, asset)
+	}
+	for range 2 {
+		if resp := s.Get("/api/v1/download/" + tagged.ID); resp.StatusCode != http.StatusOK {
+			t.Fatalf("download of kept asset: status %d", resp.StatusCode)
+		}
+	}
+	var untagged Asset
+	testserver.DecodeJSON(t, admin(http.MethodPatch, "/admin/assets/"+kept.ID+"/tags", `{"remove": ["keep"]}`), &untagged)
+	if untagged.Retention != defaultRetention.Name || untagged.downloadLimit() != 1 || len(untagged.Tags) != 0 {
+		t.Fatalf("untagging: %+v", untagged)
+	}
+	if resp := admin(http.MethodPatch, "/admin/assets/missing/tags", `{"add": ["x"]}`); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("tagging a missing asset: status %d, want 404", resp.StatusCode)
+	}
+
+	var counts []TagCount
+	testserver.DecodeJSON(t, admin(http.MethodGet, "/admin/tags", ""), &counts)
+	if want := []TagCount{{"album:summer", 1}, {"keep", 1}}; !slices.Equal(counts, want) {
+		t.Fatalf("tags %+v, want %+v", counts, want)
+	}
+}
+
+func TestUploadPrecheck(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.RetentionRules = []RetentionRule{{Name: "forever-ish", Keys: []string{keyActor(testAPIKey)}, MaxDownloads: unlimitedDownloads, TTL: Duration(time.Hour)}}
+	})
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	sum := sha256.Sum256(png)
+
+	type precheck struct {
+		Exists bool    `json:"exists"`
+		Ticket string  `json:"ticket"`
+		Asset  AssetV1 `json:"asset"`
+	}
+	check := func(hash string, size int) (*http.Response, precheck) {
+		t.Helper()
+		resp := s.Do(http.MethodPost, "/api/v1/precheck?sha256="+hash+"&size="+strconv.Itoa(size), "", nil)
+		var env struct {
+			Data precheck `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		return resp, env.Data
+	}
+	upload := func(ticket string, data []byte) *http.Response {
+		t.Helper()
+		body, _ := json.Marshal(map[string]any{"filename": "a.png", "data_base64": base64.StdEncoding.EncodeToString(data)})
+		req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/upload", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Upload-Ticket", ticket)
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp, pc := check(hex.EncodeToString(sum[:]), len(png))
+	if resp.StatusCode != http.StatusOK || pc.Exists || pc.Ticket == "" {
+		t.Fatalf("precheck of new content: status %d %+v, want a ticket", resp.StatusCode, pc)
+	}
+	if resp := upload(pc.Ticket, append([]byte{}, png[:len(png)-1]...)); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("upload of other content: status %d, want 400", resp.StatusCode)
+	}
+	_, pc = check(hex.EncodeToString(sum[:]), len(png))
+	if resp := upload(pc.Ticket, png); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload with granted ticket: status %d, want 201", resp.StatusCode)
+	}
+
+	resp, pc = check(strings.ToUpper(hex.EncodeToString(sum[:])), len(png))
+	if resp.StatusCode != http.StatusOK || !pc.Exists || pc.Asset.SHA256 != hex.EncodeToString(sum[:]) || pc.Ticket != "" {
+		t.Fatalf("precheck of stored content: status %d %+v, want the asset", resp.StatusCode, pc)
+	}
+	if resp, _ := check("abc", len(png)); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("precheck with a bad hash: status %d, want 400", resp.StatusCode)
+	}
+	if resp, _ := check(hex.EncodeToString(sum[:]), int(s.srv.config.MaxFileSize)+1); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("precheck of too large a file: status %d, want 413", resp.StatusCode)
+	}
+
+	// Single download assets are not handed out twice
+	s.srv.config.RetentionRules = nil
+	other := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR\x00")
+	uploadV1(t, s, "b.png", other)
+	sum = sha256.Sum256(other)
+	if _, pc := check(hex.EncodeToString(sum[:]), len(other)); pc.Exists {
+		t.Fatalf("precheck of single download content %+v, want a ticket", pc)
+	}
+}
+
+func TestSlowUpload(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.MinUploadRate = 1 << 20
+		cfg.UploadRateGrace = Duration(200 * time.Millisecond)
+	})
+
+	// An upload trickling in its first bytes and nothing after
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go pw.Write([]byte("--x\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.txt\"\r\n\r\nstart"))
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/upload", pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=x")
+	req.Header.Set("X-API-Key", testAPIKey)
+	start := time.Now()
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Fatalf("trickling upload: status %d, want 408", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("trickling upload aborted after %v", elapsed)
+	}
+
+	// Uploads that arrive at once are unaffected however long storing takes
+	uploadV1(t, s, "a.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"))
+}
+
+func TestConnLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := newConnLimitListener(inner, 1)
+	defer ln.Close()
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+
+	first, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	held := <-accepted
+
+	// A second connection from the same address is closed on arrival
+	second, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := second.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read on connection over the limit: %v, want EOF", err)
+	}
+
+	// Closing the first frees its slot
+	held.Close()
+	third, err := net.Dial("tcp", inner.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection after a slot was freed not accepted")
+	}
+}
+
+// readFromRecorder is a ResponseWriter that, like a connection's, copies
+// from readers itself, noting what it was given.
+type readFromRecorder struct {
+	*httptest.ResponseRecorder
+	files int
+}
+
+func (w *readFromRecorder) ReadFrom(r io.Reader) (int64, error) {
+	if lr, ok := r.(*io.LimitedReader); ok {
+		if _, ok := lr.R.(*os.File); ok {
+			w.files++
+		}
+	}
+	return io.Copy(w.ResponseRecorder, r)
+}
+
+// cutRecorder is a ResponseWriter whose connection drops after n bytes.
+type cutRecorder struct {
+	*httptest.ResponseRecorder
+	n int
+}
+
+func (w *cutRecorder) Write(p []byte) (int, error) {
+	n, _ := w.ResponseRecorder.Write(p[:min(len(p), w.n)])
+	if w.n -= n; n < len(p) {
+		return n, io.ErrClosedPipe
+	}
+	return n, nil
+}
+
+func TestSendFileRange(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), sendChunk/4)
+	path := filepath.Join(t.TempDir(), "f")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Files reach the connection through the transfer tracking untouched
+	rec := &readFromRecorder{ResponseRecorder: httptest.NewRecorder()}
+	tr := &transfer{}
+	n, err := sendFileRange(transferWriter{rec, tr}, f, 5, int64(len(data))-10)
+	if err != nil || n != int64(len(data))-10 {
+		t.Fatalf("sendFileRange = %d, %v", n, err)
+	}
+	if !bytes.Equal(rec.Body.Bytes(), data[5:len(data)-5]) {
+		t.Fatal("sent data differs from the range of the file")
+	}
+	if rec.files != 3 || tr.bytes.Load() != n {
+		t.Fatalf("%d file chunks and %d bytes counted, want 3 and %d", rec.files, tr.bytes.Load(), n)
+	}
+
+	// Writers that can't take a file are copied to
+	var buf bytes.Buffer
+	if n, err := sendFileRange(struct{ io.Writer }{&buf}, f, 0, 10); err != nil || n != 10 || buf.String() != "0123456789" {
+		t.Fatalf("sendFileRange to a plain writer = %d, %v, %q", n, err, buf.String())
+	}
+	if _, err := sendFileRange(&buf, f, int64(len(data))-1, 2); err != io.ErrUnexpectedEOF {
+		t.Fatalf("sendFileRange past the end: %v, want unexpected EOF", err)
+	}
+}
+
+func TestWorkerPoolPriorities(t *testing.T) {
+	pool := &workerPool{size: 1}
+	ctx := context.Background()
+	if err := pool.acquire(ctx, "optimize", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// A transcode queued first, then a thumbnail, then one that gives up
+	order := make(chan string, 2)
+	wait := func(stage string, priority int) {
+		if err := pool.acquire(ctx, stage, priority); err != nil {
+			t.Error(err)
+			return
+		}
+		order <- stage
+		pool.release()
+	}
+	go wait("gif_video", 0)
+	for pool.stats().Queued["gif_video"] == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	go wait("thumbnail", 3)
+	cctx, cancel := context.WithCancel(ctx)
+	gaveUp := make(chan error)
+	go func() { gaveUp <- pool.acquire(cctx, "scan", 2) }()
+	for st := pool.stats(); st.Queued["thumbnail"] == 0 || st.Queued["scan"] == 0; st = pool.stats() {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-gaveUp; err != context.Canceled {
+		t.Fatalf("cancelled acquire: %v", err)
+	}
+	if st := pool.stats(); st.Busy != 1 || st.Queued["scan"] != 0 || st.Queued["thumbnail"] != 1 || st.Queued["gif_video"] != 1 {
+		t.Fatalf("stats %+v", st)
+	}
+
+	pool.release()
+	if first, second := <-order, <-order; first != "thumbnail" || second != "gif_video" {
+		t.Fatalf("ran %s before %s, want the thumbnail first", first, second)
+	}
+	if st := pool.stats(); st.Busy != 0 || len(st.Queued) != 0 {
+		t.Fatalf("stats after the queue drained %+v", st)
+	}
+}
+
+func TestStageTimeouts(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.ScanCommand = []string{"sh", "-c", "exec sleep 5"}
+		cfg.StageTimeouts = map[string]Duration{"scan": Duration(100 * time.Millisecond)}
+	})
+	start := time.Now()
+	resp := s.UploadMultipart("/api/v1/upload", "file", map[string][]byte{"a.png": []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("upload with a hanging scanner: status %d, want 422", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Fatalf("scan stage ran for %v", elapsed)
+	}
+
+	cfg := Config{StageTimeouts: map[string]Duration{"transcode": Duration(time.Second)}}
+	if err := (&Server{config: cfg}).validateWorkerConfig(); err == nil {
+		t.Fatal("timeout of an unknown stage accepted")
+	}
+}
+
+func TestSrcset(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) { cfg.SrcsetWidths = []int{1024, 256, 512, 2048} })
+	encode := func(w, h int) []byte {
+		img := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(img, img.Bounds(), image.Opaque, image.Point{}, draw.Src)
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+
+	asset := uploadV1(t, s, "wide.png", encode(1200, 600))
+	want := map[string]string{"1200w": asset.URL}
+	for _, w := range []string{"256w", "512w", "1024w"} {
+		want[w] = asset.URL + "/" + w
+	}
+	if !maps.Equal(asset.Srcset, want) {
+		t.Fatalf("srcset %v, want %v", asset.Srcset, want)
+	}
+
+	var info struct {
+		Data AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, s.Do(http.MethodGet, "/api/v1/assets/"+asset.ID, "", nil), &info)
+	if !maps.Equal(info.Data.Srcset, want) {
+		t.Fatalf("srcset of info %v, want %v", info.Data.Srcset, want)
+	}
+
+	resp := s.Get(asset.Srcset["512w"])
+	body := testserver.Body(t, resp)
+	img, format, err := image.Decode(bytes.NewReader(body))
+	if err != nil || format != "jpeg" || img.Bounds().Dx() != 512 || img.Bounds().Dy() != 256 {
+		t.Fatalf("512w: %v %s %v, want a 512x256 JPEG", err, format, img.Bounds())
+	}
+
+	if small := uploadV1(t, s, "small.png", encode(200, 100)); small.Srcset != nil {
+		t.Fatalf("srcset of an image narrower than every width: %v", small.Srcset)
+	}
+}
+
+func TestHLS(t *testing.T) {
+	tools := t.TempDir()
+	ffprobe := filepath.Join(tools, "ffprobe")
+	ffmpeg := filepath.Join(tools, "ffmpeg")
+	probe := `{"streams": [{"codec_type": "video", "width": 1280, "height": 720, "disposition": {"attached_pic": 0}}],` +
+		` "format": {"duration": "10.0"}}`
+	// The fake ffmpeg writes two segments next to the playlist, its last
+	// argument
+	scripts := map[string]string{
+		ffprobe: "#!/bin/sh\necho '" + probe + "'\n",
+		ffmpeg: "#!/bin/sh\nfor out; do :; done\ndir=$(dirname \"$out\")\n" +
+			"head -c 6000 /dev/zero > \"$dir/000.ts\"\nhead -c 2000 /dev/zero > \"$dir/001.ts\"\n" +
+			"printf '#EXTM3U\\n#EXTINF:6.0,\\n000.ts\\n#EXTINF:4.0,\\n001.ts\\n#EXT-X-ENDLIST\\n' > \"$out\"\n",
+	}
+	for path, script := range scripts {
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AllowedTypes = []string{"video/mp4"}
+		cfg.ContentTypeOrder = []string{"sniff"}
+		cfg.HLS = true
+		cfg.FFmpeg, cfg.FFprobe = ffmpeg, ffprobe
+		cfg.RetentionRules = []RetentionRule{{Name: "day", MaxDownloads: unlimitedDownloads, TTL: Duration(24 * time.Hour)}}
+	})
+	video := append([]byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"), make([]byte, 1000)...)
+	asset := uploadV1(t, s, "clip.mp4", video)
+	if want := "https://assets.example.com/stream/" + asset.ID + "/index.m3u8"; asset.StreamURL != want {
+		t.Fatalf("stream URL %q, want %q", asset.StreamURL, want)
+	}
+
+	resp := s.Get(asset.StreamURL)
+	master := string(testserver.Body(t, resp))
+	want := "#EXTM3U\n#EXT-X-VERSION:3\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=8000,RESOLUTION=640x360\n360p/index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=8000,RESOLUTION=1280x720\n720p/index.m3u8\n"
+	if resp.StatusCode != http.StatusOK || master != want {
+		t.Fatalf("master playlist: %d %q, want %q", resp.StatusCode, master, want)
+	}
+
+	base := strings.TrimSuffix(asset.StreamURL, "index.m3u8")
+	resp = s.Get(base + "720p/000.ts")
+	if body := testserver.Body(t, resp); resp.StatusCode != http.StatusOK || len(body) != 6000 ||
+		resp.Header.Get("Content-Type") != "video/mp2t" {
+		t.Fatalf("segment: %d %s, %d bytes", resp.StatusCode, resp.Header.Get("Content-Type"), len(body))
+	}
+	for _, path := range []string{"1080p/index.m3u8", "720p/other.txt", "720p"} {
+		if resp := s.Get(base + path); resp.StatusCode != http.StatusNotFound {
+			t.Fatalf("%s: %d, want 404", path, resp.StatusCode)
+		}
+		resp.Body.Close()
+	}
+
+	// Streaming doesn't use up downloads, and the stream goes with the asset
+	if stored, _ := s.srv.assets.get(asset.ID); stored.Downloads != 0 {
+		t.Fatalf("%d downloads after streaming", stored.Downloads)
+	}
+	resp = s.Do(http.MethodDelete, asset.DeleteURL, "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete: %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+	if resp := s.Get(asset.StreamURL); resp.StatusCode != http.StatusGone {
+		t.Fatalf("stream of deleted asset: %d, want 410", resp.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(s.srv.hlsDir(), asset.ID)); !os.IsNotExist(err) {
+		t.Fatalf("stream of deleted asset left on disk: %v", err)
+	}
+}
+
+func TestSidecars(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.MaxSidecarSize = 64
+		cfg.RetentionRules = []RetentionRule{{MaxDownloads: 2, TTL: Duration(time.Hour)}}
+	})
+	asset := uploadV1(t, s, "talk.txt", []byte("a talk"))
+	put := func(name, body string) (*http.Response, AssetV1) {
+		t.Helper()
+		resp := s.Do(http.MethodPut, "/api/v1/assets/"+asset.ID+"/sidecars/"+name, "text/plain", strings.NewReader(body))
+		var env struct {
+			Data AssetV1 `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		return resp, env.Data
+	}
+
+	subtitles := "WEBVTT\n\n00:00.000 --> 00:01.000\nHello\n"
+	resp, updated := put("en.vtt", subtitles)
+	if resp.StatusCode != http.StatusOK || len(updated.Sidecars) != 1 ||
+		updated.Sidecars[0].URL != asset.URL+"/sidecar/en.vtt" {
+		t.Fatalf("put: %d %+v", resp.StatusCode, updated.Sidecars)
+	}
+	for _, tc := range []struct {
+		name, body string
+		status     int
+	}{
+		{"en.html", "<script>", http.StatusBadRequest},
+		{"de.vtt", "not subtitles", http.StatusBadRequest},
+		{"de.txt", "\xff\xfe", http.StatusBadRequest},
+		{"long.txt", strings.Repeat("x", 65), http.StatusRequestEntityTooLarge},
+	} {
+		if resp, _ := put(tc.name, tc.body); resp.StatusCode != tc.status {
+			t.Errorf("put %s: %d, want %d", tc.name, resp.StatusCode, tc.status)
+		}
+	}
+
+	// Sidecars are served as text and don't use up downloads
+	for range 3 {
+		resp = s.Get(updated.Sidecars[0].URL)
+		if body := testserver.Body(t, resp); resp.StatusCode != http.StatusOK || string(body) != subtitles ||
+			resp.Header.Get("Content-Type") != "text/vtt; charset=utf-8" {
+			t.Fatalf("sidecar: %d %s %q", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+		}
+	}
+	if stored, _ := s.srv.assets.get(asset.ID); stored.Downloads != 0 {
+		t.Fatalf("%d downloads after fetching sidecars", stored.Downloads)
+	}
+
+	resp = s.Do(http.MethodDelete, "/api/v1/assets/"+asset.ID+"/sidecars/en.vtt", "", nil)
+	resp.Body.Close()
+	if resp := s.Get(updated.Sidecars[0].URL); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("removed sidecar: %d, want 404", resp.StatusCode)
+	}
+
+	// Only the uploader's key may attach sidecars
+	s.srv.assets.update(asset.ID, func(a *Asset) error {
+		a.Uploader = "key:00000000"
+		return nil
+	})
+	if resp, _ := put("en.vtt", subtitles); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("put by another key: %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestTranscription(t *testing.T) {
+	whisper := filepath.Join(t.TempDir(), "whisper")
+	if err := os.WriteFile(whisper, []byte("#!/bin/sh\necho '  hello from the command '\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer stt-key" || r.Header.Get("Content-Type") != "audio/mpeg" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"text": "hello from the service"})
+	}))
+	defer api.Close()
+
+	audio := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), make([]byte, 100)...)
+	for _, tc := range []struct {
+		name      string
+		configure func(*Config)
+		want      string
+	}{
+		{"command", func(cfg *Config) { cfg.TranscribeCommand = []string{whisper, "-nt"} }, "hello from the command"},
+		{"service", func(cfg *Config) { cfg.TranscribeURL, cfg.TranscribeKey = api.URL, "stt-key" }, "hello from the service"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *Config) {
+				cfg.ContentTypeOrder = []string{"sniff"}
+				cfg.RetentionRules = []RetentionRule{{MaxDownloads: 2, TTL: Duration(time.Hour)}}
+				tc.configure(cfg)
+			})
+			asset := uploadV1(t, s, "speech.mp3", audio)
+			if asset.ContentType != "audio/mpeg" || asset.Transcript != tc.want {
+				t.Fatalf("asset %s with transcript %q, want %q", asset.ContentType, asset.Transcript, tc.want)
+			}
+			if len(asset.Sidecars) != 1 || asset.Sidecars[0].Name != "transcript.txt" {
+				t.Fatalf("sidecars %+v, want the transcript", asset.Sidecars)
+			}
+			resp := s.Get(asset.Sidecars[0].URL)
+			if body := testserver.Body(t, resp); string(body) != tc.want+"\n" {
+				t.Fatalf("transcript sidecar %q", body)
+			}
+		})
+	}
+}
+
+func TestAudioInfo(t *testing.T) {
+	ffprobe := filepath.Join(t.TempDir(), "ffprobe")
+	probe := `{"streams": [{"codec_type": "audio", "sample_rate": "44100", "channels": 2},` +
+		` {"codec_type": "video", "width": 500, "height": 500, "disposition": {"attached_pic": 1}}],` +
+		` "format": {"duration": "12.345678"}}`
+	if err := os.WriteFile(ffprobe, []byte("#!/bin/sh\necho '"+probe+"'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.ContentTypeOrder = []string{"sniff"}
+		cfg.ProbeAudio = true
+		cfg.FFprobe = ffprobe
+	})
+
+	asset := uploadV1(t, s, "speech.mp3", append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), make([]byte, 100)...))
+	want := AudioInfo{Duration: 12.346, SampleRate: 44100, Channels: 2}
+	if asset.Audio == nil || *asset.Audio != want {
+		t.Fatalf("audio %+v, want %+v", asset.Audio, want)
+	}
+	if image := uploadV1(t, s, "image.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")); image.Audio != nil {
+		t.Fatalf("image with audio %+v", image.Audio)
+	}
+}
+
+func TestImageInfo(t *testing.T) {
+	s := newTestServer(t, nil)
+	img := image.NewRGBA(image.Rect(0, 0, 300, 200))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{200, 100, 50, 255}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	asset := uploadV1(t, s, "flat.png", buf.Bytes())
+	if asset.Width != 300 || asset.Height != 200 || asset.Orientation != 0 {
+		t.Fatalf("%dx%d orientation %d, want 300x200 and none", asset.Width, asset.Height, asset.Orientation)
+	}
+	if asset.Color != "#c86432" {
+		t.Fatalf("color %s, want #c86432", asset.Color)
+	}
+	// As the reference encoder hashes a flat image
+	if want := "L5M|T9}XfQ}X}XoKfQoKfQfQfQfQ"; asset.Blurhash != want {
+		t.Fatalf("blurhash %s, want %s", asset.Blurhash, want)
+	}
+
+	var info struct {
+		Data AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, s.Do(http.MethodGet, "/api/v1/assets/"+asset.ID, "", nil), &info)
+	if info.Data.Blurhash != asset.Blurhash || info.Data.Width != 300 {
+		t.Fatalf("info %+v", info.Data)
+	}
+
+	data, ok := strings.CutPrefix(asset.Placeholder, "data:image/jpeg;base64,")
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if !ok || err != nil || len(raw) > 1024 {
+		t.Fatalf("placeholder %q: %v", asset.Placeholder, err)
+	}
+	if cfg, err := jpeg.DecodeConfig(bytes.NewReader(raw)); err != nil || cfg.Width != 16 || cfg.Height != 10 {
+		t.Fatalf("placeholder %dx%d: %v, want 16x10", cfg.Width, cfg.Height, err)
+	}
+	restricted, _ := s.srv.assets.get(asset.ID)
+	restricted.PasswordHash = "hash"
+	if v := s.srv.assetV1(&restricted, ""); v.Placeholder != "" || v.Blurhash == "" {
+		t.Fatalf("password protected asset with placeholder %q, blurhash %q", v.Placeholder, v.Blurhash)
+	}
+
+	// A photo taken with the camera turned, EXIF orientation 6
+	buf.Reset()
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 40, 30)), nil); err != nil {
+		t.Fatal(err)
+	}
+	app1 := []byte("\xff\xe1\x00\x22Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08" +
+		"\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")
+	photo := append(append([]byte{0xff, 0xd8}, app1...), buf.Bytes()[2:]...)
+	asset = uploadV1(t, s, "photo.jpg", photo)
+	if asset.Width != 40 || asset.Height != 30 || asset.Orientation != 6 || asset.Color != "#000000" {
+		t.Fatalf("%dx%d orientation %d color %s, want 40x30, 6 and #000000", asset.Width, asset.Height, asset.Orientation, asset.Color)
+	}
+}
+
+func TestBlindUploads(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 64, 48))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	s := newTestServer(t, nil)
+	if resp := s.UploadMultipart("/api/v1/upload?blind=true", "file", map[string][]byte{"pic.png": data}); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("blind upload while disabled: status %d, want 403", resp.StatusCode)
+	}
+
+	// Blind uploads pass type checks and are kept as opaque bytes
+	s = newTestServer(t, func(cfg *Config) {
+		cfg.BlindUploads = true
+		cfg.AllowedTypes = []string{"text/plain"}
+	})
+	if resp := s.UploadMultipart("/api/v1/upload", "file", map[string][]byte{"pic.png": data}); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("png upload: status %d, want 415", resp.StatusCode)
+	}
+	resp := s.UploadMultipart("/api/v1/upload?blind=true", "file", map[string][]byte{"pic.png": data})
+	var env struct {
+		Data AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	asset := env.Data
+	if resp.StatusCode != http.StatusCreated || !asset.Blind || asset.ContentType != blindContentType {
+		t.Fatalf("blind upload: status %d %+v", resp.StatusCode, asset)
+	}
+	if asset.Width != 0 || asset.Blurhash != "" || len(asset.Thumbnails) != 0 || len(asset.Variants) != 0 {
+		t.Fatalf("blind upload previewed: %+v", asset)
+	}
+	if stored, _ := s.srv.assets.get(asset.ID); strings.Contains(stored.OriginalName, "pic") {
+		t.Fatalf("blind upload kept its filename %q", stored.OriginalName)
+	}
+	resp = s.Get(asset.URL)
+	if body := testserver.Body(t, resp); !bytes.Equal(body, data) || resp.Header.Get("Content-Type") != blindContentType {
+		t.Fatalf("blind download as %s: %d bytes, want %d", resp.Header.Get("Content-Type"), len(body), len(data))
+	}
+}
+
+func TestImagePlaceholders(t *testing.T) {
+	s := newTestServer(t, nil)
+	for _, tc := range []struct {
+		name          string
+		width, height int
+		query         string
+		// wantWidth and wantHeight are the size of the placeholder, none
+		// if zero
+		wantWidth, wantHeight int
+	}{
+		{"wide", 300, 200, "", 16, 10},
+		{"tall", 100, 400, "", 4, 16},
+		{"square", 20, 20, "", 16, 16},
+		{"strip", 1000, 10, "", 16, 1},
+		{"password", 300, 200, "?password=secret", 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			fill := color.RGBA{30, 160, 90, 255}
+			img := image.NewRGBA(image.Rect(0, 0, tc.width, tc.height))
+			draw.Draw(img, img.Bounds(), image.NewUniform(fill), image.Point{}, draw.Src)
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, img); err != nil {
+				t.Fatal(err)
+			}
+			resp := s.UploadMultipart("/api/v1/upload"+tc.query, "file", map[string][]byte{tc.name + ".png": buf.Bytes()})
+			var env struct {
+				Data AssetV1 `json:"data"`
+			}
+			testserver.DecodeJSON(t, resp, &env)
+			asset := env.Data
+			if resp.StatusCode != http.StatusCreated || asset.Blurhash == "" {
+				t.Fatalf("upload: %d, blurhash %q", resp.StatusCode, asset.Blurhash)
+			}
+
+			// Restricted images keep their blurhash, but no preview
+			if tc.wantWidth == 0 {
+				if asset.Placeholder != "" {
+					t.Fatalf("placeholder %q, want none", asset.Placeholder)
+				}
+				return
+			}
+			data, ok := strings.CutPrefix(asset.Placeholder, "data:image/jpeg;base64,")
+			raw, err := base64.StdEncoding.DecodeString(data)
+			if !ok || err != nil {
+				t.Fatalf("placeholder %q: %v", asset.Placeholder, err)
+			}
+			preview, err := jpeg.Decode(bytes.NewReader(raw))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := preview.Bounds(); b.Dx() != tc.wantWidth || b.Dy() != tc.wantHeight {
+				t.Fatalf("placeholder %dx%d, want %dx%d", b.Dx(), b.Dy(), tc.wantWidth, tc.wantHeight)
+			}
+			r, g, b, _ := preview.At(0, 0).RGBA()
+			for _, c := range []struct{ got, want uint32 }{{r >> 8, uint32(fill.R)}, {g >> 8, uint32(fill.G)}, {b >> 8, uint32(fill.B)}} {
+				if c.got+16 < c.want || c.got > c.want+16 {
+					t.Fatalf("placeholder color %d,%d,%d, want about %v", r>>8, g>>8, b>>8, fill)
+				}
+			}
+		})
+	}
+}
+
+func TestAssetPassword(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.RetentionRules = []RetentionRule{{Name: "kept", MaxDownloads: unlimitedDownloads, TTL: Duration(time.Hour)}}
+	})
+	data := []byte("for your eyes only")
+	resp := s.UploadMultipart("/api/v1/upload?password=secret", "file", map[string][]byte{"secret.txt": data})
+	var env struct {
+		Data AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload with a password: status %d", resp.StatusCode)
+	}
+	// download fetches the asset with a password sent in the header, a
+	// posted form or not at all
+	download := func(header, form string, html bool) (*http.Response, []byte) {
+		t.Helper()
+		method, body := http.MethodGet, io.Reader(nil)
+		if form != "" {
+			method, body = http.MethodPost, strings.NewReader(url.Values{"password": {form}}.Encode())
+		}
+		req, err := http.NewRequest(method, s.URL+"/api/v1/download/"+env.Data.ID, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if form != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if header != "" {
+			req.Header.Set("X-Asset-Password", header)
+		}
+		if html {
+			req.Header.Set("Accept", "text/html")
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, testserver.Body(t, resp)
+	}
+
+	resp, body := download("", "", true)
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(body), `<input type="password" name="password"`) ||
+		resp.Header.Get("Cache-Control") != "no-store" {
+		t.Fatalf("browser without a password: status %d, %q", resp.StatusCode, body)
+	}
+	if resp, body := download("", "", false); resp.StatusCode != http.StatusUnauthorized || strings.Contains(string(body), "<form") {
+		t.Fatalf("client without a password: status %d, %q", resp.StatusCode, body)
+	}
+	if resp, _ := download("wrong", "", false); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong password in the header: status %d, want 401", resp.StatusCode)
+	}
+	if resp, body := download("", "wrong", true); resp.StatusCode != http.StatusUnauthorized || !strings.Contains(string(body), "Wrong password.") {
+		t.Fatalf("wrong password in the form: status %d, %q", resp.StatusCode, body)
+	}
+	if resp, body := download("secret", "", false); resp.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+		t.Fatalf("password in the header: status %d, %q", resp.StatusCode, body)
+	}
+	if resp, body := download("", "secret", true); resp.StatusCode != http.StatusOK || !bytes.Equal(body, data) {
+		t.Fatalf("password in the form: status %d, %q", resp.StatusCode, body)
+	}
+
+	// Guessing is cut off after ten attempts, the right password included
+	for i := 4; i < 10; i++ {
+		if resp, _ := download("wrong", "", false); resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status %d, want 401", i+1, resp.StatusCode)
+		}
+	}
+	if resp, _ := download("secret", "", false); resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("attempt after the limit: status %d, want 429 with Retry-After", resp.StatusCode)
+	}
+}
+
+func TestHotlinkProtection(t *testing.T) {
+	kept := []RetentionRule{{Name: "kept", MaxDownloads: unlimitedDownloads, TTL: Duration(time.Hour)}}
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.RetentionRules = kept
+		cfg.HotlinkAllowedReferers = []string{"chat.example.org", "*.forum.example"}
+		cfg.HotlinkSigningKey = "hotlink-signing-key"
+	})
+	// status fetches an asset with a query and Referer
+	status := func(s *testServer, id, query, referer string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, s.URL+"/api/v1/download/"+id+"?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if referer != "" {
+			req.Header.Set("Referer", referer)
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	asset := uploadV1(t, s, "pic.png", []byte("\x89PNG\r\n\x1a\n"))
+	other := uploadV1(t, s, "other.png", []byte("\x89PNG\r\n\x1a\n other"))
+	var env struct {
+		Data struct {
+			Query string `json:"query"`
+		} `json:"data"`
+	}
+	testserver.DecodeJSON(t, s.Get("/api/v1/assets/"+asset.ID+"/embed?ttl=1h"), &env)
+	token := env.Data.Query
+	q, _ := url.ParseQuery(token)
+	q.Set("sig", strings.Repeat("A", len(q.Get("sig"))))
+	forged := q.Encode()
+
+	tests := []struct {
+		name, id, query, referer string
+		want                     int
+	}{
+		{"no referer", asset.ID, "", "", http.StatusOK},
+		{"own pages", asset.ID, "", "https://assets.example.com/gallery", http.StatusOK},
+		{"allowed host", asset.ID, "", "https://chat.example.org/room", http.StatusOK},
+		{"allowed subdomain", asset.ID, "", "https://www.forum.example/t/1", http.StatusOK},
+		{"wildcard parent", asset.ID, "", "https://forum.example/", http.StatusForbidden},
+		{"other site", asset.ID, "", "https://evil.example/", http.StatusForbidden},
+		{"other site with embed token", asset.ID, token, "https://evil.example/", http.StatusOK},
+		{"forged signature", asset.ID, forged, "https://evil.example/", http.StatusForbidden},
+		{"token of another asset", other.ID, token, "https://evil.example/", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		if got := status(s, test.id, test.query, test.referer); got != test.want {
+			t.Errorf("%s: status %d, want %d", test.name, got, test.want)
+		}
+	}
+	s.clock.Advance(time.Hour)
+	if got := status(s, asset.ID, token, "https://evil.example/"); got != http.StatusForbidden {
+		t.Errorf("expired embed token: status %d, want 403", got)
+	}
+
+	// Requests without a Referer can be refused too
+	s = newTestServer(t, func(cfg *Config) {
+		cfg.RetentionRules = kept
+		cfg.HotlinkAllowedReferers = []string{"chat.example.org"}
+		cfg.HotlinkRequireReferer = true
+	})
+	asset = uploadV1(t, s, "pic.png", []byte("\x89PNG\r\n\x1a\n"))
+	if got := status(s, asset.ID, "", ""); got != http.StatusForbidden {
+		t.Errorf("no referer with hotlink_require_referer: status %d, want 403", got)
+	}
+	if got := status(s, asset.ID, "", "https://chat.example.org/room"); got != http.StatusOK {
+		t.Errorf("allowed referer with hotlink_require_referer: status %d, want 200", got)
+	}
+}
+
+func TestBodyLimits(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.BodyLimits = map[string]int64{"/api/v1/": 1 << 20, "/api/v1/upload": 2048}
+	})
+	if s.srv.config.MaxHeaderBytes != defaultMaxHeaderBytes {
+		t.Fatalf("max_header_bytes %d, want the default", s.srv.config.MaxHeaderBytes)
+	}
+
+	// The longest prefix wins over the endpoint's own limit
+	resp := s.UploadMultipart("/api/v1/upload", "file", map[string][]byte{"big.txt": bytes.Repeat([]byte("a"), 4096)})
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("upload over the limit: status %d, want 413", resp.StatusCode)
+	}
+	uploadV1(t, s, "small.txt", []byte("small"))
+
+	for _, limits := range []map[string]int64{{"api/v1/keys": 1024}, {"/report": 0}} {
+		srv := &Server{config: Config{BodyLimits: limits}}
+		if err := srv.validateLimitsConfig(); err == nil {
+			t.Errorf("body_limits %v accepted", limits)
+		}
+	}
+}
+
+func TestConfigSections(t *testing.T) {
+	// Every option belongs to exactly one section
+	seen := make(map[string]string)
+	for section, options := range configSections {
+		for _, option := range options {
+			if other, dup := seen[option]; dup {
+				t.Errorf("option %s in sections %s and %s", option, other, section)
+			}
+			seen[option] = section
+		}
+	}
+	typ := reflect.TypeFor[Config]()
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if _, ok := seen[name]; !ok {
+			t.Errorf("option %s is in no section", name)
+		}
+		delete(seen, name)
+	}
+	for option := range seen {
+		t.Errorf("section %s lists unknown option %s", seen[option], option)
+	}
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := "domain: assets.example.com\nmax_file_sise: 10\n" +
+		"storage:\n  upload_dir: ./uploads\n  hls: true\n  uplod_dir: ./typo\n" +
+		"auth:\n  api_key_file: /dev/null\n"
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"option domain at the top level is deprecated, move it into the server section",
+		"unknown option max_file_sise",
+		"option hls in the storage section is deprecated, move it into the processing section",
+		"unknown option uplod_dir in the storage section",
+	}
+	if !slices.Equal(cfg.Warnings, want) {
+		t.Fatalf("warnings %q, want %q", cfg.Warnings, want)
+	}
+	if !cfg.HLS || cfg.Domain != "assets.example.com" {
+		t.Fatalf("options out of their section not applied: %+v", cfg)
+	}
+
+	// Every problem is reported at once
+	err = newServer(Config{TrashRetention: -1}).checkConfig()
+	for _, problem := range []string{"max_file_size", "api_key", "upload_dir", "domain", "trash_retention"} {
+		if err == nil || !strings.Contains(err.Error(), problem) {
+			t.Errorf("error %v does not mention %s", err, problem)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) { cfg.ShortLinks = true })
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 300, 200))); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := s.UploadMultipart("/api/v1/upload?dry_run=true", "file", map[string][]byte{"test.png": buf.Bytes()})
+	var env struct {
+		Data AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	asset := env.Data
+	if resp.StatusCode != http.StatusCreated || !asset.DryRun || asset.Verdict == nil || asset.Width != 300 {
+		t.Fatalf("dry run: status %d, %+v", resp.StatusCode, asset)
+	}
+	if asset.DeleteToken != "" || asset.ShortURL != "" {
+		t.Fatalf("dry run with delete token %q, short link %q", asset.DeleteToken, asset.ShortURL)
+	}
+	if _, ok := s.srv.assets.get(asset.ID); ok {
+		t.Fatal("dry run recorded")
+	}
+	if entries, _ := os.ReadDir(s.srv.config.UploadDir); slices.ContainsFunc(entries, func(e os.DirEntry) bool { return !e.IsDir() }) {
+		t.Fatalf("dry run left files in upload_dir: %v", entries)
+	}
+	if resp := s.Get(asset.URL); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("download of dry run: status %d", resp.StatusCode)
+	}
+
+	resp = s.UploadMultipart("/api/v1/upload?dry_run=maybe", "file", map[string][]byte{"test.png": buf.Bytes()})
+	if resp.Body.Close(); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid flag: status %d", resp.StatusCode)
+	}
+
+	// Dry runs are checked in the staging area and don't count against
+	// max_storage_size
+	s = newTestServer(t, func(cfg *Config) { cfg.MaxStorageSize = 10 })
+	resp = s.UploadMultipart("/api/v1/upload?dry_run=true", "file", map[string][]byte{"test.png": buf.Bytes()})
+	if resp.Body.Close(); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("dry run over max_storage_size: status %d", resp.StatusCode)
+	}
+	if left, _ := filepath.Glob(filepath.Join(s.srv.stagingDir(), ".dry-run-*")); len(left) > 0 {
+		t.Fatalf("dry run left files in the staging area: %v", left)
+	}
+
+	// With dry_run set every upload is one
+	s = newTestServer(t, func(cfg *Config) { cfg.DryRun = true })
+	if asset := uploadV1(t, s, "test.png", buf.Bytes()); !asset.DryRun {
+		t.Fatal("upload stored with dry_run set")
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.UploadDir, cfg.DataDir = "", ""
+		cfg.StorageBackend = "memory"
+		cfg.MaxStorageSize = 10
+	})
+	dir := s.srv.memoryDir
+	if !strings.HasPrefix(s.srv.config.UploadDir, dir) || !strings.HasPrefix(s.srv.config.DataDir, dir) {
+		t.Fatalf("memory storage in %s: upload_dir %s, data_dir %s", dir, s.srv.config.UploadDir, s.srv.config.DataDir)
+	}
+
+	asset := uploadV1(t, s, "a.bin", []byte("123456"))
+	resp := s.UploadMultipart("/api/v1/upload", "file", map[string][]byte{"b.bin": []byte("123456")})
+	if resp.Body.Close(); resp.StatusCode != http.StatusInsufficientStorage {
+		t.Fatalf("upload over max_storage_size: status %d", resp.StatusCode)
+	}
+
+	// Downloading the asset deletes it, which frees its space
+	if body := testserver.Body(t, s.Get(asset.URL)); string(body) != "123456" {
+		t.Fatalf("download: %q", body)
+	}
+	uploadV1(t, s, "b.bin", []byte("123456"))
+
+	if err := s.srv.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatalf("memory storage left after close: %v", err)
+	}
+
+	_, err := New(Config{MaxFileSize: 1, APIKey: testAPIKey, Domain: "assets.example.com",
+		StorageBackend: "memory", UploadDir: t.TempDir()})
+	if err == nil {
+		t.Fatal("memory storage_backend accepted with upload_dir")
+	}
+
+	// Checking the configuration only names the directory
+	checked := newServer(Config{MaxFileSize: 1, APIKey: testAPIKey, Domain: "assets.example.com", StorageBackend: "memory"})
+	if err := checked.checkConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(checked.memoryDir); !os.IsNotExist(err) {
+		t.Fatalf("memory storage created by checking the configuration: %v", err)
+	}
+}
+
+func TestInbox(t *testing.T) {
+	inbox := t.TempDir()
+	s := newTestServer(t, func(cfg *Config) { cfg.InboxDir = inbox })
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(inbox, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("scan.bin", "\x00\x01inbox")
+	write("scan.bin.meta.json", `{"source":"scanner"}`)
+	write("bad.bin", "rejected")
+	write("bad.bin.meta.json", `[1, 2]`)
+	write(".partial", "still being written")
+
+	// Files are only ingested once a second scan sees them unchanged
+	seen := s.srv.scanInbox(context.Background(), nil)
+	if len(s.srv.assets.list()) != 0 {
+		t.Fatal("file ingested on first sight")
+	}
+	s.srv.scanInbox(context.Background(), seen)
+
+	assets := s.srv.assets.list()
+	if len(assets) != 1 || assets[0].OriginalName != "scan.bin" || assets[0].Uploader != inboxActor ||
+		assets[0].Metadata["source"] != "scanner" {
+		t.Fatalf("ingested assets: %+v", assets)
+	}
+	if body := testserver.Body(t, s.Get("/api/v1/download/"+assets[0].ID)); string(body) != "\x00\x01inbox" {
+		t.Fatalf("download: %q", body)
+	}
+	var left []string
+	filepath.WalkDir(inbox, func(path string, d os.DirEntry, err error) error {
+		if !d.IsDir() {
+			rel, _ := filepath.Rel(inbox, path)
+			left = append(left, rel)
+		}
+		return nil
+	})
+	want := []string{".partial", "rejected/bad.bin", "rejected/bad.bin.meta.json"}
+	if !slices.Equal(left, want) {
+		t.Fatalf("inbox left with %v, want %v", left, want)
+	}
+}
+
+func TestColdProxy(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.ColdBackend = "dir"
+		cfg.ColdDir = t.TempDir()
+		cfg.ColdProxy = true
+	})
+	data := []byte("\x00\x01 cold storage")
+	uploaded := uploadV1(t, s, "cold.bin", data)
+	asset, _ := s.srv.assets.get(uploaded.ID)
+	if err := s.srv.moveToCold(asset); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/api/v1/download/"+uploaded.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=3-6")
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := testserver.Body(t, resp); resp.StatusCode != http.StatusPartialContent || string(body) != "cold" ||
+		resp.Header.Get("Content-Range") != "bytes 3-6/15" {
+		t.Fatalf("range of cold file: status %d, %q, %s", resp.StatusCode, body, resp.Header.Get("Content-Range"))
+	}
+	if asset, _ := s.srv.assets.get(uploaded.ID); asset.Tier != tierCold {
+		t.Fatal("cold file brought back to upload_dir")
+	}
+	if _, err := os.Stat(s.srv.assetPath(uploaded.ID)); !os.IsNotExist(err) {
+		t.Fatalf("cold file in upload_dir: %v", err)
+	}
+
+	if body := testserver.Body(t, s.Get(uploaded.URL)); !bytes.Equal(body, data) {
+		t.Fatalf("download of cold file: %q", body)
+	}
+}
+
+func TestReplicaRestore(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.Replicas = []ReplicaConfig{{Name: "a", Backend: "dir", Dir: dirs[0]}, {Name: "b", Backend: "dir", Dir: dirs[1]}}
+		cfg.RetentionRules = []RetentionRule{{Name: "kept", MaxDownloads: unlimitedDownloads, TTL: Duration(time.Hour)}}
+	})
+	data := []byte("\x00\x01 replicated")
+	uploaded := uploadV1(t, s, "replica.bin", data)
+	for _, dir := range dirs {
+		if stored, err := os.ReadFile(filepath.Join(dir, uploaded.ID)); err != nil || !bytes.Equal(stored, data) {
+			t.Fatalf("replica in %s: %q, %v", dir, stored, err)
+		}
+	}
+
+	// Replica a lacks the file, then has a bad copy; b restores it each
+	// time and a is not taken for broken
+	for _, damage := range []func(string) error{
+		os.Remove,
+		func(path string) error { return os.WriteFile(path, []byte("garbage"), 0600) },
+	} {
+		if err := damage(filepath.Join(dirs[0], uploaded.ID)); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Remove(s.srv.assetPath(uploaded.ID)); err != nil {
+			t.Fatal(err)
+		}
+		if body := testserver.Body(t, s.Get(uploaded.URL)); !bytes.Equal(body, data) {
+			t.Fatalf("download of lost file: %q", body)
+		}
+		if !s.srv.replicas[0].healthy() {
+			t.Fatal("replica without a good copy passed over")
+		}
+	}
+
+	// A replica that can't be read from is
+	if err := os.RemoveAll(dirs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dirs[0], nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(s.srv.assetPath(uploaded.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if body := testserver.Body(t, s.Get(uploaded.URL)); !bytes.Equal(body, data) {
+		t.Fatalf("download of lost file: %q", body)
+	}
+	if s.srv.replicas[0].healthy() {
+		t.Fatal("unreadable replica still tried first")
+	}
+}
+
+func TestCDNOrigin(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.CDNURL = "https://cdn.example.net/"
+		cfg.CDNSigningKey = "cdn-signing-key"
+	})
+	noFollow := *s.Client()
+	noFollow.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	// redirect downloads an asset and returns where the CDN is sent
+	redirect := func(id string) *url.URL {
+		t.Helper()
+		resp, err := noFollow.Get(s.URL + "/api/v1/download/" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound || resp.Header.Get("Cache-Control") != "no-store" {
+			t.Fatalf("download behind a CDN: status %d, Cache-Control %q", resp.StatusCode, resp.Header.Get("Cache-Control"))
+		}
+		u, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil || u.Host != "cdn.example.net" || u.Path != "/api/v1/origin/"+id {
+			t.Fatalf("redirect to %q", resp.Header.Get("Location"))
+		}
+		return u
+	}
+
+	data := []byte("fetched once by the CDN")
+	asset := uploadV1(t, s, "once.txt", data)
+	origin := redirect(asset.ID)
+	if resp := s.Get(asset.URL); resp.StatusCode == http.StatusFound {
+		t.Fatal("second download of a one-time asset redirected")
+	}
+	q := origin.Query()
+	q.Set("sig", strings.Repeat("A", len(q.Get("sig"))))
+	forged := *origin
+	forged.RawQuery = q.Encode()
+	if resp := s.Get(forged.String()); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("origin with a forged signature: status %d, want 403", resp.StatusCode)
+	}
+	resp := s.Get(origin.String())
+	if body := testserver.Body(t, resp); resp.StatusCode != http.StatusOK || !bytes.Equal(body, data) ||
+		!strings.HasPrefix(resp.Header.Get("Cache-Control"), "public, max-age=") {
+		t.Fatalf("origin with a valid signature: status %d, %q, Cache-Control %q", resp.StatusCode, body, resp.Header.Get("Cache-Control"))
+	}
+	waitDeleted(t, s, asset.ID)
+	if _, err := os.Stat(s.srv.assetPath(asset.ID)); !os.IsNotExist(err) {
+		t.Fatalf("file of used up asset: %v", err)
+	}
+
+	// Links stop working after their expiry
+	asset = uploadV1(t, s, "late.txt", data)
+	origin = redirect(asset.ID)
+	s.clock.Advance(3 * time.Hour)
+	if resp := s.Get(origin.String()); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expired origin link: status %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestOrigins(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.Origins = []Origin{
+			{Name: "eu", Domain: "eu.assets.example.com", Countries: []string{"de", "fr"}},
+			{Name: "us", Domain: "us.assets.example.com", Countries: []string{"us"}},
+		}
+		cfg.OriginCountryHeader = "CF-IPCountry"
+	})
+	asset := uploadV1(t, s, "a.bin", []byte("\x00\x01"))
+	want := []MirrorV1{
+		{"eu", "https://eu.assets.example.com/api/v1/download/" + asset.ID},
+		{"us", "https://us.assets.example.com/api/v1/download/" + asset.ID},
+	}
+	if asset.URL != "https://assets.example.com/api/v1/download/"+asset.ID || !slices.Equal(asset.Mirrors, want) {
+		t.Fatalf("url %s, mirrors %v", asset.URL, asset.Mirrors)
+	}
+
+	for _, tc := range []struct {
+		header, value, domain string
+	}{
+		{"CF-IPCountry", "DE", "eu.assets.example.com"},
+		{"CF-IPCountry", "us", "us.assets.example.com"},
+		{"CF-IPCountry", "JP", "assets.example.com"},
+		{"X-Asset-Origin", "us", "us.assets.example.com"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, s.URL+"/api/v1/assets/"+asset.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", testAPIKey)
+		req.Header.Set(tc.header, tc.value)
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var env struct {
+			Data AssetV1 `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		if want := "https://" + tc.domain + "/api/v1/download/" + asset.ID; env.Data.URL != want {
+			t.Errorf("%s: %s: url %s, want %s", tc.header, tc.value, env.Data.URL, want)
+		}
+	}
+}
+
+func TestAnnounce(t *testing.T) {
+	// A stand in for the clientrpc websocket of brclient
+	requests := make(chan rpcRequest, 1)
+	rpc := httptest.NewTLSServer(websocket.Handler(func(ws *websocket.Conn) {
+		var req rpcRequest
+		if err := websocket.JSON.Receive(ws, &req); err != nil {
+			return
+		}
+		requests <- req
+		websocket.JSON.Send(ws, map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": map[string]any{}})
+	}))
+	defer rpc.Close()
+	certFile := filepath.Join(t.TempDir(), "rpc.cert")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: rpc.Certificate().Raw})
+	if err := os.WriteFile(certFile, cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.BRAnnounceGC = "mirrors"
+		cfg.BRClientRPCURL = "wss" + strings.TrimPrefix(rpc.URL, "https")
+		cfg.BRServerCert = certFile
+		cfg.RetentionRules = []RetentionRule{
+			{Name: "public", Tags: []string{"public"}, MaxDownloads: unlimitedDownloads, TTL: Duration(time.Hour)},
+		}
+	})
+
+	// Single download assets would be used up by the first mirror
+	uploadV1(t, s, "once.bin", []byte("\x00\x01 once"))
+	resp := s.UploadMultipart("/api/v1/upload?tags=public", "file", map[string][]byte{"public.bin": []byte("\x00\x01 public")})
+	var env struct {
+		Data AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+
+	select {
+	case req := <-requests:
+		want := "assetserver-mirror/1 " + env.Data.SHA256 + " 9 application/octet-stream " + env.Data.URL
+		params, _ := req.Params.(map[string]any)
+		if req.Method != "ChatService.GCM" || params["gc"] != "mirrors" || params["msg"] != want {
+			t.Fatalf("announcement %+v, want %q", req, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no announcement")
+	}
+	select {
+	case req := <-requests:
+		t.Fatalf("second announcement %+v", req)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestProxyRegister(t *testing.T) {
+	// A stand in for Caddy's admin API
+	var calls []string
+	var route map[string]any
+	caddy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		if r.Method == http.MethodPost {
+			json.NewDecoder(r.Body).Decode(&route)
+		}
+		if r.Method == http.MethodDelete {
+			http.Error(w, `{"error":"unknown object ID"}`, http.StatusNotFound)
+		}
+	}))
+	defer caddy.Close()
+
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.ProxyRegister = "caddy"
+		cfg.CaddyAdminURL = caddy.URL
+		cfg.Port = ":8123"
+	})
+	if err := s.srv.registerProxy(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"DELETE /id/braibot-assetserver", "POST /config/apps/http/servers/srv0/routes"}
+	if !slices.Equal(calls, want) {
+		t.Fatalf("caddy calls %v, want %v", calls, want)
+	}
+	handle := route["handle"].([]any)[0].(map[string]any)
+	upstream := handle["upstreams"].([]any)[0].(map[string]any)
+	if route["@id"] != "braibot-assetserver" || upstream["dial"] != "localhost:8123" {
+		t.Fatalf("caddy route %v", route)
+	}
+
+	file := filepath.Join(t.TempDir(), "assetserver.yml")
+	s = newTestServer(t, func(cfg *Config) {
+		cfg.ProxyRegister = "traefik"
+		cfg.TraefikConfig = file
+		cfg.TraefikCertResolver = "letsencrypt"
+		cfg.ProxyUpstream = "assetserver:8080"
+	})
+	if err := s.srv.registerProxy(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"rule: Host(`assets.example.com`)", "certResolver: letsencrypt", "url: http://assetserver:8080"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("traefik config lacks %q:\n%s", want, data)
+		}
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	cfg := fmt.Sprintf(`{"server": {"domain": "assets.example.com"}, "auth": {"api_key": %q},
+		"limits": {"max_file_size": 1048576},
+		"storage": {"upload_dir": %q, "data_dir": %q}}`,
+		testAPIKey, filepath.Join(dir, "uploads"), filepath.Join(dir, "data"))
+	if err := os.WriteFile(path, []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A server started for the test, where downloads delete the asset
+	var buf bytes.Buffer
+	if !SelfTest(context.Background(), path, "", &buf) {
+		t.Fatalf("self-test failed:\n%s", buf.String())
+	}
+	for _, want := range []string{"ok    upload", "ok    fetch", "SHA-256 verified", "deleted by its download", "ok    gone", "self-test passed"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, buf.String())
+		}
+	}
+
+	// A running server, where the asset is deleted with its token
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.RetentionRules = []RetentionRule{{MaxDownloads: unlimitedDownloads, TTL: Duration(time.Hour)}}
+	})
+	buf.Reset()
+	if !SelfTest(context.Background(), path, s.URL, &buf) {
+		t.Fatalf("self-test of running server failed:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "deleted by its download") {
+		t.Errorf("unlimited asset deleted by its download:\n%s", buf.String())
+	}
+
+	s = newTestServer(t, func(cfg *Config) { cfg.AllowedTypes = []string{"application/pdf"} })
+	buf.Reset()
+	if SelfTest(context.Background(), path, s.URL, &buf) || !strings.Contains(buf.String(), "FAIL  upload") {
+		t.Fatalf("self-test passed with images refused:\n%s", buf.String())
+	}
+}
+
+func TestAdminStats(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminKey = "test-admin-key"
+		cfg.RetentionRules = []RetentionRule{{MaxDownloads: unlimitedDownloads, TTL: Duration(30 * 24 * time.Hour)}}
+	})
+	stats := func() StorageStats {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, s.URL+"/admin/stats", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Admin-Key", "test-admin-key")
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var st StorageStats
+		testserver.DecodeJSON(t, resp, &st)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status %d", resp.StatusCode)
+		}
+		return st
+	}
+
+	small := uploadV1(t, s, "small.bin", []byte("\x00\x01small"))
+	if st := stats(); st.Assets != 1 || st.Bytes != small.Size || st.Ages[0].Count != 1 {
+		t.Fatalf("stats %+v, want the small asset in the first hour", st)
+	}
+	if st := stats(); len(st.Filesystems) != 2 || st.Filesystems[0].Error == "" && st.Filesystems[0].Size == 0 {
+		t.Fatalf("filesystems %+v", st.Filesystems)
+	}
+
+	// A new record is counted at once, though the cache has not expired
+	s.clock.Advance(2 * time.Hour)
+	large := uploadV1(t, s, "large.bin", append([]byte("\x00\x01"), make([]byte, 1000)...))
+	st := stats()
+	if st.Assets != 2 || st.Bytes != small.Size+large.Size {
+		t.Fatalf("stats %+v, want both assets", st)
+	}
+	if len(st.Largest) != 2 || st.Largest[0].ID != large.ID || st.Largest[1].ID != small.ID {
+		t.Fatalf("largest %+v, want %s then %s", st.Largest, large.ID, small.ID)
+	}
+	if typ := st.Types[large.ContentType]; typ.Count != 2 || typ.Bytes != st.Bytes {
+		t.Fatalf("types %+v", st.Types)
+	}
+	if st.Ages[0].Count != 1 || st.Ages[1].Count != 1 {
+		t.Fatalf("ages %+v, want one asset in each of the first two buckets", st.Ages)
+	}
+
+	// Ages move on once the cache expires
+	s.clock.Advance(2 * 24 * time.Hour)
+	if st := stats(); st.Ages[2].Count != 2 {
+		t.Fatalf("ages %+v, want both assets within 7 days", st.Ages)
+	}
+}
+
+func TestLoggingSettings(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminKey = "test-admin-key"
+	})
+	admin := func(method, body string) (*http.Response, LoggingV1) {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+"/admin/logging", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Admin-Key", "test-admin-key")
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v LoggingV1
+		testserver.DecodeJSON(t, resp, &v)
+		return resp, v
+	}
+
+	if _, v := admin(http.MethodGet, ""); v.Level != "info" || v.MIMEDetection || len(v.DumpBodies) != 0 {
+		t.Fatalf("logging %+v, want the defaults", v)
+	}
+	for _, body := range []string{`{"level": "verbose"}`, `{"dump_bodies": ["00000000"]}`} {
+		if resp, _ := admin(http.MethodPatch, body); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: status %d, want 400", body, resp.StatusCode)
+		}
+	}
+
+	key := keyActor(testAPIKey)
+	resp, v := admin(http.MethodPatch, `{"level": "debug", "mime_detection": true, "dump_bodies": ["`+key+`"]}`)
+	if resp.StatusCode != http.StatusOK || v.Level != "debug" || !v.MIMEDetection || !slices.Equal(v.DumpBodies, []string{strings.TrimPrefix(key, "key:")}) {
+		t.Fatalf("status %d, logging %+v", resp.StatusCode, v)
+	}
+	if _, v := admin(http.MethodPatch, `{"mime_detection": false}`); v.Level != "debug" || v.MIMEDetection || len(v.DumpBodies) != 1 {
+		t.Fatalf("logging %+v, want only mime_detection changed", v)
+	}
+
+	// Dumping a body leaves it whole for the upload
+	data := append([]byte("\x00\x01"), make([]byte, 2*dumpBodyLimit)...)
+	asset := uploadV1(t, s, "dumped.bin", data)
+	if asset.Size != int64(len(data)) {
+		t.Fatalf("stored %d bytes, want %d", asset.Size, len(data))
+	}
+
+	if _, v := admin(http.MethodPatch, `{"dump_bodies": []}`); len(v.DumpBodies) != 0 {
+		t.Fatalf("logging %+v, want no bodies dumped", v)
+	}
+}
+
+func TestJSONEncoding(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.CompressMinSize = 1
+		cfg.RetentionRules = []RetentionRule{{MaxDownloads: unlimitedDownloads, TTL: Duration(time.Hour)}}
+	})
+	data := []byte("\x00\x01json encoding")
+	asset := uploadV1(t, s, "a.bin", data)
+	get := func(ref string, header ...string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, s.URL+ref, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", testAPIKey)
+		for i := 0; i < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, body
+	}
+
+	// Setting Accept-Encoding keeps the client from decompressing
+	resp, body := get("/api/v1/assets/"+asset.ID, "Accept-Encoding", "br;q=1.0, gzip;q=0.8")
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Content-Encoding %q, want gzip", resp.Header.Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var env struct {
+		Data AssetV1 `json:"data"`
+	}
+	if err := json.NewDecoder(zr).Decode(&env); err != nil || env.Data.ID != asset.ID {
+		t.Fatalf("decoded %+v, %v", env.Data, err)
+	}
+	if resp, _ := get("/api/v1/assets/"+asset.ID, "Accept-Encoding", "gzip;q=0"); resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("Content-Encoding %q with gzip refused", resp.Header.Get("Content-Encoding"))
+	}
+	if resp, _ := get("/api/v1/assets/"+asset.ID, "Accept-Encoding", "br"); resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("Content-Encoding %q for a client taking only brotli", resp.Header.Get("Content-Encoding"))
+	}
+
+	// Asset files are sent as stored
+	resp, body = get("/api/v1/download/"+asset.ID, "Accept-Encoding", "gzip")
+	if resp.Header.Get("Content-Encoding") != "" || !bytes.Equal(body, data) {
+		t.Fatalf("download with Content-Encoding %q: %q", resp.Header.Get("Content-Encoding"), body)
+	}
+
+	if _, body := get("/api/v1/assets/" + asset.ID); bytes.Contains(body, []byte("\n  ")) {
+		t.Fatalf("compact response is indented: %s", body)
+	}
+	if _, body := get("/api/v1/assets/" + asset.ID + "?pretty=1"); !bytes.Contains(body, []byte("{\n  \"api_version\": \"v1\",\n")) {
+		t.Fatalf("pretty response is not indented: %s", body)
+	}
+
+	_, body = get("/api/v1/assets/" + asset.ID)
+	full := len(body)
+	resp, body = get("/api/v1/assets/"+asset.ID, "Prefer", "return=minimal")
+	if resp.Header.Get("Preference-Applied") != "return=minimal" || len(body) >= full || bytes.Contains(body, []byte(`"tags"`)) {
+		t.Fatalf("minimal response %s, full response %d bytes", body, full)
+	}
+	if err := json.Unmarshal(body, &env); err != nil || env.Data.SHA256 != asset.SHA256 {
+		t.Fatalf("minimal asset %+v, %v", env.Data, err)
+	}
+	_, body = get("/test", "Prefer", "return=minimal")
+	var test Response
+	if err := json.Unmarshal(body, &test); err != nil || !test.Success || test.Message != "" || test.Capabilities != nil {
+		t.Fatalf("minimal /test response %s", body)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.SessionTTL = Duration(10 * time.Minute)
+	})
+	do := func(method, ref string, header map[string]string, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+ref, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	open := func(key string) string {
+		t.Helper()
+		resp := do(http.MethodPost, "/api/v1/auth", map[string]string{"X-API-Key": key}, "")
+		var env struct {
+			Data struct {
+				Token     string    `json:"token"`
+				ExpiresAt time.Time `json:"expires_at"`
+				ExpiresIn int       `json:"expires_in"`
+			} `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		if resp.StatusCode != http.StatusCreated || env.Data.Token == "" || env.Data.ExpiresIn != 600 {
+			t.Fatalf("status %d, session %+v", resp.StatusCode, env.Data)
+		}
+		return env.Data.Token
+	}
+	upload := func(token string) *http.Response {
+		t.Helper()
+		return do(http.MethodPost, "/api/v1/upload", map[string]string{
+			"Authorization": "Bearer " + token,
+			"Content-Type":  "application/json",
+		}, `{"filename": "a.bin", "data_base64": "AAFzZXNzaW9u"}`)
+	}
+
+	token := open(testAPIKey)
+	resp := upload(token)
+	var env struct {
+		Data AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload with session: status %d", resp.StatusCode)
+	}
+	if asset, _ := s.srv.assets.get(env.Data.ID); asset.Uploader != keyActor(testAPIKey) {
+		t.Fatalf("uploader %q, want the session's key %q", asset.Uploader, keyActor(testAPIKey))
+	}
+
+	// Using a session keeps it open
+	s.clock.Advance(8 * time.Minute)
+	if resp := upload(token); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload after 8 minutes: status %d", resp.StatusCode)
+	}
+	s.clock.Advance(11 * time.Minute)
+	if resp := upload(token); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("upload with expired session: status %d, want 401", resp.StatusCode)
+	}
+
+	// A session cannot open another
+	if resp := do(http.MethodPost, "/api/v1/auth", map[string]string{"Authorization": "Bearer " + open(testAPIKey)}, ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("session opened by a session: status %d, want 401", resp.StatusCode)
+	}
+
+	// Sessions end with their key
+	key, k, err := s.srv.createAPIKey("bot", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token = open(key)
+	if resp := upload(token); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload with session of managed key: status %d", resp.StatusCode)
+	}
+	s.srv.apiKeys.update(k.ID, func(k *APIKey) error {
+		now := s.clock.Now()
+		k.DisabledAt = &now
+		return nil
+	})
+	if resp := upload(token); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("upload with session of disabled key: status %d, want 401", resp.StatusCode)
+	}
+
+	token = open(testAPIKey)
+	if resp := do(http.MethodDelete, "/api/v1/auth", map[string]string{"Authorization": "Bearer " + token}, ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("closing session: status %d", resp.StatusCode)
+	}
+	if resp := upload(token); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("upload with closed session: status %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestScopedTokens(t *testing.T) {
+	s := newTestServer(t, nil)
+	do := func(method, ref, token, contentType, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+ref, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		} else {
+			req.Header.Set("X-API-Key", testAPIKey)
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	mint := func(query string) ScopedTokenV1 {
+		t.Helper()
+		resp := do(http.MethodPost, "/api/v1/tokens?"+query, "", "", "")
+		var env struct {
+			Data ScopedTokenV1 `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		if resp.StatusCode != http.StatusCreated || !strings.HasPrefix(env.Data.Token, scopedTokenPrefix) {
+			t.Fatalf("minting %s: status %d, token %+v", query, resp.StatusCode, env.Data)
+		}
+		return env.Data
+	}
+	upload := func(token string) *http.Response {
+		t.Helper()
+		return do(http.MethodPost, "/api/v1/upload", token, "application/json",
+			`{"filename": "a.bin", "data_base64": "AAFzY29wZWQ=", "tags": ["mine"]}`)
+	}
+	album := func(token string) []AssetV1 {
+		t.Helper()
+		resp := do(http.MethodGet, "/api/v1/albums/trip", token, "", "")
+		var env struct {
+			Data []AssetV1 `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		if resp.StatusCode != http.StatusOK {
+			return nil
+		}
+		return env.Data
+	}
+
+	for _, query := range []string{"access=read", "album=trip&asset=x&access=read", "album=trip&access=write", "album=Trip!&access=read"} {
+		if resp := do(http.MethodPost, "/api/v1/tokens?"+query, "", "", ""); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("minting %s: status %d, want 400", query, resp.StatusCode)
+		}
+	}
+
+	// An append token adds to its album, for the key that minted it, and
+	// nothing else
+	appender := mint("album=Trip&access=append")
+	resp := upload(appender.Token)
+	var env struct {
+		Data AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusCreated || !slices.Equal(env.Data.Tags, []string{"album:trip", "mine"}) {
+		t.Fatalf("upload with append token: status %d, tags %v", resp.StatusCode, env.Data.Tags)
+	}
+	inAlbum := env.Data
+	if asset, _ := s.srv.assets.get(inAlbum.ID); asset.Uploader != keyActor(testAPIKey) {
+		t.Fatalf("uploader %q, want the minting key", asset.Uploader)
+	}
+	if album(appender.Token) != nil {
+		t.Fatal("append token listed its album")
+	}
+	if resp := do(http.MethodPost, "/api/v1/tokens?album=trip&access=read", appender.Token, "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("token minted by a token: status %d, want 401", resp.StatusCode)
+	}
+
+	// A read token sees its album and nothing else
+	other := uploadV1(t, s, "b.bin", []byte("\x00\x01other"))
+	reader := mint("album=trip&access=read")
+	if list := album(reader.Token); len(list) != 1 || list[0].ID != inAlbum.ID {
+		t.Fatalf("album %+v, want %s", list, inAlbum.ID)
+	}
+	if resp := do(http.MethodGet, "/api/v1/assets/"+inAlbum.ID, reader.Token, "", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("album asset with read token: status %d", resp.StatusCode)
+	}
+	if resp := do(http.MethodGet, "/api/v1/assets/"+other.ID, reader.Token, "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("other asset with read token: status %d, want 401", resp.StatusCode)
+	}
+	if resp := upload(reader.Token); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("upload with read token: status %d, want 401", resp.StatusCode)
+	}
+
+	// Others may tag their assets into the album, but only its owner
+	// shares it, and its tokens only see the owner's assets
+	otherKey, _, err := s.srv.createAPIKey("other", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/upload", strings.NewReader(
+		`{"filename": "c.bin", "data_base64": "AAFzdHJhbmdlcg==", "tags": ["album:trip"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-API-Key", otherKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("upload by another key: status %d", resp.StatusCode)
+	}
+	stranger := env.Data
+	if list := album(reader.Token); len(list) != 1 || list[0].ID != inAlbum.ID {
+		t.Fatalf("album %+v, want only %s", list, inAlbum.ID)
+	}
+	if resp := do(http.MethodGet, "/api/v1/assets/"+stranger.ID, reader.Token, "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("asset of another key with read token: status %d, want 401", resp.StatusCode)
+	}
+	for _, album := range []string{"trip", "fresh"} {
+		req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/tokens?access=read&album="+album, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", otherKey)
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if want := map[string]int{"trip": http.StatusForbidden, "fresh": http.StatusCreated}[album]; resp.StatusCode != want {
+			t.Fatalf("minting for album %s with another key: status %d, want %d", album, resp.StatusCode, want)
+		}
+	}
+	if resp := do(http.MethodPost, "/api/v1/tokens?album=fresh&access=read", "", "", ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("minting for an album shared by another key: status %d, want 403", resp.StatusCode)
+	}
+
+	// An append token for an asset attaches sidecars without replacing any
+	sidecars := mint("asset=" + other.ID + "&access=append")
+	put := func() *http.Response {
+		return do(http.MethodPut, "/api/v1/assets/"+other.ID+"/sidecars/en.vtt", sidecars.Token, "text/vtt", "WEBVTT\n")
+	}
+	if resp := put(); resp.StatusCode != http.StatusOK {
+		t.Fatalf("sidecar with append token: status %d", resp.StatusCode)
+	}
+	if resp := put(); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("replacing sidecar with append token: status %d, want 409", resp.StatusCode)
+	}
+	if resp := do(http.MethodDelete, "/api/v1/assets/"+other.ID+"/sidecars/en.vtt", sidecars.Token, "", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("deleting sidecar with append token: status %d, want 401", resp.StatusCode)
+	}
+
+	// Revoked and expired tokens stop working
+	if resp := do(http.MethodDelete, "/api/v1/tokens/"+reader.ID, "", "", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("revoking: status %d", resp.StatusCode)
+	}
+	if album(reader.Token) != nil {
+		t.Fatal("revoked token listed its album")
+	}
+	s.clock.Advance(31 * 24 * time.Hour)
+	if resp := upload(appender.Token); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("upload with expired token: status %d, want 401", resp.StatusCode)
+	}
+
+	var list struct {
+		Data []ScopedTokenV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, do(http.MethodGet, "/api/v1/tokens", "", "", ""), &list)
+	if len(list.Data) != 3 || list.Data[0].Token != "" {
+		t.Fatalf("tokens %+v, want the 3 minted by the key without the tokens themselves", list.Data)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminKey = "test-admin-key"
+		cfg.BRUserMaxFiles = 2
+	})
+	alice := strings.Repeat("a1", 32)
+	upload := func(user, nick string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/upload",
+			strings.NewReader(`{"filename": "a.bin", "data_base64": "AAF1c2Vy"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", testAPIKey)
+		req.Header.Set("X-BR-User", user)
+		req.Header.Set("X-BR-Nick", nick)
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	user := func() UserV1 {
+		t.Helper()
+		var env struct {
+			Data UserV1 `json:"data"`
+		}
+		testserver.DecodeJSON(t, s.Do(http.MethodGet, "/api/v1/users/"+alice, "", nil), &env)
+		return env.Data
+	}
+
+	for _, bad := range [][2]string{{"a1b2", "alice"}, {alice, "ali\tce"}, {"", "alice"}} {
+		if resp := upload(bad[0], bad[1]); resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("upload for %q %q: status %d, want 400", bad[0], bad[1], resp.StatusCode)
+		}
+	}
+	if resp := s.Do(http.MethodGet, "/api/v1/users/"+alice, "", nil); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown user: status %d, want 404", resp.StatusCode)
+	}
+
+	// Uploads are counted for the user, under the nick last seen
+	first := upload(strings.ToUpper(alice), "alice")
+	var env struct {
+		Data AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, first, &env)
+	if first.StatusCode != http.StatusCreated {
+		t.Fatalf("upload for a user: status %d", first.StatusCode)
+	}
+	if asset, _ := s.srv.assets.get(env.Data.ID); asset.User != alice {
+		t.Fatalf("asset user %q, want %q", asset.User, alice)
+	}
+	s.clock.Advance(time.Minute)
+	if resp := upload(alice, "alice2"); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("second upload: status %d", resp.StatusCode)
+	}
+	uploadV1(t, s, "other.bin", []byte("\x00\x01other"))
+	if u := user(); u.Nick != "alice2" || u.Files != 2 || u.Bytes != 12 || u.MaxFiles != 2 {
+		t.Fatalf("user %+v", u)
+	}
+	if resp := upload(alice, "alice"); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("upload over the limit: status %d, want 403", resp.StatusCode)
+	}
+
+	var list struct {
+		Data []AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, s.Do(http.MethodGet, "/api/v1/users/"+alice+"/assets?limit=1", "", nil), &list)
+	if len(list.Data) != 1 || list.Data[0].ID == env.Data.ID {
+		t.Fatalf("assets %+v, want the newest", list.Data)
+	}
+	if resp := s.Do(http.MethodDelete, "/api/v1/assets/"+env.Data.ID+"?token="+env.Data.DeleteToken, "", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("delete: status %d", resp.StatusCode)
+	}
+	testserver.DecodeJSON(t, s.Do(http.MethodGet, "/api/v1/users/"+alice+"/assets", "", nil), &list)
+	if len(list.Data) != 1 || user().Files != 1 {
+		t.Fatalf("assets %+v, want the deleted one gone", list.Data)
+	}
+
+	// Operators can give a user their own limits
+	admin := func(method, ref, body string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+ref, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Admin-Key", "test-admin-key")
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	var u UserV1
+	testserver.DecodeJSON(t, admin(http.MethodPatch, "/admin/users/"+alice, `{"quota": 6, "max_files": -1}`), &u)
+	if u.Quota != 6 || u.MaxFiles != 0 {
+		t.Fatalf("user %+v, want quota 6 and no file limit", u)
+	}
+	if resp := upload(alice, "alice"); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("upload over the quota: status %d, want 403", resp.StatusCode)
+	}
+	if resp := admin(http.MethodPatch, "/admin/users/"+strings.Repeat("b2", 32), `{"quota": 1}`); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("unknown user: status %d, want 404", resp.StatusCode)
+	}
+	var users []UserV1
+	testserver.DecodeJSON(t, admin(http.MethodGet, "/admin/users", ""), &users)
+	if len(users) != 1 || users[0].ID != alice {
+		t.Fatalf("users %+v", users)
+	}
+}
+
+func TestMultipartTempFiles(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.MultipartMemory = 64
+		cfg.MaxFileSize = 1 << 16
+	})
+	leftovers := func() []string {
+		t.Helper()
+		files, err := filepath.Glob(filepath.Join(s.srv.stagingDir(), ".multipart-*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files
+	}
+
+	// A part over multipart_memory goes through a temporary file, which is
+	// gone once the upload is stored
+	data := append([]byte("\x00\x01"), bytes.Repeat([]byte("spill"), 1000)...)
+	asset := uploadV1(t, s, "large.bin", data)
+	if got, err := os.ReadFile(s.srv.assetPath(asset.ID)); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("stored %d bytes, want %d: %v", len(got), len(data), err)
+	}
+	if files := leftovers(); len(files) != 0 {
+		t.Fatalf("temporary files left: %v", files)
+	}
+	if stats := s.srv.multipartTemp.stats(); stats.Spilled != 1 || stats.SpilledBytes != int64(len(data)) ||
+		stats.Files != 0 || stats.Bytes != 0 || stats.PeakBytes != int64(len(data)) {
+		t.Fatalf("stats %+v", stats)
+	}
+
+	// So is one of a body cut off by the client
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "cut.bin")
+	fw.Write(data)
+	mw.Close()
+	req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/upload", bytes.NewReader(body.Bytes()[:body.Len()-100]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-API-Key", testAPIKey)
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusCreated {
+		t.Fatal("truncated upload stored")
+	}
+	if files := leftovers(); len(files) != 0 {
+		t.Fatalf("temporary files left: %v", files)
+	}
+	if stats := s.srv.multipartTemp.stats(); stats.Spilled != 2 || stats.Files != 0 || stats.Bytes != 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+}
+
+func TestUploadErrorDetails(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.MaxFileSize = 16
+		cfg.MaxBatchFiles = 2
+		cfg.AllowedTypes = []string{"image/png", "application/octet-stream"}
+	})
+	reject := func(resp *http.Response, status int, code string) *ErrorDetails {
+		t.Helper()
+		var env Envelope
+		testserver.DecodeJSON(t, resp, &env)
+		if resp.StatusCode != status || env.Error == nil || env.Error.Code != code {
+			t.Fatalf("got %d %+v, want %d %s", resp.StatusCode, env.Error, status, code)
+		}
+		if env.Error.Details == nil {
+			t.Fatalf("%s has no details", code)
+		}
+		return env.Error.Details
+	}
+
+	d := reject(s.UploadMultipart("/api/v1/upload", "file", map[string][]byte{"a.pdf": []byte("%PDF-1.4\n")}),
+		http.StatusUnsupportedMediaType, "type_not_allowed")
+	if d.DetectedType != "application/pdf" || !reflect.DeepEqual(d.AllowedTypes, []string{"image/png", "application/octet-stream"}) {
+		t.Errorf("type details: %+v", d)
+	}
+
+	d = reject(s.UploadMultipart("/api/v1/upload", "file", map[string][]byte{"a.bin": []byte("\x00\x01" + strings.Repeat("x", 30))}),
+		http.StatusRequestEntityTooLarge, "file_too_large")
+	if d.Limit != 16 || d.Size <= 16 {
+		t.Errorf("size details: %+v", d)
+	}
+
+	d = reject(s.UploadMultipart("/api/v1/upload", "files[]", map[string][]byte{
+		"a.bin": []byte("\x00\x01a"), "b.bin": []byte("\x00\x01b"), "c.bin": []byte("\x00\x01c"),
+	}), http.StatusRequestEntityTooLarge, "too_many_files")
+	if d.Files != 3 || d.Limit != 2 {
+		t.Errorf("batch details: %+v", d)
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AllowedTypes = []string{"image/png", "audio/*"}
+		cfg.MaxBatchFiles = 4
+		cfg.QRCodes = true
+		cfg.RetentionRules = []RetentionRule{
+			{Name: "voice", Types: []string{"audio/*"}, MaxDownloads: 3, TTL: Duration(24 * time.Hour)},
+			{Name: "other-key", Keys: []string{"key:00000000"}, MaxDownloads: 5},
+		}
+	})
+	var resp Response
+	testserver.DecodeJSON(t, s.Get("/test"), &resp)
+	c := resp.Capabilities
+	if !resp.Success || c == nil {
+		t.Fatalf("/test: %+v", resp)
+	}
+	if c.Version == "" || c.APIVersion != apiVersion || c.MaxFileSize != 1<<20 || c.MaxBatchFiles != 4 {
+		t.Errorf("capabilities %+v", c)
+	}
+	if !reflect.DeepEqual(c.MaxSizes, map[string]int64{"image/png": 1 << 20, "audio/*": 1 << 20}) {
+		t.Errorf("max sizes %v", c.MaxSizes)
+	}
+	if !reflect.DeepEqual(c.UploadModes, []string{"multipart", "form", "json"}) {
+		t.Errorf("upload modes %v", c.UploadModes)
+	}
+	if !reflect.DeepEqual(c.ResponseEncodings, []string{"gzip"}) {
+		t.Errorf("response encodings %v", c.ResponseEncodings)
+	}
+	if !c.Features["qr_codes"] || c.Features["short_links"] {
+		t.Errorf("features %v", c.Features)
+	}
+
+	// Rules for other keys are left out
+	want := RetentionV1{
+		Default: RetentionRuleV1{Name: "default", MaxDownloads: 1},
+		Rules:   []RetentionRuleV1{{Name: "voice", Types: []string{"audio/*"}, MaxDownloads: 3, TTL: 86400}},
+	}
+	if !reflect.DeepEqual(c.Retention, want) {
+		t.Errorf("retention %+v, want %+v", c.Retention, want)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	s := newTestServer(t, nil)
+	resp, err := s.Client().Get(s.URL + "/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b BuildInfo
+	testserver.DecodeJSON(t, resp, &b)
+	if resp.StatusCode != http.StatusOK || b.Version == "" || b.APIVersion != apiVersion || b.APIRevision != APIRevision {
+		t.Fatalf("/version: %d %+v", resp.StatusCode, b)
+	}
+
+	// Every response carries the API revision, errors included
+	for _, ref := range []string{"/version", "/test", "/api/v1/assets/missing", "/nowhere"} {
+		resp := s.Get(ref)
+		resp.Body.Close()
+		if got := resp.Header.Get("API-Version"); got != APIRevision {
+			t.Errorf("%s: API-Version %q", ref, got)
+		}
+	}
+}
+
+func TestQuotaWarnings(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.MaxStorageSize = 30
+		cfg.BRUserQuota = 20
+	})
+	alice := strings.Repeat("a1", 32)
+	upload := func(user string) []Warning {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/upload",
+			strings.NewReader(`{"filename": "a.bin", "data_base64": "AAF1c2Vy"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", testAPIKey)
+		req.Header.Set("X-BR-User", user)
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var env Envelope
+		testserver.DecodeJSON(t, resp, &env)
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("upload: %d %+v", resp.StatusCode, env.Error)
+		}
+		return env.Warnings
+	}
+
+	// 6 and 12 of alice's 20 bytes are fine, 18 are not
+	for i := 0; i < 2; i++ {
+		if w := upload(alice); len(w) != 0 {
+			t.Fatalf("upload %d warned %+v", i+1, w)
+		}
+	}
+	if w := upload(alice); len(w) != 1 || w[0].Code != "user_quota" || w[0].Used != 18 || w[0].Limit != 20 || w[0].Message == "" {
+		t.Fatalf("third upload warned %+v", w)
+	}
+
+	// 24 of 30 bytes of storage are in use
+	w := upload("")
+	if len(w) != 1 || w[0].Code != "storage" || w[0].Used != 24 || w[0].Limit != 30 {
+		t.Fatalf("storage warnings %+v", w)
+	}
+
+	s = newTestServer(t, func(cfg *Config) {
+		cfg.MaxStorageSize = 8
+		cfg.QuotaWarning = -1
+	})
+	if w := upload(""); len(w) != 0 {
+		t.Fatalf("warnings turned off, got %+v", w)
+	}
+}
+
+func TestAlbumUpload(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AllowedTypes = []string{"application/octet-stream"}
+	})
+	create := func(name, cover string, files ...string) *http.Response {
+		t.Helper()
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		mw.WriteField("name", name)
+		if cover != "" {
+			mw.WriteField("cover", cover)
+		}
+		for _, f := range files {
+			fw, err := mw.CreateFormFile("files[]", f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasSuffix(f, ".pdf") {
+				fw.Write([]byte("%PDF-1.4\n"))
+			} else {
+				fw.Write([]byte("\x00\x01" + f))
+			}
+		}
+		mw.Close()
+		return s.Do(http.MethodPost, "/api/v1/albums", mw.FormDataContentType(), &body)
+	}
+
+	resp := create("Job-42", "c.bin", "c.bin", "a.bin", "b.bin")
+	var env struct {
+		Data AlbumV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	album := env.Data
+	if resp.StatusCode != http.StatusCreated || album.Name != "job-42" || len(album.Assets) != 3 {
+		t.Fatalf("create: %d %+v", resp.StatusCode, album)
+	}
+	var ids []string
+	for _, a := range album.Assets {
+		ids = append(ids, a.ID)
+		if a.DeleteToken == "" {
+			t.Fatalf("album asset without deletion token: %+v", a)
+		}
+	}
+	if album.Cover != ids[0] {
+		t.Fatalf("cover %s, want %s", album.Cover, ids[0])
+	}
+
+	// Listing keeps the order the files were sent in
+	var list struct {
+		Data []AssetV1 `json:"data"`
+	}
+	testserver.DecodeJSON(t, s.Get("/api/v1/albums/job-42"), &list)
+	var listed []string
+	for _, a := range list.Data {
+		listed = append(listed, a.ID)
+	}
+	if !slices.Equal(listed, ids) {
+		t.Fatalf("album lists %v, want %v", listed, ids)
+	}
+
+	if resp := create("job-42", "", "d.bin"); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("duplicate album: status %d, want 409", resp.StatusCode)
+	}
+	if resp := create("job-43", "3", "d.bin", "e.bin"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("cover out of range: status %d, want 400", resp.StatusCode)
+	}
+
+	// An album shared before it had files may still be created by its
+	// owner
+	if resp := s.Do(http.MethodPost, "/api/v1/tokens?album=job-45&access=append", "", nil); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("sharing an album: status %d", resp.StatusCode)
+	}
+	if resp := create("job-45", "", "h.bin"); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("creating a shared album: status %d, want 201", resp.StatusCode)
+	}
+	if a, _ := s.srv.albums.get("job-45"); len(a.Assets) != 1 || a.Owner != keyActor(testAPIKey) {
+		t.Fatalf("shared album recorded as %+v", a)
+	}
+
+	// A refused file takes the album with it
+	if resp := create("job-44", "", "f.bin", "g.pdf"); resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("album with a refused file: status %d, want 415", resp.StatusCode)
+	}
+	stored := 0
+	for _, asset := range s.srv.assets.list() {
+		if !slices.Contains(asset.Tags, "album:job-44") {
+			continue
+		}
+		if stored++; asset.State != stateDeleted {
+			t.Errorf("asset %s of a failed album in state %s", asset.ID, asset.State)
+		}
+	}
+	if stored != 1 {
+		t.Errorf("%d files of the failed album stored, want 1", stored)
+	}
+	if _, ok := s.srv.albums.get("job-44"); ok {
+		t.Fatal("failed album recorded")
+	}
+}
+
+func TestReplaceAsset(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.RetentionRules = []RetentionRule{{MaxDownloads: -1, TTL: Duration(time.Hour)}}
+	})
+	asset := uploadV1(t, s, "draft.txt", []byte("\x00\x01first draft"))
+	replace := func(body string) (*http.Response, AssetV1) {
+		t.Helper()
+		resp := s.Do(http.MethodPut, "/api/v1/assets/"+asset.ID+"?filename=final.txt", "application/octet-stream", strings.NewReader(body))
+		var env struct {
+			Data AssetV1 `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		return resp, env.Data
+	}
+
+	resp, replaced := replace("\x00\x01final version")
+	if resp.StatusCode != http.StatusOK || replaced.ID != asset.ID || replaced.URL != asset.URL ||
+		replaced.Version != 2 || len(replaced.Versions) != 1 || replaced.Versions[0].SHA256 != asset.SHA256 {
+		t.Fatalf("replace: %d %+v", resp.StatusCode, replaced)
+	}
+	if n := len(s.srv.assets.list()); n != 1 {
+		t.Fatalf("%d asset records after replacing, want 1", n)
+	}
+	for ref, want := range map[string]string{
+		asset.URL:                "\x00\x01final version",
+		asset.URL + "?version=2": "\x00\x01final version",
+		replaced.Versions[0].URL: "\x00\x01first draft",
+	} {
+		resp := s.Get(ref)
+		if body := testserver.Body(t, resp); resp.StatusCode != http.StatusOK || string(body) != want {
+			t.Errorf("%s: %d %q, want %q", ref, resp.StatusCode, body, want)
+		}
+	}
+	if resp := s.Get(asset.URL + "?version=3"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown version: %d, want 404", resp.StatusCode)
+	}
+
+	// Earlier versions go with the asset
+	stored, _ := s.srv.assets.get(asset.ID)
+	if _, err := s.srv.setAssetState(asset.ID, stateDeleted, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(s.srv.versionPath(asset.ID, 1)); !os.IsNotExist(err) || len(stored.Versions) != 1 {
+		t.Fatalf("version file after delete: %v", err)
+	}
+	if resp, _ := replace("\x00\x01too late"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("replace deleted: %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestCopyAsset(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.RetentionRules = []RetentionRule{
+			{Name: "keep", Tags: []string{"keep"}, MaxDownloads: -1},
+			{Name: "day", MaxDownloads: 5, TTL: Duration(24 * time.Hour)},
+		}
+	})
+	asset := uploadV1(t, s, "render.txt", []byte("\x00\x01generated"))
+	copyOf := func(query string) (*http.Response, AssetV1) {
+		t.Helper()
+		resp := s.Do(http.MethodPost, "/api/v1/assets/"+asset.ID+"/copy"+query, "", nil)
+		var env struct {
+			Data AssetV1 `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		return resp, env.Data
+	}
+
+	resp, kept := copyOf("?tags=keep")
+	if resp.StatusCode != http.StatusCreated || kept.ID == asset.ID || kept.SHA256 != asset.SHA256 ||
+		kept.MaxDownloads != nil || kept.ExpiresAt != nil || kept.DeleteToken == "" {
+		t.Fatalf("copy: %d %+v", resp.StatusCode, kept)
+	}
+	resp, short := copyOf("?ttl=1h&max_downloads=1")
+	if resp.StatusCode != http.StatusCreated || short.MaxDownloads == nil || *short.MaxDownloads != 1 ||
+		short.ExpiresAt == nil || short.ExpiresAt.Sub(*asset.ExpiresAt) > -time.Hour {
+		t.Fatalf("copy with ttl: %d %+v", resp.StatusCode, short)
+	}
+	for _, tc := range []struct {
+		query  string
+		status int
+	}{
+		{"?ttl=soon", http.StatusBadRequest},
+		{"?max_downloads=0", http.StatusBadRequest},
+		{"?tags=No+Tag!", http.StatusBadRequest},
+	} {
+		if resp, _ := copyOf(tc.query); resp.StatusCode != tc.status {
+			t.Errorf("copy%s: %d, want %d", tc.query, resp.StatusCode, tc.status)
+		}
+	}
+
+	// Copies share the bytes and outlive the original
+	if _, err := s.srv.setAssetState(asset.ID, stateDeleted, "test"); err != nil {
+		t.Fatal(err)
+	}
+	resp = s.Get(short.URL)
+	if body := testserver.Body(t, resp); resp.StatusCode != http.StatusOK || string(body) != "\x00\x01generated" {
+		t.Fatalf("download of copy: %d %q", resp.StatusCode, body)
+	}
+	if resp := s.Get(short.URL); resp.StatusCode != http.StatusGone && resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("second download of single copy: %d", resp.StatusCode)
+	}
+	if resp := s.Get(kept.URL); resp.StatusCode != http.StatusOK {
+		t.Fatalf("download of kept copy: %d", resp.StatusCode)
+	}
+	if resp, _ := copyOf(""); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("copy of deleted: %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestKeepOriginal(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AllowedTypes = append(cfg.AllowedTypes, "image/png", "image/jpeg")
+		cfg.OptimizeImages = "jpeg"
+		cfg.KeepOriginals = true
+	})
+	img := image.NewRGBA(image.Rect(0, 0, 200, 200))
+	for y := range 200 {
+		for x := range 200 {
+			img.Set(x, y, color.RGBA{uint8(x * y), uint8(x ^ y), uint8(x + 3*y), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		query    string
+		variants int
+	}{
+		{"", 1},
+		{"?keep_original=false", 0},
+		{"?keep_original=true", 1},
+	} {
+		resp := s.UploadMultipart("/api/v1/upload"+tc.query, "file", map[string][]byte{"render.png": buf.Bytes()})
+		var env struct {
+			Data AssetV1 `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		if resp.StatusCode != http.StatusCreated || env.Data.ContentType != "image/jpeg" || len(env.Data.Variants) != tc.variants {
+			t.Fatalf("upload%s: %d %s with %d variants, want %d", tc.query, resp.StatusCode, env.Data.ContentType,
+				len(env.Data.Variants), tc.variants)
+		}
+		if tc.variants > 0 && (env.Data.Variants[0].Name != "original" || env.Data.Variants[0].URL != env.Data.URL+"/original") {
+			t.Fatalf("upload%s: variant %+v", tc.query, env.Data.Variants[0])
+		}
+	}
+	if resp := s.UploadMultipart("/api/v1/upload?keep_original=maybe", "file", map[string][]byte{"render.png": buf.Bytes()}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("invalid flag: %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminKey = "test-admin-key"
+		cfg.RetentionRules = []RetentionRule{{MaxDownloads: -1, TTL: Duration(time.Hour)}}
+	})
+	admin := func(method, body string) (*http.Response, MaintenanceV1) {
+		t.Helper()
+		req, err := http.NewRequest(method, s.URL+"/admin/maintenance", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Admin-Key", "test-admin-key")
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v MaintenanceV1
+		testserver.DecodeJSON(t, resp, &v)
+		return resp, v
+	}
+	asset := uploadV1(t, s, "before.txt", []byte("\x00\x01stored"))
+
+	if _, v := admin(http.MethodGet, ""); v.Enabled || v.Since != nil {
+		t.Fatalf("maintenance %+v, want off", v)
+	}
+	if resp, _ := admin(http.MethodPut, `{"message": "no enabled"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("without enabled: %d, want 400", resp.StatusCode)
+	}
+	resp, v := admin(http.MethodPut, `{"enabled": true, "message": "Moving disks"}`)
+	if resp.StatusCode != http.StatusOK || !v.Enabled || v.Message != "Moving disks" || v.Since == nil {
+		t.Fatalf("enable: %d %+v", resp.StatusCode, v)
+	}
+
+	resp = s.UploadMultipart("/api/v1/upload", "file", map[string][]byte{"during.txt": []byte("\x00\x01refused")})
+	var env struct {
+		Error *APIError `json:"error"`
+	}
+	testserver.DecodeJSON(t, resp, &env)
+	if resp.StatusCode != http.StatusServiceUnavailable || env.Error == nil || env.Error.Code != "maintenance" ||
+		env.Error.Message != "Moving disks" {
+		t.Fatalf("upload in maintenance: %d %+v", resp.StatusCode, env.Error)
+	}
+	if resp := s.Do(http.MethodPost, "/api/v1/assets/"+asset.ID+"/copy", "", nil); resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("copy in maintenance: %d, want 503", resp.StatusCode)
+	}
+	if _, err := s.srv.Put(context.Background(), "cli:test", File{Name: "put.txt", Data: strings.NewReader("\x00\x01put")}); err == nil {
+		t.Fatal("Put in maintenance succeeded")
+	}
+	resp = s.Get(asset.URL)
+	if body := testserver.Body(t, resp); resp.StatusCode != http.StatusOK || string(body) != "\x00\x01stored" {
+		t.Fatalf("download in maintenance: %d %q", resp.StatusCode, body)
+	}
+
+	if _, v := admin(http.MethodPut, `{"enabled": false}`); v.Enabled {
+		t.Fatalf("disable: %+v", v)
+	}
+	uploadV1(t, s, "after.txt", []byte("\x00\x01stored again"))
+}
+
+// panicProcessor is a check stage that panics.
+type panicProcessor struct{}
+
+func (panicProcessor) Name() string        { return "panic" }
+func (panicProcessor) Phase() processPhase { return phaseCheck }
+func (panicProcessor) Process(ctx context.Context, s *Server, p *processing) error {
+	panic("stage failed")
+}
+
+func TestPanicRecovery(t *testing.T) {
+	s := newTestServer(t, nil)
+	h := s.srv.withRecovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Disposition", "attachment")
+		panic("handler failed")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/assets/x", nil))
+	var env struct {
+		Error *APIError `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || rec.Code != http.StatusInternalServerError ||
+		env.Error == nil || env.Error.Code != "internal_error" || rec.Header().Get("Content-Disposition") != "" {
+		t.Fatalf("api: %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/upload", nil))
+	var legacy Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &legacy); err != nil || rec.Code != http.StatusInternalServerError || legacy.Success {
+		t.Fatalf("legacy: %d %s", rec.Code, rec.Body)
+	}
+
+	// A check that panicked might have failed the asset
+	p := &processing{asset: &Asset{ID: "x.png", ContentType: "image/png"}, next: stateActive}
+	if err := s.srv.runStage(context.Background(), panicProcessor{}, p); !errors.Is(err, errPanicked) {
+		t.Fatalf("stage: %v, want errPanicked", err)
+	}
+	if n := s.srv.panics.Load(); n != 3 {
+		t.Fatalf("%d panics counted, want 3", n)
+	}
+}
+
+func TestStreamingUpload(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.MaxFileSize = 4096
+		cfg.RetentionRules = []RetentionRule{{Name: "forever-ish", Keys: []string{keyActor(testAPIKey)}, MaxDownloads: unlimitedDownloads, TTL: Duration(time.Hour)}}
+	})
+	data := bytes.Repeat([]byte("\x00\x01"), 1500)
+	sum := sha256.Sum256(data)
+
+	// Files no stage transforms are hashed and sized as they are stored
+	asset := uploadV1(t, s, "a.bin", data)
+	if asset.SHA256 != hex.EncodeToString(sum[:]) || asset.Size != int64(len(data)) || asset.ContentType != "application/octet-stream" {
+		t.Fatalf("streamed upload %+v, want %d bytes with hash %x", asset, len(data), sum)
+	}
+	if body := testserver.Body(t, s.Get(asset.URL)); !bytes.Equal(body, data) {
+		t.Fatalf("download of streamed upload: %d bytes, want %d", len(body), len(data))
+	}
+
+	// A ticket for a hash is checked against what was stored
+	granted := bytes.Repeat([]byte("\x00\x02"), 1500)
+	sum = sha256.Sum256(granted)
+	upload := func(data []byte) *http.Response {
+		t.Helper()
+		resp := s.Do(http.MethodPost, "/api/v1/precheck?sha256="+hex.EncodeToString(sum[:])+"&size="+strconv.Itoa(len(data)), "", nil)
+		var env struct {
+			Data struct {
+				Ticket string `json:"ticket"`
+			} `json:"data"`
+		}
+		testserver.DecodeJSON(t, resp, &env)
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "b.bin")
+		fw.Write(data)
+		mw.Close()
+		req, err := http.NewRequest(http.MethodPost, s.URL+"/api/v1/upload", &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("X-Upload-Ticket", env.Data.Ticket)
+		resp, err = s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	if resp := upload(data); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("streamed upload of other content: status %d, want 400", resp.StatusCode)
+	}
+	if resp := upload(granted); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("streamed upload with granted ticket: status %d, want 201", resp.StatusCode)
+	}
+
+	// Put finds files too large or unreadable while storing them, and
+	// leaves nothing behind
+	assets := len(s.srv.assets.list())
+	if _, err := s.srv.Put(context.Background(), "put", File{Name: "big.bin", Data: bytes.NewReader(make([]byte, 5000))}); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Fatalf("put of too large a file: %v", err)
+	}
+	broken := io.MultiReader(bytes.NewReader(data[:1000]), iotest.ErrReader(errors.New("connection reset")))
+	if _, err := s.srv.Put(context.Background(), "put", File{Name: "broken.bin", Data: broken}); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("put of an unreadable file: %v", err)
+	}
+	if n := len(s.srv.assets.list()); n != assets {
+		t.Fatalf("%d assets after failed puts, want %d", n, assets)
+	}
+}
+
+func TestCompressedStorage(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.CompressStorage = true
+		cfg.AdminKey = "test-admin-key"
+		cfg.AllowedTypes = []string{"text/plain", "application/octet-stream"}
+		cfg.RetentionRules = []RetentionRule{
+			{Name: "keep", Tags: []string{"keep"}, MaxDownloads: unlimitedDownloads},
+			{Name: "once", Tags: []string{"once"}, MaxDownloads: 1},
+		}
+	})
+	text := bytes.Repeat([]byte("hello, compressed world\n"), 200)
+	sum := sha256.Sum256(text)
+	put, err := s.srv.Put(context.Background(), "put", File{Name: "a.txt", ContentType: "text/plain", Tags: []string{"keep"}, Data: bytes.NewReader(text)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	asset, _ := s.srv.assets.get(put.ID)
+	if asset.Encoding != encodingZstd || asset.StoredSize <= 0 || asset.StoredSize >= asset.Size ||
+		asset.Size != int64(len(text)) || asset.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatalf("stored text %+v, want it compressed with the size and hash of the content", asset)
+	}
+	if fi, err := os.Stat(s.srv.assetPath(asset.ID)); err != nil || fi.Size() != asset.StoredSize {
+		t.Fatalf("file of compressed text: %v, want %d bytes", err, asset.StoredSize)
+	}
+	if used := s.srv.storageUsage(); used != asset.StoredSize {
+		t.Fatalf("storage usage %d, want the %d bytes stored", used, asset.StoredSize)
+	}
+
+	download := func(header http.Header) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, s.URL+"/api/v1/download/"+asset.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		maps.Copy(req.Header, header)
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, testserver.Body(t, resp)
+	}
+
+	// Clients accepting zstd get the file as stored, others the content
+	resp, body := download(http.Header{"Accept-Encoding": {"gzip, zstd"}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "zstd" || int64(len(body)) != asset.StoredSize {
+		t.Fatalf("download accepting zstd: status %d, encoding %q, %d bytes", resp.StatusCode, resp.Header.Get("Content-Encoding"), len(body))
+	}
+	dec, err := zstd.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := io.ReadAll(dec); err != nil || !bytes.Equal(content, text) {
+		t.Fatalf("decoded download: %d bytes, %v", len(content), err)
+	}
+	dec.Close()
+	if !slices.Contains(resp.Header.Values("Vary"), "Accept-Encoding") {
+		t.Fatalf("download of compressed file varies by %q, want Accept-Encoding", resp.Header.Values("Vary"))
+	}
+	resp, body = download(nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Encoding") != "" || !bytes.Equal(body, text) {
+		t.Fatalf("download: status %d, encoding %q, %d bytes", resp.StatusCode, resp.Header.Get("Content-Encoding"), len(body))
+	}
+	resp, body = download(http.Header{"Accept-Encoding": {"zstd"}, "Range": {"bytes=2400-2423"}})
+	if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("Content-Encoding") != "" || !bytes.Equal(body, text[2400:2424]) {
+		t.Fatalf("range download: status %d, encoding %q, body %q", resp.StatusCode, resp.Header.Get("Content-Encoding"), body)
+	}
+
+	// WebDAV shows and reads the content too
+	for _, method := range []string{http.MethodGet, "PROPFIND"} {
+		req, err := http.NewRequest(method, s.URL+"/dav/"+asset.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Depth", "0")
+		req.SetBasicAuth("admin", "test-admin-key")
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := testserver.Body(t, resp)
+		switch {
+		case method == http.MethodGet && (resp.StatusCode != http.StatusOK || !bytes.Equal(body, text)):
+			t.Fatalf("WebDAV get: status %d, %d bytes", resp.StatusCode, len(body))
+		case method == "PROPFIND" && !strings.Contains(string(body), fmt.Sprintf("<D:getcontentlength>%d<", len(text))):
+			t.Fatalf("WebDAV propfind: status %d, body %s", resp.StatusCode, body)
+		}
+	}
+
+	// Downloads are journaled in content bytes: part of the file as stored
+	// delivers none of them, so resuming it by range completes nothing
+	var varied bytes.Buffer
+	for i := range 500 {
+		fmt.Fprintf(&varied, "line %d of %d\n", i*i, i*7)
+	}
+	once, err := s.srv.Put(context.Background(), "put", File{Name: "d.txt", ContentType: "text/plain", Tags: []string{"once"}, Data: &varied})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/download/"+once.ID, nil)
+	req.Header.Set("Accept-Encoding", "zstd")
+	cut := &cutRecorder{ResponseRecorder: httptest.NewRecorder(), n: 100}
+	s.srv.Handler().ServeHTTP(cut, req)
+	if a, _ := s.srv.assets.get(once.ID); cut.Header().Get("Content-Encoding") != "zstd" || a.Delivery != nil {
+		t.Fatalf("interrupted download as stored: encoding %q, journal %+v", cut.Header().Get("Content-Encoding"), a.Delivery)
+	}
+	req, err = http.NewRequest(http.MethodGet, s.URL+"/api/v1/download/"+once.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Range", "bytes=100-")
+	resp, err = s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if a, ok := s.srv.assets.get(once.ID); resp.StatusCode != http.StatusPartialContent || !ok || a.Downloads != 0 {
+		t.Fatalf("resumed download: status %d, %+v, want no download counted", resp.StatusCode, a)
+	}
+
+	// Checksums are of the content
+	if sum, err := fileChecksum(s.srv.assetPath(asset.ID), asset.Encoding); err != nil || sum != asset.SHA256 {
+		t.Fatalf("checksum of compressed file %s, %v, want %s", sum, err, asset.SHA256)
+	}
+
+	// Types left out and files that don't shrink are stored as they are
+	binary := uploadV1(t, s, "b.bin", bytes.Repeat([]byte("\x00\x01"), 200))
+	short, err := s.srv.Put(context.Background(), "put", File{Name: "c.txt", ContentType: "text/plain", Data: bytes.NewReader([]byte("hi"))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{binary.ID, short.ID} {
+		if a, _ := s.srv.assets.get(id); a.Encoding != "" || a.StoredSize != 0 {
+			t.Fatalf("%s (%s) stored with encoding %q", id, a.ContentType, a.Encoding)
+		}
+	}
+}
+
+func TestStagingCleanup(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.StagingDir = filepath.Join(t.TempDir(), "staging")
+	})
+	var leftovers []string
+	for _, name := range []string{".upload-1", ".multipart-1"} {
+		path := filepath.Join(s.srv.stagingDir(), name)
+		if err := os.WriteFile(path, []byte("partial"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		leftovers = append(leftovers, path)
+	}
+
+	// A command opening the server alongside it must leave its uploads be
+	cli, err := New(s.srv.config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Close()
+	for _, path := range leftovers {
+		if _, err := os.Stat(path); err != nil {
+			t.Fatalf("opening a second server: %v", err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.srv.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range leftovers {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s left after Run: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestDownloadReservation(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.RetentionRules = []RetentionRule{{MaxDownloads: 1, TTL: Duration(time.Hour)}}
+	})
+	data := []byte("\x00\x01 once")
+	asset := uploadV1(t, s, "once.bin", data)
+	get := func(rangeHeader string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, s.URL+"/api/v1/download/"+asset.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// A whole file download being sent holds the only download left, while
+	// parts may still be fetched
+	release, err := s.srv.reserveDownload(asset.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp := get(""); resp.Body.Close() != nil || resp.StatusCode != http.StatusConflict {
+		t.Fatalf("second whole download: status %d, want 409", resp.StatusCode)
+	}
+	if resp := get("bytes=0-3"); resp.Body.Close() != nil || resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("range during a whole download: status %d, want 206", resp.StatusCode)
+	}
+
+	// A failed download gives its reservation back
+	release()
+	if body := testserver.Body(t, get("")); !bytes.Equal(body, data) {
+		t.Fatalf("download after release: %q", body)
+	}
+	if resp := get(""); resp.Body.Close() != nil || resp.StatusCode != http.StatusGone {
+		t.Fatalf("download past the limit: status %d, want 410", resp.StatusCode)
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminKey = "test-admin-key"
+	})
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/events?types=upload,download", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Admin-Key", "test-admin-key")
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("status %d, type %q", resp.StatusCode, ct)
+	}
+
+	events := make(chan Event)
+	go func() {
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			if data, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+				var e Event
+				json.Unmarshal([]byte(data), &e)
+				events <- e
+			}
+		}
+		close(events)
+	}()
+
+	asset := uploadV1(t, s, "a.txt", []byte("hello"))
+	testserver.Body(t, s.Get(asset.URL))
+	for _, want := range []Event{
+		{Type: "upload", AssetID: asset.ID, Bytes: 5},
+		{Type: "download", AssetID: asset.ID, Bytes: 5},
+	} {
+		select {
+		case e := <-events:
+			if e.Type != want.Type || e.AssetID != want.AssetID || e.Bytes != want.Bytes {
+				t.Fatalf("event %+v, want %+v", e, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s event", want.Type)
+		}
+	}
+}
+
+func TestWebDAV(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminKey = "test-admin-key"
+	})
+	asset := uploadV1(t, s, "a.txt", []byte("hello"))
+	if err := os.WriteFile(filepath.Join(s.srv.config.UploadDir, ".upload-123"), []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dav := func(method, path, password string) *http.Response {
+		req, err := http.NewRequest(method, s.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Depth", "1")
+		if password != "" {
+			req.SetBasicAuth("admin", password)
+		}
+		resp, err := s.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := dav("PROPFIND", "/dav/", "wrong")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("wrong password: status %d, want a 401 challenge", resp.StatusCode)
+	}
+
+	resp = dav("PROPFIND", "/dav/", "test-admin-key")
+	listing := string(testserver.Body(t, resp))
+	if resp.StatusCode != http.StatusMultiStatus || !strings.Contains(listing, "/dav/"+asset.ID) {
+		t.Fatalf("listing: status %d, body %s", resp.StatusCode, listing)
+	}
+	if strings.Contains(listing, ".upload-123") {
+		t.Fatal("listing shows a partial upload")
+	}
+
+	resp = dav(http.MethodGet, "/dav/"+asset.ID, "test-admin-key")
+	if got := testserver.Body(t, resp); resp.StatusCode != http.StatusOK || string(got) != "hello" {
+		t.Fatalf("get: status %d, body %q", resp.StatusCode, got)
+	}
+	for _, method := range []string{http.MethodPut, http.MethodDelete, "MKCOL", "MOVE"} {
+		resp = dav(method, "/dav/"+asset.ID, "test-admin-key")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Fatalf("%s: status %d, want 405", method, resp.StatusCode)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.AdminKey = "test-admin-key"
+	})
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")
+	var launch []string
+	for _, album := range []string{"launch", "launch", "other"} {
+		saved, err := s.srv.Put(context.Background(), "test", File{Name: "a.png", Data: bytes.NewReader(png),
+			Metadata: `{"album": "` + album + `"}`})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if album == "launch" {
+			launch = append(launch, saved.ID)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, s.URL+"/admin/export?meta=album:launch&title=Launch+party", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Admin-Key", "test-admin-key")
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/gzip" {
+		t.Fatalf("status %d, type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name], _ = io.ReadAll(tr)
+	}
+	if len(files) != 4 {
+		t.Fatalf("tarball has %d files, want 2 assets, assets.json and index.html", len(files))
+	}
+	for _, id := range launch {
+		if !bytes.Equal(files["files/"+id], png) {
+			t.Errorf("files/%s missing or changed", id)
+		}
+		if !bytes.Contains(files["index.html"], []byte(`src="files/`+id+`"`)) {
+			t.Errorf("gallery doesn't show %s", id)
+		}
+	}
+	if !bytes.Contains(files["index.html"], []byte("<title>Launch party</title>")) {
+		t.Errorf("gallery has no title:\n%s", files["index.html"])
+	}
+
+	dir := t.TempDir()
+	n, err := s.srv.ExportDir(context.Background(), ExportOptions{Metadata: map[string]string{"album": "other"}}, dir)
+	if err != nil || n != 1 {
+		t.Fatalf("directory export: %d assets, %v", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "index.html")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSessionTTL = 15 * time.Minute
+
+	// sessionMaxAge bounds a session however often it is used, so a
+	// service exchanges its key again at least daily
+	sessionMaxAge = 24 * time.Hour
+
+	// maxSessions bounds the sessions open at once
+	maxSessions = 10000
+)
+
+func (s *Server) validateSessionConfig() error {
+	if s.config.SessionTTL == 0 {
+		s.config.SessionTTL = Duration(defaultSessionTTL)
+	}
+	if s.config.SessionTTL < 0 || time.Duration(s.config.SessionTTL) > sessionMaxAge {
+		return fmt.Errorf("session_ttl must be positive and at most 24h")
+	}
+	return nil
+}
+
+// session stands in for the API key it was opened with until it goes
+// unused for session_ttl.
+type session struct {
+	actor   string
+	opened  time.Time
+	expires time.Time
+}
+
+// sessions are the session tokens handed out and not expired yet.
+type sessions struct {
+	mu     sync.Mutex
+	active map[string]*session
+}
+
+func (s *sessions) open(actor string, now time.Time, ttl time.Duration) (string, session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.active == nil {
+		s.active = make(map[string]*session)
+	}
+	for token, sess := range s.active {
+		if !now.Before(sess.expires) {
+			delete(s.active, token)
+		}
+	}
+	if len(s.active) >= maxSessions {
+		return "", session{}, false
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	sess := &session{actor: actor, opened: now, expires: now.Add(ttl)}
+	s.active[token] = sess
+	return token, *sess, true
+}
+
+// use returns the session of a token, if it has not expired, and keeps it
+// open for another ttl.
+func (s *sessions) use(token string, now time.Time, ttl time.Duration) (session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.active[token]
+	if !ok {
+		return session{}, false
+	}
+	if !now.Before(sess.expires) {
+		delete(s.active, token)
+		return session{}, false
+	}
+	sess.expires = now.Add(ttl)
+	if limit := sess.opened.Add(sessionMaxAge); sess.expires.After(limit) {
+		sess.expires = limit
+	}
+	return *sess, true
+}
+
+func (s *sessions) close(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.active[token]
+	delete(s.active, token)
+	return ok
+}
+
+// sessionActor identifies a session in the audit log without recording
+// its token.
+func sessionActor(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "session:" + hex.EncodeToString(sum[:4])
+}
+
+// bearerToken returns the token of an Authorization: Bearer header.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type sessionKey struct{}
+
+// withSession authenticates requests carrying a session token instead of
+// an API key as the key the session was opened with, as long as that key
+// is still valid.  Requests with an unknown or expired token go on without
+// a session and are refused like those with a wrong key.
+func (s *Server) withSession(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := bearerToken(r)
+		if token == "" || strings.HasPrefix(token, scopedTokenPrefix) || r.Header.Get("X-API-Key") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		sess, ok := s.sessions.use(token, s.now(), time.Duration(s.config.SessionTTL))
+		if ok && !s.keyActive(sess.actor) {
+			s.sessions.close(token)
+			ok = false
+		}
+		if ok {
+			r = r.WithContext(context.WithValue(r.Context(), sessionKey{}, sess))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// requestSession returns the session a request was authenticated with, if
+// any.
+func requestSession(r *http.Request) (session, bool) {
+	sess, ok := r.Context().Value(sessionKey{}).(session)
+	return sess, ok
+}
+
+// requestKeyActor identifies the API key of a request, given as the key
+// itself or through a session.
+func requestKeyActor(r *http.Request) string {
+	if sess, ok := requestSession(r); ok {
+		return sess.actor
+	}
+	return keyActor(r.Header.Get("X-API-Key"))
+}
+
+// keyActive reports whether the API key identified by actor is the
+// configured api_key or a managed key that is still valid.  Sessions end
+// with the key they were opened with, once a rotated key's overlap is over.
+func (s *Server) keyActive(actor string) bool {
+	if actor == keyActor(s.config.APIKey) {
+		return true
+	}
+	k, ok := s.apiKeys.get(strings.TrimPrefix(actor, "key:"))
+	return ok && k.valid(s.now())
+}
+
+// authHandler exchanges the API key for a session token, which requests
+// may send as Authorization: Bearer instead of the key until it goes
+// unused for session_ttl, or for a day at most.  DELETE ends the session
+// a request carries.
+func (s *Server) authHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		token := bearerToken(r)
+		if _, ok := requestSession(r); !ok || !s.sessions.close(token) {
+			s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid session token")
+			return
+		}
+		s.audit(r.Context(), requestKeyActor(r), auditSession, sessionActor(token), "closed")
+		sendEnvelope(w, http.StatusOK, nil)
+		return
+	}
+
+	// Sessions cannot renew themselves, so they end with the key
+	if r.Header.Get("X-API-Key") == "" || !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+	actor := keyActor(r.Header.Get("X-API-Key"))
+	token, sess, ok := s.sessions.open(actor, s.now(), time.Duration(s.config.SessionTTL))
+	if !ok {
+		s.sendEnvelopeError(w, r, http.StatusServiceUnavailable, "too_many_sessions", "Too many open sessions, try again later")
+		return
+	}
+	expires := sess.expires.Truncate(time.Second).UTC()
+	s.audit(r.Context(), actor, auditSession, sessionActor(token), "expires "+expires.Format(time.RFC3339))
+	w.Header().Set("Cache-Control", "no-store")
+	sendEnvelope(w, http.StatusCreated, map[string]any{
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_at": expires,
+		"expires_in": int(time.Duration(s.config.SessionTTL) / time.Second),
+	})
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// validateSFTPConfig parses the keys authorized for SFTP.  A key's comment
+// names it in the audit log, so operators can tell toolchains apart.
+func (s *Server) validateSFTPConfig() error {
+	if s.config.SFTPListen == "" {
+		return nil
+	}
+	if len(s.config.SFTPAuthorizedKeys) == 0 {
+		return fmt.Errorf("sftp_authorized_keys cannot be empty with sftp_listen")
+	}
+	if s.config.SFTPHostKey == "" {
+		s.config.SFTPHostKey = filepath.Join(s.config.DataDir, "sftp_host_key")
+	}
+	s.sftpKeys = make(map[string]string)
+	for i, line := range s.config.SFTPAuthorizedKeys {
+		key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return fmt.Errorf("sftp_authorized_keys #%d: %v", i+1, err)
+		}
+		actor := "sftp:" + comment
+		if comment == "" {
+			sum := sha256.Sum256(key.Marshal())
+			actor = "sftp:" + hex.EncodeToString(sum[:4])
+		}
+		s.sftpKeys[string(key.Marshal())] = actor
+	}
+	return nil
+}
+
+// sftpHostKey loads the SFTP listener's host key, creating it on first use.
+func (s *Server) sftpHostKey() (ssh.Signer, error) {
+	data, err := os.ReadFile(s.config.SFTPHostKey)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		block, err := ssh.MarshalPrivateKey(key, "")
+		if err != nil {
+			return nil, err
+		}
+		data = pem.EncodeToMemory(block)
+		if err := os.WriteFile(s.config.SFTPHostKey, data, 0600); err != nil {
+			return nil, fmt.Errorf("error writing SFTP host key: %v", err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading SFTP host key: %v", err)
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing SFTP host key: %v", err)
+	}
+	return signer, nil
+}
+
+// sftpConfig is the SSH configuration of the SFTP listener.
+func (s *Server) sftpConfig(hostKey ssh.Signer) *ssh.ServerConfig {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			actor, ok := s.sftpKeys[string(key.Marshal())]
+			if !ok {
+				return nil, fmt.Errorf("unknown key for %s", conn.User())
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"actor": actor}}, nil
+		},
+	}
+	config.AddHostKey(hostKey)
+	return config
+}
+
+// serveSFTP runs the SFTP listener until ctx is done.
+func (s *Server) serveSFTP(ctx context.Context) error {
+	hostKey, err := s.sftpHostKey()
+	if err != nil {
+		return err
+	}
+	config := s.sftpConfig(hostKey)
+	ln, err := net.Listen("tcp", s.config.SFTPListen)
+	if err != nil {
+		return err
+	}
+	lis := s.limitConns(ln)
+	go func() {
+		<-ctx.Done()
+		lis.Close()
+	}()
+
+	s.infof("SFTP listener starting on %s with host key %s...\n",
+		s.config.SFTPListen, ssh.FingerprintSHA256(hostKey.PublicKey()))
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		go s.handleSFTPConn(ctx, conn, config)
+	}
+}
+
+// handleSFTPConn serves the sftp subsystem on the sessions of an SSH
+// connection.  Anything else, such as shells or the legacy scp protocol,
+// is refused.
+func (s *Server) handleSFTPConn(ctx context.Context, conn net.Conn, config *ssh.ServerConfig) {
+	// Clients get read_timeout to finish the handshake and log in
+	conn.SetDeadline(time.Now().Add(time.Duration(s.config.ReadTimeout)))
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	actor := sconn.Permissions.Extensions["actor"]
+	s.audit(ctx, actor, auditKeyUse, "sftp", sconn.RemoteAddr().String())
+
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			newChan.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		ch, requests, err := newChan.Accept()
+		if err != nil {
+			fmt.Printf("Error accepting SFTP session: %v\n", err)
+			continue
+		}
+		go func() {
+			for req := range requests {
+				ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+				if !ok {
+					continue
+				}
+				server := sftp.NewRequestServer(ch, s.sftpHandlers(ctx, actor))
+				if err := server.Serve(); err != nil && !errors.Is(err, io.EOF) {
+					s.infof("SFTP session of %s ended: %v\n", actor, err)
+				}
+				server.Close()
+				return
+			}
+		}()
+	}
+}
+
+// sftpDropbox is an SFTP file system that can only be written to.  Every
+// file written is ingested as an upload when it is closed.
+type sftpDropbox struct {
+	s     *Server
+	ctx   context.Context
+	actor string
+}
+
+func (s *Server) sftpHandlers(ctx context.Context, actor string) sftp.Handlers {
+	d := sftpDropbox{s: s, ctx: ctx, actor: actor}
+	return sftp.Handlers{FileGet: d, FilePut: d, FileCmd: d, FileList: d}
+}
+
+func (d sftpDropbox) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	return nil, sftp.ErrSSHFxPermissionDenied
+}
+
+func (d sftpDropbox) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	f, err := os.CreateTemp(d.s.stagingDir(), ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	return &sftpUpload{d: d, name: path.Base(r.Filepath), f: f}, nil
+}
+
+// Filecmd accepts setting attributes, which clients do after writing a
+// file, and refuses every other change.
+func (d sftpDropbox) Filecmd(r *sftp.Request) error {
+	if r.Method == "Setstat" {
+		return nil
+	}
+	return sftp.ErrSSHFxPermissionDenied
+}
+
+// Filelist shows an empty root directory, so clients can copy files into
+// it.
+func (d sftpDropbox) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	if r.Filepath != "/" {
+		return nil, os.ErrNotExist
+	}
+	switch r.Method {
+	case "List":
+		return sftpListing(nil), nil
+	case "Stat":
+		return sftpListing{sftpRoot{}}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+type sftpListing []os.FileInfo
+
+func (l sftpListing) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+type sftpRoot struct{}
+
+func (sftpRoot) Name() string       { return "/" }
+func (sftpRoot) Size() int64        { return 0 }
+func (sftpRoot) Mode() os.FileMode  { return os.ModeDir | 0700 }
+func (sftpRoot) ModTime() time.Time { return time.Time{} }
+func (sftpRoot) IsDir() bool        { return true }
+func (sftpRoot) Sys() any           { return nil }
+
+// sftpUpload collects a file written over SFTP in the staging area.
+type sftpUpload struct {
+	d    sftpDropbox
+	name string
+	f    *os.File
+
+	mu     sync.Mutex
+	failed bool
+}
+
+func (u *sftpUpload) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > u.d.s.config.MaxFileSize {
+		u.TransferError(errors.New("file too large"))
+		return 0, fmt.Errorf("File too large (max: %d bytes)", u.d.s.config.MaxFileSize)
+	}
+	return u.f.WriteAt(p, off)
+}
+
+// TransferError is called if the connection ends while the file is open,
+// in which case it is discarded.
+func (u *sftpUpload) TransferError(err error) {
+	u.mu.Lock()
+	u.failed = true
+	u.mu.Unlock()
+}
+
+// Close ingests the file.  Failures are reported to the client as the
+// result of closing it.
+func (u *sftpUpload) Close() error {
+	defer os.Remove(u.f.Name())
+	defer u.f.Close()
+	u.mu.Lock()
+	failed := u.failed
+	u.mu.Unlock()
+	if failed {
+		return nil
+	}
+	if _, err := u.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	s := u.d.s
+	ctx, cancel := context.WithTimeout(u.d.ctx, time.Duration(s.config.UploadTimeout))
+	defer cancel()
+	saved, uerr := s.putFile(ctx, u.d.actor, File{Name: u.name, Data: u.f})
+	if uerr != nil {
+		s.infof("Rejected SFTP upload %s from %s: %s\n", u.name, u.d.actor, uerr.message)
+		return errors.New(uerr.message)
+	}
+	s.infof("Stored SFTP upload %s from %s as %s\n", u.name, u.d.actor, saved.ID)
+	s.sendUploaded(saved, u.d.actor)
+	return nil
+}
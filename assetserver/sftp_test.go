@@ -0,0 +1,166 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestSFTPIngest(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhooks := make(chan WebhookEvent, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event WebhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		webhooks <- event
+	}))
+	defer receiver.Close()
+
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.SFTPListen = "127.0.0.1:0"
+		cfg.SFTPAuthorizedKeys = []string{strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))) + " ci@build"}
+		cfg.WebhookURL = receiver.URL
+		cfg.WebhookSecret = "secret"
+	})
+	hostKey, err := s.srv.sftpHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		if conn, err := lis.Accept(); err == nil {
+			s.srv.handleSFTPConn(context.Background(), conn, s.srv.sftpConfig(hostKey))
+		}
+	}()
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sconn, chans, reqs, err := ssh.NewClientConn(conn, lis.Addr().String(), &ssh.ClientConfig{
+		User:            "ci",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey.PublicKey()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := sftp.NewClient(ssh.NewClient(sconn, chans, reqs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	put := func(name string, data []byte) error {
+		f, err := client.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		return f.Close()
+	}
+
+	if err := put("chart.png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR")); err != nil {
+		t.Fatalf("png upload: %v", err)
+	}
+	// The scan verdict may be sent first
+	var event WebhookEvent
+	for event.Event != "asset.uploaded" {
+		select {
+		case event = <-webhooks:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no webhook for the upload")
+		}
+	}
+	if event.Event != "asset.uploaded" || event.Uploader != "sftp:ci@build" || event.URL == "" || event.DeleteURL == "" {
+		t.Fatalf("webhook %+v", event)
+	}
+	asset, ok := s.srv.assets.get(event.AssetID)
+	if !ok || asset.OriginalName != "chart.png" || asset.ContentType != "image/png" {
+		t.Fatalf("stored asset %+v", asset)
+	}
+
+	if err := put("notes.txt", []byte("hello")); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("text upload: %v, want a type error", err)
+	}
+	if _, err := client.Open("/" + asset.ID); err == nil {
+		t.Fatal("files can be read back")
+	}
+}
+
+func TestSFTPHandshakeTimeout(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.SFTPListen = "127.0.0.1:0"
+		cfg.SFTPAuthorizedKeys = []string{strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub)))}
+		cfg.ReadTimeout = Duration(100 * time.Millisecond)
+	})
+	hostKey, err := s.srv.sftpHostKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if conn, err := lis.Accept(); err == nil {
+			s.srv.handleSFTPConn(context.Background(), conn, s.srv.sftpConfig(hostKey))
+		}
+	}()
+
+	// A client that connects and never says anything is let go
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("silent client held the connection past read_timeout")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+const shortLinkAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// shortLinkAttempts is how many random codes of a length are tried before
+// moving to a longer code.
+const shortLinkAttempts = 5
+
+// ShortLink maps a short code to the asset it redirects to.
+type ShortLink struct {
+	Code      string    `json:"code"`
+	AssetID   string    `json:"asset_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *Server) shortURL(code string) string {
+	return fmt.Sprintf("https://%s/s/%s", s.config.Domain, code)
+}
+
+func randomCode(n int) (string, error) {
+	b := make([]byte, n)
+	limit := big.NewInt(int64(len(shortLinkAlphabet)))
+	for i := range b {
+		v, err := rand.Int(rand.Reader, limit)
+		if err != nil {
+			return "", err
+		}
+		b[i] = shortLinkAlphabet[v.Int64()]
+	}
+	return string(b), nil
+}
+
+// newShortLink allocates a short code for an asset.  Codes that are taken
+// are retried, growing the code when a length gets crowded.
+func (s *Server) newShortLink(assetID string) (string, error) {
+	for n := s.config.ShortLinkLength; ; n++ {
+		for range shortLinkAttempts {
+			code, err := randomCode(n)
+			if err != nil {
+				return "", err
+			}
+			err = s.shortLinks.insert(code, ShortLink{Code: code, AssetID: assetID, CreatedAt: s.now().UTC()})
+			if errors.Is(err, errRecordExists) {
+				continue
+			}
+			return code, err
+		}
+	}
+}
+
+// shortLinkHandler redirects a short link to its asset's download URL.
+// Links share the fate of their asset: once it is expired, used up or
+// deleted the link answers like the download would.
+func (s *Server) shortLinkHandler(w http.ResponseWriter, r *http.Request) {
+	link, ok := s.shortLinks.get(r.PathValue("code"))
+	if !ok {
+		s.httpError(w, r, "Link not found", http.StatusNotFound)
+		return
+	}
+	asset, ok := s.assets.get(link.AssetID)
+	if !ok {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+	switch {
+	case asset.State == stateQuarantined:
+		s.httpError(w, r, "File unavailable for legal reasons", http.StatusUnavailableForLegalReasons)
+		return
+	case asset.State == stateDeleted, asset.expired(s.now()), asset.usedUp():
+		s.httpError(w, r, "File deleted", http.StatusGone)
+		return
+	case asset.State != stateActive:
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, s.downloadURL(asset.ID), http.StatusFound)
+}
@@ -0,0 +1,308 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxSidecars          = 16
+	maxSidecarNameLength = 64
+)
+
+// sidecarTypes maps the extensions of the sidecar files an asset can carry
+// to the type they are served as.  All of them are text.
+var sidecarTypes = map[string]string{
+	".vtt": "text/vtt; charset=utf-8",
+	".srt": "application/x-subrip; charset=utf-8",
+	".txt": "text/plain; charset=utf-8",
+}
+
+// Sidecar is a text file attached to an asset after upload, such as
+// subtitles or a transcript.
+type Sidecar struct {
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	AddedAt     time.Time `json:"added_at"`
+}
+
+// SidecarV1 is version 1 of a sidecar entry of an asset object.
+type SidecarV1 struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+func (s *Server) validateSidecarConfig() error {
+	if s.config.MaxSidecarSize < 0 {
+		return fmt.Errorf("max_sidecar_size cannot be negative")
+	}
+	if s.config.MaxSidecarSize == 0 {
+		s.config.MaxSidecarSize = 1 << 20
+	}
+	return nil
+}
+
+// validSidecarName reports whether a sidecar name, such as en.vtt, is made
+// of letters, digits and the separators - _ . with a known extension.
+func validSidecarName(name string) bool {
+	if name == "" || len(name) > maxSidecarNameLength || name[0] == '.' {
+		return false
+	}
+	if _, ok := sidecarTypes[path.Ext(name)]; !ok {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) sidecarDir() string {
+	return filepath.Join(s.config.UploadDir, ".sidecars")
+}
+
+func sidecarFileName(id, name string) string {
+	return id + "." + name
+}
+
+func (s *Server) sidecarPath(id, name string) string {
+	return filepath.Join(s.sidecarDir(), sidecarFileName(id, name))
+}
+
+func (s *Server) sidecarURL(id, name string) string {
+	return s.downloadURL(id) + "/sidecar/" + name
+}
+
+func (a *Asset) sidecar(name string) (Sidecar, bool) {
+	for _, sc := range a.Sidecars {
+		if sc.Name == name {
+			return sc, true
+		}
+	}
+	return Sidecar{}, false
+}
+
+// addSidecar adds a sidecar to an asset, replacing any of the same name.
+func (a *Asset) addSidecar(sc Sidecar) {
+	if i := slices.IndexFunc(a.Sidecars, func(x Sidecar) bool { return x.Name == sc.Name }); i >= 0 {
+		a.Sidecars[i] = sc
+		return
+	}
+	a.Sidecars = append(a.Sidecars, sc)
+}
+
+func (s *Server) removeSidecars(asset Asset) {
+	for _, sc := range asset.Sidecars {
+		path := s.sidecarPath(asset.ID, sc.Name)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error removing sidecar %s: %v\n", path, err)
+		}
+	}
+}
+
+// ownedAsset looks up an asset whose sidecars or content the key of a
+// request may change: its uploader's, active or pending.  A scoped token
+// granting access to the asset stands in for the key, if access is set.
+func (s *Server) ownedAsset(w http.ResponseWriter, r *http.Request, access string) (Asset, bool) {
+	asset, ok := s.assets.get(r.PathValue("id"))
+	scoped := ok && access != "" && s.checkScopedToken(r, access, &asset)
+	if !scoped && !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return Asset{}, false
+	}
+	if !ok || asset.State == stateDeleted {
+		s.sendEnvelopeError(w, r, http.StatusNotFound, "not_found", "Asset not found")
+		return Asset{}, false
+	}
+	if !scoped && asset.Uploader != requestKeyActor(r) {
+		s.sendEnvelopeError(w, r, http.StatusForbidden, "forbidden", "Asset belongs to another key")
+		return Asset{}, false
+	}
+	if asset.State == stateQuarantined {
+		s.sendEnvelopeError(w, r, http.StatusConflict, "quarantined", "Asset is quarantined")
+		return Asset{}, false
+	}
+	return asset, true
+}
+
+// putSidecarHandler attaches the request body to an asset as the sidecar
+// named in the path, replacing any of that name.  Sidecars are scanned
+// like uploads, and must be UTF-8 text; WebVTT files must start as such.
+func (s *Server) putSidecarHandler(w http.ResponseWriter, r *http.Request) {
+	asset, ok := s.ownedAsset(w, r, accessAppend)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if !validSidecarName(name) {
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_name", "Invalid sidecar name")
+		return
+	}
+	// Append tokens add sidecars but never replace one
+	if _, exists := asset.sidecar(name); exists {
+		if _, scoped := requestScopedToken(r); scoped {
+			s.sendEnvelopeError(w, r, http.StatusConflict, "sidecar_exists", "Sidecar exists")
+			return
+		}
+	}
+	if _, exists := asset.sidecar(name); !exists && len(asset.Sidecars) >= maxSidecars {
+		s.sendEnvelopeError(w, r, http.StatusConflict, "too_many_sidecars", "Too many sidecars")
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.bodyLimit(r, s.config.MaxSidecarSize)))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.rejectUpload(w, r, fileTooLarge(err, tooLarge.Limit))
+			return
+		}
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "read_error", "Error reading file")
+		return
+	}
+	text := bytes.TrimPrefix(data, []byte("\ufeff"))
+	if !utf8.Valid(data) || (path.Ext(name) == ".vtt" && !bytes.HasPrefix(text, []byte("WEBVTT"))) {
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_sidecar", "Sidecar must be UTF-8 text")
+		return
+	}
+
+	// Write beside the final name so a failed scan or update leaves any
+	// previous sidecar in place
+	dst := s.sidecarPath(asset.ID, name)
+	tmp, err := os.CreateTemp(s.sidecarDir(), ".upload-*")
+	if err == nil {
+		_, err = tmp.Write(data)
+		if cerr := tmp.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Printf("Error writing sidecar of %s: %v\n", asset.ID, err)
+		s.sendEnvelopeError(w, r, http.StatusInternalServerError, "storage_error", s.localize(r, "Error saving file: %v", err))
+		return
+	}
+	defer os.Remove(tmp.Name())
+	reason, err := s.scanFile(r.Context(), tmp.Name())
+	if err != nil || reason != "" {
+		s.infof("Sidecar %s of %s rejected: %s %v\n", name, asset.ID, reason, err)
+		s.sendEnvelopeError(w, r, http.StatusUnprocessableEntity, "rejected", "Sidecar rejected by scanner")
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	sc := Sidecar{
+		Name:        name,
+		ContentType: sidecarTypes[path.Ext(name)],
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		AddedAt:     s.now().UTC(),
+	}
+	saved, err := s.assets.update(asset.ID, func(a *Asset) error {
+		if a.State == stateDeleted || a.State == stateQuarantined {
+			return fmt.Errorf("asset is %s", a.State)
+		}
+		if _, exists := a.sidecar(name); !exists && len(a.Sidecars) >= maxSidecars {
+			return fmt.Errorf("too many sidecars")
+		}
+		if err := os.Rename(tmp.Name(), dst); err != nil {
+			return err
+		}
+		a.addSidecar(sc)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error adding sidecar %s to %s: %v\n", name, asset.ID, err)
+		s.sendEnvelopeError(w, r, http.StatusConflict, "conflict", "Sidecar could not be added")
+		return
+	}
+	s.audit(r.Context(), saved.Uploader, auditSidecar, asset.ID, "added "+name)
+	sendEnvelope(w, http.StatusOK, s.originAsset(r, s.assetV1(&saved, "")))
+}
+
+// deleteSidecarHandler removes a sidecar from an asset.
+func (s *Server) deleteSidecarHandler(w http.ResponseWriter, r *http.Request) {
+	asset, ok := s.ownedAsset(w, r, "")
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	saved, err := s.assets.update(asset.ID, func(a *Asset) error {
+		i := slices.IndexFunc(a.Sidecars, func(x Sidecar) bool { return x.Name == name })
+		if i < 0 {
+			return errRecordNotFound
+		}
+		a.Sidecars = slices.Delete(a.Sidecars, i, i+1)
+		return nil
+	})
+	if err != nil {
+		s.sendEnvelopeError(w, r, http.StatusNotFound, "not_found", "File not found")
+		return
+	}
+	s.removeSidecars(Asset{ID: asset.ID, Sidecars: []Sidecar{{Name: name}}})
+	s.audit(r.Context(), saved.Uploader, auditSidecar, asset.ID, "removed "+name)
+	sendEnvelope(w, http.StatusOK, s.originAsset(r, s.assetV1(&saved, "")))
+}
+
+// sidecarHandler serves a sidecar of an asset to whoever may download the
+// asset.  Like thumbnails, sidecars may be fetched any number of times
+// while the asset can be downloaded; they don't count as downloads.
+func (s *Server) sidecarHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	asset, ok := s.assets.get(id)
+	if !validAssetID(id) || !ok {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+	switch {
+	case asset.State == stateQuarantined:
+		s.httpError(w, r, "File unavailable for legal reasons", http.StatusUnavailableForLegalReasons)
+		return
+	case asset.State == stateDeleted, asset.expired(s.now()), asset.usedUp():
+		s.httpError(w, r, "File deleted", http.StatusGone)
+		return
+	case asset.State != stateActive:
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+	sc, ok := asset.sidecar(r.PathValue("name"))
+	if !ok {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+	if !s.hotlinkAllowed(r, id) {
+		s.httpError(w, r, "Hotlinking not allowed", http.StatusForbidden)
+		return
+	}
+	if !s.checkAssetPassword(w, r, asset) || !s.checkRecipient(w, r, asset) {
+		return
+	}
+
+	w.Header().Set("Content-Type", sc.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", s.cacheControl(&asset, s.now()))
+	http.ServeFile(w, r, s.sidecarPath(id, sc.Name))
+}
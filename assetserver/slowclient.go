@@ -0,0 +1,138 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// defaultMaxConnsPerIP caps the connections of a client when the server
+// isn't behind a proxy.
+const defaultMaxConnsPerIP = 64
+
+func (s *Server) validateSlowClientConfig() error {
+	if s.config.ReadHeaderTimeout < 0 || s.config.UploadRateGrace < 0 {
+		return fmt.Errorf("timeouts cannot be negative")
+	}
+	if s.config.ReadHeaderTimeout == 0 {
+		s.config.ReadHeaderTimeout = Duration(10 * time.Second)
+	}
+	if s.config.MinUploadRate == 0 {
+		s.config.MinUploadRate = 1024 // Bytes per second
+	}
+	if s.config.UploadRateGrace == 0 {
+		s.config.UploadRateGrace = Duration(30 * time.Second)
+	}
+	// Behind a proxy every connection comes from the proxy
+	if s.config.MaxConnsPerIP == 0 && !s.config.TrustProxy {
+		s.config.MaxConnsPerIP = defaultMaxConnsPerIP
+	}
+	return nil
+}
+
+// enforceUploadRate aborts an upload whose client, after upload_rate_grace,
+// has sent less than min_upload_rate bytes per second on average while the
+// server waits for more, by expiring the read deadline of its connection.
+// Time the handler spends storing the file doesn't count against the
+// client.  It returns when ctx is done.
+func (s *Server) enforceUploadRate(ctx context.Context, t *transfer, abort func()) {
+	grace := time.Duration(s.config.UploadRateGrace)
+	ticker := time.NewTicker(min(grace, time.Second))
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		elapsed := time.Since(start)
+		if elapsed < grace || t.received.Load() || !t.reading.Load() {
+			continue
+		}
+		n := t.bytes.Load()
+		if float64(n) >= float64(s.config.MinUploadRate)*elapsed.Seconds() {
+			continue
+		}
+		s.infof("Aborting upload from %s: %d bytes in %v is below min_upload_rate\n",
+			t.info.Client, n, elapsed.Round(time.Second))
+		abort()
+		return
+	}
+}
+
+// limitConns caps the connections of a client on the SFTP and SMTP
+// listeners at max_conns_per_ip.  No HTTP proxy stands in front of them,
+// so the cap applies even with trust_proxy, unless turned off with -1.
+func (s *Server) limitConns(ln net.Listener) net.Listener {
+	max := s.config.MaxConnsPerIP
+	if max == 0 {
+		max = defaultMaxConnsPerIP
+	}
+	if max < 0 {
+		return ln
+	}
+	return newConnLimitListener(ln, max)
+}
+
+// connLimitListener closes the connections of a client beyond max as soon
+// as they are accepted, so a single client can't hold every handler.
+type connLimitListener struct {
+	net.Listener
+	max int
+
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+func newConnLimitListener(l net.Listener, max int) *connLimitListener {
+	return &connLimitListener{Listener: l, max: max, conns: make(map[string]int)}
+}
+
+func (l *connLimitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+		if err != nil {
+			host = c.RemoteAddr().String()
+		}
+		l.mu.Lock()
+		if l.conns[host] >= l.max {
+			l.mu.Unlock()
+			c.Close()
+			continue
+		}
+		l.conns[host]++
+		l.mu.Unlock()
+		return &limitedConn{Conn: c, release: func() { l.release(host) }}, nil
+	}
+}
+
+func (l *connLimitListener) release(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[host]--; l.conns[host] <= 0 {
+		delete(l.conns, host)
+	}
+}
+
+// limitedConn gives back its slot when closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
@@ -0,0 +1,309 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	netsmtp "net/smtp"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-smtp"
+)
+
+const (
+	// smtpMaxAttachments is how many attachments of a message are stored.
+	// A message may be as large as that many files of max_file_size,
+	// base64 encoded, plus its text.
+	smtpMaxAttachments = 5
+
+	// minSMTPSecretLength is the shortest smtp_secret accepted.
+	minSMTPSecretLength = 16
+)
+
+// validSMTPSecret reports whether a secret is long enough and may stand in
+// the local part of an address without quoting.
+func validSMTPSecret(secret string) bool {
+	if len(secret) < minSMTPSecretLength {
+		return false
+	}
+	for _, c := range secret {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) validateSMTPConfig() error {
+	if s.config.SMTPListen == "" {
+		return nil
+	}
+	local, _, ok := strings.Cut(s.config.SMTPAddress, "@")
+	if !ok || local == "" || strings.Contains(local, "+") {
+		return fmt.Errorf("smtp_address must be an address without a plus in its local part")
+	}
+	if !validSMTPSecret(s.config.SMTPSecret) {
+		return fmt.Errorf("smtp_secret must be at least %d letters, digits, dashes or underscores with smtp_listen", minSMTPSecretLength)
+	}
+	if len(s.config.SMTPSenders) == 0 {
+		return fmt.Errorf("smtp_senders cannot be empty with smtp_listen")
+	}
+	if s.config.SMTPRelay == "" {
+		s.config.SMTPRelay = "localhost:25"
+	}
+	return nil
+}
+
+// smtpSenderAllowed reports whether smtp_senders lists an address, either
+// in full or by its @domain.
+func (s *Server) smtpSenderAllowed(from string) bool {
+	from = strings.ToLower(from)
+	for _, sender := range s.config.SMTPSenders {
+		sender = strings.ToLower(sender)
+		if from == sender || (strings.HasPrefix(sender, "@") && strings.HasSuffix(from, sender)) {
+			return true
+		}
+	}
+	return false
+}
+
+// smtpRecipientAllowed reports whether mail is addressed to smtp_address
+// with smtp_secret after a plus in its local part, as in
+// upload+secret@assets.example.com.  Sender addresses are easily forged,
+// so knowing the secret is what lets mail in.
+func (s *Server) smtpRecipientAllowed(to string) bool {
+	local, domain, _ := strings.Cut(s.config.SMTPAddress, "@")
+	at := strings.LastIndex(to, "@")
+	if at < 0 || !strings.EqualFold(to[at+1:], domain) {
+		return false
+	}
+	base, secret, ok := strings.Cut(to[:at], "+")
+	return ok && strings.EqualFold(base, local) &&
+		subtle.ConstantTimeCompare([]byte(secret), []byte(s.config.SMTPSecret)) == 1
+}
+
+// smtpServer is the SMTP listener ingesting the attachments of mail sent
+// to smtp_address.
+func (s *Server) smtpServer(ctx context.Context) *smtp.Server {
+	server := smtp.NewServer(smtp.BackendFunc(func(c *smtp.Conn) (smtp.Session, error) {
+		return &smtpSession{s: s, ctx: ctx}, nil
+	}))
+	server.Addr = s.config.SMTPListen
+	server.Domain = s.config.Domain
+	server.MaxRecipients = 1
+	server.MaxMessageBytes = smtpMaxAttachments*(s.config.MaxFileSize*4/3) + 1<<20
+	server.ReadTimeout = time.Duration(s.config.ReadTimeout)
+	server.WriteTimeout = time.Duration(s.config.UploadTimeout)
+	return server
+}
+
+// serveSMTP runs the SMTP listener until ctx is done.
+func (s *Server) serveSMTP(ctx context.Context) error {
+	server := s.smtpServer(ctx)
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	ln, err := net.Listen("tcp", s.config.SMTPListen)
+	if err != nil {
+		return err
+	}
+	s.infof("SMTP listener starting on %s for %s...\n", s.config.SMTPListen, s.config.SMTPAddress)
+	err = server.Serve(s.limitConns(ln))
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// smtpSession receives one message at a time.
+type smtpSession struct {
+	s    *Server
+	ctx  context.Context
+	from string
+}
+
+func (m *smtpSession) Reset() {
+	m.from = ""
+}
+
+func (m *smtpSession) Logout() error {
+	return nil
+}
+
+func (m *smtpSession) Mail(from string, opts *smtp.MailOptions) error {
+	if !m.s.smtpSenderAllowed(from) {
+		return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 7, 1}, Message: "Sender not allowed"}
+	}
+	m.from = from
+	return nil
+}
+
+func (m *smtpSession) Rcpt(to string, opts *smtp.RcptOptions) error {
+	if !m.s.smtpRecipientAllowed(to) {
+		return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 1, 1}, Message: "No such recipient"}
+	}
+	return nil
+}
+
+// Data stores the attachments of a message as they are read and replies
+// to its sender with their URLs, or why they were refused.
+func (m *smtpSession) Data(r io.Reader) error {
+	defer io.Copy(io.Discard, r)
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return &smtp.SMTPError{Code: 554, EnhancedCode: smtp.EnhancedCode{5, 6, 0}, Message: "Malformed message"}
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+
+	var metadata string
+	if subject != "" {
+		meta, _ := json.Marshal(map[string]string{"subject": subject})
+		metadata = string(meta)
+	}
+
+	s := m.s
+	actor := "smtp:" + strings.ToLower(m.from)
+	var report strings.Builder
+	found := 0
+	err = mailAttachments(msg, func(a mailAttachment) bool {
+		if found == smtpMaxAttachments {
+			fmt.Fprintf(&report, "Only the first %d attachments were stored.\n", smtpMaxAttachments)
+			return false
+		}
+		found++
+		ctx, cancel := context.WithTimeout(m.ctx, time.Duration(s.config.UploadTimeout))
+		saved, uerr := s.putFile(ctx, actor, File{
+			Name:        a.name,
+			ContentType: a.contentType,
+			Metadata:    metadata,
+			Data:        a.data,
+		})
+		cancel()
+		if uerr != nil {
+			s.infof("Rejected mailed file %s from %s: %s\n", a.name, m.from, uerr.message)
+			fmt.Fprintf(&report, "%s: not stored: %s\n", a.name, uerr.message)
+			return true
+		}
+		s.infof("Stored mailed file %s from %s as %s\n", a.name, m.from, saved.ID)
+		fmt.Fprintf(&report, "%s: %s\n  Delete: %s\n", a.name, saved.URL, saved.DeleteURL)
+		return true
+	})
+	switch {
+	case err != nil && found == 0:
+		return &smtp.SMTPError{Code: 554, EnhancedCode: smtp.EnhancedCode{5, 6, 0}, Message: "Malformed message"}
+	case err != nil:
+		report.WriteString("The rest of the message could not be read.\n")
+	case found == 0:
+		report.WriteString("The message had no attachments to store.\n")
+	}
+
+	reply := mailReply(s.config.SMTPAddress, m.from, subject, msg.Header.Get("Message-Id"), report.String())
+	to := m.from
+	s.background.Go(func() {
+		if err := s.relayMail(to, reply); err != nil {
+			fmt.Printf("Error sending upload reply to %s: %v\n", to, err)
+		}
+	})
+	return nil
+}
+
+// relayMail sends a message through smtp_relay, using STARTTLS if the
+// relay offers it.
+func (s *Server) relayMail(to string, msg []byte) error {
+	return netsmtp.SendMail(s.config.SMTPRelay, nil, s.config.SMTPAddress, []string{to}, msg)
+}
+
+// mailAttachment is a file attached to a message, read from data.
+type mailAttachment struct {
+	name        string
+	contentType string
+	data        io.Reader
+}
+
+// mailAttachments calls store with each part of a message that carries a
+// file name, looking into nested multipart parts, as they are read.  It
+// stops at the first part store returns false for, leaving the rest
+// unread.
+func mailAttachments(msg *mail.Message, store func(mailAttachment) bool) error {
+	_, err := partAttachments(msg.Header, msg.Body, store)
+	return err
+}
+
+// mailHeader is what partAttachments needs of a message or part header.
+type mailHeader interface {
+	Get(key string) string
+}
+
+// partAttachments passes the attachments of a part to store, reporting
+// whether to go on with the parts after it.
+func partAttachments(header mailHeader, body io.Reader, store func(mailAttachment) bool) (bool, error) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return true, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			if more, err := partAttachments(part.Header, part, store); !more || err != nil {
+				return false, err
+			}
+		}
+	}
+
+	name := params["name"]
+	if _, dparams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil && dparams["filename"] != "" {
+		name = dparams["filename"]
+	}
+	if name == "" {
+		return true, nil
+	}
+	if decoded, err := new(mime.WordDecoder).DecodeHeader(name); err == nil {
+		name = decoded
+	}
+	// multipart.Reader already decodes quoted-printable parts
+	if strings.EqualFold(header.Get("Content-Transfer-Encoding"), "base64") {
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	}
+	return store(mailAttachment{name: name, contentType: mediaType, data: body}), nil
+}
+
+// mailReply builds the reply to a message.
+func mailReply(from, to, subject, inReplyTo, body string) []byte {
+	if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+		subject = strings.TrimSpace("Re: " + subject)
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if inReplyTo != "" {
+		fmt.Fprintf(&b, "In-Reply-To: %s\r\n", inReplyTo)
+	}
+	b.WriteString("Auto-Submitted: auto-replied\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return b.Bytes()
+}
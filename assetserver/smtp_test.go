@@ -0,0 +1,217 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"github.com/karamble/braibot-assetserver/internal/testserver"
+)
+
+// relaySession collects the messages sent through a test relay.
+type relaySession struct {
+	messages chan string
+}
+
+func (r relaySession) Reset()        {}
+func (r relaySession) Logout() error { return nil }
+
+func (r relaySession) Mail(from string, opts *smtp.MailOptions) error { return nil }
+func (r relaySession) Rcpt(to string, opts *smtp.RcptOptions) error   { return nil }
+
+func (r relaySession) Data(data io.Reader) error {
+	msg, err := io.ReadAll(data)
+	r.messages <- string(msg)
+	return err
+}
+
+// sendMail sends a message without TLS, which the test servers don't
+// offer.
+func sendMail(addr, from, to, msg string) error {
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.SendMail(from, []string{to}, strings.NewReader(msg))
+}
+
+// listenSMTP serves an SMTP server on a loopback port and returns its address.
+func listenSMTP(t *testing.T, server *smtp.Server) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(lis)
+	t.Cleanup(func() { server.Close() })
+	return lis.Addr().String()
+}
+
+func TestSMTPIngest(t *testing.T) {
+	replies := make(chan string, 1)
+	relay := smtp.NewServer(smtp.BackendFunc(func(c *smtp.Conn) (smtp.Session, error) {
+		return relaySession{replies}, nil
+	}))
+	relay.Domain = "relay.example.com"
+	relayAddr := listenSMTP(t, relay)
+
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.SMTPListen = "127.0.0.1:0"
+		cfg.SMTPAddress = "upload@assets.example.com"
+		cfg.SMTPSecret = "n0t-so-s3cret_key"
+		cfg.SMTPSenders = []string{"@bot.example.com"}
+		cfg.SMTPRelay = relayAddr
+	})
+	addr := listenSMTP(t, s.srv.smtpServer(context.Background()))
+
+	message := strings.ReplaceAll(`From: ci@bot.example.com
+To: upload+n0t-so-s3cret_key@assets.example.com
+Subject: Nightly chart
+Message-Id: <1@bot.example.com>
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary=b
+
+--b
+Content-Type: text/plain
+
+See attached.
+--b
+Content-Type: image/png
+Content-Disposition: attachment; filename="chart.png"
+Content-Transfer-Encoding: base64
+
+iVBORw0KGgoAAAANSUhEUg==
+--b
+Content-Type: text/plain
+Content-Disposition: attachment; filename="notes.txt"
+
+hello
+--b--
+`, "\n", "\r\n")
+
+	// Listed senders are easily forged, so the secret is needed too
+	for _, tc := range []struct{ from, to string }{
+		{"mallory@evil.example.com", "upload+n0t-so-s3cret_key@assets.example.com"},
+		{"ci@bot.example.com", "upload@assets.example.com"},
+		{"ci@bot.example.com", "upload+guess@assets.example.com"},
+		{"ci@bot.example.com", "other+n0t-so-s3cret_key@assets.example.com"},
+	} {
+		if err := sendMail(addr, tc.from, tc.to, message); err == nil {
+			t.Fatalf("mail from %s to %s was accepted", tc.from, tc.to)
+		}
+	}
+	if err := sendMail(addr, "ci@bot.example.com", "Upload+n0t-so-s3cret_key@Assets.example.com", message); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	var reply string
+	select {
+	case reply = <-replies:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply")
+	}
+	if !strings.Contains(reply, "Subject: Re: Nightly chart") || !strings.Contains(reply, "In-Reply-To: <1@bot.example.com>") {
+		t.Fatalf("reply headers:\n%s", reply)
+	}
+	if !strings.Contains(reply, "chart.png: https://assets.example.com/") || !strings.Contains(reply, "notes.txt: not stored: File type not allowed") {
+		t.Fatalf("reply body:\n%s", reply)
+	}
+
+	var stored []Asset
+	for _, asset := range s.srv.assets.list() {
+		if asset.Uploader == "smtp:ci@bot.example.com" {
+			stored = append(stored, asset)
+		}
+	}
+	if len(stored) != 1 || stored[0].OriginalName != "chart.png" || stored[0].Metadata["subject"] != "Nightly chart" {
+		t.Fatalf("stored %+v", stored)
+	}
+}
+
+func TestSMTPAttachmentLimit(t *testing.T) {
+	replies := make(chan string, 1)
+	relay := smtp.NewServer(smtp.BackendFunc(func(c *smtp.Conn) (smtp.Session, error) {
+		return relaySession{replies}, nil
+	}))
+	relay.Domain = "relay.example.com"
+	relayAddr := listenSMTP(t, relay)
+
+	s := newTestServer(t, func(cfg *Config) {
+		cfg.SMTPListen = "127.0.0.1:0"
+		cfg.SMTPAddress = "upload@assets.example.com"
+		cfg.SMTPSecret = "n0t-so-s3cret_key"
+		cfg.SMTPSenders = []string{"ci@bot.example.com"}
+		cfg.SMTPRelay = relayAddr
+	})
+	addr := listenSMTP(t, s.srv.smtpServer(context.Background()))
+
+	var message strings.Builder
+	message.WriteString("From: ci@bot.example.com\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n")
+	for i := range smtpMaxAttachments + 2 {
+		fmt.Fprintf(&message, "--b\r\nContent-Type: image/png\r\nContent-Disposition: attachment; filename=\"%d.png\"\r\n"+
+			"Content-Transfer-Encoding: base64\r\n\r\niVBORw0KGgoAAAANSUhEUg==\r\n", i)
+	}
+	message.WriteString("--b--\r\n")
+	if err := sendMail(addr, "ci@bot.example.com", "upload+n0t-so-s3cret_key@assets.example.com", message.String()); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+
+	var reply string
+	select {
+	case reply = <-replies:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reply")
+	}
+	if !strings.Contains(reply, fmt.Sprintf("Only the first %d attachments were stored.", smtpMaxAttachments)) ||
+		strings.Contains(reply, fmt.Sprintf("%d.png", smtpMaxAttachments)) {
+		t.Fatalf("reply body:\n%s", reply)
+	}
+	if n := len(s.srv.assets.list()); n != smtpMaxAttachments {
+		t.Fatalf("%d assets stored, want %d", n, smtpMaxAttachments)
+	}
+}
+
+func TestSMTPConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name, address, secret string
+		ok                    bool
+	}{
+		{"valid", "upload@assets.example.com", "n0t-so-s3cret_key", true},
+		{"no secret", "upload@assets.example.com", "", false},
+		{"short secret", "upload@assets.example.com", "short", false},
+		{"secret with an at", "upload@assets.example.com", "n0t-so-s3cret@key", false},
+		{"plus in the address", "up+load@assets.example.com", "n0t-so-s3cret_key", false},
+		{"no address", "", "n0t-so-s3cret_key", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dirs := testserver.TempDirs(t)
+			srv, err := New(Config{
+				MaxFileSize: 1 << 20,
+				APIKey:      testAPIKey,
+				UploadDir:   dirs.Upload,
+				DataDir:     dirs.Data,
+				Domain:      "assets.example.com",
+				SMTPListen:  "127.0.0.1:0",
+				SMTPAddress: tc.address,
+				SMTPSecret:  tc.secret,
+				SMTPSenders: []string{"ci@bot.example.com"},
+			})
+			if err == nil {
+				srv.Close()
+			}
+			if (err == nil) != tc.ok {
+				t.Fatalf("New: %v, want ok %v", err, tc.ok)
+			}
+		})
+	}
+}
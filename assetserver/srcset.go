@@ -0,0 +1,106 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"strconv"
+
+	"golang.org/x/image/draw"
+)
+
+// srcsetQuality is the JPEG quality of resized images.  They are shown in
+// place of the original, so it is higher than that of thumbnails.
+const srcsetQuality = 85
+
+func (s *Server) validateSrcsetConfig() error {
+	for _, width := range s.config.SrcsetWidths {
+		if width <= 0 {
+			return fmt.Errorf("srcset_widths must be positive")
+		}
+	}
+	slices.Sort(s.config.SrcsetWidths)
+	s.config.SrcsetWidths = slices.Compact(s.config.SrcsetWidths)
+	return nil
+}
+
+// srcsetName is the name of the variant of an image resized to a width,
+// which is also its width descriptor in a srcset, e.g. "512w".
+func srcsetName(width int) string {
+	return strconv.Itoa(width) + "w"
+}
+
+// resizeImage returns variants of an image scaled down to each width in
+// srcset_widths narrower than the image, and the dimensions of the image.
+// Opaque images are resized to JPEG and others to PNG.
+func (s *Server) resizeImage(data []byte) ([]variantFile, image.Config, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, cfg, fmt.Errorf("error reading image header: %v", err)
+	}
+	if cfg.Width*cfg.Height > maxThumbnailSourcePixels {
+		return nil, cfg, fmt.Errorf("image too large to resize: %dx%d", cfg.Width, cfg.Height)
+	}
+	if cfg.Width <= s.config.SrcsetWidths[0] {
+		return nil, cfg, nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, cfg, fmt.Errorf("error decoding image: %v", err)
+	}
+
+	o, ok := src.(interface{ Opaque() bool })
+	opaque := ok && o.Opaque()
+	var variants []variantFile
+	b := src.Bounds()
+	for _, width := range s.config.SrcsetWidths {
+		if width >= b.Dx() {
+			break
+		}
+		dst := image.NewRGBA(image.Rect(0, 0, width, max(1, b.Dy()*width/b.Dx())))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+
+		var buf bytes.Buffer
+		contentType := "image/png"
+		if opaque {
+			contentType = "image/jpeg"
+			err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: srcsetQuality})
+		} else {
+			err = png.Encode(&buf, dst)
+		}
+		if err != nil {
+			return variants, cfg, err
+		}
+		variants = append(variants, variantFile{
+			name:        srcsetName(width),
+			contentType: contentType,
+			data:        buf.Bytes(),
+			width:       width,
+			height:      dst.Bounds().Dy(),
+		})
+	}
+	return variants, cfg, nil
+}
+
+// srcset maps the width descriptors of an image's resized variants and of
+// the image itself to their URLs, or is nil for assets without any.
+func (s *Server) srcset(a *Asset) map[string]string {
+	var set map[string]string
+	for _, v := range a.Variants {
+		if v.Width == 0 || v.Name != srcsetName(v.Width) {
+			continue
+		}
+		if set == nil {
+			set = map[string]string{srcsetName(a.Width): s.downloadURL(a.ID)}
+		}
+		set[v.Name] = s.variantURL(a.ID, v.Name)
+	}
+	return set
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/karamble/braibot-assetserver/internal/upload"
+)
+
+// errStagingFull is returned when an upload doesn't fit in what is left of
+// staging_max_size.
+var errStagingFull = errors.New("staging area full")
+
+// stagingDir is where uploads are written while they come in.
+func (s *Server) stagingDir() string {
+	if s.config.StagingDir != "" {
+		return s.config.StagingDir
+	}
+	return s.config.UploadDir
+}
+
+// cleanStaging removes uploads, dry runs and multipart temporary files left
+// in the staging area by a crash.  Only the process serving uploads may call it,
+// not commands opening the server alongside a running one.
+func (s *Server) cleanStaging() error {
+	for _, pattern := range []string{".upload-*", ".dry-run-*", ".multipart-*"} {
+		files, err := filepath.Glob(filepath.Join(s.stagingDir(), pattern))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := os.Remove(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// stagedFile is an upload written to the staging area.
+type stagedFile struct {
+	path   string
+	size   int64
+	sha256 string
+	used   *atomic.Int64
+}
+
+// stagingWriter writes a staged file, hashing it and counting it in used,
+// which may not exceed max bytes if max is set.
+type stagingWriter struct {
+	f    *os.File
+	hash hash.Hash
+	n    int64
+	used *atomic.Int64
+	max  int64
+}
+
+func (w *stagingWriter) Write(p []byte) (int, error) {
+	size := int64(len(p))
+	if used := w.used.Add(size); w.max > 0 && used > w.max {
+		w.used.Add(-size)
+		return 0, errStagingFull
+	}
+	n, err := w.f.Write(p)
+	w.used.Add(int64(n) - size)
+	w.n += int64(n)
+	w.hash.Write(p[:n])
+	return n, err
+}
+
+// contextReader stops reading once its context is done, so an upload whose
+// deadline passed doesn't keep filling the staging area.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// errUploadRead wraps the errors of reading an upload as it is stored,
+// which are the client's rather than those of the staging area.
+var errUploadRead = errors.New("error reading upload")
+
+// uploadReader reads an upload of at most max bytes as it is stored,
+// failing with upload.ErrTooLarge once there are more.
+type uploadReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.n += int64(n); r.n > r.max {
+		return n, upload.ErrTooLarge
+	}
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %w", errUploadRead, err)
+	}
+	return n, err
+}
+
+// stageUpload writes an upload to the staging area.  The staged file must be
+// committed or discarded.
+func (s *Server) stageUpload(ctx context.Context, data io.Reader) (*stagedFile, error) {
+	f, err := os.CreateTemp(s.stagingDir(), ".upload-*")
+	if err != nil {
+		return nil, err
+	}
+	w := &stagingWriter{f: f, hash: sha256.New(), used: &s.stagingUsed, max: s.config.StagingMaxSize}
+	_, err = io.Copy(w, contextReader{ctx, data})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	staged := &stagedFile{path: f.Name(), size: w.n, sha256: hex.EncodeToString(w.hash.Sum(nil)), used: &s.stagingUsed}
+	if err != nil {
+		staged.discard()
+		return nil, err
+	}
+	return staged, nil
+}
+
+// commit moves a staged file to its place in upload_dir.  A staging area on
+// another file system, such as a tmpfs, is copied from.
+func (s *stagedFile) commit(path string) error {
+	defer s.discard()
+	if err := os.Rename(s.path, path); err == nil {
+		return nil
+	}
+
+	src, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error moving upload from staging: %v", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// discard removes a staged file and releases its space.
+func (s *stagedFile) discard() {
+	if s.path == "" {
+		return
+	}
+	os.Remove(s.path)
+	s.used.Add(-s.size)
+	s.path = ""
+}
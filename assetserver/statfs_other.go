@@ -0,0 +1,14 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build !(linux || darwin || freebsd)
+
+package assetserver
+
+import "errors"
+
+// statFilesystem is not supported on this platform.
+func statFilesystem(path string) (FilesystemStats, error) {
+	return FilesystemStats{}, errors.New("file system statistics not supported")
+}
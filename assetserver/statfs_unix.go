@@ -0,0 +1,27 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build linux || darwin || freebsd
+
+package assetserver
+
+import "syscall"
+
+// statFilesystem reports the space and inodes of the file system holding
+// path.
+func statFilesystem(path string) (FilesystemStats, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return FilesystemStats{}, err
+	}
+	bsize := uint64(st.Bsize)
+	return FilesystemStats{
+		Path:       path,
+		Size:       uint64(st.Blocks) * bsize,
+		Free:       uint64(st.Bfree) * bsize,
+		Available:  uint64(st.Bavail) * bsize,
+		Inodes:     uint64(st.Files),
+		InodesFree: uint64(st.Ffree),
+	}, nil
+}
@@ -0,0 +1,167 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// statsMaxAge is how long asset statistics are reused while no record
+	// changes, bounding how far the age histogram lags behind
+	statsMaxAge = time.Minute
+
+	// statsLargest is how many of the largest assets are listed
+	statsLargest = 10
+)
+
+// statsAgeBuckets are the upper bounds of the age histogram.  Older assets
+// fall in a last, unbounded bucket.
+var statsAgeBuckets = []struct {
+	name string
+	age  time.Duration
+}{
+	{"1h", time.Hour},
+	{"1d", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+	{"365d", 365 * 24 * time.Hour},
+}
+
+// StorageStats is the payload of /admin/stats: the file systems holding
+// upload_dir and data_dir, and what the stored assets take up by type,
+// by age and the largest of them.  Assets count while their file is kept,
+// including in the trash; those in the cold store are counted apart.
+type StorageStats struct {
+	Filesystems []FilesystemStats    `json:"filesystems"`
+	Assets      int                  `json:"assets"`
+	Bytes       int64                `json:"bytes"`
+	ColdAssets  int                  `json:"cold_assets"`
+	ColdBytes   int64                `json:"cold_bytes"`
+	Types       map[string]TypeStats `json:"types"`
+	Ages        []AgeStats           `json:"ages"`
+	Largest     []LargestAsset       `json:"largest"`
+	ComputedAt  time.Time            `json:"computed_at"`
+}
+
+// FilesystemStats is the space and inodes of a file system, in bytes and
+// inodes.  Available is what non-root users may still use.
+type FilesystemStats struct {
+	Path       string `json:"path"`
+	Size       uint64 `json:"size"`
+	Free       uint64 `json:"free"`
+	Available  uint64 `json:"available"`
+	Inodes     uint64 `json:"inodes"`
+	InodesFree uint64 `json:"inodes_free"`
+	Error      string `json:"error,omitempty"`
+}
+
+// TypeStats counts the assets of a content type and their bytes,
+// variants included.
+type TypeStats struct {
+	Count int   `json:"count"`
+	Bytes int64 `json:"bytes"`
+}
+
+// AgeStats counts the assets uploaded within MaxAge, and not in an earlier
+// bucket.  The last bucket has no MaxAge.
+type AgeStats struct {
+	MaxAge string `json:"max_age,omitempty"`
+	Count  int    `json:"count"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// LargestAsset is one of the largest stored assets.
+type LargestAsset struct {
+	ID          string    `json:"id"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+}
+
+// assetStats caches the statistics computed from the asset records, which
+// are only computed again once the records changed or statsMaxAge passed.
+type assetStats struct {
+	mu         sync.Mutex
+	generation uint64
+	stats      *StorageStats
+}
+
+// storageStats returns the statistics of the stored assets.  They are
+// computed from the records, never by walking upload_dir, and reused
+// while no record changes.
+func (s *Server) storageStats() StorageStats {
+	s.stats.mu.Lock()
+	defer s.stats.mu.Unlock()
+	now := s.now().UTC()
+	gen := s.assets.currentGeneration()
+	if st := s.stats.stats; st != nil && s.stats.generation == gen && now.Sub(st.ComputedAt) < statsMaxAge {
+		return *st
+	}
+
+	st := &StorageStats{
+		Types:      make(map[string]TypeStats),
+		Ages:       make([]AgeStats, len(statsAgeBuckets)+1),
+		ComputedAt: now,
+	}
+	for i, b := range statsAgeBuckets {
+		st.Ages[i].MaxAge = b.name
+	}
+	for _, asset := range s.assets.list() {
+		if asset.State == stateDeleted && asset.TrashedAt.IsZero() {
+			continue
+		}
+		size := asset.Size
+		for _, v := range asset.Variants {
+			size += v.Size
+		}
+		if asset.Tier == tierCold {
+			st.ColdAssets++
+			st.ColdBytes += size
+			continue
+		}
+		st.Assets++
+		st.Bytes += size
+		t := st.Types[asset.ContentType]
+		t.Count++
+		t.Bytes += size
+		st.Types[asset.ContentType] = t
+
+		i := 0
+		for i < len(statsAgeBuckets) && now.Sub(asset.UploadedAt) > statsAgeBuckets[i].age {
+			i++
+		}
+		st.Ages[i].Count++
+		st.Ages[i].Bytes += size
+
+		st.Largest = append(st.Largest, LargestAsset{asset.ID, asset.Size, asset.ContentType, asset.UploadedAt})
+	}
+	slices.SortFunc(st.Largest, func(a, b LargestAsset) int {
+		if c := cmp.Compare(b.Size, a.Size); c != 0 {
+			return c
+		}
+		return a.UploadedAt.Compare(b.UploadedAt)
+	})
+	st.Largest = st.Largest[:min(len(st.Largest), statsLargest)]
+
+	s.stats.generation, s.stats.stats = gen, st
+	return *st
+}
+
+func (s *Server) adminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	st := s.storageStats()
+	for _, dir := range []string{s.config.UploadDir, s.config.DataDir} {
+		fs, err := statFilesystem(dir)
+		if err != nil {
+			fs = FilesystemStats{Path: dir, Error: err.Error()}
+		}
+		st.Filesystems = append(st.Filesystems, fs)
+	}
+	writeJSON(w, http.StatusOK, st)
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// defaultMemoryStorageSize is max_storage_size with the memory
+// storage_backend when none is configured.
+const defaultMemoryStorageSize = 256 << 20
+
+// errStorageFull is returned when an upload doesn't fit in what is left of
+// max_storage_size.
+var errStorageFull = errors.New("storage full")
+
+// validateStorageConfig checks storage_backend and max_storage_size.  The
+// memory backend keeps upload_dir and data_dir in a directory of their own
+// on /dev/shm, named here so the paths in them can be filled in, created by
+// open and removed again by Close.
+func (s *Server) validateStorageConfig() error {
+	if s.config.MaxStorageSize < 0 {
+		return fmt.Errorf("max_storage_size cannot be negative")
+	}
+	switch s.config.StorageBackend {
+	case "", "disk":
+		s.config.StorageBackend = "disk"
+		return nil
+	case "memory":
+	default:
+		return fmt.Errorf("unknown storage_backend %q", s.config.StorageBackend)
+	}
+
+	if s.config.UploadDir != "" || s.config.DataDir != "" {
+		return fmt.Errorf("upload_dir and data_dir cannot be set with the memory storage_backend")
+	}
+	root, err := memoryRoot()
+	if err != nil {
+		return err
+	}
+	id, err := randomID()
+	if err != nil {
+		return err
+	}
+	s.memoryDir = filepath.Join(root, "assetserver-"+id)
+	s.config.UploadDir = filepath.Join(s.memoryDir, "uploads")
+	s.config.DataDir = filepath.Join(s.memoryDir, "data")
+	if s.config.MaxStorageSize == 0 {
+		s.config.MaxStorageSize = defaultMemoryStorageSize
+	}
+	return nil
+}
+
+// memoryRoot is the RAM backed file system of the memory storage_backend,
+// /dev/shm.  Systems without one can't use the backend, since a directory
+// on disk would not keep what it promises.
+func memoryRoot() (string, error) {
+	if fi, err := os.Stat("/dev/shm"); err != nil || !fi.IsDir() {
+		return "", fmt.Errorf("the memory storage_backend needs a tmpfs on /dev/shm")
+	}
+	return "/dev/shm", nil
+}
+
+// openMemoryStorage creates the directory of the memory storage_backend,
+// which no one else may read.
+func (s *Server) openMemoryStorage() error {
+	if s.memoryDir == "" {
+		return nil
+	}
+	if err := os.Mkdir(s.memoryDir, 0700); err != nil {
+		// Never remove a directory this server didn't create
+		s.memoryDir = ""
+		return err
+	}
+	return nil
+}
+
+// removeMemoryStorage deletes everything the memory storage_backend stored.
+func (s *Server) removeMemoryStorage() error {
+	if s.memoryDir == "" {
+		return nil
+	}
+	return os.RemoveAll(s.memoryDir)
+}
+
+// storageUsage adds up the bytes of assets counted against
+// max_storage_size.  Files of deleted assets, unless in the trash, and of
+// assets in the cold store take no space.
+func (s *Server) storageUsage() int64 {
+	var used int64
+	for _, asset := range s.assets.list() {
+		if (asset.State == stateDeleted && asset.TrashedAt.IsZero()) || asset.Tier == "cold" {
+			continue
+		}
+		used += asset.storedSize()
+		for _, v := range asset.Variants {
+			used += v.Size
+		}
+		for _, v := range asset.Versions {
+			used += v.storedSize()
+		}
+	}
+	return used
+}
+
+// reserveStorage counts size bytes about to be stored against
+// max_storage_size until the returned release is called, by which time the
+// asset record should carry its size.
+func (s *Server) reserveStorage(size int64) (release func(), err error) {
+	if s.config.MaxStorageSize <= 0 {
+		return func() {}, nil
+	}
+	s.storageMu.Lock()
+	defer s.storageMu.Unlock()
+	used := s.storageReserved + s.storageUsage()
+	if used+size > s.config.MaxStorageSize {
+		return nil, fmt.Errorf("%w: %d of %d bytes in use", errStorageFull, used, s.config.MaxStorageSize)
+	}
+	s.storageReserved += size
+	return func() {
+		s.storageMu.Lock()
+		s.storageReserved -= size
+		s.storageMu.Unlock()
+	}, nil
+}
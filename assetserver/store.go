@@ -0,0 +1,247 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	errRecordNotFound = errors.New("record not found")
+	errRecordExists   = errors.New("record already exists")
+)
+
+// recordStore is a map of records keyed by ID that is persisted to a single
+// JSON file.  The whole file is rewritten on every change, which is fine for
+// the number of records this server keeps around.
+//
+// Other processes on the host, such as the put command, may change the file
+// while the server runs.  Every operation holds an exclusive lock on a
+// companion .lock file and reloads the records if the file changed since
+// they were last read.
+type recordStore[T any] struct {
+	mu      sync.Mutex
+	path    string
+	lock    *os.File
+	loaded  os.FileInfo
+	records map[string]T
+
+	// generation counts the changes to records, by any process, so data
+	// derived from them can be cached
+	generation uint64
+}
+
+func openRecordStore[T any](path string) (*recordStore[T], error) {
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s := &recordStore[T]{
+		path:    path,
+		lock:    lock,
+		records: make(map[string]T),
+	}
+
+	if err := s.acquire(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	defer s.release()
+	return s, nil
+}
+
+// acquire locks the store against other goroutines and processes and
+// brings the records up to date with the file.
+func (s *recordStore[T]) acquire() error {
+	s.mu.Lock()
+	if err := lockFile(s.lock); err != nil {
+		s.mu.Unlock()
+		return fmt.Errorf("error locking %s: %v", s.path, err)
+	}
+	if err := s.reloadLocked(); err != nil {
+		s.release()
+		return err
+	}
+	return nil
+}
+
+func (s *recordStore[T]) release() {
+	unlockFile(s.lock)
+	s.mu.Unlock()
+}
+
+// close releases the lock file of a store, which may be nil if it was
+// never opened.
+func (s *recordStore[T]) close() error {
+	if s == nil {
+		return nil
+	}
+	return s.lock.Close()
+}
+
+func (s *recordStore[T]) reloadLocked() error {
+	fi, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.loaded != nil && os.SameFile(fi, s.loaded) && fi.ModTime().Equal(s.loaded.ModTime()) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	records := make(map[string]T)
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("error parsing %s: %v", s.path, err)
+	}
+	s.records = records
+	s.loaded = fi
+	s.generation++
+	return nil
+}
+
+func (s *recordStore[T]) get(id string) (T, bool) {
+	if err := s.acquire(); err != nil {
+		fmt.Printf("Error reading records: %v\n", err)
+		var zero T
+		return zero, false
+	}
+	defer s.release()
+	rec, ok := s.records[id]
+	return rec, ok
+}
+
+func (s *recordStore[T]) put(id string, rec T) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.release()
+	s.records[id] = rec
+	return s.saveLocked()
+}
+
+// insert adds a record, failing if one with the same ID exists.
+func (s *recordStore[T]) insert(id string, rec T) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.release()
+	if _, ok := s.records[id]; ok {
+		return errRecordExists
+	}
+	s.records[id] = rec
+	return s.saveLocked()
+}
+
+// update applies fn to the record with the given ID and persists the result.
+// If fn returns an error the record is left unchanged.
+func (s *recordStore[T]) update(id string, fn func(*T) error) (T, error) {
+	var rec T
+	if err := s.acquire(); err != nil {
+		return rec, err
+	}
+	defer s.release()
+	rec, ok := s.records[id]
+	if !ok {
+		return rec, errRecordNotFound
+	}
+	if err := fn(&rec); err != nil {
+		return s.records[id], err
+	}
+	s.records[id] = rec
+	return rec, s.saveLocked()
+}
+
+// upsert is update for a record that is created if there is none.
+func (s *recordStore[T]) upsert(id string, fn func(*T) error) (T, error) {
+	var rec T
+	if err := s.acquire(); err != nil {
+		return rec, err
+	}
+	defer s.release()
+	rec = s.records[id]
+	if err := fn(&rec); err != nil {
+		return s.records[id], err
+	}
+	s.records[id] = rec
+	return rec, s.saveLocked()
+}
+
+func (s *recordStore[T]) remove(id string) error {
+	if err := s.acquire(); err != nil {
+		return err
+	}
+	defer s.release()
+	if _, ok := s.records[id]; !ok {
+		return errRecordNotFound
+	}
+	delete(s.records, id)
+	return s.saveLocked()
+}
+
+// list returns a copy of all records in no particular order.
+func (s *recordStore[T]) list() []T {
+	if err := s.acquire(); err != nil {
+		fmt.Printf("Error reading records: %v\n", err)
+		return nil
+	}
+	defer s.release()
+	recs := make([]T, 0, len(s.records))
+	for _, rec := range s.records {
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+// currentGeneration returns the generation of the records, after
+// picking up changes by other processes.
+func (s *recordStore[T]) currentGeneration() uint64 {
+	if err := s.acquire(); err != nil {
+		fmt.Printf("Error reading records: %v\n", err)
+		return 0
+	}
+	defer s.release()
+	return s.generation
+}
+
+func (s *recordStore[T]) saveLocked() error {
+	data, err := json.MarshalIndent(s.records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated store
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(s.path); err == nil {
+		s.loaded = fi
+	}
+	s.generation++
+	return nil
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+//go:build !unix
+
+package assetserver
+
+import "os"
+
+// Without flock only a single process may use the data directory at a time.
+
+func lockFile(f *os.File) error { return nil }
+
+func unlockFile(f *os.File) error { return nil }
@@ -0,0 +1,160 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	maxTags      = 32
+	maxTagLength = 64
+)
+
+// validTag reports whether a tag, already lower cased, is made of letters,
+// digits and the separators - _ . : only.
+func validTag(tag string) bool {
+	if tag == "" || len(tag) > maxTagLength {
+		return false
+	}
+	for _, c := range tag {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// uploadTags returns the tags of the tags form fields of an upload, and
+// the album of its scoped token.
+func uploadTags(r *http.Request) ([]string, *uploadError) {
+	values := r.Form["tags"]
+	if album, ok := scopedAlbumTag(r); ok {
+		values = append(slices.Clip(values), album)
+	}
+	return parseTags(values)
+}
+
+// parseTags reads tags given one per value or comma separated, lower cased
+// and sorted, without duplicates.
+func parseTags(values []string) ([]string, *uploadError) {
+	var tags []string
+	for _, v := range values {
+		for _, tag := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' }) {
+			tag = strings.ToLower(tag)
+			if !validTag(tag) {
+				return nil, &uploadError{http.StatusBadRequest, "invalid_tag", "Invalid tag", nil}
+			}
+			if !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	if len(tags) > maxTags {
+		return nil, &uploadError{http.StatusBadRequest, "too_many_tags", "Too many tags", nil}
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// hasTags reports whether an asset carries all of tags.
+func (a *Asset) hasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(a.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// adminTagsHandler changes the tags of an asset: those of the add member of
+// the body are added and those of remove removed.  Retention rules are
+// evaluated again, so a tag can extend or end the life of an asset.
+func (s *Server) adminTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.bodyLimit(r, maxRequestSize))).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid request body"})
+		return
+	}
+	add, uerr := parseTags(req.Add)
+	if uerr != nil {
+		writeJSON(w, uerr.status, Response{Message: uerr.message})
+		return
+	}
+	remove, uerr := parseTags(req.Remove)
+	if uerr != nil {
+		writeJSON(w, uerr.status, Response{Message: uerr.message})
+		return
+	}
+
+	id := r.PathValue("id")
+	asset, err := s.assets.update(id, func(a *Asset) error {
+		if a.State == stateDeleted {
+			return errors.New("asset is deleted")
+		}
+		tags := slices.DeleteFunc(slices.Clone(a.Tags), func(tag string) bool {
+			return slices.Contains(remove, tag)
+		})
+		tags, uerr := parseTags(append(tags, add...))
+		if uerr != nil {
+			return errors.New(uerr.message)
+		}
+		a.Tags = tags
+		a.applyRetention(s.retentionFor(a.ContentType, a.Size, a.Uploader, a.Tags))
+		return nil
+	})
+	if err == errRecordNotFound {
+		writeJSON(w, http.StatusNotFound, Response{Message: "Asset not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusConflict, Response{Message: err.Error()})
+		return
+	}
+	s.audit(r.Context(), "admin", auditTagChange, id, strings.Join(asset.Tags, ","))
+	writeJSON(w, http.StatusOK, asset)
+}
+
+// TagCount is an entry of the tag listing.
+type TagCount struct {
+	Tag    string `json:"tag"`
+	Assets int    `json:"assets"`
+}
+
+// adminListTagsHandler lists the tags in use by assets that aren't deleted,
+// most used first.
+func (s *Server) adminListTagsHandler(w http.ResponseWriter, r *http.Request) {
+	counts := make(map[string]int)
+	for _, asset := range s.assets.list() {
+		if asset.State == stateDeleted {
+			continue
+		}
+		for _, tag := range asset.Tags {
+			counts[tag]++
+		}
+	}
+	tags := []TagCount{}
+	for tag, n := range counts {
+		tags = append(tags, TagCount{tag, n})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Assets != tags[j].Assets {
+			return tags[i].Assets > tags[j].Assets
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	writeJSON(w, http.StatusOK, tags)
+}
@@ -0,0 +1,181 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	// Decoders for the formats thumbnails are generated from
+	_ "image/gif"
+	_ "image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxThumbnailSourcePixels bounds the images thumbnails are generated from
+// so a small file declaring huge dimensions can't exhaust memory.
+const maxThumbnailSourcePixels = 50_000_000
+
+// Thumbnail is a scaled down JPEG preview of an image asset.
+type Thumbnail struct {
+	Size   int `json:"size"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// thumbnailable reports whether thumbnails can be generated for a type.
+func thumbnailable(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/jpg", "image/pjpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// assetThumbnails generates the thumbnails of an image or, with
+// pdf_previews, the first page of a PDF.  Password protected assets and
+// those restricted to recipients get none so the restriction can't be
+// bypassed.
+func (s *Server) assetThumbnails(ctx context.Context, asset Asset) ([]Thumbnail, error) {
+	if asset.Blind || asset.PasswordHash != "" || len(asset.Recipients) > 0 || len(s.config.ThumbnailSizes) == 0 {
+		return nil, nil
+	}
+	switch {
+	case thumbnailable(asset.ContentType):
+		return s.generateThumbnails(asset.ID, s.contentPath(&asset))
+	case s.config.PDFPreviews && isPDF(asset.ContentType):
+		return s.pdfThumbnails(ctx, asset.ID, s.contentPath(&asset))
+	}
+	return nil, nil
+}
+
+func (s *Server) thumbnailDir() string {
+	return filepath.Join(s.config.UploadDir, ".thumbnails")
+}
+
+// thumbnailName is the file name of an asset's thumbnail of a given size.
+// It is also the path element thumbnails are served under.
+func thumbnailName(id string, size int) string {
+	return fmt.Sprintf("%s.%d.jpg", id, size)
+}
+
+func (s *Server) thumbnailURL(id string, size int) string {
+	return fmt.Sprintf("https://%s/api/v1/thumbnails/%s", s.config.Domain, thumbnailName(id, size))
+}
+
+// generateThumbnails writes a thumbnail for every configured size whose
+// longest edge fits within that size.  Sizes larger than the source image
+// are skipped.
+func (s *Server) generateThumbnails(id, path string) ([]Thumbnail, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image header: %v", err)
+	}
+	if cfg.Width*cfg.Height > maxThumbnailSourcePixels {
+		return nil, fmt.Errorf("image too large for thumbnails: %dx%d", cfg.Width, cfg.Height)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding image: %v", err)
+	}
+
+	var thumbs []Thumbnail
+	b := src.Bounds()
+	for _, size := range s.config.ThumbnailSizes {
+		w, h := b.Dx(), b.Dy()
+		if w <= size && h <= size {
+			continue
+		}
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+
+		out, err := os.Create(filepath.Join(s.thumbnailDir(), thumbnailName(id, size)))
+		if err != nil {
+			return thumbs, err
+		}
+		err = jpeg.Encode(out, dst, &jpeg.Options{Quality: 80})
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return thumbs, err
+		}
+		thumbs = append(thumbs, Thumbnail{Size: size, Width: w, Height: h})
+	}
+	return thumbs, nil
+}
+
+func (s *Server) removeThumbnails(asset Asset) {
+	for _, t := range asset.Thumbnails {
+		path := filepath.Join(s.thumbnailDir(), thumbnailName(asset.ID, t.Size))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error removing thumbnail %s: %v\n", path, err)
+		}
+	}
+}
+
+// thumbnailHandler serves thumbnails of active assets.  Unlike the asset
+// itself, thumbnails may be fetched any number of times.
+func (s *Server) thumbnailHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	base, ok := strings.CutSuffix(name, ".jpg")
+	i := strings.LastIndexByte(base, '.')
+	if !ok || i < 0 {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+	id := base[:i]
+	size, err := strconv.Atoi(base[i+1:])
+	if err != nil || !validAssetID(id) {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+
+	asset, ok := s.assets.get(id)
+	if !ok || asset.State != stateActive || !asset.hasThumbnail(size) {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+	if !s.hotlinkAllowed(r, id) {
+		s.httpError(w, r, "Hotlinking not allowed", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeFile(w, r, filepath.Join(s.thumbnailDir(), thumbnailName(id, size)))
+}
+
+func (a *Asset) hasThumbnail(size int) bool {
+	for _, t := range a.Thumbnails {
+		if t.Size == size {
+			return true
+		}
+	}
+	return false
+}
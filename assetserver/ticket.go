@@ -0,0 +1,248 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTicketTTL = 15 * time.Minute
+	maxTicketTTL     = 24 * time.Hour
+
+	// maxTickets bounds the tickets waiting to be used.
+	maxTickets = 10000
+)
+
+// uploadTicket lets whoever holds it upload one file on behalf of the key
+// that minted it.
+type uploadTicket struct {
+	actor   string
+	maxSize int64
+	types   []string
+	expires time.Time
+
+	// sha256 is the hash the file must have, if set
+	sha256 string
+}
+
+// tickets are the upload tickets minted and not used yet.
+type tickets struct {
+	mu      sync.Mutex
+	pending map[string]uploadTicket
+}
+
+func (t *tickets) issue(ticket uploadTicket, now time.Time) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending == nil {
+		t.pending = make(map[string]uploadTicket)
+	}
+	for nonce, pending := range t.pending {
+		if now.After(pending.expires) {
+			delete(t.pending, nonce)
+		}
+	}
+	if len(t.pending) >= maxTickets {
+		return "", false
+	}
+	b := make([]byte, 32)
+	rand.Read(b)
+	nonce := hex.EncodeToString(b)
+	t.pending[nonce] = ticket
+	return nonce, true
+}
+
+// take removes a ticket, returning it if it was still valid.  A ticket is
+// spent by the first upload presenting it, whether or not it is stored.
+func (t *tickets) take(nonce string, now time.Time) (uploadTicket, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ticket, ok := t.pending[nonce]
+	if !ok {
+		return uploadTicket{}, false
+	}
+	delete(t.pending, nonce)
+	return ticket, !now.After(ticket.expires)
+}
+
+// ticketActor identifies a ticket in the audit log without recording it.
+func ticketActor(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return "ticket:" + hex.EncodeToString(sum[:4])
+}
+
+type uploadTicketKey struct{}
+
+// uploadTicketNonce returns the ticket an upload carries in the
+// X-Upload-Ticket header or ticket query parameter, if any.
+func uploadTicketNonce(r *http.Request) string {
+	if nonce := r.Header.Get("X-Upload-Ticket"); nonce != "" {
+		return nonce
+	}
+	return r.URL.Query().Get("ticket")
+}
+
+// redeemTicket spends the ticket an upload carries and returns the request
+// carrying it, or nil if there is no valid ticket.
+func (s *Server) redeemTicket(r *http.Request) *http.Request {
+	nonce := uploadTicketNonce(r)
+	if nonce == "" {
+		return nil
+	}
+	ticket, ok := s.tickets.take(nonce, s.now())
+	if !ok {
+		s.audit(r.Context(), "ip:"+s.clientIP(r), auditKeyUse, r.URL.Path, "rejected ticket")
+		return nil
+	}
+	s.audit(r.Context(), ticketActor(nonce), auditKeyUse, r.URL.Path, "accepted for "+ticket.actor)
+	return r.WithContext(context.WithValue(r.Context(), uploadTicketKey{}, ticket))
+}
+
+// requestTicket returns the ticket an upload was authorized with, if any.
+func requestTicket(r *http.Request) (uploadTicket, bool) {
+	ticket, ok := r.Context().Value(uploadTicketKey{}).(uploadTicket)
+	return ticket, ok
+}
+
+// uploadActor is who an upload is recorded for: the API key it carries or
+// the one that minted its ticket or scoped token.
+func uploadActor(r *http.Request) string {
+	if ticket, ok := requestTicket(r); ok {
+		return ticket.actor
+	}
+	if t, ok := requestScopedToken(r); ok {
+		return t.Owner
+	}
+	return requestKeyActor(r)
+}
+
+// uploadMaxSize is the largest file an upload may carry.
+func (s *Server) uploadMaxSize(r *http.Request) int64 {
+	if ticket, ok := requestTicket(r); ok {
+		return ticket.maxSize
+	}
+	return s.config.MaxFileSize
+}
+
+// uploadMaxFiles is how many files a multipart upload may carry.
+func (s *Server) uploadMaxFiles(r *http.Request) int {
+	if _, ok := requestTicket(r); ok {
+		return 1
+	}
+	return s.config.MaxBatchFiles
+}
+
+// errHashMismatch is returned for an upload stored as it was read whose
+// hash turned out not to be the one its ticket was granted for.
+var errHashMismatch = errors.New("file does not match the hash of the ticket")
+
+// ticketSHA256 returns the hash the ticket of an upload, if any, requires
+// the file to have.
+func ticketSHA256(r *http.Request) string {
+	ticket, _ := requestTicket(r)
+	return ticket.sha256
+}
+
+// ticketAllowsData reports whether the ticket of an upload, if any, was
+// granted for this content.
+func ticketAllowsData(r *http.Request, data []byte) bool {
+	ticket, ok := requestTicket(r)
+	if !ok || ticket.sha256 == "" {
+		return true
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) == ticket.sha256
+}
+
+// ticketAllowsType reports whether the ticket of an upload, if any, allows
+// a content type on top of allowed_types.
+func ticketAllowsType(r *http.Request, contentType string) bool {
+	ticket, ok := requestTicket(r)
+	return !ok || len(ticket.types) == 0 || matchContentType(contentType, ticket.types)
+}
+
+// uploadAllowedTypes returns the types the ticket of an upload narrows the
+// allowed types to.
+func uploadAllowedTypes(r *http.Request) []string {
+	ticket, _ := requestTicket(r)
+	return ticket.types
+}
+
+// ticketHandler mints a single use upload ticket.  The ttl, max_size and
+// types parameters narrow it down from the defaults of 15 minutes, any size
+// up to max_file_size and any allowed type.
+func (s *Server) ticketHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+
+	ticket := uploadTicket{actor: requestKeyActor(r), maxSize: s.config.MaxFileSize}
+	ttl := defaultTicketTTL
+	if v := r.FormValue("ttl"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 || d > maxTicketTTL {
+			s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_ttl", "ttl must be a duration of up to 24h")
+			return
+		}
+		ttl = d
+	}
+	if v := r.FormValue("max_size"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 || n > s.config.MaxFileSize {
+			s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_max_size",
+				s.localize(r, "max_size must be between 1 and %d", s.config.MaxFileSize))
+			return
+		}
+		ticket.maxSize = n
+	}
+	for _, t := range strings.FieldsFunc(r.FormValue("types"), func(r rune) bool { return r == ',' || r == ' ' }) {
+		if major, minor, ok := strings.Cut(t, "/"); !ok || major == "" || minor == "" {
+			s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_types", "types must be MIME types such as image/png or image/*")
+			return
+		}
+		ticket.types = append(ticket.types, strings.ToLower(t))
+	}
+
+	grant, ok := s.mintTicket(w, r, ticket, ttl)
+	if !ok {
+		return
+	}
+	grant["types"] = ticket.types
+	sendEnvelope(w, http.StatusCreated, grant)
+}
+
+// mintTicket issues a ticket valid for ttl and returns the members of the
+// response describing it, or false with the response written if there are
+// too many pending.
+func (s *Server) mintTicket(w http.ResponseWriter, r *http.Request, ticket uploadTicket, ttl time.Duration) (map[string]any, bool) {
+	now := s.now()
+	ticket.expires = now.Add(ttl).Truncate(time.Second).UTC()
+	nonce, ok := s.tickets.issue(ticket, now)
+	if !ok {
+		s.sendEnvelopeError(w, r, http.StatusServiceUnavailable, "too_many_tickets", "Too many pending tickets, try again later")
+		return nil, false
+	}
+	s.audit(r.Context(), ticket.actor, auditTicket, ticketActor(nonce),
+		"expires "+ticket.expires.Format(time.RFC3339))
+	w.Header().Set("Cache-Control", "no-store")
+	return map[string]any{
+		"ticket":     nonce,
+		"upload_url": fmt.Sprintf("https://%s/api/v1/upload?ticket=%s", s.config.Domain, nonce),
+		"expires_at": ticket.expires,
+		"max_size":   ticket.maxSize,
+	}, true
+}
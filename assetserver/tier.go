@@ -0,0 +1,262 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// tierCold marks assets whose file has been moved to the cold store.
+const tierCold = "cold"
+
+// coldTransferTimeout bounds moving a single file to or from cold storage.
+const coldTransferTimeout = 30 * time.Minute
+
+// errColdRestoring is returned while an archived file is being restored by
+// the cold store and cannot be read yet.
+var errColdRestoring = errors.New("file is being restored from archive")
+
+// fileStore holds asset files away from upload_dir: the cold store, with
+// the files of assets that haven't been accessed for cold_after, and
+// replicas.  get fails with os.ErrNotExist for a file the store doesn't
+// have.
+type fileStore interface {
+	put(ctx context.Context, id string, r io.Reader, size int64) error
+	get(ctx context.Context, id string) (io.ReadCloser, error)
+	remove(ctx context.Context, id string) error
+}
+
+func (s *Server) openColdStore() error {
+	switch s.config.ColdBackend {
+	case "":
+		return nil
+	case "dir":
+		if err := os.MkdirAll(s.config.ColdDir, 0700); err != nil {
+			return fmt.Errorf("error creating cold_dir: %v", err)
+		}
+		s.cold = dirStore(s.config.ColdDir)
+	case "s3":
+		store, err := s.newS3ColdStore()
+		if err != nil {
+			return fmt.Errorf("error configuring cold storage: %v", err)
+		}
+		s.cold = store
+	default:
+		return fmt.Errorf("unknown cold_backend %q", s.config.ColdBackend)
+	}
+	return nil
+}
+
+// dirStore keeps files in a directory, typically a mount of slower,
+// cheaper storage.
+type dirStore string
+
+func (d dirStore) put(ctx context.Context, id string, r io.Reader, size int64) error {
+	tmp, err := os.CreateTemp(string(d), ".put-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(string(d), id))
+}
+
+func (d dirStore) get(ctx context.Context, id string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(string(d), id))
+}
+
+func (d dirStore) remove(ctx context.Context, id string) error {
+	err := os.Remove(filepath.Join(string(d), id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// accessedAt is when the asset was last uploaded or downloaded.
+func (a *Asset) accessedAt() time.Time {
+	if a.AccessedAt.IsZero() {
+		return a.UploadedAt
+	}
+	return a.AccessedAt
+}
+
+// tierColdAssets moves the files of active assets untouched for cold_after
+// to the cold store.  Thumbnails stay on local disk.
+func (s *Server) tierColdAssets() {
+	if s.cold == nil || s.config.ColdAfter <= 0 {
+		return
+	}
+	cutoff := s.now().Add(-time.Duration(s.config.ColdAfter))
+	for _, asset := range s.assets.list() {
+		if asset.State != stateActive || asset.Tier == tierCold || asset.accessedAt().After(cutoff) {
+			continue
+		}
+		if err := s.moveToCold(asset); err != nil {
+			fmt.Printf("Error moving %s to cold storage: %v\n", asset.ID, err)
+		}
+	}
+}
+
+func (s *Server) moveToCold(asset Asset) error {
+	ctx, cancel := context.WithTimeout(context.Background(), coldTransferTimeout)
+	defer cancel()
+
+	f, err := os.Open(s.assetPath(asset.ID))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := s.cold.put(ctx, asset.ID, f, fi.Size()); err != nil {
+		return err
+	}
+
+	// Only drop the local copy if nothing happened to the asset meanwhile
+	_, err = s.assets.update(asset.ID, func(a *Asset) error {
+		if a.State != stateActive || !a.accessedAt().Equal(asset.accessedAt()) {
+			return fmt.Errorf("asset changed while moving to cold storage")
+		}
+		a.Tier = tierCold
+		return nil
+	})
+	if err != nil {
+		s.cold.remove(ctx, asset.ID)
+		return err
+	}
+	return os.Remove(s.assetPath(asset.ID))
+}
+
+// warmAsset brings a cold asset's file back to local disk.
+func (s *Server) warmAsset(ctx context.Context, id string) error {
+	s.warming.Lock()
+	done, busy := s.warming.inFlight[id]
+	if !busy {
+		done = make(chan struct{})
+		s.warming.inFlight[id] = done
+	}
+	s.warming.Unlock()
+
+	if busy {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if asset, ok := s.assets.get(id); ok && asset.Tier == tierCold {
+			return fmt.Errorf("retrieval from cold storage failed")
+		}
+		return nil
+	}
+
+	defer func() {
+		s.warming.Lock()
+		delete(s.warming.inFlight, id)
+		s.warming.Unlock()
+		close(done)
+	}()
+	return s.retrieveFromCold(ctx, id)
+}
+
+func (s *Server) retrieveFromCold(ctx context.Context, id string) error {
+	asset, ok := s.assets.get(id)
+	if !ok {
+		return errRecordNotFound
+	}
+	if asset.Tier != tierCold {
+		return nil
+	}
+
+	rc, err := s.cold.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp(s.config.UploadDir, ".warm-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), rc)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if asset.Encoding != "" {
+		// The cold store holds the file as stored, and the checksum is
+		// that of the content
+		if sum, err = fileChecksum(tmp.Name(), asset.Encoding); err != nil {
+			return err
+		}
+	}
+	if asset.SHA256 != "" && sum != asset.SHA256 {
+		return fmt.Errorf("checksum mismatch retrieving %s from cold storage", id)
+	}
+	if err := os.Rename(tmp.Name(), s.assetPath(id)); err != nil {
+		return err
+	}
+
+	if _, err := s.assets.update(id, func(a *Asset) error {
+		a.Tier = ""
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := s.cold.remove(context.WithoutCancel(ctx), id); err != nil {
+		fmt.Printf("Error removing %s from cold storage: %v\n", id, err)
+	}
+	return nil
+}
+
+// removeColdFile deletes the cold copy of a deleted asset.
+func (s *Server) removeColdFile(asset Asset) {
+	if s.cold == nil || asset.Tier != tierCold {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), coldTransferTimeout)
+	defer cancel()
+	if err := s.cold.remove(ctx, asset.ID); err != nil {
+		fmt.Printf("Error removing %s from cold storage: %v\n", asset.ID, err)
+	}
+}
+
+// openColdFile opens the file of a cold asset for reading straight from
+// the cold store.  Reads after a seek fetch only the rest of the file from
+// there, so ranges are passed through rather than downloaded in full.
+func (s *Server) openColdFile(ctx context.Context, id string) (io.ReadSeekCloser, error) {
+	rc, err := s.cold.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := rc.(io.ReadSeekCloser)
+	if !ok {
+		rc.Close()
+		return nil, fmt.Errorf("cold store cannot seek")
+	}
+	return f, nil
+}
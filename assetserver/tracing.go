@@ -0,0 +1,98 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.43.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans for upload and download phases.  Until
+// setupTracing installs a provider it is a no-op, so instrumentation costs
+// nothing when tracing is disabled.
+var tracer = otel.Tracer("github.com/karamble/braibot-assetserver")
+
+// setupTracing exports spans over OTLP/HTTP when otlp_endpoint is set.
+func (s *Server) setupTracing() error {
+	if s.config.OTLPEndpoint == "" {
+		return nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(s.config.OTLPEndpoint)}
+	if s.config.OTLPInsecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return fmt.Errorf("error creating OTLP exporter: %v", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName("braibot-assetserver"),
+	))
+	if err != nil {
+		return fmt.Errorf("error creating trace resource: %v", err)
+	}
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(s.config.TraceSampleRatio))),
+	))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	s.infof("Exporting traces to %s\n", s.config.OTLPEndpoint)
+	return nil
+}
+
+// phaseSpans traces the sequential phases of a handler.  Starting a phase
+// ends the previous one, so early returns only need the deferred end.
+type phaseSpans struct {
+	ctx  context.Context
+	span trace.Span
+}
+
+func newPhaseSpans(ctx context.Context) *phaseSpans {
+	return &phaseSpans{ctx: ctx}
+}
+
+func (p *phaseSpans) start(name string) {
+	p.end()
+	_, p.span = tracer.Start(p.ctx, name)
+}
+
+func (p *phaseSpans) set(kv ...attribute.KeyValue) {
+	if p.span != nil {
+		p.span.SetAttributes(kv...)
+	}
+}
+
+// fail records why the current phase failed.
+func (p *phaseSpans) fail(err error) {
+	if p.span != nil {
+		p.span.RecordError(err)
+		p.span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+func (p *phaseSpans) end() {
+	if p.span != nil {
+		p.span.End()
+		p.span = nil
+	}
+}
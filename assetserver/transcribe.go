@@ -0,0 +1,114 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	transcribeTimeout = 15 * time.Minute
+
+	// transcriptSidecar is the sidecar transcripts are stored as
+	transcriptSidecar = "transcript.txt"
+
+	// maxInlineTranscript is the longest transcript also kept in the asset
+	// object.  Longer ones are only in the sidecar.
+	maxInlineTranscript = 16 << 10
+)
+
+func (s *Server) validateTranscribeConfig() error {
+	if len(s.config.TranscribeCommand) > 0 && s.config.TranscribeURL != "" {
+		return fmt.Errorf("only one of transcribe_command and transcribe_url may be set")
+	}
+	return nil
+}
+
+// transcribe returns the text spoken in an audio file.  transcribe_command
+// gets the file path appended and prints the text, as whisper.cpp does;
+// transcribe_url is sent the file in a POST, with transcribe_key as a
+// bearer token if set, and answers with a JSON object with a text.
+func (s *Server) transcribe(ctx context.Context, path, contentType string) (string, error) {
+	ctx, cancel := toolContext(ctx, transcribeTimeout)
+	defer cancel()
+
+	if len(s.config.TranscribeCommand) > 0 {
+		args := append(append([]string{}, s.config.TranscribeCommand[1:]...), path)
+		out, err := exec.CommandContext(ctx, s.config.TranscribeCommand[0], args...).Output()
+		if err != nil {
+			return "", fmt.Errorf("error running transcriber: %v", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.TranscribeURL, f)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if s.config.TranscribeKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.TranscribeKey)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("transcriber returned %s", resp.Status)
+	}
+
+	var result struct {
+		Text *string `json:"text"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, s.config.MaxSidecarSize*2)).Decode(&result); err != nil {
+		return "", fmt.Errorf("error decoding transcriber response: %v", err)
+	}
+	if result.Text == nil {
+		return "", fmt.Errorf("transcriber response has no text")
+	}
+	return strings.TrimSpace(*result.Text), nil
+}
+
+// writeTranscript stores a transcript as an asset's transcript sidecar,
+// cut to max_sidecar_size.
+func (s *Server) writeTranscript(id, text string) (Sidecar, error) {
+	text = strings.ToValidUTF8(text, "\uFFFD")
+	if int64(len(text)) > s.config.MaxSidecarSize {
+		text = text[:s.config.MaxSidecarSize]
+		for !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+	data := []byte(text + "\n")
+	if err := os.WriteFile(s.sidecarPath(id, transcriptSidecar), data, 0644); err != nil {
+		return Sidecar{}, err
+	}
+	sum := sha256.Sum256(data)
+	return Sidecar{
+		Name:        transcriptSidecar,
+		ContentType: sidecarTypes[".txt"],
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		AddedAt:     s.now().UTC(),
+	}, nil
+}
@@ -0,0 +1,238 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transfer directions.
+const (
+	transferUpload   = "upload"
+	transferDownload = "download"
+)
+
+// Transfer is an upload or download in progress as listed by the admin API.
+// Size is the request's Content-Length for uploads and is unknown for
+// downloads; Rate is the average in bytes per second since the start.
+type Transfer struct {
+	ID        string    `json:"id"`
+	Direction string    `json:"direction"`
+	AssetID   string    `json:"asset_id,omitempty"`
+	Client    string    `json:"client"`
+	StartedAt time.Time `json:"started_at"`
+	Bytes     int64     `json:"bytes"`
+	Size      int64     `json:"size,omitempty"`
+	Rate      float64   `json:"rate"`
+}
+
+// transfer is the live state behind a Transfer.
+type transfer struct {
+	info   Transfer
+	bytes  atomic.Int64
+	cancel func()
+
+	// reading is set while the handler waits for upload data, received
+	// once the body has ended
+	reading  atomic.Bool
+	received atomic.Bool
+}
+
+// transfers are the uploads and downloads being served.
+type transfers struct {
+	sync.Mutex
+	next   uint64
+	active map[string]*transfer
+}
+
+func (ts *transfers) add(t *transfer) {
+	ts.Lock()
+	defer ts.Unlock()
+	if ts.active == nil {
+		ts.active = make(map[string]*transfer)
+	}
+	ts.next++
+	t.info.ID = strconv.FormatUint(ts.next, 10)
+	ts.active[t.info.ID] = t
+}
+
+func (ts *transfers) remove(id string) {
+	ts.Lock()
+	defer ts.Unlock()
+	delete(ts.active, id)
+}
+
+func (ts *transfers) get(id string) (*transfer, bool) {
+	ts.Lock()
+	defer ts.Unlock()
+	t, ok := ts.active[id]
+	return t, ok
+}
+
+func (ts *transfers) list(now time.Time) []Transfer {
+	ts.Lock()
+	defer ts.Unlock()
+	list := make([]Transfer, 0, len(ts.active))
+	for _, t := range ts.active {
+		info := t.info
+		info.Bytes = t.bytes.Load()
+		if elapsed := now.Sub(info.StartedAt).Seconds(); elapsed > 0 {
+			info.Rate = float64(info.Bytes) / elapsed
+		}
+		list = append(list, info)
+	}
+	return list
+}
+
+// transferDirection tells uploads and downloads of asset files apart from
+// other requests, along with the asset downloaded.
+func transferDirection(r *http.Request) (direction, assetID string) {
+	if isUpload(r) {
+		return transferUpload, ""
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		return "", ""
+	}
+	rest, ok := strings.CutPrefix(r.URL.Path, "/api/v1/download/")
+	if !ok {
+		rest, ok = strings.CutPrefix(r.URL.Path, "/download/")
+	}
+	if !ok {
+		return "", ""
+	}
+	id, variant, _ := strings.Cut(rest, "/")
+	if id == "" || variant == "qr.png" {
+		return "", ""
+	}
+	return transferDownload, id
+}
+
+// transferBody counts the bytes read of an upload.
+type transferBody struct {
+	io.ReadCloser
+	t *transfer
+}
+
+func (b transferBody) Read(p []byte) (int, error) {
+	b.t.reading.Store(true)
+	n, err := b.ReadCloser.Read(p)
+	b.t.reading.Store(false)
+	b.t.bytes.Add(int64(n))
+	if err != nil {
+		b.t.received.Store(true)
+	}
+	return n, err
+}
+
+// transferWriter counts the bytes written of a download.
+type transferWriter struct {
+	http.ResponseWriter
+	t *transfer
+}
+
+func (w transferWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.t.bytes.Add(int64(n))
+	return n, err
+}
+
+// ReadFrom passes files on to the connection, which can send them with
+// sendfile.
+func (w transferWriter) ReadFrom(r io.Reader) (int64, error) {
+	n, err := copyBuffer(w.ResponseWriter, r)
+	w.t.bytes.Add(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the connection.
+func (w transferWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// trackTransfers lists uploads and downloads while they are served so they
+// can be inspected and cancelled through the admin API.  Cancelling expires
+// the connection's deadlines, which unblocks a handler stuck on a stalled
+// client, and cancels the request's context.
+func (s *Server) trackTransfers(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		direction, assetID := transferDirection(r)
+		if direction == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		rc := http.NewResponseController(w)
+		t := &transfer{
+			info: Transfer{
+				Direction: direction,
+				AssetID:   assetID,
+				Client:    s.clientIP(r),
+				StartedAt: s.now().UTC(),
+			},
+			cancel: func() {
+				cancel()
+				rc.SetReadDeadline(time.Now())
+				rc.SetWriteDeadline(time.Now())
+			},
+		}
+		if direction == transferUpload && r.ContentLength > 0 {
+			t.info.Size = r.ContentLength
+		}
+		s.transfers.add(t)
+		defer s.transfers.remove(t.info.ID)
+
+		r = r.WithContext(ctx)
+		if direction == transferUpload {
+			r.Body = transferBody{r.Body, t}
+			if s.config.MinUploadRate > 0 {
+				go s.enforceUploadRate(ctx, t, func() { rc.SetReadDeadline(time.Now()) })
+			}
+		} else {
+			w = transferWriter{w, t}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// adminTransfersHandler lists the uploads and downloads in progress, the
+// longest running first.
+func (s *Server) adminTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	list := s.transfers.list(s.now())
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].StartedAt.Before(list[j].StartedAt)
+	})
+	writeJSON(w, http.StatusOK, list)
+}
+
+// adminCancelTransferHandler cuts off a transfer, such as a client pinning
+// bandwidth.  The client is free to start over.
+func (s *Server) adminCancelTransferHandler(w http.ResponseWriter, r *http.Request) {
+	t, ok := s.transfers.get(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, Response{Message: "Transfer not found"})
+		return
+	}
+	t.cancel()
+
+	target := t.info.AssetID
+	if target == "" {
+		target = t.info.Client
+	}
+	s.infof("Cancelled %s %s from %s\n", t.info.Direction, t.info.ID, t.info.Client)
+	s.audit(r.Context(), "admin", auditTransfer, target,
+		fmt.Sprintf("cancelled %s from %s after %d bytes", t.info.Direction, t.info.Client, t.bytes.Load()))
+	writeJSON(w, http.StatusOK, Response{Success: true, Message: "Transfer cancelled"})
+}
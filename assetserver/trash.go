@@ -0,0 +1,143 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// trashDir holds the files of deleted assets until trash_retention has
+// passed, so a deletion can be undone.
+func (s *Server) trashDir() string {
+	return filepath.Join(s.config.UploadDir, ".trash")
+}
+
+// assetFiles returns the paths of an asset's file, thumbnails, variants,
+// sidecars, stream directory and earlier versions within dir, which is either the upload
+// directory or the trash.
+func (s *Server) assetFiles(asset Asset, trashed bool) []string {
+	dir, thumbs, variants := s.config.UploadDir, s.thumbnailDir(), s.variantDir()
+	if trashed {
+		dir, thumbs, variants = s.trashDir(), s.trashDir(), s.trashDir()
+	}
+	paths := []string{filepath.Join(dir, asset.ID)}
+	for _, t := range asset.Thumbnails {
+		paths = append(paths, filepath.Join(thumbs, thumbnailName(asset.ID, t.Size)))
+	}
+	for _, v := range asset.Variants {
+		paths = append(paths, filepath.Join(variants, variantName(asset.ID, v.Name)))
+	}
+	for _, sc := range asset.Sidecars {
+		if trashed {
+			paths = append(paths, filepath.Join(s.trashDir(), asset.ID+".sidecar."+sc.Name))
+		} else {
+			paths = append(paths, s.sidecarPath(asset.ID, sc.Name))
+		}
+	}
+	if len(asset.Renditions) > 0 {
+		if trashed {
+			paths = append(paths, filepath.Join(s.trashDir(), asset.ID+".hls"))
+		} else {
+			paths = append(paths, filepath.Join(s.hlsDir(), asset.ID))
+		}
+	}
+	for _, v := range asset.Versions {
+		if trashed {
+			paths = append(paths, filepath.Join(s.trashDir(), versionName(asset.ID, v.Version)))
+		} else {
+			paths = append(paths, s.versionPath(asset.ID, v.Version))
+		}
+	}
+	return paths
+}
+
+// moveAssetFiles moves an asset's files into or out of the trash.  Missing
+// thumbnails are skipped; a missing asset file is an error unless the file
+// is in cold storage, where it stays while trashed.
+func (s *Server) moveAssetFiles(asset Asset, toTrash bool) error {
+	from, to := s.assetFiles(asset, !toTrash), s.assetFiles(asset, toTrash)
+	for i := range from {
+		required := i == 0 && asset.Tier != tierCold
+		err := os.Rename(from[i], to[i])
+		if err != nil && (required || !errors.Is(err, os.ErrNotExist)) {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTrashedFiles permanently deletes the trashed files of an asset.
+func (s *Server) removeTrashedFiles(asset Asset) {
+	s.removeColdFile(asset)
+	s.removeReplicas(asset)
+	for _, path := range s.assetFiles(asset, true) {
+		if err := os.RemoveAll(path); err != nil {
+			fmt.Printf("Error removing %s: %v\n", path, err)
+		}
+	}
+}
+
+// purgeTrash permanently deletes trashed files whose recovery window has
+// passed.  With the trash disabled everything left in it is purged.
+func (s *Server) purgeTrash() {
+	cutoff := s.now().Add(-time.Duration(s.config.TrashRetention))
+	for _, asset := range s.assets.list() {
+		if asset.State != stateDeleted || asset.TrashedAt.IsZero() {
+			continue
+		}
+		if s.config.TrashRetention > 0 && asset.TrashedAt.After(cutoff) {
+			continue
+		}
+		purged, err := s.assets.update(asset.ID, func(a *Asset) error {
+			if a.State != stateDeleted {
+				return fmt.Errorf("asset was restored")
+			}
+			a.TrashedAt = time.Time{}
+			return nil
+		})
+		if err != nil {
+			continue
+		}
+		s.removeTrashedFiles(purged)
+		s.audit(context.Background(), "system", auditDelete, asset.ID, "purged from trash")
+	}
+}
+
+// adminTrashHandler lists deleted assets that can still be restored, most
+// recently deleted first.
+func (s *Server) adminTrashHandler(w http.ResponseWriter, r *http.Request) {
+	trashed := []Asset{}
+	for _, asset := range s.assets.list() {
+		if asset.State == stateDeleted && !asset.TrashedAt.IsZero() {
+			trashed = append(trashed, asset)
+		}
+	}
+	sort.Slice(trashed, func(i, j int) bool {
+		return trashed[i].TrashedAt.After(trashed[j].TrashedAt)
+	})
+	writeJSON(w, http.StatusOK, trashed)
+}
+
+// adminRestoreHandler returns a trashed asset to the state it was deleted
+// from.
+func (s *Server) adminRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	asset, ok := s.assets.get(r.PathValue("id"))
+	if !ok {
+		writeJSON(w, http.StatusNotFound, Response{Message: "Asset not found"})
+		return
+	}
+	to := asset.DeletedFrom
+	if to == "" || to == statePending {
+		to = stateActive
+	}
+	s.changeAssetState(w, r, to, "restored by admin")
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const usageDateFormat = "2006-01-02"
+
+// Usage is what one uploader used on one day, in UTC.  Downloads are
+// counted against the key that uploaded the asset.  StoredBytes is the
+// most that was stored for the key at any time of the day.
+type Usage struct {
+	Date          string `json:"date"`
+	Key           string `json:"key"`
+	Uploads       int    `json:"uploads"`
+	UploadBytes   int64  `json:"upload_bytes"`
+	Downloads     int    `json:"downloads"`
+	DownloadBytes int64  `json:"download_bytes"`
+	StoredBytes   int64  `json:"stored_bytes"`
+}
+
+func usageID(date, key string) string {
+	return date + " " + key
+}
+
+// addUsage adds to today's usage of a key.
+func (s *Server) addUsage(key string, fn func(u *Usage)) {
+	date := s.now().UTC().Format(usageDateFormat)
+	_, err := s.usage.upsert(usageID(date, key), func(u *Usage) error {
+		u.Date, u.Key = date, key
+		fn(u)
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error recording usage of %s: %v\n", key, err)
+	}
+}
+
+func (s *Server) recordUpload(key string, size int64) {
+	s.addUsage(key, func(u *Usage) {
+		u.Uploads++
+		u.UploadBytes += size
+	})
+}
+
+// recordDownload counts the bytes sent of an asset, complete download or
+// not.
+func (s *Server) recordDownload(asset Asset, sent ByteRange) {
+	if sent.End <= sent.Start {
+		return
+	}
+	s.addUsage(asset.Uploader, func(u *Usage) {
+		u.Downloads++
+		u.DownloadBytes += sent.End - sent.Start
+	})
+	s.publishEvent(eventDownload, asset.ID, "", sent.End-sent.Start, "")
+}
+
+// recordStoredBytes updates the peak storage of today for every key with
+// files on disk.  Deleted assets don't count, even while in the trash.
+func (s *Server) recordStoredBytes() {
+	stored := make(map[string]int64)
+	for _, asset := range s.assets.list() {
+		if asset.State == stateDeleted {
+			continue
+		}
+		size := asset.Size
+		for _, v := range asset.Variants {
+			size += v.Size
+		}
+		stored[asset.Uploader] += size
+	}
+	date := s.now().UTC().Format(usageDateFormat)
+	for key, size := range stored {
+		if u, ok := s.usage.get(usageID(date, key)); ok && u.StoredBytes >= size {
+			continue
+		}
+		s.addUsage(key, func(u *Usage) {
+			u.StoredBytes = max(u.StoredBytes, size)
+		})
+	}
+}
+
+// adminUsageHandler reports daily usage per key between the from and to
+// dates, inclusive, as JSON or, with format=csv, as CSV.  It defaults to
+// the last 30 days.
+func (s *Server) adminUsageHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	to := s.now().UTC().Format(usageDateFormat)
+	if v := q.Get("to"); v != "" {
+		if _, err := time.Parse(usageDateFormat, v); err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid to date"})
+			return
+		}
+		to = v
+	}
+	t, _ := time.Parse(usageDateFormat, to)
+	from := t.AddDate(0, 0, -29).Format(usageDateFormat)
+	if v := q.Get("from"); v != "" {
+		if _, err := time.Parse(usageDateFormat, v); err != nil {
+			writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid from date"})
+			return
+		}
+		from = v
+	}
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "Format must be json or csv"})
+		return
+	}
+
+	// Dates in this format sort as strings
+	rows := []Usage{}
+	for _, u := range s.usage.list() {
+		if u.Date < from || u.Date > to {
+			continue
+		}
+		if key := q.Get("key"); key != "" && u.Key != key {
+			continue
+		}
+		rows = append(rows, u)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Date != rows[j].Date {
+			return rows[i].Date < rows[j].Date
+		}
+		return rows[i].Key < rows[j].Key
+	})
+
+	if format != "csv" {
+		writeJSON(w, http.StatusOK, rows)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=usage-%s-%s.csv", from, to))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "key", "uploads", "upload_bytes", "downloads", "download_bytes", "stored_bytes"})
+	for _, u := range rows {
+		cw.Write([]string{
+			u.Date,
+			u.Key,
+			strconv.Itoa(u.Uploads),
+			strconv.FormatInt(u.UploadBytes, 10),
+			strconv.Itoa(u.Downloads),
+			strconv.FormatInt(u.DownloadBytes, 10),
+			strconv.FormatInt(u.StoredBytes, 10),
+		})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,314 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxNickLength bounds the nick recorded for a user.
+const maxNickLength = 64
+
+// errUserQuota is returned when an upload doesn't fit in what is left of
+// its user's quota.
+var errUserQuota = errors.New("user quota exceeded")
+
+func (s *Server) validateUserConfig() error {
+	if s.config.BRUserQuota < 0 || s.config.BRUserMaxFiles < 0 {
+		return fmt.Errorf("br_user_quota and br_user_max_files cannot be negative")
+	}
+	return nil
+}
+
+// User is a Bison Relay user braibot stores files for, known by the hex
+// identity key that is their fingerprint.  The nick is the last one seen.
+// Quota and MaxFiles replace br_user_quota and br_user_max_files for the
+// user if set; -1 is unlimited.
+type User struct {
+	ID         string    `json:"id"`
+	Nick       string    `json:"nick"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Quota      int64     `json:"quota,omitempty"`
+	MaxFiles   int       `json:"max_files,omitempty"`
+}
+
+// UserV1 is a user with the storage they use and may use.  Zero limits
+// are unlimited.
+type UserV1 struct {
+	ID         string    `json:"id"`
+	Nick       string    `json:"nick"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	Files      int       `json:"files"`
+	Bytes      int64     `json:"bytes"`
+	Quota      int64     `json:"quota"`
+	MaxFiles   int       `json:"max_files"`
+}
+
+// validIdentity reports whether id is a hex Bison Relay identity key,
+// already lower cased.
+func validIdentity(id string) bool {
+	b, err := hex.DecodeString(id)
+	return err == nil && len(b) == ed25519.PublicKeySize && hex.EncodeToString(b) == id
+}
+
+// validNick reports whether a nick is short printable text.
+func validNick(nick string) bool {
+	if nick == "" || len(nick) > maxNickLength || !utf8.ValidString(nick) {
+		return false
+	}
+	return strings.IndexFunc(nick, func(r rune) bool { return !unicode.IsPrint(r) }) < 0
+}
+
+// uploadUser returns the user an upload is stored for, given by braibot as
+// the X-BR-User identity key and X-BR-Nick headers, and records them as
+// seen.  Only uploads with the API key may name a user, since anyone else
+// could claim to be anyone.
+func (s *Server) uploadUser(r *http.Request) (string, *uploadError) {
+	id := strings.ToLower(r.Header.Get("X-BR-User"))
+	nick := strings.TrimSpace(r.Header.Get("X-BR-Nick"))
+	if id == "" {
+		if nick != "" {
+			return "", &uploadError{http.StatusBadRequest, "invalid_user", "X-BR-Nick needs X-BR-User", nil}
+		}
+		return "", nil
+	}
+	_, ticketed := requestTicket(r)
+	_, scoped := requestScopedToken(r)
+	if ticketed || scoped {
+		return "", &uploadError{http.StatusForbidden, "forbidden", "Only the API key may upload for a user", nil}
+	}
+	if !validIdentity(id) {
+		return "", &uploadError{http.StatusBadRequest, "invalid_user", "Invalid user identity", nil}
+	}
+	if nick != "" && !validNick(nick) {
+		return "", &uploadError{http.StatusBadRequest, "invalid_user", "Invalid nick", nil}
+	}
+
+	now := s.now().UTC()
+	_, err := s.users.upsert(id, func(u *User) error {
+		if u.ID == "" {
+			u.ID, u.CreatedAt = id, now
+		}
+		if nick != "" {
+			u.Nick = nick
+		}
+		u.LastSeenAt = now
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("Error recording user %s: %v\n", id, err)
+		return "", &uploadError{http.StatusInternalServerError, "internal_error", "Error recording user", nil}
+	}
+	return id, nil
+}
+
+// userUsage counts the files of a user and their size, with variants and
+// earlier versions, as long as they are not deleted.
+func (s *Server) userUsage(id string) (files int, bytes int64) {
+	for _, asset := range s.assets.list() {
+		if asset.User != id || asset.State == stateDeleted {
+			continue
+		}
+		files++
+		bytes += asset.Size
+		for _, v := range asset.Variants {
+			bytes += v.Size
+		}
+		for _, v := range asset.Versions {
+			bytes += v.Size
+		}
+	}
+	return files, bytes
+}
+
+// userLimits returns the quota and file limit of a user, 0 if unlimited.
+func (s *Server) userLimits(u User) (int64, int) {
+	quota, maxFiles := s.config.BRUserQuota, s.config.BRUserMaxFiles
+	if u.Quota != 0 {
+		quota = max(u.Quota, 0)
+	}
+	if u.MaxFiles != 0 {
+		maxFiles = max(u.MaxFiles, 0)
+	}
+	return quota, maxFiles
+}
+
+func (s *Server) userV1(u User) UserV1 {
+	files, bytes := s.userUsage(u.ID)
+	quota, maxFiles := s.userLimits(u)
+	return UserV1{
+		ID:         u.ID,
+		Nick:       u.Nick,
+		CreatedAt:  u.CreatedAt,
+		LastSeenAt: u.LastSeenAt,
+		Files:      files,
+		Bytes:      bytes,
+		Quota:      quota,
+		MaxFiles:   maxFiles,
+	}
+}
+
+// reserveUserStorage counts the file of an asset, of size bytes, about to
+// be stored for a user against their limits until the returned release is
+// called, by which time the asset record should count it.
+func (s *Server) reserveUserStorage(id, assetID string, size int64) (release func(), err error) {
+	if id == "" {
+		return func() {}, nil
+	}
+	u, _ := s.users.get(id)
+	quota, maxFiles := s.userLimits(u)
+	if quota == 0 && maxFiles == 0 {
+		return func() {}, nil
+	}
+	s.storageMu.Lock()
+	defer s.storageMu.Unlock()
+	files, used := s.userUsage(id)
+	if pending, ok := s.assets.get(assetID); ok && pending.User == id && pending.State != stateDeleted {
+		files--
+	}
+	reserved := s.userReserved[id]
+	files += reserved.files
+	used += reserved.bytes
+	switch {
+	case maxFiles > 0 && files+1 > maxFiles:
+		return nil, fmt.Errorf("%w: %d of %d files stored", errUserQuota, files, maxFiles)
+	case quota > 0 && used+size > quota:
+		return nil, fmt.Errorf("%w: %d of %d bytes in use", errUserQuota, used, quota)
+	}
+	if s.userReserved == nil {
+		s.userReserved = make(map[string]userReservation)
+	}
+	s.userReserved[id] = userReservation{reserved.files + 1, reserved.bytes + size}
+	return func() {
+		s.storageMu.Lock()
+		r := s.userReserved[id]
+		if r.files--; r.files == 0 {
+			delete(s.userReserved, id)
+		} else {
+			r.bytes -= size
+			s.userReserved[id] = r
+		}
+		s.storageMu.Unlock()
+	}, nil
+}
+
+// userReservation is what uploads being stored for a user add to their
+// usage.
+type userReservation struct {
+	files int
+	bytes int64
+}
+
+// userHandler returns a user with their usage, for the bot to show.
+func (s *Server) userHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+	u, ok := s.users.get(strings.ToLower(r.PathValue("id")))
+	if !ok {
+		s.sendEnvelopeError(w, r, http.StatusNotFound, "not_found", "User not found")
+		return
+	}
+	sendEnvelope(w, http.StatusOK, s.userV1(u))
+}
+
+// userAssetsHandler lists the files stored for a user, newest first, for
+// a !myfiles command.  It takes the filters of the admin search, and lists
+// the files that are not deleted unless a state is given.
+func (s *Server) userAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAPIKey(r) {
+		s.sendEnvelopeError(w, r, http.StatusUnauthorized, "unauthorized", "Invalid API key")
+		return
+	}
+	f, msg := parseAssetFilter(r.URL.Query())
+	if msg != "" {
+		s.sendEnvelopeError(w, r, http.StatusBadRequest, "invalid_filter", msg)
+		return
+	}
+	f.User = strings.ToLower(r.PathValue("id"))
+	if _, ok := s.users.get(f.User); !ok {
+		s.sendEnvelopeError(w, r, http.StatusNotFound, "not_found", "User not found")
+		return
+	}
+
+	var assets []Asset
+	for _, asset := range s.assets.list() {
+		if f.match(&asset) && (f.State != "" || asset.State != stateDeleted) {
+			assets = append(assets, asset)
+		}
+	}
+	sort.Slice(assets, func(i, j int) bool { return assets[i].UploadedAt.After(assets[j].UploadedAt) })
+	if len(assets) > f.Limit {
+		assets = assets[:f.Limit]
+	}
+	list := []AssetV1{}
+	for _, asset := range assets {
+		list = append(list, s.originAsset(r, s.assetV1(&asset, "")))
+	}
+	sendEnvelope(w, http.StatusOK, list)
+}
+
+// adminListUsersHandler lists the users with their usage, those seen most
+// recently first.
+func (s *Server) adminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	users := s.users.list()
+	sort.Slice(users, func(i, j int) bool { return users[i].LastSeenAt.After(users[j].LastSeenAt) })
+	list := []UserV1{}
+	for _, u := range users {
+		list = append(list, s.userV1(u))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// adminUpdateUserHandler sets the quota and max_files of a user, replacing
+// the configured ones.  0 restores those, and -1 is unlimited.
+func (s *Server) adminUpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Quota    *int64 `json:"quota"`
+		MaxFiles *int   `json:"max_files"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.bodyLimit(r, maxRequestSize))).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "Invalid request body"})
+		return
+	}
+	if (req.Quota != nil && *req.Quota < -1) || (req.MaxFiles != nil && *req.MaxFiles < -1) {
+		writeJSON(w, http.StatusBadRequest, Response{Message: "quota and max_files must be -1 or more"})
+		return
+	}
+	id := strings.ToLower(r.PathValue("id"))
+	u, err := s.users.update(id, func(u *User) error {
+		if req.Quota != nil {
+			u.Quota = *req.Quota
+		}
+		if req.MaxFiles != nil {
+			u.MaxFiles = *req.MaxFiles
+		}
+		return nil
+	})
+	if errors.Is(err, errRecordNotFound) {
+		writeJSON(w, http.StatusNotFound, Response{Message: "User not found"})
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, Response{Message: fmt.Sprintf("Error updating user: %v", err)})
+		return
+	}
+	quota, maxFiles := s.userLimits(u)
+	s.audit(r.Context(), "admin", auditUserChange, "user:"+id, fmt.Sprintf("quota %d, max_files %d", quota, maxFiles))
+	writeJSON(w, http.StatusOK, s.userV1(u))
+}
@@ -0,0 +1,141 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// variantOriginal is the variant keeping an upload as it was sent when the
+// stored file was converted.
+const variantOriginal = "original"
+
+// Variant is an alternative rendition of an asset, stored alongside it and
+// downloaded from the asset's download URL with the variant name appended.
+type Variant struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+
+	// Width and Height are set for resized images
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+}
+
+// VariantV1 is version 1 of a variant entry of an asset object.
+type VariantV1 struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+}
+
+// variantFile is a variant waiting to be written by saveAsset.
+type variantFile struct {
+	name        string
+	contentType string
+	data        []byte
+	width       int
+	height      int
+}
+
+func (s *Server) variantDir() string {
+	return filepath.Join(s.config.UploadDir, ".variants")
+}
+
+func variantName(id, name string) string {
+	return id + "." + name
+}
+
+func (s *Server) variantPath(id, name string) string {
+	return filepath.Join(s.variantDir(), variantName(id, name))
+}
+
+func (s *Server) variantURL(id, name string) string {
+	return s.downloadURL(id) + "/" + name
+}
+
+// variantFilePath is where the file of a variant of an asset is, which is
+// the staging area for dry runs.
+func (s *Server) variantFilePath(asset *Asset, name string) string {
+	if asset.DryRun {
+		return s.dryRunPath(variantName(asset.ID, name))
+	}
+	return s.variantPath(asset.ID, name)
+}
+
+// writeVariants stores the variants of a new asset.
+func (s *Server) writeVariants(asset *Asset, files []variantFile) ([]Variant, error) {
+	var variants []Variant
+	for _, f := range files {
+		if err := os.WriteFile(s.variantFilePath(asset, f.name), f.data, 0644); err != nil {
+			return variants, err
+		}
+		sum := sha256.Sum256(f.data)
+		variants = append(variants, Variant{
+			Name:        f.name,
+			ContentType: f.contentType,
+			Size:        int64(len(f.data)),
+			SHA256:      hex.EncodeToString(sum[:]),
+			Width:       f.width,
+			Height:      f.height,
+		})
+	}
+	return variants, nil
+}
+
+func (s *Server) removeVariants(asset Asset) {
+	for _, v := range asset.Variants {
+		path := s.variantFilePath(&asset, v.Name)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error removing variant %s: %v\n", path, err)
+		}
+	}
+}
+
+func (a *Asset) variant(name string) (Variant, bool) {
+	for _, v := range a.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// sendVariant serves a variant of an active asset the caller has checked
+// may be downloaded.  Fetching a variant counts as a download of the asset.
+func (s *Server) sendVariant(w http.ResponseWriter, r *http.Request, asset Asset, name string) {
+	v, ok := asset.variant(name)
+	if !ok {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+
+	phase := newPhaseSpans(r.Context())
+	defer phase.end()
+	phase.start("open")
+
+	path := s.variantPath(asset.ID, v.Name)
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && s.restoreReplica(r.Context(), asset, variantName(asset.ID, v.Name), path) == nil {
+		file, err = os.Open(path)
+	}
+	if err != nil {
+		s.httpError(w, r, "File not found", http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	s.sendDownload(w, r, phase, asset, v.Name, asset.ID+s.storedExtension("", v.ContentType), file, v.Size)
+}
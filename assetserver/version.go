@@ -0,0 +1,98 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// APIRevision is the semantic version of the HTTP API, sent in the
+// API-Version header of every response.  Its major version is the one in
+// the /api/v1 paths; the minor version grows with additions clients may
+// look for, and the patch version with fixes.
+const APIRevision = "1.0.0"
+
+// modulePath is the module the server is built from, to find its version
+// in the build info of the program embedding it.
+const modulePath = "github.com/karamble/braibot-assetserver"
+
+// Version, Commit and BuildTime describe the build, set with
+//
+//	go build -ldflags "-X github.com/karamble/braibot-assetserver/assetserver.Version=v1.2.0 \
+//	  -X github.com/karamble/braibot-assetserver/assetserver.Commit=$(git rev-parse HEAD)"
+//
+// Those left empty come from the build info Go records in the binary.
+var (
+	Version   string
+	Commit    string
+	BuildTime string
+)
+
+// BuildInfo describes the build of a server, as /version reports it.
+type BuildInfo struct {
+	Version     string `json:"version"`
+	Commit      string `json:"commit,omitempty"`
+	BuildTime   string `json:"build_time,omitempty"`
+	GoVersion   string `json:"go_version"`
+	APIVersion  string `json:"api_version"`
+	APIRevision string `json:"api_revision"`
+}
+
+// Build returns the version, commit and build time of the server.  The
+// version is "devel" for builds from a source checkout without one set.
+func Build() BuildInfo {
+	b := BuildInfo{
+		Version:     Version,
+		Commit:      Commit,
+		BuildTime:   BuildTime,
+		GoVersion:   runtime.Version(),
+		APIVersion:  apiVersion,
+		APIRevision: APIRevision,
+	}
+	info, ok := debug.ReadBuildInfo()
+	if ok && b.Version == "" {
+		if info.Main.Path == modulePath && info.Main.Version != "(devel)" {
+			b.Version = info.Main.Version
+		}
+		for _, dep := range info.Deps {
+			if dep.Path == modulePath {
+				b.Version = dep.Version
+			}
+		}
+	}
+	if ok && info.Main.Path == modulePath {
+		for _, setting := range info.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && b.Commit == "":
+				b.Commit = setting.Value
+			case setting.Key == "vcs.time" && b.BuildTime == "":
+				b.BuildTime = setting.Value
+			}
+		}
+	}
+	if b.Version == "" {
+		b.Version = "devel"
+	}
+	return b
+}
+
+// withAPIVersion sends the API revision with every response, so clients
+// can tell an incompatible server apart before relying on a response.
+func withAPIVersion(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", APIRevision)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// versionHandler reports the build of the server.  It needs no key, like
+// a health check.
+func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Build())
+}
@@ -0,0 +1,250 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// AssetVersion is content an asset had before it was replaced, kept until
+// the asset is deleted.
+type AssetVersion struct {
+	Version      int       `json:"version"`
+	OriginalName string    `json:"original_name"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256"`
+	StoredAt     time.Time `json:"stored_at"`
+	Encoding     string    `json:"encoding,omitempty"`
+	StoredSize   int64     `json:"stored_size,omitempty"`
+}
+
+// storedSize is the space the file of a version takes.
+func (v *AssetVersion) storedSize() int64 {
+	if v.Encoding != "" {
+		return v.StoredSize
+	}
+	return v.Size
+}
+
+// VersionV1 is version 1 of an earlier version entry of an asset object.
+type VersionV1 struct {
+	Version     int       `json:"version"`
+	URL         string    `json:"url"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	SHA256      string    `json:"sha256"`
+	StoredAt    time.Time `json:"stored_at"`
+}
+
+// version returns the number of the current content of an asset.
+func (a *Asset) version() int {
+	return max(a.Version, 1)
+}
+
+func (a *Asset) earlierVersion(n int) (AssetVersion, bool) {
+	for _, v := range a.Versions {
+		if v.Version == n {
+			return v, true
+		}
+	}
+	return AssetVersion{}, false
+}
+
+func (s *Server) versionDir() string {
+	return filepath.Join(s.config.UploadDir, ".versions")
+}
+
+func versionName(id string, n int) string {
+	return id + ".v" + strconv.Itoa(n)
+}
+
+func (s *Server) versionPath(id string, n int) string {
+	return filepath.Join(s.versionDir(), versionName(id, n))
+}
+
+func (s *Server) versionURL(id string, n int) string {
+	return s.downloadURL(id) + "?version=" + strconv.Itoa(n)
+}
+
+func (s *Server) removeVersions(asset Asset) {
+	for _, v := range asset.Versions {
+		path := s.versionPath(asset.ID, v.Version)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Error removing version %s: %v\n", path, err)
+		}
+	}
+}
+
+// replaceFile stores f as the new content of an asset, keeping the URL.
+// The file goes through the checks and processing of any upload as an
+// asset of its own, which then takes the place of the content: the
+// current file is kept as an earlier version, and the thumbnails,
+// variants, sidecars and streams of the new file replace those of the old
+// one.  Everything else about the asset stays.
+func (s *Server) replaceFile(ctx context.Context, actor, id string, f File) (AssetV1, *uploadError) {
+	if asset, ok := s.assets.get(id); !ok || asset.State != stateActive {
+		return AssetV1{}, &uploadError{http.StatusConflict, "not_active", "Only active assets can be replaced", nil}
+	} else if asset.Tier == tierCold {
+		return AssetV1{}, &uploadError{http.StatusConflict, "cold", "Asset is in cold storage", nil}
+	}
+
+	f.replaceOf = id
+	stored, uerr := s.putFile(ctx, actor, f)
+	if uerr != nil {
+		return AssetV1{}, uerr
+	}
+	if stored.DryRun {
+		return stored, nil
+	}
+	replacement, _ := s.assets.get(stored.ID)
+	saved, err := s.adoptReplacement(ctx, id, replacement)
+	if err != nil {
+		fmt.Printf("Error replacing %s with %s: %v\n", id, replacement.ID, err)
+		if _, derr := s.setAssetState(replacement.ID, stateDeleted, "replacement failed"); derr != nil {
+			fmt.Printf("Error deleting replacement %s: %v\n", replacement.ID, derr)
+		}
+		return AssetV1{}, &uploadError{http.StatusInternalServerError, "storage_error", fmt.Sprintf("Error replacing file: %v", err), nil}
+	}
+	s.audit(ctx, actor, auditReplace, id, fmt.Sprintf("version %d, %s, %d bytes", saved.Version, saved.ContentType, saved.Size))
+	s.publishEvent(auditReplace, id, actor, saved.Size, saved.ContentType)
+	s.sendVerdict(saved)
+	s.announceAsset(saved)
+	return s.assetV1(&saved, ""), nil
+}
+
+// adoptReplacement moves the files of a replacement, stored as the asset
+// t, to the asset id, whose current file becomes an earlier version, and
+// drops the record of t.
+func (s *Server) adoptReplacement(ctx context.Context, id string, t Asset) (Asset, error) {
+	if err := os.MkdirAll(s.versionDir(), 0755); err != nil {
+		return Asset{}, err
+	}
+	saved, err := s.assets.update(id, func(a *Asset) error {
+		if a.State != stateActive || a.Tier == tierCold {
+			return fmt.Errorf("asset is no longer active on disk")
+		}
+		old, n := *a, a.version()
+		if err := os.Rename(s.assetPath(id), s.versionPath(id, n)); err != nil {
+			return err
+		}
+
+		// Thumbnails and the like of the old file are named as those of
+		// the new one will be
+		s.removeThumbnails(old)
+		s.removeVariants(old)
+		s.removeStream(old)
+		s.removeSidecars(old)
+		moved := t
+		moved.ID = id
+		from, to := s.assetFiles(t, false), s.assetFiles(moved, false)
+		for i := range from {
+			if err := os.Rename(from[i], to[i]); err != nil && (i == 0 || !errors.Is(err, os.ErrNotExist)) {
+				if i == 0 {
+					os.Rename(s.versionPath(id, n), s.assetPath(id))
+				}
+				return err
+			}
+		}
+
+		storedAt := a.ReplacedAt
+		if storedAt.IsZero() {
+			storedAt = a.UploadedAt
+		}
+		a.Versions = append(a.Versions, AssetVersion{
+			Version:      n,
+			OriginalName: a.OriginalName,
+			ContentType:  a.ContentType,
+			Size:         a.Size,
+			SHA256:       a.SHA256,
+			StoredAt:     storedAt,
+			Encoding:     a.Encoding,
+			StoredSize:   a.StoredSize,
+		})
+		a.Version = n + 1
+		a.ReplacedAt = t.UploadedAt
+		a.OriginalName, a.ContentType, a.Size = t.OriginalName, t.ContentType, t.Size
+		a.SHA256, a.SourceSHA256 = t.SHA256, t.SourceSHA256
+		a.Encoding, a.StoredSize = t.Encoding, t.StoredSize
+		a.Thumbnails, a.Variants, a.Renditions = t.Thumbnails, t.Variants, t.Renditions
+		a.Sidecars, a.Transcript = t.Sidecars, t.Transcript
+		a.Pages, a.Audio = t.Pages, t.Audio
+		a.Width, a.Height, a.Orientation = t.Width, t.Height, t.Orientation
+		a.Color, a.Blurhash, a.Placeholder = t.Color, t.Blurhash, t.Placeholder
+		a.NSFW, a.Verdict = t.NSFW, t.Verdict
+		a.Delivery = nil
+		return nil
+	})
+	if err != nil {
+		return saved, err
+	}
+	if err := s.assets.remove(t.ID); err != nil {
+		fmt.Printf("Error removing the record of replacement %s: %v\n", t.ID, err)
+	}
+	s.removeReplicas(t)
+	if err := s.replicateAsset(ctx, saved); err != nil {
+		fmt.Printf("Error replicating replaced %s: %v\n", id, err)
+	}
+	return saved, nil
+}
+
+// replaceHandler replaces the content of an asset with the request body,
+// for its uploader.  The Content-Type header is trusted as a part's type
+// would be, and the filename parameter names the file.
+func (s *Server) replaceHandler(w http.ResponseWriter, r *http.Request) {
+	asset, ok := s.ownedAsset(w, r, "")
+	if !ok {
+		return
+	}
+	saved, uerr := s.replaceFile(r.Context(), requestKeyActor(r), asset.ID, File{
+		Name:        r.URL.Query().Get("filename"),
+		ContentType: r.Header.Get("Content-Type"),
+		Data:        http.MaxBytesReader(w, r.Body, s.bodyLimit(r, s.config.MaxFileSize+1)),
+	})
+	if uerr != nil {
+		s.rejectUpload(w, r, uerr)
+		return
+	}
+	sendEnvelope(w, http.StatusOK, s.originAsset(r, saved))
+}
+
+// sendVersion serves an earlier version of an active asset the caller has
+// checked may be downloaded.  Like a variant, it counts as a download of
+// the asset.
+func (s *Server) sendVersion(w http.ResponseWriter, r *http.Request, asset Asset, version string) {
+	n, err := strconv.Atoi(version)
+	v, ok := asset.earlierVersion(n)
+	if err != nil || !ok {
+		s.httpError(w, r, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	phase := newPhaseSpans(r.Context())
+	defer phase.end()
+	phase.start("open")
+
+	file, err := os.Open(s.versionPath(asset.ID, n))
+	if err != nil {
+		s.httpError(w, r, "Version not found", http.StatusNotFound)
+		return
+	}
+	content, size, err := storedContent(w, r, file, v.Encoding, v.storedSize(), v.Size)
+	if err != nil {
+		file.Close()
+		fmt.Printf("Error opening version %d of %s: %v\n", n, asset.ID, err)
+		s.httpError(w, r, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	s.sendDownload(w, r, phase, asset, "v"+strconv.Itoa(n), asset.ID+s.storedExtension("", v.ContentType), content, size)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// defaultQuotaWarning is how full storage may get before uploads carry a
+// warning, unless quota_warning is set.
+const defaultQuotaWarning = 0.8
+
+func (s *Server) validateQuotaWarning() error {
+	if s.config.QuotaWarning == 0 {
+		s.config.QuotaWarning = defaultQuotaWarning
+	}
+	if s.config.QuotaWarning != -1 && (s.config.QuotaWarning < 0 || s.config.QuotaWarning > 1) {
+		return fmt.Errorf("quota_warning must be between 0 and 1, or -1")
+	}
+	return nil
+}
+
+// Warning tells the client of a successful upload that a limit is close,
+// before uploads start failing on it.  Used and Limit are bytes, or files
+// for user_files.
+type Warning struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Used    int64  `json:"used"`
+	Limit   int64  `json:"limit"`
+}
+
+// quotaWarnings returns a warning for every limit past quota_warning after
+// assets were uploaded: max_storage_size and the quotas of their users.
+func (s *Server) quotaWarnings(r *http.Request, assets ...AssetV1) []Warning {
+	ratio := s.config.QuotaWarning
+	if ratio < 0 {
+		return nil
+	}
+	full := func(used, limit int64) bool {
+		return limit > 0 && float64(used) >= ratio*float64(limit)
+	}
+
+	var warnings []Warning
+	if limit := s.config.MaxStorageSize; limit > 0 {
+		if used := s.storageUsage(); full(used, limit) {
+			warnings = append(warnings, Warning{"storage", s.localize(r, "Storage is %d%% full", used*100/limit), used, limit})
+		}
+	}
+	seen := make(map[string]bool)
+	for _, a := range assets {
+		asset, ok := s.assets.get(a.ID)
+		if !ok || asset.User == "" || seen[asset.User] {
+			continue
+		}
+		seen[asset.User] = true
+		u, _ := s.users.get(asset.User)
+		quota, maxFiles := s.userLimits(u)
+		files, used := s.userUsage(u.ID)
+		if full(used, quota) {
+			warnings = append(warnings, Warning{"user_quota", s.localize(r, "User %s has used %d%% of their quota", u.ID, used*100/quota), used, quota})
+		}
+		if full(int64(files), int64(maxFiles)) {
+			warnings = append(warnings, Warning{"user_files", s.localize(r, "User %s has stored %d of %d files", u.ID, files, maxFiles), int64(files), int64(maxFiles)})
+		}
+	}
+	return warnings
+}
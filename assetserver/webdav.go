@@ -0,0 +1,213 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+// davPrefix is the path the asset tree is exported under.
+const davPrefix = "/dav"
+
+// davHandler exports upload_dir read-only over WebDAV, so operators can
+// mount the store and browse or copy assets with standard tools.
+func (s *Server) davHandler() http.Handler {
+	dav := &webdav.Handler{
+		Prefix:     davPrefix,
+		FileSystem: readOnlyFS{webdav.Dir(s.config.UploadDir), s},
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil && !os.IsNotExist(err) {
+				fmt.Printf("WebDAV %s %s: %v\n", r.Method, r.URL.Path, err)
+			}
+		},
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// WebDAV clients only speak Basic authentication, so the admin key
+		// is also accepted as its password, with any user name.
+		key := r.Header.Get("X-Admin-Key")
+		if _, password, ok := r.BasicAuth(); ok {
+			key = password
+		}
+		client := "ip:" + s.clientIP(r)
+		if subtle.ConstantTimeCompare([]byte(key), []byte(s.config.AdminKey)) != 1 {
+			if key != "" {
+				s.authFailed(r.Context(), client, r.URL.Path)
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="assetserver"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodOptions, http.MethodGet, http.MethodHead, "PROPFIND":
+			dav.ServeHTTP(w, r)
+		default:
+			w.Header().Set("Allow", "OPTIONS, GET, HEAD, PROPFIND")
+			http.Error(w, "Read-only", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// readOnlyFS refuses changes to the tree and hides the files being written
+// to it, which are named with a leading dot until they are complete.  Files
+// stored compressed are shown and read as their content.
+type readOnlyFS struct {
+	webdav.Dir
+	s *Server
+}
+
+func (d readOnlyFS) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return os.ErrPermission
+}
+
+func (d readOnlyFS) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, os.ErrPermission
+	}
+	if _, err := d.Stat(ctx, name); err != nil {
+		return nil, err
+	}
+	f, err := d.Dir.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	if encoding, size := d.storedEncoding(name); encoding != "" {
+		if f, err = openDecodedFile(f, size); err != nil {
+			return nil, err
+		}
+	}
+	return readOnlyFile{f}, nil
+}
+
+func (d readOnlyFS) RemoveAll(ctx context.Context, name string) error {
+	return os.ErrPermission
+}
+
+func (d readOnlyFS) Rename(ctx context.Context, oldName, newName string) error {
+	return os.ErrPermission
+}
+
+func (d readOnlyFS) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	fi, err := d.Dir.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if partialFile(fi) {
+		return nil, os.ErrNotExist
+	}
+	if encoding, size := d.storedEncoding(name); encoding != "" {
+		fi = contentFileInfo{fi, size}
+	}
+	return fi, nil
+}
+
+// storedEncoding returns the encoding of a file of an asset, or of an
+// earlier version of one, and the size of its content.  The encoding is
+// empty for files stored as they are.
+func (d readOnlyFS) storedEncoding(name string) (string, int64) {
+	dir, file := path.Split(path.Clean("/" + name))
+	switch dir {
+	case "/":
+		if a, ok := d.s.assets.get(file); ok {
+			return a.Encoding, a.Size
+		}
+	case "/" + filepath.Base(d.s.versionDir()) + "/":
+		i := strings.LastIndex(file, ".v")
+		if i < 0 {
+			break
+		}
+		n, err := strconv.Atoi(file[i+2:])
+		if err != nil {
+			break
+		}
+		if a, ok := d.s.assets.get(file[:i]); ok {
+			if v, ok := a.earlierVersion(n); ok {
+				return v.Encoding, v.Size
+			}
+		}
+	}
+	return "", 0
+}
+
+// partialFile reports whether a file is a temporary one, such as an upload
+// in progress.
+func partialFile(fi fs.FileInfo) bool {
+	return !fi.IsDir() && strings.HasPrefix(fi.Name(), ".")
+}
+
+type readOnlyFile struct {
+	webdav.File
+}
+
+// decodedFile reads the content of a file stored compressed.
+type decodedFile struct {
+	webdav.File
+	z *zstdFile
+}
+
+func openDecodedFile(f webdav.File, size int64) (webdav.File, error) {
+	z, err := openZstd(f, size)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return decodedFile{f, z}, nil
+}
+
+func (f decodedFile) Read(p []byte) (int, error) {
+	return f.z.Read(p)
+}
+
+func (f decodedFile) Seek(offset int64, whence int) (int64, error) {
+	return f.z.Seek(offset, whence)
+}
+
+func (f decodedFile) Close() error {
+	return f.z.Close()
+}
+
+func (f decodedFile) Stat() (fs.FileInfo, error) {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return contentFileInfo{fi, f.z.size}, nil
+}
+
+// contentFileInfo describes a compressed file by the size of its content.
+type contentFileInfo struct {
+	fs.FileInfo
+	size int64
+}
+
+func (fi contentFileInfo) Size() int64 {
+	return fi.size
+}
+
+func (f readOnlyFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (f readOnlyFile) Readdir(count int) ([]fs.FileInfo, error) {
+	entries, err := f.File.Readdir(count)
+	kept := entries[:0]
+	for _, fi := range entries {
+		if !partialFile(fi) {
+			kept = append(kept, fi)
+		}
+	}
+	return kept, err
+}
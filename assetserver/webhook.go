@@ -0,0 +1,137 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	webhookAttempts = 5
+	webhookTimeout  = 10 * time.Second
+)
+
+// WebhookEvent is posted to webhook_url when the checks of an upload are
+// done.  Bots can use it to retract messages linking assets that were
+// flagged after they were posted.  Files ingested over SFTP are also
+// announced, since their uploader gets no response carrying the URL, as
+// are clients locked out for guessing keys.
+type WebhookEvent struct {
+	Event     string     `json:"event"`
+	AssetID   string     `json:"asset_id,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	DeleteURL string     `json:"delete_url,omitempty"`
+	State     AssetState `json:"state,omitempty"`
+	Uploader  string     `json:"uploader,omitempty"`
+	Verdict   *Verdict   `json:"verdict,omitempty"`
+
+	// Client and Detail describe auth.lockout events
+	Client string `json:"client,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// webhookSignature signs a webhook body.  The timestamp is part of the
+// signed message so receivers can reject replays.
+func (s *Server) webhookSignature(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.config.WebhookSecret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendVerdict delivers the verdict of an asset's checks.  Dry runs are
+// gone by the time a receiver could look at them, so theirs isn't sent,
+// and new content of an asset is reported once it has replaced the old.
+func (s *Server) sendVerdict(asset Asset) {
+	if asset.Verdict == nil || asset.DryRun || asset.ReplaceOf != "" {
+		return
+	}
+	s.sendWebhook(WebhookEvent{
+		Event:    "asset.verdict",
+		AssetID:  asset.ID,
+		URL:      s.downloadURL(asset.ID),
+		State:    asset.State,
+		Uploader: asset.Uploader,
+		Verdict:  asset.Verdict,
+	})
+}
+
+// sendUploaded announces an asset stored without a client waiting for
+// the response, including its deletion URL.
+func (s *Server) sendUploaded(asset AssetV1, uploader string) {
+	s.sendWebhook(WebhookEvent{
+		Event:     "asset.uploaded",
+		AssetID:   asset.ID,
+		URL:       asset.URL,
+		DeleteURL: asset.DeleteURL,
+		State:     asset.State,
+		Uploader:  uploader,
+	})
+}
+
+// sendWebhook delivers an event in the background, retrying with backoff
+// until the receiver answers with a 2xx status.
+func (s *Server) sendWebhook(event WebhookEvent) {
+	if s.config.WebhookURL == "" {
+		return
+	}
+	subject := event.AssetID
+	if subject == "" {
+		subject = event.Client
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		fmt.Printf("Error encoding webhook for %s: %v\n", subject, err)
+		return
+	}
+
+	go func() {
+		client := &http.Client{Timeout: webhookTimeout}
+		delay := time.Second
+		for attempt := 1; ; attempt++ {
+			err := s.postWebhook(client, body)
+			if err == nil {
+				return
+			}
+			if attempt == webhookAttempts {
+				fmt.Printf("Giving up delivering webhook for %s: %v\n", subject, err)
+				return
+			}
+			fmt.Printf("Error delivering webhook for %s, retrying in %v: %v\n", subject, delay, err)
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}()
+}
+
+func (s *Server) postWebhook(client *http.Client, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.config.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", s.webhookSignature(timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultStagePriorities run quick stages that every image goes through
+// before slow transcodes.  Higher priorities get a free worker first.
+var defaultStagePriorities = map[string]int{
+	"exif_strip": 3,
+	"thumbnail":  3,
+	"page_count": 3,
+	"audio_info": 3,
+	"image_info": 3,
+	"scan":       2,
+	"nsfw_check": 2,
+	"provenance": 2,
+	"optimize":   1,
+	"srcset":     1,
+	"gif_video":  0,
+	"transcribe": 0,
+	"hls":        0,
+}
+
+func (s *Server) validateWorkerConfig() error {
+	if s.config.ProcessingWorkers == 0 {
+		s.config.ProcessingWorkers = runtime.NumCPU()
+	}
+	for name, timeout := range s.config.StageTimeouts {
+		if _, ok := processors[name]; !ok {
+			return fmt.Errorf("stage_timeouts: unknown stage %q", name)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("stage_timeouts: timeout of %s must be positive", name)
+		}
+	}
+	for name := range s.config.StagePriorities {
+		if _, ok := processors[name]; !ok {
+			return fmt.Errorf("stage_priorities: unknown stage %q", name)
+		}
+	}
+	return nil
+}
+
+func (s *Server) stagePriority(name string) int {
+	if priority, ok := s.config.StagePriorities[name]; ok {
+		return priority
+	}
+	return defaultStagePriorities[name]
+}
+
+// workerPool bounds the processing stages running at once.  Stages waiting
+// for a worker get one in order of priority, then of arrival.
+type workerPool struct {
+	mu      sync.Mutex
+	size    int
+	busy    int
+	seq     uint64
+	waiting []*poolWaiter
+}
+
+type poolWaiter struct {
+	stage    string
+	priority int
+	seq      uint64
+	ready    chan struct{}
+}
+
+// acquire waits for a worker to run a stage, failing if ctx is done first.
+// Every successful acquire must be followed by a release.
+func (p *workerPool) acquire(ctx context.Context, stage string, priority int) error {
+	p.mu.Lock()
+	if p.size <= 0 || (p.busy < p.size && len(p.waiting) == 0) {
+		p.busy++
+		p.mu.Unlock()
+		return nil
+	}
+	p.seq++
+	w := &poolWaiter{stage: stage, priority: priority, seq: p.seq, ready: make(chan struct{})}
+	i, _ := slices.BinarySearchFunc(p.waiting, w, func(a, b *poolWaiter) int {
+		return cmp.Or(cmp.Compare(b.priority, a.priority), cmp.Compare(a.seq, b.seq))
+	})
+	p.waiting = slices.Insert(p.waiting, i, w)
+	p.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+	p.mu.Lock()
+	if i := slices.Index(p.waiting, w); i >= 0 {
+		p.waiting = slices.Delete(p.waiting, i, i+1)
+		p.mu.Unlock()
+		return ctx.Err()
+	}
+	// The worker was handed over as ctx ended; pass it on
+	p.mu.Unlock()
+	p.release()
+	return ctx.Err()
+}
+
+// release hands a worker to the first waiting stage or frees it.
+func (p *workerPool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.waiting) == 0 {
+		p.busy--
+		return
+	}
+	w := p.waiting[0]
+	p.waiting = p.waiting[1:]
+	close(w.ready)
+}
+
+// ProcessingStats is the load of the processing workers: how many there
+// are (-1 for no limit), how many are running a stage and how many stages
+// wait for one, by stage.
+type ProcessingStats struct {
+	Workers int            `json:"workers"`
+	Busy    int            `json:"busy"`
+	Queued  map[string]int `json:"queued"`
+}
+
+func (p *workerPool) stats() ProcessingStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st := ProcessingStats{Workers: p.size, Busy: p.busy, Queued: make(map[string]int)}
+	for _, w := range p.waiting {
+		st.Queued[w.stage]++
+	}
+	return st
+}
+
+func (s *Server) adminProcessingHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.workers.stats())
+}
+
+type stageTimeoutKey struct{}
+
+// errNoWorker fails stages that got no worker in time.
+var errNoWorker = errors.New("no worker free")
+
+// runStage runs a stage on a worker, under its stage_timeouts entry if it
+// has one.  A stage that gets no worker before ctx is done fails with
+// errNoWorker, and one that panics with errPanicked.
+func (s *Server) runStage(ctx context.Context, stage Processor, p *processing) (err error) {
+	name := stage.Name()
+	queued := time.Now()
+	if err := s.workers.acquire(ctx, name, s.stagePriority(name)); err != nil {
+		return fmt.Errorf("%w: %w", errNoWorker, err)
+	}
+	defer s.workers.release()
+	if wait := time.Since(queued); wait > time.Second {
+		s.infof("Stage %s of %s waited %v for a worker\n", name, p.asset.ID, wait.Round(time.Millisecond))
+	}
+
+	if timeout, ok := s.config.StageTimeouts[name]; ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.WithValue(ctx, stageTimeoutKey{}, true), time.Duration(timeout))
+		defer cancel()
+	}
+	defer func() {
+		if rec := recover(); rec != nil {
+			s.recovered(ctx, "stage "+name+" of "+p.asset.ID, rec)
+			err = fmt.Errorf("%w: %v", errPanicked, rec)
+		}
+	}()
+	return stage.Process(ctx, s, p)
+}
+
+// toolContext bounds a run of an external tool by def, unless it runs in a
+// stage with a timeout of its own.
+func toolContext(ctx context.Context, def time.Duration) (context.Context, context.CancelFunc) {
+	if ctx.Value(stageTimeoutKey{}) != nil {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, def)
+}
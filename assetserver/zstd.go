@@ -0,0 +1,240 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package assetserver
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// encodingZstd is the encoding of files stored compressed with zstd, as
+// named in Content-Encoding.
+const encodingZstd = "zstd"
+
+// defaultCompressStorageTypes are the types compress_storage compresses
+// unless compress_storage_types is set: text, which compresses well, and
+// which nothing reads again once the upload is checked.
+var defaultCompressStorageTypes = []string{"text/*", "image/svg+xml", "application/json",
+	"application/xml", "application/javascript", "application/x-ndjson"}
+
+var zstdEncoders = sync.Pool{
+	New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	},
+}
+
+func (s *Server) validateStorageCompressionConfig() error {
+	if len(s.config.CompressStorageTypes) == 0 {
+		s.config.CompressStorageTypes = defaultCompressStorageTypes
+	}
+	for _, t := range s.config.CompressStorageTypes {
+		if !strings.Contains(t, "/") {
+			return fmt.Errorf("compress_storage_types: %q is not a content type", t)
+		}
+	}
+	return nil
+}
+
+// compressesType reports whether files of a type are stored compressed.
+func (s *Server) compressesType(contentType string) bool {
+	if !s.config.CompressStorage {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = contentType
+	}
+	return matchContentType(mediaType, s.config.CompressStorageTypes)
+}
+
+// storedSize is the space the file of an asset takes.
+func (a *Asset) storedSize() int64 {
+	if a.Encoding != "" {
+		return a.StoredSize
+	}
+	return a.Size
+}
+
+// compressFile writes the zstd compression of a file next to it and
+// returns its path and size, or an empty path if it is no smaller.
+func compressFile(path string) (string, int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".zstd-*")
+	if err != nil {
+		return "", 0, err
+	}
+
+	enc := zstdEncoders.Get().(*zstd.Encoder)
+	defer zstdEncoders.Put(enc)
+	enc.Reset(tmp)
+	_, err = enc.ReadFrom(src)
+	if cerr := enc.Close(); err == nil {
+		err = cerr
+	}
+	var size int64
+	if err == nil {
+		size, err = tmp.Seek(0, io.SeekCurrent)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil || size >= fi.Size() {
+		os.Remove(tmp.Name())
+		return "", 0, err
+	}
+	return tmp.Name(), size, nil
+}
+
+// compressUpload compresses the file of an upload about to be activated if
+// compress_storage covers its type, returning the path of the compressed
+// file, to take the place of the upload's, and its size.  The path is empty
+// if the file is stored as it is.
+func (s *Server) compressUpload(asset Asset) (string, int64) {
+	if asset.Blind || asset.DryRun || !s.compressesType(asset.ContentType) {
+		return "", 0
+	}
+	path, size, err := compressFile(s.assetPath(asset.ID))
+	if err != nil {
+		fmt.Printf("Error compressing %s: %v\n", asset.ID, err)
+		return "", 0
+	}
+	return path, size
+}
+
+// zstdFile reads the content of a file stored compressed with zstd, of
+// size bytes, or -1 if unknown.  Seeking only moves the offset; the next
+// read decompresses up to it, from the start if it lies behind, so a range
+// costs as much as reading up to its end.
+type zstdFile struct {
+	f    io.ReadSeekCloser
+	dec  *zstd.Decoder
+	pos  int64
+	off  int64
+	size int64
+}
+
+func openZstd(f io.ReadSeekCloser, size int64) (*zstdFile, error) {
+	dec, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdFile{f: f, dec: dec, size: size}, nil
+}
+
+func (z *zstdFile) Read(p []byte) (int, error) {
+	if z.off < z.pos {
+		if _, err := z.f.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if err := z.dec.Reset(z.f); err != nil {
+			return 0, err
+		}
+		z.pos = 0
+	}
+	if z.off > z.pos {
+		n, err := io.CopyN(io.Discard, z.dec, z.off-z.pos)
+		if z.pos += n; err != nil {
+			return 0, err
+		}
+	}
+	n, err := z.dec.Read(p)
+	z.pos += int64(n)
+	z.off = z.pos
+	return n, err
+}
+
+func (z *zstdFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += z.off
+	case io.SeekEnd:
+		if z.size < 0 {
+			return z.off, errors.New("cannot seek from the end of a compressed file")
+		}
+		offset += z.size
+	default:
+		return z.off, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return z.off, errors.New("negative position")
+	}
+	z.off = offset
+	return offset, nil
+}
+
+func (z *zstdFile) Close() error {
+	z.dec.Close()
+	return z.f.Close()
+}
+
+// encodedFile is a compressed file sent as it is stored, for a client
+// accepting its encoding, with content of size bytes.
+type encodedFile struct {
+	io.ReadSeekCloser
+	encoding string
+	size     int64
+}
+
+// delivered returns the part of the content of an encoded file of stored
+// bytes delivered by sending part of it: all of it once the whole file was
+// sent, and none before, as compressed offsets map to no content offsets.
+func (f *encodedFile) delivered(sent ByteRange, stored int64) (ByteRange, bool) {
+	if sent.Start > 0 || sent.End < stored {
+		return ByteRange{}, false
+	}
+	return ByteRange{0, f.size}, true
+}
+
+// storedContent prepares the stored file of some content for sending,
+// returning what to send and its size.  A file stored with an encoding is
+// sent as it is to clients accepting the encoding and asking for all of it,
+// and decompressed for others.
+func storedContent(w http.ResponseWriter, r *http.Request, file io.ReadSeekCloser, encoding string, stored, size int64) (io.ReadSeekCloser, int64, error) {
+	if encoding == "" {
+		return file, stored, nil
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	if r.Header.Get("Range") == "" && acceptsEncoding(r, encoding) {
+		return &encodedFile{file, encoding, size}, stored, nil
+	}
+	z, err := openZstd(file, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	return z, size, nil
+}
+
+// openContent opens a stored file for reading its content.
+func openContent(path, encoding string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil || encoding == "" {
+		return f, err
+	}
+	z, err := openZstd(f, -1)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return z, nil
+}
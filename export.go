@@ -0,0 +1,137 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/karamble/braibot-assetserver/assetserver"
+)
+
+// metaFlags collects repeated -meta key:value flags.
+type metaFlags map[string]string
+
+func (m metaFlags) String() string {
+	return fmt.Sprint(map[string]string(m))
+}
+
+func (m metaFlags) Set(v string) error {
+	key, value, ok := strings.Cut(v, ":")
+	if !ok || key == "" {
+		return fmt.Errorf("must have the form key:value")
+	}
+	m[key] = value
+	return nil
+}
+
+// tagFlags collects the -tag flags of the export command.
+type tagFlags []string
+
+func (t *tagFlags) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *tagFlags) Set(v string) error {
+	*t = append(*t, strings.ToLower(v))
+	return nil
+}
+
+// parseExportTime reads an RFC 3339 time or a date, taken as midnight UTC.
+func parseExportTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// runExport implements the export command, which writes the active assets
+// uploaded in a time range or carrying given metadata or tags as a static
+// gallery, to a directory or, for a destination ending in .tar.gz or -, a
+// gzipped tarball.  It returns the process exit status.
+func runExport(configPath string, args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: assetserver [-config path] export [flags] dir|file.tar.gz|-\n")
+		fs.PrintDefaults()
+	}
+	title := fs.String("title", "", "title of the gallery page")
+	since := fs.String("since", "", "only assets uploaded at or after this date or RFC 3339 time")
+	until := fs.String("until", "", "only assets uploaded before this date or RFC 3339 time")
+	meta := metaFlags{}
+	fs.Var(meta, "meta", "only assets with this top level metadata `key:value` (repeatable)")
+	var tags tagFlags
+	fs.Var(&tags, "tag", "only assets with this `tag` (repeatable)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	opts := assetserver.ExportOptions{Title: *title, Metadata: meta, Tags: tags}
+	var err error
+	if *since != "" {
+		if opts.Since, err = parseExportTime(*since); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -since: %v\n", err)
+			return 2
+		}
+	}
+	if *until != "" {
+		if opts.Until, err = parseExportTime(*until); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -until: %v\n", err)
+			return 2
+		}
+	}
+
+	// The tarball may go to standard output
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+
+	cfg, err := assetserver.LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	srv, err := assetserver.New(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer srv.Close()
+
+	dest := fs.Arg(0)
+	var n int
+	switch {
+	case dest == "-":
+		n, err = srv.ExportTarGz(context.Background(), opts, stdout)
+	case strings.HasSuffix(dest, ".tar.gz") || strings.HasSuffix(dest, ".tgz"):
+		n, err = exportToFile(srv, opts, dest)
+	default:
+		n, err = srv.ExportDir(context.Background(), opts, dest)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error exporting to %s: %v\n", dest, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d assets to %s\n", n, dest)
+	return 0
+}
+
+func exportToFile(srv *assetserver.Server, opts assetserver.ExportOptions, path string) (int, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := srv.ExportTarGz(context.Background(), opts, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
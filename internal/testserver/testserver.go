@@ -0,0 +1,175 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package testserver runs the asset server's HTTP handler in process for
+// end-to-end tests, with its files in temporary directories and a clock the
+// test moves forward.
+package testserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Clock is a fake clock that only moves when told to.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a clock stopped at start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Dirs are the directories a server keeps its files in.
+type Dirs struct {
+	Upload string
+	Data   string
+}
+
+// TempDirs returns fresh directories that are removed when the test ends.
+func TempDirs(t testing.TB) Dirs {
+	t.Helper()
+	root := t.TempDir()
+	dirs := Dirs{
+		Upload: filepath.Join(root, "uploads"),
+		Data:   filepath.Join(root, "data"),
+	}
+	for _, dir := range []string{dirs.Upload, dirs.Data} {
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dirs
+}
+
+// Server serves a handler on a loopback listener until the test ends.
+type Server struct {
+	*httptest.Server
+	t      testing.TB
+	apiKey string
+}
+
+// New starts serving h.  Requests made through the server's helpers carry
+// apiKey in the X-API-Key header.
+func New(t testing.TB, h http.Handler, apiKey string) *Server {
+	t.Helper()
+	s := &Server{Server: httptest.NewServer(h), t: t, apiKey: apiKey}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// url resolves a path, or a URL handed out by the server under its public
+// domain, against the test listener.
+func (s *Server) url(ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		s.t.Fatalf("bad URL %q: %v", ref, err)
+	}
+	base, _ := url.Parse(s.URL)
+	u.Scheme, u.Host = base.Scheme, base.Host
+	return u.String()
+}
+
+// Do sends a request built for method and ref, with the API key set.
+func (s *Server) Do(method, ref, contentType string, body io.Reader) *http.Response {
+	s.t.Helper()
+	req, err := http.NewRequest(method, s.url(ref), body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if s.apiKey != "" {
+		req.Header.Set("X-API-Key", s.apiKey)
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	s.t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// Get fetches a path or a URL handed out by the server.
+func (s *Server) Get(ref string) *http.Response {
+	s.t.Helper()
+	return s.Do(http.MethodGet, ref, "", nil)
+}
+
+// UploadMultipart posts files as a multipart form to path, each as a file
+// part of the named field.
+func (s *Server) UploadMultipart(path, field string, files map[string][]byte) *http.Response {
+	s.t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, data := range files {
+		fw, err := mw.CreateFormFile(field, name)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		fw.Write(data)
+	}
+	mw.Close()
+	return s.Do(http.MethodPost, path, mw.FormDataContentType(), &body)
+}
+
+// UploadForm posts a file as base64 in a urlencoded form to path.
+func (s *Server) UploadForm(path, name, contentType string, data []byte) *http.Response {
+	s.t.Helper()
+	form := url.Values{
+		"filename": {name},
+		"type":     {contentType},
+		"data":     {base64.StdEncoding.EncodeToString(data)},
+	}
+	return s.Do(http.MethodPost, path, "application/x-www-form-urlencoded",
+		strings.NewReader(form.Encode()))
+}
+
+// Body reads the whole body of a response.
+func Body(t testing.TB, resp *http.Response) []byte {
+	t.Helper()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// DecodeJSON decodes the JSON body of a response into v.
+func DecodeJSON(t testing.TB, resp *http.Response, v any) {
+	t.Helper()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("error decoding response to %s %s: %v",
+			resp.Request.Method, resp.Request.URL.Path, err)
+	}
+}
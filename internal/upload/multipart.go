@@ -0,0 +1,155 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package upload
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+)
+
+const (
+	// maxValueBytes bounds the fields of a multipart body other than files,
+	// which are always kept in memory
+	maxValueBytes = 10 << 20
+
+	// maxParts bounds the parts of a multipart body, each of which costs
+	// its headers in memory whatever its size
+	maxParts = 1000
+)
+
+// ErrMultipart is returned for a multipart body that can't be read.
+var ErrMultipart = errors.New("invalid multipart body")
+
+// TempFile holds a file part too large to keep in memory.  The server
+// decides where it lives and accounts for the space it takes.
+type TempFile interface {
+	io.Writer
+
+	// Close ends writing the file, which Open then reads back
+	Close() error
+	Open() (io.ReadCloser, error)
+
+	// Remove deletes the file
+	Remove() error
+}
+
+// MultipartForm is a multipart body read by ReadMultipart.  Its temporary
+// files stay until RemoveAll.
+type MultipartForm struct {
+	Value map[string][]string
+	File  map[string][]*Part
+
+	temp []TempFile
+}
+
+// Part is a file part of a multipart body, kept in memory or in a temporary
+// file.
+type Part struct {
+	Filename string
+	Header   textproto.MIMEHeader
+	Size     int64
+
+	data []byte
+	temp TempFile
+}
+
+// Open returns the content of a part.
+func (p *Part) Open() (io.ReadCloser, error) {
+	if p.temp != nil {
+		return p.temp.Open()
+	}
+	return io.NopCloser(bytes.NewReader(p.data)), nil
+}
+
+// RemoveAll deletes the temporary files of a form, returning the first
+// error.  It can be called more than once.
+func (f *MultipartForm) RemoveAll() error {
+	var err error
+	for _, t := range f.temp {
+		if rerr := t.Remove(); err == nil {
+			err = rerr
+		}
+	}
+	f.temp = nil
+	return err
+}
+
+// ReadMultipart reads a multipart body, keeping up to maxMemory bytes of
+// file parts in memory and writing those past it to files made by newTemp.
+// The files made are removed if reading fails or panics, so only a form
+// returned holds any, until its RemoveAll.
+func ReadMultipart(r *multipart.Reader, maxMemory int64, newTemp func() (TempFile, error)) (*MultipartForm, error) {
+	form := &MultipartForm{Value: make(map[string][]string), File: make(map[string][]*Part)}
+	done := false
+	defer func() {
+		if !done {
+			form.RemoveAll()
+		}
+	}()
+
+	valueBytes := int64(0)
+	for parts := 0; ; parts++ {
+		p, err := r.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if parts >= maxParts {
+			return nil, fmt.Errorf("%w: more than %d parts", ErrMultipart, maxParts)
+		}
+		name := p.FormName()
+		if name == "" {
+			continue
+		}
+
+		// Fields other than files are kept in memory, within their own
+		// limit
+		if p.FileName() == "" {
+			var b bytes.Buffer
+			n, err := io.Copy(&b, io.LimitReader(p, maxValueBytes-valueBytes+1))
+			if err != nil {
+				return nil, err
+			}
+			if valueBytes += n; valueBytes > maxValueBytes {
+				return nil, fmt.Errorf("%w: fields over %d bytes", ErrMultipart, maxValueBytes)
+			}
+			form.Value[name] = append(form.Value[name], b.String())
+			continue
+		}
+
+		part := &Part{Filename: p.FileName(), Header: p.Header}
+		var b bytes.Buffer
+		n, err := io.Copy(&b, io.LimitReader(p, maxMemory+1))
+		if err != nil {
+			return nil, err
+		}
+		if n <= maxMemory {
+			part.data, part.Size = b.Bytes(), n
+			maxMemory -= n
+		} else {
+			if part.temp, err = newTemp(); err != nil {
+				return nil, err
+			}
+			form.temp = append(form.temp, part.temp)
+			n, err = io.Copy(part.temp, io.MultiReader(&b, p))
+			if cerr := part.temp.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return nil, err
+			}
+			part.Size = n
+		}
+		form.File[name] = append(form.File[name], part)
+	}
+	done = true
+	return form, nil
+}
@@ -0,0 +1,299 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package upload parses the bodies of upload requests into files, apart
+// from checking and storing them, so that malformed requests can be tested
+// without a running server.
+package upload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Kind is the encoding of an upload request body.
+type Kind int
+
+const (
+	// Unsupported is a body the server doesn't accept uploads in.
+	Unsupported Kind = iota
+
+	// Multipart is a multipart/form-data body with one or more file parts.
+	Multipart
+
+	// Form is an application/x-www-form-urlencoded body carrying the file
+	// as base64 in the data field.
+	Form
+
+	// JSON is an application/json object carrying the file as base64 in
+	// its data_base64 member.
+	JSON
+)
+
+// String returns the name of the encoding.
+func (k Kind) String() string {
+	switch k {
+	case Multipart:
+		return "multipart"
+	case Form:
+		return "form"
+	case JSON:
+		return "json"
+	}
+	return "unsupported"
+}
+
+// Classify returns the encoding of a body with the given Content-Type.
+func Classify(contentType string) Kind {
+	switch {
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		return Multipart
+	case contentType == "application/x-www-form-urlencoded":
+		return Form
+	case contentType == "application/json" || strings.HasPrefix(contentType, "application/json;"):
+		return JSON
+	}
+	return Unsupported
+}
+
+var (
+	// ErrNoFile is returned when a request carries no file.
+	ErrNoFile = errors.New("no file in request")
+
+	// ErrTooManyFiles is returned for a multipart body with more file
+	// parts than allowed.
+	ErrTooManyFiles = errors.New("too many files")
+
+	// ErrTooLarge is returned for a file over the size limit.
+	ErrTooLarge = errors.New("file too large")
+
+	// ErrBase64 is returned for form data that isn't valid base64.
+	ErrBase64 = errors.New("invalid base64 data")
+
+	// ErrJSON is returned for a JSON body that isn't a valid upload object.
+	ErrJSON = errors.New("invalid JSON upload")
+)
+
+// SizeError is ErrTooLarge for a file whose size is known.
+type SizeError struct {
+	Size  int64
+	Limit int64
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("%v: %d bytes, limit %d", ErrTooLarge, e.Size, e.Limit)
+}
+
+// Is makes a SizeError match ErrTooLarge.
+func (e *SizeError) Is(target error) bool {
+	return target == ErrTooLarge
+}
+
+// File is an uploaded file before it is checked.  Type is the content type
+// the client declared, if any.
+type File struct {
+	Name string
+	Type string
+	Data []byte
+}
+
+// ParseForm returns the file of a form upload: the base64 data field, named
+// by the filename field (default file.dat) and typed by the type field or
+// the X-File-Type header.
+func ParseForm(form url.Values, header http.Header, maxSize int64) (File, error) {
+	f := File{Name: form.Get("filename"), Type: form.Get("type")}
+	if f.Name == "" {
+		f.Name = "file.dat"
+	}
+	if f.Type == "" {
+		f.Type = header.Get("X-File-Type")
+	}
+
+	data := form.Get("data")
+	if data == "" {
+		return f, ErrNoFile
+	}
+	var err error
+	if f.Data, err = DecodeBase64(data, maxSize); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+// jsonUpload is the body of a JSON upload.
+type jsonUpload struct {
+	Filename    string          `json:"filename"`
+	ContentType string          `json:"content_type"`
+	DataBase64  string          `json:"data_base64"`
+	Metadata    json.RawMessage `json:"metadata"`
+	Password    string          `json:"password"`
+	Blind       *bool           `json:"blind"`
+	Recipients  []string        `json:"recipients"`
+	Tags        []string        `json:"tags"`
+}
+
+// ParseJSON returns the file of a JSON upload: the base64 data_base64
+// member, named by filename (default file.dat) and typed by content_type.
+// The metadata, password, blind, recipients and tags members are returned
+// as the form fields of the same names, so they can be handled like those
+// of a form upload.
+func ParseJSON(body io.Reader, maxSize int64) (File, url.Values, error) {
+	var u jsonUpload
+	dec := json.NewDecoder(body)
+	if err := dec.Decode(&u); err != nil {
+		return File{}, nil, fmt.Errorf("%w: %w", ErrJSON, err)
+	}
+	if dec.More() {
+		return File{}, nil, ErrJSON
+	}
+
+	f := File{Name: u.Filename, Type: u.ContentType}
+	if f.Name == "" {
+		f.Name = "file.dat"
+	}
+	fields := url.Values{}
+	if f.Type != "" {
+		fields.Set("type", f.Type)
+	}
+	if len(u.Metadata) > 0 && string(u.Metadata) != "null" {
+		fields.Set("metadata", string(u.Metadata))
+	}
+	if u.Password != "" {
+		fields.Set("password", u.Password)
+	}
+	if u.Blind != nil {
+		fields.Set("blind", strconv.FormatBool(*u.Blind))
+	}
+	for _, key := range u.Recipients {
+		fields.Add("recipients", key)
+	}
+	for _, tag := range u.Tags {
+		fields.Add("tags", tag)
+	}
+
+	if u.DataBase64 == "" {
+		return f, fields, ErrNoFile
+	}
+	var err error
+	if f.Data, err = DecodeBase64(u.DataBase64, maxSize); err != nil {
+		return f, fields, err
+	}
+	return f, fields, nil
+}
+
+// DecodeBase64 decodes standard, padded base64 of at most maxSize bytes.
+func DecodeBase64(s string, maxSize int64) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBase64, err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, &SizeError{int64(len(data)), maxSize}
+	}
+	return data, nil
+}
+
+// MultipartFiles returns the file parts of a multipart form, given either
+// as repeated file parts or as files[], refusing more than maxFiles.
+// single reports a lone file part, which keeps the original response
+// format rather than that of a batch.
+func MultipartFiles(form *MultipartForm, maxFiles int) (parts []*Part, single bool, err error) {
+	files := form.File["file"]
+	batch := form.File["files[]"]
+	parts = append(append([]*Part{}, files...), batch...)
+	if len(parts) == 0 {
+		return nil, false, ErrNoFile
+	}
+	if len(parts) > maxFiles {
+		return nil, false, ErrTooManyFiles
+	}
+	return parts, len(files) == 1 && len(batch) == 0, nil
+}
+
+// OpenPart opens a file part of at most maxSize bytes for reading.  A part
+// that can't be opened is reported as ErrNoFile.
+func OpenPart(part *Part, maxSize int64) (io.ReadCloser, error) {
+	if part.Size > maxSize {
+		return nil, &SizeError{part.Size, maxSize}
+	}
+	file, err := part.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoFile, err)
+	}
+	return file, nil
+}
+
+// ReadPart reads a file part of at most maxSize bytes.  A part that can't
+// be opened is reported as ErrNoFile.
+func ReadPart(part *Part, maxSize int64) (File, error) {
+	f := File{Name: part.Filename, Type: part.Header.Get("Content-Type")}
+	file, err := OpenPart(part, maxSize)
+	if err != nil {
+		return f, err
+	}
+	defer file.Close()
+
+	if f.Data, err = io.ReadAll(io.LimitReader(file, maxSize+1)); err != nil {
+		return f, err
+	}
+	if int64(len(f.Data)) > maxSize {
+		return f, ErrTooLarge
+	}
+	return f, nil
+}
+
+// SniffLen is how much of a file ContentType looks at when sniffing.
+const SniffLen = 512
+
+// Head reads the first SniffLen bytes of a file, or all of a shorter one,
+// so that its type can be sniffed before the rest is read.  The returned
+// reader yields the whole file, head included.
+func Head(r io.Reader) ([]byte, io.Reader, error) {
+	head := make([]byte, SniffLen)
+	n, err := io.ReadFull(r, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	head = head[:n]
+	return head, io.MultiReader(bytes.NewReader(head), r), err
+}
+
+// ContentType resolves the type of an uploaded file from the first of the
+// declared types that is set, or else by sniffing the data, of which the
+// first SniffLen bytes are enough.  Files declared or detected as
+// application/octet-stream get the image or PDF type their signature
+// indicates, since clients often send them untyped.
+func ContentType(data []byte, declared ...string) string {
+	contentType := ""
+	for _, t := range declared {
+		if t != "" {
+			contentType = t
+			break
+		}
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	if contentType != "application/octet-stream" {
+		return contentType
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return "application/pdf"
+	case len(data) > 4 && bytes.HasPrefix(data, []byte{0x89, 0x50, 0x4E, 0x47}):
+		return "image/png"
+	case len(data) > 3 && bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	}
+	return contentType
+}
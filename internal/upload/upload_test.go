@@ -0,0 +1,366 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package upload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        Kind
+	}{
+		{"multipart/form-data; boundary=x", Multipart},
+		{"multipart/form-data", Multipart},
+		{"application/x-www-form-urlencoded", Form},
+		{"application/x-www-form-urlencoded; charset=utf-8", Unsupported},
+		{"application/json", JSON},
+		{"application/json; charset=utf-8", JSON},
+		{"application/jsonp", Unsupported},
+		{"", Unsupported},
+	}
+	for _, test := range tests {
+		if got := Classify(test.contentType); got != test.want {
+			t.Errorf("Classify(%q) = %v, want %v", test.contentType, got, test.want)
+		}
+	}
+}
+
+func TestParseForm(t *testing.T) {
+	form := url.Values{"data": {base64.StdEncoding.EncodeToString([]byte("hello"))}}
+	header := http.Header{"X-File-Type": {"text/plain"}}
+	f, err := ParseForm(form, header, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "file.dat" || f.Type != "text/plain" || string(f.Data) != "hello" {
+		t.Errorf("ParseForm = %+v", f)
+	}
+
+	var sizeErr *SizeError
+	if _, err := ParseForm(form, header, 4); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("over size limit: got %v, want %v", err, ErrTooLarge)
+	} else if !errors.As(err, &sizeErr) || sizeErr.Size != 5 || sizeErr.Limit != 4 {
+		t.Errorf("over size limit: got %v, want the size and limit", err)
+	}
+	if _, err := ParseForm(url.Values{}, header, 5); !errors.Is(err, ErrNoFile) {
+		t.Errorf("without data: got %v, want %v", err, ErrNoFile)
+	}
+	form.Set("data", "not base64!")
+	if _, err := ParseForm(form, header, 100); !errors.Is(err, ErrBase64) {
+		t.Errorf("bad data: got %v, want %v", err, ErrBase64)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	body := `{"filename": "a.txt", "content_type": "text/plain", "data_base64": "aGVsbG8=",
+		"metadata": {"prompt": "hi"}, "password": "secret", "blind": false, "recipients": ["k1", "k2"], "tags": ["bot"]}`
+	f, fields, err := ParseJSON(strings.NewReader(body), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "a.txt" || f.Type != "text/plain" || string(f.Data) != "hello" {
+		t.Errorf("ParseJSON = %+v", f)
+	}
+	want := url.Values{"type": {"text/plain"}, "metadata": {`{"prompt": "hi"}`}, "password": {"secret"}, "blind": {"false"},
+		"recipients": {"k1", "k2"}, "tags": {"bot"}}
+	if fields.Encode() != want.Encode() {
+		t.Errorf("fields = %v, want %v", fields, want)
+	}
+
+	tests := []struct {
+		body string
+		want error
+	}{
+		{`{"data_base64": "aGVsbG8="}`, nil},
+		{`{"data_base64": "aGVsbG8h"}`, ErrTooLarge},
+		{`{"filename": "a.txt"}`, ErrNoFile},
+		{`{"data_base64": "not base64!"}`, ErrBase64},
+		{`{"data_base64": 5}`, ErrJSON},
+		{`{} {}`, ErrJSON},
+		{``, ErrJSON},
+	}
+	for _, test := range tests {
+		_, _, err := ParseJSON(strings.NewReader(test.body), 5)
+		if !errors.Is(err, test.want) || (test.want == nil && err != nil) {
+			t.Errorf("ParseJSON(%q): got %v, want %v", test.body, err, test.want)
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n")
+	tests := []struct {
+		data     []byte
+		declared []string
+		want     string
+	}{
+		{png, nil, "image/png"},
+		{png, []string{"", "image/gif"}, "image/gif"},
+		{png, []string{"application/octet-stream"}, "image/png"},
+		{[]byte("\xff\xd8\xff\xe0"), []string{"application/octet-stream"}, "image/jpeg"},
+		{[]byte("%PDF-1.7"), []string{"application/octet-stream"}, "application/pdf"},
+		{[]byte{0, 1, 2}, nil, "application/octet-stream"},
+	}
+	for _, test := range tests {
+		if got := ContentType(test.data, test.declared...); got != test.want {
+			t.Errorf("ContentType(%q, %q) = %q, want %q", test.data, test.declared, got, test.want)
+		}
+	}
+}
+
+func TestHead(t *testing.T) {
+	for _, size := range []int{0, 10, SniffLen, SniffLen + 1, 3 * SniffLen} {
+		data := bytes.Repeat([]byte("a"), size)
+		head, r, err := Head(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Head of %d bytes: %v", size, err)
+		}
+		if want := min(size, SniffLen); len(head) != want {
+			t.Errorf("Head of %d bytes read %d, want %d", size, len(head), want)
+		}
+		if all, err := io.ReadAll(r); err != nil || !bytes.Equal(all, data) {
+			t.Errorf("Head of %d bytes gave back %d bytes, %v", size, len(all), err)
+		}
+	}
+}
+
+// FuzzClassify checks that only the multipart and form encodings are
+// accepted, whatever the Content-Type header holds.
+func FuzzClassify(f *testing.F) {
+	for _, s := range []string{
+		"multipart/form-data; boundary=abc",
+		"application/x-www-form-urlencoded",
+		"application/json; charset=utf-8",
+		"application/octet-stream",
+		"MULTIPART/FORM-DATA",
+		"",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, contentType string) {
+		kind := Classify(contentType)
+		switch {
+		case strings.HasPrefix(contentType, "multipart/form-data"):
+			if kind != Multipart {
+				t.Errorf("Classify(%q) = %v, want multipart", contentType, kind)
+			}
+		case contentType == "application/x-www-form-urlencoded":
+			if kind != Form {
+				t.Errorf("Classify(%q) = %v, want form", contentType, kind)
+			}
+		case contentType == "application/json" || strings.HasPrefix(contentType, "application/json;"):
+			if kind != JSON {
+				t.Errorf("Classify(%q) = %v, want json", contentType, kind)
+			}
+		default:
+			if kind != Unsupported {
+				t.Errorf("Classify(%q) = %v, want unsupported", contentType, kind)
+			}
+		}
+	})
+}
+
+// FuzzDecodeBase64 checks that arbitrary form data either decodes within
+// the size limit or fails with one of the documented errors, and that
+// encoded files survive the trip.
+func FuzzDecodeBase64(f *testing.F) {
+	f.Add("aGVsbG8=", int64(5))
+	f.Add("aGVsbG8", int64(5))
+	f.Add("aGVs\r\nbG8=", int64(5))
+	f.Add("====", int64(0))
+	f.Add("", int64(-1))
+	f.Fuzz(func(t *testing.T, s string, maxSize int64) {
+		data, err := DecodeBase64(s, maxSize)
+		if err != nil {
+			if !errors.Is(err, ErrBase64) && !errors.Is(err, ErrTooLarge) {
+				t.Fatalf("DecodeBase64(%q): unexpected error %v", s, err)
+			}
+			return
+		}
+		if int64(len(data)) > maxSize {
+			t.Fatalf("DecodeBase64(%q, %d) returned %d bytes", s, maxSize, len(data))
+		}
+
+		raw := []byte(s)
+		got, err := DecodeBase64(base64.StdEncoding.EncodeToString(raw), int64(len(raw)))
+		if err != nil || !bytes.Equal(got, raw) {
+			t.Fatalf("round trip of %q: got %q, %v", raw, got, err)
+		}
+	})
+}
+
+// testTempFile is a TempFile in a test's temporary directory.
+type testTempFile struct {
+	*os.File
+}
+
+func (f testTempFile) Open() (io.ReadCloser, error) {
+	return os.Open(f.Name())
+}
+
+func (f testTempFile) Remove() error {
+	return os.Remove(f.Name())
+}
+
+func tempFiles(t testing.TB) func() (TempFile, error) {
+	dir := t.TempDir()
+	return func() (TempFile, error) {
+		f, err := os.CreateTemp(dir, "part-*")
+		return testTempFile{f}, err
+	}
+}
+
+func TestReadMultipart(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.SetBoundary("boundary")
+	mw.WriteField("tags", "a,b")
+	fw, _ := mw.CreateFormFile("file", "small.txt")
+	fw.Write([]byte("hello"))
+	fw, _ = mw.CreateFormFile("files[]", "large.bin")
+	fw.Write(bytes.Repeat([]byte{1}, 100))
+	mw.Close()
+
+	newTemp := tempFiles(t)
+	var temps []string
+	form, err := ReadMultipart(multipart.NewReader(bytes.NewReader(body.Bytes()), "boundary"), 16,
+		func() (TempFile, error) {
+			f, err := newTemp()
+			temps = append(temps, f.(testTempFile).Name())
+			return f, err
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := form.Value["tags"]; len(got) != 1 || got[0] != "a,b" {
+		t.Fatalf("tags %q", got)
+	}
+	parts, single, err := MultipartFiles(form, 2)
+	if err != nil || single || len(parts) != 2 {
+		t.Fatalf("%d parts, single %v: %v", len(parts), single, err)
+	}
+	if len(temps) != 1 {
+		t.Fatalf("%d temporary files, want the large part's only", len(temps))
+	}
+	for _, part := range parts {
+		file, err := ReadPart(part, 100)
+		if err != nil || int64(len(file.Data)) != part.Size {
+			t.Fatalf("reading %s: %d bytes of %d: %v", part.Filename, len(file.Data), part.Size, err)
+		}
+	}
+	if err := form.RemoveAll(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(temps[0]); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left after RemoveAll: %v", err)
+	}
+
+	// A body cut off after a part spilled leaves nothing behind
+	temps = nil
+	cut := body.Bytes()[:body.Len()-20]
+	if _, err := ReadMultipart(multipart.NewReader(bytes.NewReader(cut), "boundary"), 16,
+		func() (TempFile, error) {
+			f, err := newTemp()
+			temps = append(temps, f.(testTempFile).Name())
+			return f, err
+		}); err == nil {
+		t.Fatal("truncated body read")
+	}
+	if len(temps) != 1 {
+		t.Fatalf("%d temporary files made", len(temps))
+	}
+	if _, err := os.Stat(temps[0]); !os.IsNotExist(err) {
+		t.Fatalf("temporary file left after a failed read: %v", err)
+	}
+}
+
+// FuzzMultipart feeds arbitrary bodies through the multipart path, checking
+// that the files found respect the limits.
+func FuzzMultipart(f *testing.F) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.SetBoundary("boundary")
+	fw, _ := mw.CreateFormFile("file", "a.txt")
+	fw.Write([]byte("hello"))
+	fw, _ = mw.CreateFormFile("files[]", "b.png")
+	fw.Write([]byte("\x89PNG\r\n\x1a\n"))
+	mw.Close()
+	f.Add(body.Bytes(), 2, int64(8))
+	f.Add([]byte("--boundary\r\n\r\n--boundary--\r\n"), 1, int64(1))
+	f.Add([]byte{}, 0, int64(0))
+
+	f.Fuzz(func(t *testing.T, body []byte, maxFiles int, maxSize int64) {
+		if maxSize < 0 || maxSize > 1<<20 {
+			return
+		}
+		form, err := ReadMultipart(multipart.NewReader(bytes.NewReader(body), "boundary"), 4, tempFiles(t))
+		if err != nil {
+			return
+		}
+		defer form.RemoveAll()
+
+		parts, single, err := MultipartFiles(form, maxFiles)
+		if err != nil {
+			if !errors.Is(err, ErrNoFile) && !errors.Is(err, ErrTooManyFiles) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			return
+		}
+		if len(parts) == 0 || len(parts) > maxFiles {
+			t.Fatalf("%d files with a limit of %d", len(parts), maxFiles)
+		}
+		if single && len(parts) != 1 {
+			t.Fatalf("single upload with %d files", len(parts))
+		}
+		for _, part := range parts {
+			file, err := ReadPart(part, maxSize)
+			if err != nil {
+				if !errors.Is(err, ErrTooLarge) {
+					t.Fatalf("reading %q: %v", part.Filename, err)
+				}
+				continue
+			}
+			if int64(len(file.Data)) > maxSize {
+				t.Fatalf("read %d bytes with a limit of %d", len(file.Data), maxSize)
+			}
+			if ContentType(file.Data, file.Type) == "" {
+				t.Fatalf("no content type for %q", part.Filename)
+			}
+		}
+	})
+}
+
+// FuzzParseJSON checks that arbitrary JSON bodies either give a file within
+// the size limit or fail with one of the documented errors.
+func FuzzParseJSON(f *testing.F) {
+	f.Add([]byte(`{"filename": "a.txt", "data_base64": "aGVsbG8=", "metadata": {"a": 1}}`), int64(5))
+	f.Add([]byte(`{"data_base64": "aGVsbG8=", "blind": true}`), int64(4))
+	f.Add([]byte(`{"data_base64": null}`), int64(5))
+	f.Add([]byte(`[]`), int64(5))
+	f.Fuzz(func(t *testing.T, body []byte, maxSize int64) {
+		file, _, err := ParseJSON(bytes.NewReader(body), maxSize)
+		if err != nil {
+			if !errors.Is(err, ErrJSON) && !errors.Is(err, ErrNoFile) &&
+				!errors.Is(err, ErrBase64) && !errors.Is(err, ErrTooLarge) {
+				t.Fatalf("ParseJSON(%q): unexpected error %v", body, err)
+			}
+			return
+		}
+		if int64(len(file.Data)) > maxSize || file.Name == "" {
+			t.Fatalf("ParseJSON(%q, %d) = %+v", body, maxSize, file)
+		}
+	})
+}
@@ -0,0 +1,1321 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        v5.29.3
+// source: assetserver.proto
+
+package assetserverv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type UploadRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*UploadRequest_Info
+	//	*UploadRequest_Chunk
+	Payload       isUploadRequest_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadRequest) Reset() {
+	*x = UploadRequest{}
+	mi := &file_assetserver_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadRequest) ProtoMessage() {}
+
+func (x *UploadRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadRequest.ProtoReflect.Descriptor instead.
+func (*UploadRequest) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *UploadRequest) GetPayload() isUploadRequest_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetInfo() *UploadInfo {
+	if x != nil {
+		if x, ok := x.Payload.(*UploadRequest_Info); ok {
+			return x.Info
+		}
+	}
+	return nil
+}
+
+func (x *UploadRequest) GetChunk() []byte {
+	if x != nil {
+		if x, ok := x.Payload.(*UploadRequest_Chunk); ok {
+			return x.Chunk
+		}
+	}
+	return nil
+}
+
+type isUploadRequest_Payload interface {
+	isUploadRequest_Payload()
+}
+
+type UploadRequest_Info struct {
+	Info *UploadInfo `protobuf:"bytes,1,opt,name=info,proto3,oneof"`
+}
+
+type UploadRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*UploadRequest_Info) isUploadRequest_Payload() {}
+
+func (*UploadRequest_Chunk) isUploadRequest_Payload() {}
+
+type UploadInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Original name of the file
+	Filename string `protobuf:"bytes,1,opt,name=filename,proto3" json:"filename,omitempty"`
+	// Detected from the data if empty
+	ContentType string `protobuf:"bytes,2,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	// JSON object stored with the asset, if not empty
+	MetadataJson string `protobuf:"bytes,3,opt,name=metadata_json,json=metadataJson,proto3" json:"metadata_json,omitempty"`
+	// Protects downloads if not empty
+	Password string `protobuf:"bytes,4,opt,name=password,proto3" json:"password,omitempty"`
+	// Bison Relay identity keys downloads are restricted to, hex encoded
+	Recipients []string `protobuf:"bytes,5,rep,name=recipients,proto3" json:"recipients,omitempty"`
+	// Tags stored with the asset
+	Tags          []string `protobuf:"bytes,6,rep,name=tags,proto3" json:"tags,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UploadInfo) Reset() {
+	*x = UploadInfo{}
+	mi := &file_assetserver_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UploadInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UploadInfo) ProtoMessage() {}
+
+func (x *UploadInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UploadInfo.ProtoReflect.Descriptor instead.
+func (*UploadInfo) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *UploadInfo) GetFilename() string {
+	if x != nil {
+		return x.Filename
+	}
+	return ""
+}
+
+func (x *UploadInfo) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *UploadInfo) GetMetadataJson() string {
+	if x != nil {
+		return x.MetadataJson
+	}
+	return ""
+}
+
+func (x *UploadInfo) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *UploadInfo) GetRecipients() []string {
+	if x != nil {
+		return x.Recipients
+	}
+	return nil
+}
+
+func (x *UploadInfo) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+type GetInfoRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetInfoRequest) Reset() {
+	*x = GetInfoRequest{}
+	mi := &file_assetserver_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetInfoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetInfoRequest) ProtoMessage() {}
+
+func (x *GetInfoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetInfoRequest.ProtoReflect.Descriptor instead.
+func (*GetInfoRequest) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *GetInfoRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	DeleteToken   string                 `protobuf:"bytes,2,opt,name=delete_token,json=deleteToken,proto3" json:"delete_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_assetserver_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DeleteRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeleteRequest) GetDeleteToken() string {
+	if x != nil {
+		return x.DeleteToken
+	}
+	return ""
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_assetserver_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DeleteResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type ListRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Only list assets in this state, e.g. "active"
+	State string `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
+	// At most this many assets, 100 by default and 1000 at most
+	PageSize int32 `protobuf:"varint,2,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	// next_page_token of the previous page
+	PageToken     string `protobuf:"bytes,3,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListRequest) Reset() {
+	*x = ListRequest{}
+	mi := &file_assetserver_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRequest) ProtoMessage() {}
+
+func (x *ListRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRequest.ProtoReflect.Descriptor instead.
+func (*ListRequest) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ListRequest) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *ListRequest) GetPageSize() int32 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *ListRequest) GetPageToken() string {
+	if x != nil {
+		return x.PageToken
+	}
+	return ""
+}
+
+type ListResponse struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Assets []*Asset               `protobuf:"bytes,1,rep,name=assets,proto3" json:"assets,omitempty"`
+	// Empty on the last page
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListResponse) Reset() {
+	*x = ListResponse{}
+	mi := &file_assetserver_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListResponse) ProtoMessage() {}
+
+func (x *ListResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListResponse.ProtoReflect.Descriptor instead.
+func (*ListResponse) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ListResponse) GetAssets() []*Asset {
+	if x != nil {
+		return x.Assets
+	}
+	return nil
+}
+
+func (x *ListResponse) GetNextPageToken() string {
+	if x != nil {
+		return x.NextPageToken
+	}
+	return ""
+}
+
+// Asset mirrors the asset object of the HTTP API.
+type Asset struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Url   string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	// Only set in the response to Upload
+	DeleteToken string `protobuf:"bytes,3,opt,name=delete_token,json=deleteToken,proto3" json:"delete_token,omitempty"`
+	DeleteUrl   string `protobuf:"bytes,4,opt,name=delete_url,json=deleteUrl,proto3" json:"delete_url,omitempty"`
+	// Unset for assets without a time limit
+	ExpiresAt *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	// Unset for assets that may be downloaded any number of times
+	MaxDownloads      *int32       `protobuf:"varint,6,opt,name=max_downloads,json=maxDownloads,proto3,oneof" json:"max_downloads,omitempty"`
+	Downloads         int32        `protobuf:"varint,7,opt,name=downloads,proto3" json:"downloads,omitempty"`
+	Size              int64        `protobuf:"varint,8,opt,name=size,proto3" json:"size,omitempty"`
+	Sha256            string       `protobuf:"bytes,9,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	ContentType       string       `protobuf:"bytes,10,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	State             string       `protobuf:"bytes,11,opt,name=state,proto3" json:"state,omitempty"`
+	Blind             bool         `protobuf:"varint,12,opt,name=blind,proto3" json:"blind,omitempty"`
+	PasswordProtected bool         `protobuf:"varint,13,opt,name=password_protected,json=passwordProtected,proto3" json:"password_protected,omitempty"`
+	ShortUrl          string       `protobuf:"bytes,14,opt,name=short_url,json=shortUrl,proto3" json:"short_url,omitempty"`
+	QrUrl             string       `protobuf:"bytes,15,opt,name=qr_url,json=qrUrl,proto3" json:"qr_url,omitempty"`
+	Thumbnails        []*Thumbnail `protobuf:"bytes,16,rep,name=thumbnails,proto3" json:"thumbnails,omitempty"`
+	Variants          []*Variant   `protobuf:"bytes,17,rep,name=variants,proto3" json:"variants,omitempty"`
+	Pages             int32        `protobuf:"varint,18,opt,name=pages,proto3" json:"pages,omitempty"`
+	Nsfw              bool         `protobuf:"varint,19,opt,name=nsfw,proto3" json:"nsfw,omitempty"`
+	NsfwScore         *float64     `protobuf:"fixed64,20,opt,name=nsfw_score,json=nsfwScore,proto3,oneof" json:"nsfw_score,omitempty"`
+	MetadataJson      string       `protobuf:"bytes,21,opt,name=metadata_json,json=metadataJson,proto3" json:"metadata_json,omitempty"`
+	Recipients        []string     `protobuf:"bytes,22,rep,name=recipients,proto3" json:"recipients,omitempty"`
+	Tags              []string     `protobuf:"bytes,23,rep,name=tags,proto3" json:"tags,omitempty"`
+	// Resized images and the image itself by width descriptor, e.g. "512w"
+	Srcset map[string]string `protobuf:"bytes,24,rep,name=srcset,proto3" json:"srcset,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	// HLS playlist of packaged video and audio
+	StreamUrl string `protobuf:"bytes,25,opt,name=stream_url,json=streamUrl,proto3" json:"stream_url,omitempty"`
+	// Subtitles and transcripts attached after upload
+	Sidecars []*Sidecar `protobuf:"bytes,26,rep,name=sidecars,proto3" json:"sidecars,omitempty"`
+	// Text of audio transcribed on upload, unless too long to include
+	Transcript string `protobuf:"bytes,27,opt,name=transcript,proto3" json:"transcript,omitempty"`
+	// Set for audio probed on upload
+	Audio *AudioInfo `protobuf:"bytes,28,opt,name=audio,proto3" json:"audio,omitempty"`
+	// Set for images: their dimensions, EXIF orientation if any, average
+	// color as #rrggbb and blurhash
+	Width       int32  `protobuf:"varint,29,opt,name=width,proto3" json:"width,omitempty"`
+	Height      int32  `protobuf:"varint,30,opt,name=height,proto3" json:"height,omitempty"`
+	Orientation int32  `protobuf:"varint,31,opt,name=orientation,proto3" json:"orientation,omitempty"`
+	Color       string `protobuf:"bytes,32,opt,name=color,proto3" json:"color,omitempty"`
+	Blurhash    string `protobuf:"bytes,33,opt,name=blurhash,proto3" json:"blurhash,omitempty"`
+	// Tiny JPEG of images as a data URI, to blur while they load
+	Placeholder string `protobuf:"bytes,34,opt,name=placeholder,proto3" json:"placeholder,omitempty"`
+	// Set for uploads that were checked and discarded without being stored
+	DryRun bool `protobuf:"varint,35,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`
+	// Download URLs on the other origins configured
+	Mirrors       []*Mirror `protobuf:"bytes,36,rep,name=mirrors,proto3" json:"mirrors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Asset) Reset() {
+	*x = Asset{}
+	mi := &file_assetserver_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Asset) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Asset) ProtoMessage() {}
+
+func (x *Asset) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Asset.ProtoReflect.Descriptor instead.
+func (*Asset) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Asset) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Asset) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Asset) GetDeleteToken() string {
+	if x != nil {
+		return x.DeleteToken
+	}
+	return ""
+}
+
+func (x *Asset) GetDeleteUrl() string {
+	if x != nil {
+		return x.DeleteUrl
+	}
+	return ""
+}
+
+func (x *Asset) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+func (x *Asset) GetMaxDownloads() int32 {
+	if x != nil && x.MaxDownloads != nil {
+		return *x.MaxDownloads
+	}
+	return 0
+}
+
+func (x *Asset) GetDownloads() int32 {
+	if x != nil {
+		return x.Downloads
+	}
+	return 0
+}
+
+func (x *Asset) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *Asset) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+func (x *Asset) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Asset) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Asset) GetBlind() bool {
+	if x != nil {
+		return x.Blind
+	}
+	return false
+}
+
+func (x *Asset) GetPasswordProtected() bool {
+	if x != nil {
+		return x.PasswordProtected
+	}
+	return false
+}
+
+func (x *Asset) GetShortUrl() string {
+	if x != nil {
+		return x.ShortUrl
+	}
+	return ""
+}
+
+func (x *Asset) GetQrUrl() string {
+	if x != nil {
+		return x.QrUrl
+	}
+	return ""
+}
+
+func (x *Asset) GetThumbnails() []*Thumbnail {
+	if x != nil {
+		return x.Thumbnails
+	}
+	return nil
+}
+
+func (x *Asset) GetVariants() []*Variant {
+	if x != nil {
+		return x.Variants
+	}
+	return nil
+}
+
+func (x *Asset) GetPages() int32 {
+	if x != nil {
+		return x.Pages
+	}
+	return 0
+}
+
+func (x *Asset) GetNsfw() bool {
+	if x != nil {
+		return x.Nsfw
+	}
+	return false
+}
+
+func (x *Asset) GetNsfwScore() float64 {
+	if x != nil && x.NsfwScore != nil {
+		return *x.NsfwScore
+	}
+	return 0
+}
+
+func (x *Asset) GetMetadataJson() string {
+	if x != nil {
+		return x.MetadataJson
+	}
+	return ""
+}
+
+func (x *Asset) GetRecipients() []string {
+	if x != nil {
+		return x.Recipients
+	}
+	return nil
+}
+
+func (x *Asset) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Asset) GetSrcset() map[string]string {
+	if x != nil {
+		return x.Srcset
+	}
+	return nil
+}
+
+func (x *Asset) GetStreamUrl() string {
+	if x != nil {
+		return x.StreamUrl
+	}
+	return ""
+}
+
+func (x *Asset) GetSidecars() []*Sidecar {
+	if x != nil {
+		return x.Sidecars
+	}
+	return nil
+}
+
+func (x *Asset) GetTranscript() string {
+	if x != nil {
+		return x.Transcript
+	}
+	return ""
+}
+
+func (x *Asset) GetAudio() *AudioInfo {
+	if x != nil {
+		return x.Audio
+	}
+	return nil
+}
+
+func (x *Asset) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Asset) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *Asset) GetOrientation() int32 {
+	if x != nil {
+		return x.Orientation
+	}
+	return 0
+}
+
+func (x *Asset) GetColor() string {
+	if x != nil {
+		return x.Color
+	}
+	return ""
+}
+
+func (x *Asset) GetBlurhash() string {
+	if x != nil {
+		return x.Blurhash
+	}
+	return ""
+}
+
+func (x *Asset) GetPlaceholder() string {
+	if x != nil {
+		return x.Placeholder
+	}
+	return ""
+}
+
+func (x *Asset) GetDryRun() bool {
+	if x != nil {
+		return x.DryRun
+	}
+	return false
+}
+
+func (x *Asset) GetMirrors() []*Mirror {
+	if x != nil {
+		return x.Mirrors
+	}
+	return nil
+}
+
+type Thumbnail struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Url           string                 `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	Width         int32                  `protobuf:"varint,2,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,3,opt,name=height,proto3" json:"height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Thumbnail) Reset() {
+	*x = Thumbnail{}
+	mi := &file_assetserver_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Thumbnail) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Thumbnail) ProtoMessage() {}
+
+func (x *Thumbnail) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Thumbnail.ProtoReflect.Descriptor instead.
+func (*Thumbnail) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Thumbnail) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Thumbnail) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Thumbnail) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+type AudioInfo struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Seconds
+	Duration      float64 `protobuf:"fixed64,1,opt,name=duration,proto3" json:"duration,omitempty"`
+	SampleRate    int32   `protobuf:"varint,2,opt,name=sample_rate,json=sampleRate,proto3" json:"sample_rate,omitempty"`
+	Channels      int32   `protobuf:"varint,3,opt,name=channels,proto3" json:"channels,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AudioInfo) Reset() {
+	*x = AudioInfo{}
+	mi := &file_assetserver_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AudioInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AudioInfo) ProtoMessage() {}
+
+func (x *AudioInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AudioInfo.ProtoReflect.Descriptor instead.
+func (*AudioInfo) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *AudioInfo) GetDuration() float64 {
+	if x != nil {
+		return x.Duration
+	}
+	return 0
+}
+
+func (x *AudioInfo) GetSampleRate() int32 {
+	if x != nil {
+		return x.SampleRate
+	}
+	return 0
+}
+
+func (x *AudioInfo) GetChannels() int32 {
+	if x != nil {
+		return x.Channels
+	}
+	return 0
+}
+
+type Mirror struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Origin        string                 `protobuf:"bytes,1,opt,name=origin,proto3" json:"origin,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Mirror) Reset() {
+	*x = Mirror{}
+	mi := &file_assetserver_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Mirror) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Mirror) ProtoMessage() {}
+
+func (x *Mirror) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Mirror.ProtoReflect.Descriptor instead.
+func (*Mirror) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Mirror) GetOrigin() string {
+	if x != nil {
+		return x.Origin
+	}
+	return ""
+}
+
+func (x *Mirror) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+type Sidecar struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Url           string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	ContentType   string                 `protobuf:"bytes,3,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Size          int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Sidecar) Reset() {
+	*x = Sidecar{}
+	mi := &file_assetserver_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Sidecar) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Sidecar) ProtoMessage() {}
+
+func (x *Sidecar) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Sidecar.ProtoReflect.Descriptor instead.
+func (*Sidecar) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Sidecar) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Sidecar) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Sidecar) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Sidecar) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+type Variant struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Name        string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Url         string                 `protobuf:"bytes,2,opt,name=url,proto3" json:"url,omitempty"`
+	ContentType string                 `protobuf:"bytes,3,opt,name=content_type,json=contentType,proto3" json:"content_type,omitempty"`
+	Size        int64                  `protobuf:"varint,4,opt,name=size,proto3" json:"size,omitempty"`
+	// Set for resized images
+	Width         int32 `protobuf:"varint,5,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32 `protobuf:"varint,6,opt,name=height,proto3" json:"height,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Variant) Reset() {
+	*x = Variant{}
+	mi := &file_assetserver_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Variant) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Variant) ProtoMessage() {}
+
+func (x *Variant) ProtoReflect() protoreflect.Message {
+	mi := &file_assetserver_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Variant.ProtoReflect.Descriptor instead.
+func (*Variant) Descriptor() ([]byte, []int) {
+	return file_assetserver_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Variant) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Variant) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *Variant) GetContentType() string {
+	if x != nil {
+		return x.ContentType
+	}
+	return ""
+}
+
+func (x *Variant) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *Variant) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Variant) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+var File_assetserver_proto protoreflect.FileDescriptor
+
+const file_assetserver_proto_rawDesc = "" +
+	"\n" +
+	"\x11assetserver.proto\x12\x16braibot.assetserver.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"l\n" +
+	"\rUploadRequest\x128\n" +
+	"\x04info\x18\x01 \x01(\v2\".braibot.assetserver.v1.UploadInfoH\x00R\x04info\x12\x16\n" +
+	"\x05chunk\x18\x02 \x01(\fH\x00R\x05chunkB\t\n" +
+	"\apayload\"\xc0\x01\n" +
+	"\n" +
+	"UploadInfo\x12\x1a\n" +
+	"\bfilename\x18\x01 \x01(\tR\bfilename\x12!\n" +
+	"\fcontent_type\x18\x02 \x01(\tR\vcontentType\x12#\n" +
+	"\rmetadata_json\x18\x03 \x01(\tR\fmetadataJson\x12\x1a\n" +
+	"\bpassword\x18\x04 \x01(\tR\bpassword\x12\x1e\n" +
+	"\n" +
+	"recipients\x18\x05 \x03(\tR\n" +
+	"recipients\x12\x12\n" +
+	"\x04tags\x18\x06 \x03(\tR\x04tags\" \n" +
+	"\x0eGetInfoRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"B\n" +
+	"\rDeleteRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12!\n" +
+	"\fdelete_token\x18\x02 \x01(\tR\vdeleteToken\" \n" +
+	"\x0eDeleteResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\"_\n" +
+	"\vListRequest\x12\x14\n" +
+	"\x05state\x18\x01 \x01(\tR\x05state\x12\x1b\n" +
+	"\tpage_size\x18\x02 \x01(\x05R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"page_token\x18\x03 \x01(\tR\tpageToken\"m\n" +
+	"\fListResponse\x125\n" +
+	"\x06assets\x18\x01 \x03(\v2\x1d.braibot.assetserver.v1.AssetR\x06assets\x12&\n" +
+	"\x0fnext_page_token\x18\x02 \x01(\tR\rnextPageToken\"\xbe\n" +
+	"\n" +
+	"\x05Asset\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12!\n" +
+	"\fdelete_token\x18\x03 \x01(\tR\vdeleteToken\x12\x1d\n" +
+	"\n" +
+	"delete_url\x18\x04 \x01(\tR\tdeleteUrl\x129\n" +
+	"\n" +
+	"expires_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt\x12(\n" +
+	"\rmax_downloads\x18\x06 \x01(\x05H\x00R\fmaxDownloads\x88\x01\x01\x12\x1c\n" +
+	"\tdownloads\x18\a \x01(\x05R\tdownloads\x12\x12\n" +
+	"\x04size\x18\b \x01(\x03R\x04size\x12\x16\n" +
+	"\x06sha256\x18\t \x01(\tR\x06sha256\x12!\n" +
+	"\fcontent_type\x18\n" +
+	" \x01(\tR\vcontentType\x12\x14\n" +
+	"\x05state\x18\v \x01(\tR\x05state\x12\x14\n" +
+	"\x05blind\x18\f \x01(\bR\x05blind\x12-\n" +
+	"\x12password_protected\x18\r \x01(\bR\x11passwordProtected\x12\x1b\n" +
+	"\tshort_url\x18\x0e \x01(\tR\bshortUrl\x12\x15\n" +
+	"\x06qr_url\x18\x0f \x01(\tR\x05qrUrl\x12A\n" +
+	"\n" +
+	"thumbnails\x18\x10 \x03(\v2!.braibot.assetserver.v1.ThumbnailR\n" +
+	"thumbnails\x12;\n" +
+	"\bvariants\x18\x11 \x03(\v2\x1f.braibot.assetserver.v1.VariantR\bvariants\x12\x14\n" +
+	"\x05pages\x18\x12 \x01(\x05R\x05pages\x12\x12\n" +
+	"\x04nsfw\x18\x13 \x01(\bR\x04nsfw\x12\"\n" +
+	"\n" +
+	"nsfw_score\x18\x14 \x01(\x01H\x01R\tnsfwScore\x88\x01\x01\x12#\n" +
+	"\rmetadata_json\x18\x15 \x01(\tR\fmetadataJson\x12\x1e\n" +
+	"\n" +
+	"recipients\x18\x16 \x03(\tR\n" +
+	"recipients\x12\x12\n" +
+	"\x04tags\x18\x17 \x03(\tR\x04tags\x12A\n" +
+	"\x06srcset\x18\x18 \x03(\v2).braibot.assetserver.v1.Asset.SrcsetEntryR\x06srcset\x12\x1d\n" +
+	"\n" +
+	"stream_url\x18\x19 \x01(\tR\tstreamUrl\x12;\n" +
+	"\bsidecars\x18\x1a \x03(\v2\x1f.braibot.assetserver.v1.SidecarR\bsidecars\x12\x1e\n" +
+	"\n" +
+	"transcript\x18\x1b \x01(\tR\n" +
+	"transcript\x127\n" +
+	"\x05audio\x18\x1c \x01(\v2!.braibot.assetserver.v1.AudioInfoR\x05audio\x12\x14\n" +
+	"\x05width\x18\x1d \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x1e \x01(\x05R\x06height\x12 \n" +
+	"\vorientation\x18\x1f \x01(\x05R\vorientation\x12\x14\n" +
+	"\x05color\x18  \x01(\tR\x05color\x12\x1a\n" +
+	"\bblurhash\x18! \x01(\tR\bblurhash\x12 \n" +
+	"\vplaceholder\x18\" \x01(\tR\vplaceholder\x12\x17\n" +
+	"\adry_run\x18# \x01(\bR\x06dryRun\x128\n" +
+	"\amirrors\x18$ \x03(\v2\x1e.braibot.assetserver.v1.MirrorR\amirrors\x1a9\n" +
+	"\vSrcsetEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01B\x10\n" +
+	"\x0e_max_downloadsB\r\n" +
+	"\v_nsfw_score\"K\n" +
+	"\tThumbnail\x12\x10\n" +
+	"\x03url\x18\x01 \x01(\tR\x03url\x12\x14\n" +
+	"\x05width\x18\x02 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x03 \x01(\x05R\x06height\"d\n" +
+	"\tAudioInfo\x12\x1a\n" +
+	"\bduration\x18\x01 \x01(\x01R\bduration\x12\x1f\n" +
+	"\vsample_rate\x18\x02 \x01(\x05R\n" +
+	"sampleRate\x12\x1a\n" +
+	"\bchannels\x18\x03 \x01(\x05R\bchannels\"2\n" +
+	"\x06Mirror\x12\x16\n" +
+	"\x06origin\x18\x01 \x01(\tR\x06origin\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\"f\n" +
+	"\aSidecar\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12!\n" +
+	"\fcontent_type\x18\x03 \x01(\tR\vcontentType\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\"\x94\x01\n" +
+	"\aVariant\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x10\n" +
+	"\x03url\x18\x02 \x01(\tR\x03url\x12!\n" +
+	"\fcontent_type\x18\x03 \x01(\tR\vcontentType\x12\x12\n" +
+	"\x04size\x18\x04 \x01(\x03R\x04size\x12\x14\n" +
+	"\x05width\x18\x05 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x06 \x01(\x05R\x06height2\xde\x02\n" +
+	"\fAssetService\x12P\n" +
+	"\x06Upload\x12%.braibot.assetserver.v1.UploadRequest\x1a\x1d.braibot.assetserver.v1.Asset(\x01\x12P\n" +
+	"\aGetInfo\x12&.braibot.assetserver.v1.GetInfoRequest\x1a\x1d.braibot.assetserver.v1.Asset\x12W\n" +
+	"\x06Delete\x12%.braibot.assetserver.v1.DeleteRequest\x1a&.braibot.assetserver.v1.DeleteResponse\x12Q\n" +
+	"\x04List\x12#.braibot.assetserver.v1.ListRequest\x1a$.braibot.assetserver.v1.ListResponseBLZJgithub.com/karamble/braibot-assetserver/proto/assetserver/v1;assetserverv1b\x06proto3"
+
+var (
+	file_assetserver_proto_rawDescOnce sync.Once
+	file_assetserver_proto_rawDescData []byte
+)
+
+func file_assetserver_proto_rawDescGZIP() []byte {
+	file_assetserver_proto_rawDescOnce.Do(func() {
+		file_assetserver_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_assetserver_proto_rawDesc), len(file_assetserver_proto_rawDesc)))
+	})
+	return file_assetserver_proto_rawDescData
+}
+
+var file_assetserver_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
+var file_assetserver_proto_goTypes = []any{
+	(*UploadRequest)(nil),         // 0: braibot.assetserver.v1.UploadRequest
+	(*UploadInfo)(nil),            // 1: braibot.assetserver.v1.UploadInfo
+	(*GetInfoRequest)(nil),        // 2: braibot.assetserver.v1.GetInfoRequest
+	(*DeleteRequest)(nil),         // 3: braibot.assetserver.v1.DeleteRequest
+	(*DeleteResponse)(nil),        // 4: braibot.assetserver.v1.DeleteResponse
+	(*ListRequest)(nil),           // 5: braibot.assetserver.v1.ListRequest
+	(*ListResponse)(nil),          // 6: braibot.assetserver.v1.ListResponse
+	(*Asset)(nil),                 // 7: braibot.assetserver.v1.Asset
+	(*Thumbnail)(nil),             // 8: braibot.assetserver.v1.Thumbnail
+	(*AudioInfo)(nil),             // 9: braibot.assetserver.v1.AudioInfo
+	(*Mirror)(nil),                // 10: braibot.assetserver.v1.Mirror
+	(*Sidecar)(nil),               // 11: braibot.assetserver.v1.Sidecar
+	(*Variant)(nil),               // 12: braibot.assetserver.v1.Variant
+	nil,                           // 13: braibot.assetserver.v1.Asset.SrcsetEntry
+	(*timestamppb.Timestamp)(nil), // 14: google.protobuf.Timestamp
+}
+var file_assetserver_proto_depIdxs = []int32{
+	1,  // 0: braibot.assetserver.v1.UploadRequest.info:type_name -> braibot.assetserver.v1.UploadInfo
+	7,  // 1: braibot.assetserver.v1.ListResponse.assets:type_name -> braibot.assetserver.v1.Asset
+	14, // 2: braibot.assetserver.v1.Asset.expires_at:type_name -> google.protobuf.Timestamp
+	8,  // 3: braibot.assetserver.v1.Asset.thumbnails:type_name -> braibot.assetserver.v1.Thumbnail
+	12, // 4: braibot.assetserver.v1.Asset.variants:type_name -> braibot.assetserver.v1.Variant
+	13, // 5: braibot.assetserver.v1.Asset.srcset:type_name -> braibot.assetserver.v1.Asset.SrcsetEntry
+	11, // 6: braibot.assetserver.v1.Asset.sidecars:type_name -> braibot.assetserver.v1.Sidecar
+	9,  // 7: braibot.assetserver.v1.Asset.audio:type_name -> braibot.assetserver.v1.AudioInfo
+	10, // 8: braibot.assetserver.v1.Asset.mirrors:type_name -> braibot.assetserver.v1.Mirror
+	0,  // 9: braibot.assetserver.v1.AssetService.Upload:input_type -> braibot.assetserver.v1.UploadRequest
+	2,  // 10: braibot.assetserver.v1.AssetService.GetInfo:input_type -> braibot.assetserver.v1.GetInfoRequest
+	3,  // 11: braibot.assetserver.v1.AssetService.Delete:input_type -> braibot.assetserver.v1.DeleteRequest
+	5,  // 12: braibot.assetserver.v1.AssetService.List:input_type -> braibot.assetserver.v1.ListRequest
+	7,  // 13: braibot.assetserver.v1.AssetService.Upload:output_type -> braibot.assetserver.v1.Asset
+	7,  // 14: braibot.assetserver.v1.AssetService.GetInfo:output_type -> braibot.assetserver.v1.Asset
+	4,  // 15: braibot.assetserver.v1.AssetService.Delete:output_type -> braibot.assetserver.v1.DeleteResponse
+	6,  // 16: braibot.assetserver.v1.AssetService.List:output_type -> braibot.assetserver.v1.ListResponse
+	13, // [13:17] is the sub-list for method output_type
+	9,  // [9:13] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_assetserver_proto_init() }
+func file_assetserver_proto_init() {
+	if File_assetserver_proto != nil {
+		return
+	}
+	file_assetserver_proto_msgTypes[0].OneofWrappers = []any{
+		(*UploadRequest_Info)(nil),
+		(*UploadRequest_Chunk)(nil),
+	}
+	file_assetserver_proto_msgTypes[7].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_assetserver_proto_rawDesc), len(file_assetserver_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   14,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_assetserver_proto_goTypes,
+		DependencyIndexes: file_assetserver_proto_depIdxs,
+		MessageInfos:      file_assetserver_proto_msgTypes,
+	}.Build()
+	File_assetserver_proto = out.File
+	file_assetserver_proto_goTypes = nil
+	file_assetserver_proto_depIdxs = nil
+}
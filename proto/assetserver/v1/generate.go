@@ -0,0 +1,9 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+// Package assetserverv1 holds the protobuf messages and gRPC service of the
+// asset server's gRPC API, generated from assetserver.proto.
+package assetserverv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative assetserver.proto
@@ -0,0 +1,103 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/karamble/braibot-assetserver/assetserver"
+)
+
+// runPut implements the put command, which stores a file given on the
+// command line, or read from standard input when the file is -, without
+// going through HTTP.  The asset URL is the only output on standard output
+// so the command can be used in scripts; diagnostics go to standard error.
+// It returns the process exit status.
+func runPut(configPath string, args []string) int {
+	fs := flag.NewFlagSet("put", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: assetserver [-config path] put [flags] file|-\n")
+		fs.PrintDefaults()
+	}
+	contentType := fs.String("type", "", "content type of the file (default: detected)")
+	name := fs.String("name", "", "original file name (default: the file's base name)")
+	metadata := fs.String("metadata", "", "JSON object stored with the asset")
+	tags := fs.String("tags", "", "comma separated tags stored with the asset")
+	asJSON := fs.Bool("json", false, "print the full asset object instead of the URL")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	// The server's progress messages would otherwise mix with the URL
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+
+	cfg, err := assetserver.LoadConfig(configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	srv, err := assetserver.New(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer srv.Close()
+
+	path := fs.Arg(0)
+	var src io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		src = f
+		if *name == "" {
+			*name = filepath.Base(path)
+		}
+	}
+
+	saved, err := srv.Put(context.Background(), cliActor(), assetserver.File{
+		Name:        *name,
+		ContentType: *contentType,
+		Metadata:    *metadata,
+		Tags:        []string{*tags},
+		Data:        src,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error storing %s: %v\n", path, err)
+		return 1
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(saved)
+		return 0
+	}
+	fmt.Fprintln(stdout, saved.URL)
+	fmt.Fprintf(os.Stderr, "Delete URL: %s\n", saved.DeleteURL)
+	return 0
+}
+
+// cliActor identifies the local user running a command in the audit log.
+func cliActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2025 The Decred developers
+// Use of this source code is governed by an ISC
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/karamble/braibot-assetserver/assetserver"
+)
+
+// runSelfTest implements the selftest command, which makes a round trip
+// through the server for deployment checks and reports the timing of each
+// stage.  The report is the only output on standard output; the messages
+// of a server started for the test go to standard error.  It returns the
+// process exit status.
+func runSelfTest(configPath string, args []string) int {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: assetserver [-config path] selftest [flags]\n")
+		fs.PrintDefaults()
+	}
+	url := fs.String("url", "", "base URL of a running server to test (default: start one on a loopback port)")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	defer func() { os.Stdout = stdout }()
+
+	if !assetserver.SelfTest(context.Background(), configPath, *url, stdout) {
+		return 1
+	}
+	return 0
+}